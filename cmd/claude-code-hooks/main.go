@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/michael-freling/claude-code-tools/internal/command"
 	"github.com/michael-freling/claude-code-tools/internal/hooks"
@@ -22,33 +29,317 @@ func newRootCmd() *cobra.Command {
 		Long:  `A CLI tool that provides hook execution for Claude Code, allowing control over which tools can be used and under what conditions.`,
 	}
 
-	rootCmd.AddCommand(newPreToolUseCmd())
+	rootCmd.AddCommand(
+		newPreToolUseCmd(),
+		newPostToolUseCmd(),
+		newStopCmd(),
+		newReportCmd(),
+		newServeCmd(),
+	)
 
 	return rootCmd
 }
 
+// newRules returns every built-in rule in evaluation order.
+func newRules(gitRunner command.GitRunner, ghRunner command.GhRunner) []hooks.Rule {
+	return []hooks.Rule{
+		hooks.NewNoVerifyRule(),
+		hooks.NewGitPushRule(gitRunner),
+		hooks.NewBranchProtectionRule(),
+		hooks.NewRulesetRule(),
+		hooks.NewPRMergeRule(ghRunner),
+	}
+}
+
+// defaultPolicyPath returns the policy file location used when --policy is not set.
+func defaultPolicyPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".config", "claude-hooks", "policy.yaml")
+}
+
+// newPostToolUseRules returns every built-in post-tool-use rule in evaluation order.
+func newPostToolUseRules(policy *hooks.Policy) ([]hooks.Rule, error) {
+	secretLeakRule, err := hooks.NewSecretLeakRuleFromConfig(policy.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	return []hooks.Rule{secretLeakRule}, nil
+}
+
+// loadPolicy loads the policy at path, falling back to the default policy
+// when no path can be determined, and checks that its profiles only
+// reference built-in rules. Warnings about the profiles are written to stderr.
+func loadPolicy(path string) (*hooks.Policy, error) {
+	policy := hooks.DefaultPolicy()
+	if path != "" {
+		var err error
+		policy, err = hooks.LoadPolicy(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	postToolUseRules, err := newPostToolUseRules(policy)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := policy.Validate(append(newRules(nil, nil), postToolUseRules...))
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	return policy, nil
+}
+
 func newPreToolUseCmd() *cobra.Command {
-	return &cobra.Command{
+	var policyPath string
+	var socketPath string
+
+	cmd := &cobra.Command{
 		Use:   "pre-tool-use",
 		Short: "Evaluate rules before tool execution",
-		Long:  `Reads tool input from stdin as JSON and evaluates configured rules. Returns exit code 0 to allow, exit code 2 to block.`,
-		Args:  cobra.NoArgs,
+		Long: `Reads tool input from stdin as JSON and evaluates configured rules. Returns exit code 0 to allow, exit code 2 to block.
+The rules applied are selected by the policy profile for the input's permission_mode.
+When a "claude-hooks serve" daemon listens on --socket, evaluation is delegated to it and the daemon's policy applies;
+otherwise the rules are evaluated in-process.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			toolInput, err := hooks.ParseToolInput(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("failed to parse tool input: %w", err)
+			}
+
+			result, err := evaluateWithDaemon(cmd, socketPath, toolInput)
+			if err != nil {
+				return err
+			}
+			if result == nil {
+				result, err = evaluatePreToolUse(policyPath, toolInput)
+				if err != nil {
+					return err
+				}
+			}
+
+			if !result.Allowed {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Blocked by rule %s: %s\n", result.RuleName, result.Message)
+				os.Exit(2)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&policyPath, "policy", defaultPolicyPath(), "Path to the policy file selecting rules per permission mode")
+	cmd.Flags().StringVar(&socketPath, "socket", defaultSocketPath(), "Path to the unix socket of a claude-hooks serve daemon; empty to always evaluate in-process")
+
+	return cmd
+}
+
+// evaluateWithDaemon delegates evaluation to the daemon on socketPath.
+// It returns a nil result when the rules should be evaluated in-process
+// instead, because no daemon is running or the daemon failed.
+func evaluateWithDaemon(cmd *cobra.Command, socketPath string, toolInput *hooks.ToolInput) (*hooks.RuleResult, error) {
+	if socketPath == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, nil
+	}
+
+	if toolInput.Cwd == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get working directory: %w", err)
+		}
+		toolInput.Cwd = cwd
+	}
+
+	result, err := hooks.EvaluateWithDaemon(cmd.Context(), socketPath, toolInput)
+	if err != nil {
+		if !errors.Is(err, hooks.ErrDaemonUnavailable) {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %v; evaluating in-process\n", err)
+		}
+		return nil, nil
+	}
+
+	return result, nil
+}
+
+// evaluatePreToolUse loads the policy at policyPath and evaluates the
+// pre-tool-use rules in-process.
+func evaluatePreToolUse(policyPath string, toolInput *hooks.ToolInput) (*hooks.RuleResult, error) {
+	policy, err := loadPolicy(policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy: %w", err)
+	}
+
+	runner := command.NewRunner()
+	return evaluateRules(policy, newRules(command.NewGitRunner(runner), command.NewGhRunner(runner)), toolInput)
+}
+
+// evaluateRules evaluates the rules the policy selects for the input's permission mode.
+func evaluateRules(policy *hooks.Policy, rules []hooks.Rule, toolInput *hooks.ToolInput) (*hooks.RuleResult, error) {
+	rules, err := policy.Select(toolInput.PermissionMode, rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select rules: %w", err)
+	}
+
+	engine := hooks.NewRuleEngine(rules...)
+	result, err := engine.Evaluate(toolInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate rules: %w", err)
+	}
+
+	return result, nil
+}
+
+func newServeCmd() *cobra.Command {
+	var policyPath string
+	var socketPath string
+	var cacheTTL time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run a long-lived daemon that evaluates pre-tool-use hooks",
+		Long: `Listens on a unix socket and evaluates pre-tool-use input sent by "claude-hooks pre-tool-use", so each tool call
+doesn't pay for loading the policy and forking git and gh. The policy is reloaded when the file changes, and
+current branch and pull request base branch lookups are cached for --cache-ttl.
+Runs until interrupted.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if socketPath == "" {
+				return fmt.Errorf("--socket is required")
+			}
+			if err := os.MkdirAll(filepath.Dir(socketPath), 0o700); err != nil {
+				return fmt.Errorf("failed to create socket directory: %w", err)
+			}
+
+			// Fail fast on an invalid policy instead of on the first tool call.
+			policies := newPolicyCache(policyPath)
+			if _, err := policies.Load(); err != nil {
+				return fmt.Errorf("failed to load policy: %w", err)
+			}
+
+			daemon := hooks.NewDaemon(newDaemonEvaluator(policies, hooks.NewLookupCache(cacheTTL)))
+
+			ctx, cancel := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer cancel()
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "Listening on %s\n", socketPath)
+			return daemon.Serve(ctx, socketPath)
+		},
+	}
+
+	cmd.Flags().StringVar(&policyPath, "policy", defaultPolicyPath(), "Path to the policy file selecting rules per permission mode")
+	cmd.Flags().StringVar(&socketPath, "socket", defaultSocketPath(), "Path to the unix socket to listen on")
+	cmd.Flags().DurationVar(&cacheTTL, "cache-ttl", hooks.DefaultLookupCacheTTL, "How long branch and pull request lookups are cached")
+
+	return cmd
+}
+
+// newDaemonEvaluator returns an evaluator that applies the current policy
+// with lookups answered from cache, run in the tool call's working directory.
+func newDaemonEvaluator(policies *policyCache, cache *hooks.LookupCache) hooks.EvaluateFunc {
+	runner := command.NewRunner()
+	gitRunner := command.NewGitRunner(runner)
+	ghRunner := command.NewGhRunner(runner)
+
+	return func(ctx context.Context, toolInput *hooks.ToolInput) (*hooks.RuleResult, error) {
+		policy, err := policies.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load policy: %w", err)
+		}
+
+		rules := newRules(cache.GitRunner(gitRunner, toolInput.Cwd), cache.GhRunner(ghRunner, toolInput.Cwd))
+		return evaluateRules(policy, rules, toolInput)
+	}
+}
+
+// policyCache keeps the loaded policy and reloads it when the file changes.
+type policyCache struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	loaded  bool
+	policy  *hooks.Policy
+}
+
+func newPolicyCache(path string) *policyCache {
+	return &policyCache{path: path}
+}
+
+// Load returns the cached policy, reloading it if the file was modified,
+// created, or removed since it was last loaded.
+func (c *policyCache) Load() (*hooks.Policy, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var modTime time.Time
+	if c.path != "" {
+		if info, err := os.Stat(c.path); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+
+	if c.loaded && modTime.Equal(c.modTime) {
+		return c.policy, nil
+	}
+
+	policy, err := loadPolicy(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.policy = policy
+	c.modTime = modTime
+	c.loaded = true
+	return policy, nil
+}
+
+// defaultSocketPath returns the daemon socket location used when --socket is not set.
+func defaultSocketPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".config", "claude-hooks", "serve.sock")
+}
+
+func newPostToolUseCmd() *cobra.Command {
+	var policyPath string
+
+	cmd := &cobra.Command{
+		Use:   "post-tool-use",
+		Short: "Evaluate rules on tool output",
+		Long: `Reads tool input and output from stdin as JSON and evaluates post-tool-use rules, such as scanning the
+output for leaked credentials. Returns exit code 0 to allow, exit code 2 to block with feedback to Claude.
+The rules applied are selected by the policy profile for the input's permission_mode.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			toolInput, err := hooks.ParseToolInput(cmd.InOrStdin())
 			if err != nil {
 				return fmt.Errorf("failed to parse tool input: %w", err)
 			}
 
-			runner := command.NewRunner()
-			gitRunner := command.NewGitRunner(runner)
-			ghRunner := command.NewGhRunner(runner)
+			policy, err := loadPolicy(policyPath)
+			if err != nil {
+				return fmt.Errorf("failed to load policy: %w", err)
+			}
+
+			rules, err := newPostToolUseRules(policy)
+			if err != nil {
+				return fmt.Errorf("failed to create rules: %w", err)
+			}
 
-			rules := []hooks.Rule{
-				hooks.NewNoVerifyRule(),
-				hooks.NewGitPushRule(gitRunner),
-				hooks.NewBranchProtectionRule(),
-				hooks.NewRulesetRule(),
-				hooks.NewPRMergeRule(ghRunner),
+			rules, err = policy.Select(toolInput.PermissionMode, rules)
+			if err != nil {
+				return fmt.Errorf("failed to select rules: %w", err)
 			}
 
 			engine := hooks.NewRuleEngine(rules...)
@@ -65,4 +356,147 @@ func newPreToolUseCmd() *cobra.Command {
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&policyPath, "policy", defaultPolicyPath(), "Path to the policy file selecting rules per permission mode")
+
+	return cmd
+}
+
+func newStopCmd() *cobra.Command {
+	var (
+		policyPath string
+		stateDir   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Run quality gate checks before Claude Code stops",
+		Long: `Reads Stop hook input from stdin as JSON and runs the stop checks configured in the policy, such as tests
+and linters, in the session's working directory. Returns exit code 0 to allow Claude Code to stop, exit code 2
+to block with the failing check's output so the agent keeps working. After stop.max_blocks stops in a row are
+blocked, the stop is allowed and the failing check is reported on stderr.
+The checks applied are selected by the policy profile for the input's permission_mode.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stopInput, err := hooks.ParseStopInput(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("failed to parse stop input: %w", err)
+			}
+
+			policy, err := loadPolicy(policyPath)
+			if err != nil {
+				return fmt.Errorf("failed to load policy: %w", err)
+			}
+
+			checks, err := policy.SelectStopChecks(stopInput.PermissionMode)
+			if err != nil {
+				return fmt.Errorf("failed to select stop checks: %w", err)
+			}
+
+			gate := hooks.NewStopGate(command.NewRunner(), checks, policy.Stop, stateDir)
+			result, err := gate.Evaluate(cmd.Context(), stopInput)
+			if err != nil {
+				return fmt.Errorf("failed to run stop checks: %w", err)
+			}
+
+			if !result.Allowed {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Blocked by %s: %s\n", result.RuleName, result.Message)
+				os.Exit(2)
+			}
+			if result.Message != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Allowed despite %s: %s\n", result.RuleName, result.Message)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&policyPath, "policy", defaultPolicyPath(), "Path to the policy file selecting rules per permission mode")
+	cmd.Flags().StringVar(&stateDir, "state-dir", defaultStopStateDir(), "Directory the number of stops blocked in a row is kept in per session")
+
+	return cmd
+}
+
+// defaultStopStateDir returns the stop state location used when --state-dir is not set.
+func defaultStopStateDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "claude-hooks", "stop")
+	}
+	return filepath.Join(homeDir, ".config", "claude-hooks", "stop")
+}
+
+func newReportCmd() *cobra.Command {
+	var (
+		policyPath     string
+		permissionMode string
+		format         string
+		output         string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "report <transcript.jsonl>",
+		Short: "Replay a Claude Code transcript and report rule decisions",
+		Long: `Replays every tool call in a Claude Code transcript through the configured rules and writes a report
+of which calls would have been blocked, allowed, or need review.
+
+Calls whose outcome depends on repository state at the time of the session (for example, an implicit
+git push that depends on the current branch) are reported as needing review.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "markdown" && format != "html" {
+				return fmt.Errorf("unsupported format %q: must be \"markdown\" or \"html\"", format)
+			}
+
+			policy, err := loadPolicy(policyPath)
+			if err != nil {
+				return fmt.Errorf("failed to load policy: %w", err)
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open transcript: %w", err)
+			}
+			defer f.Close()
+
+			calls, err := hooks.ParseTranscript(f)
+			if err != nil {
+				return fmt.Errorf("failed to parse transcript: %w", err)
+			}
+			if permissionMode != "" {
+				for _, call := range calls {
+					if call.Input.PermissionMode == "" {
+						call.Input.PermissionMode = permissionMode
+					}
+				}
+			}
+
+			report, err := hooks.Replay(args[0], calls, policy, newRules)
+			if err != nil {
+				return fmt.Errorf("failed to replay transcript: %w", err)
+			}
+
+			w := cmd.OutOrStdout()
+			if output != "" {
+				out, err := os.Create(output)
+				if err != nil {
+					return fmt.Errorf("failed to create output file: %w", err)
+				}
+				defer out.Close()
+				w = out
+			}
+
+			if format == "html" {
+				return report.WriteHTML(w)
+			}
+			return report.WriteMarkdown(w)
+		},
+	}
+
+	cmd.Flags().StringVar(&policyPath, "policy", defaultPolicyPath(), "Path to the policy file selecting rules per permission mode")
+	cmd.Flags().StringVar(&permissionMode, "permission-mode", "", "Permission mode to assume for tool calls whose transcript entry does not record one")
+	cmd.Flags().StringVar(&format, "format", "markdown", "Report format: markdown or html")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the report to a file instead of stdout")
+
+	return cmd
 }
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
@@ -34,7 +43,7 @@ var createOrchestrator orchestratorFactoryFunc = newOrchestrator
 
 // forgeGHGatewayURL is the gateway URL used by the forge-gh client.
 // Tests override this to inject a non-routable address.
-var forgeGHGatewayURL = "http://gateway:8083"
+var forgeGHGatewayURL = "https://gateway:8083"
 
 func main() {
 	// Busybox-style multi-call binary: if invoked as "gh" or "forge-gh",
@@ -71,6 +80,8 @@ containers, Docker networks, and session state.`,
 		newResumeCmd(),
 		newStopCmd(),
 		newStatusCmd(),
+		newLogsCmd(),
+		newApprovalsCmd(),
 		newBuildCmd(),
 		newAuthCmd(),
 		newPluginsCmd(),
@@ -307,11 +318,353 @@ func newStatusCmd() *cobra.Command {
 					c.Created.Format(time.RFC3339),
 				)
 			}
-			return w.Flush()
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			limits, err := gateway.ReadRateLimits(orch.RateLimitDir())
+			if err != nil {
+				return err
+			}
+			if len(limits) > 0 {
+				fmt.Println()
+				printRateLimits(os.Stdout, limits)
+			}
+			return nil
+		},
+	}
+}
+
+// printRateLimits prints the rate limits the gateways last saw for each
+// token.
+func printRateLimits(out io.Writer, limits []gateway.RateLimitStatus) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tTOKEN\tRESOURCE\tREMAINING\tLIMIT\tRESET\tRETRY AFTER")
+	for _, st := range limits {
+		retryAfter := "-"
+		if st.RetryAfter.After(time.Now()) {
+			retryAfter = st.RetryAfter.Local().Format(time.TimeOnly)
+		}
+		if len(st.Resources) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\t%s\n", st.Host, st.Token, retryAfter)
+			continue
+		}
+		for _, name := range slices.Sorted(maps.Keys(st.Resources)) {
+			res := st.Resources[name]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+				st.Host, st.Token, name, res.Remaining, res.Limit, res.Reset.Local().Format(time.TimeOnly), retryAfter)
+		}
+	}
+	w.Flush()
+}
+
+// auditLogPollInterval is how often "logs -f" checks the audit log for new entries.
+var auditLogPollInterval = 500 * time.Millisecond
+
+// newLogsCmd creates the "logs" subcommand.
+func newLogsCmd() *cobra.Command {
+	var (
+		gatewayLogs bool
+		follow      bool
+		raw         bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Show logs for the current project",
+		Long: `Show logs for the current project. With --gateway, show the gateway audit
+log: every git and GitHub API request made by the project's sessions and
+whether the gateway allowed it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !gatewayLogs {
+				return fmt.Errorf("--gateway is required")
+			}
+
+			orch, cleanup, err := createOrchestrator()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+			logPath, err := orch.GatewayLogPath(cwd)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer cancel()
+
+			f, err := os.Open(logPath)
+			if errors.Is(err, os.ErrNotExist) && !follow {
+				fmt.Fprintln(cmd.OutOrStdout(), "No gateway logs for this project.")
+				return nil
+			}
+			for errors.Is(err, os.ErrNotExist) {
+				// Wait for the first session to create the log.
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(auditLogPollInterval):
+				}
+				f, err = os.Open(logPath)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to open gateway log: %w", err)
+			}
+			defer f.Close()
+
+			return printAuditLog(ctx, f, cmd.OutOrStdout(), follow, raw)
+		},
+	}
+
+	cmd.Flags().BoolVar(&gatewayLogs, "gateway", false, "Show the gateway audit log")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing new entries as they are written")
+	cmd.Flags().BoolVar(&raw, "json", false, "Print entries as JSON lines")
+
+	return cmd
+}
+
+// printAuditLog prints the gateway audit log entries read from r. With
+// follow, it keeps polling r for new entries until ctx is cancelled.
+func printAuditLog(ctx context.Context, r io.Reader, w io.Writer, follow, raw bool) error {
+	br := bufio.NewReader(r)
+	var partial []byte
+	for {
+		line, err := br.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == io.EOF {
+			if !follow {
+				if len(partial) > 0 {
+					printAuditEntry(w, partial, raw)
+				}
+				return nil
+			}
+			// Keep a partially written line until the rest arrives.
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(auditLogPollInterval):
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read gateway log: %w", err)
+		}
+		printAuditEntry(w, partial, raw)
+		partial = nil
+	}
+}
+
+// printAuditEntry prints one audit log line, formatted unless raw is set.
+// Lines that are not valid entries are printed as they are.
+func printAuditEntry(w io.Writer, line []byte, raw bool) {
+	line = bytes.TrimRight(line, "\n")
+	var entry gateway.AuditEntry
+	if raw || json.Unmarshal(line, &entry) != nil {
+		fmt.Fprintf(w, "%s\n", line)
+		return
+	}
+	fmt.Fprintln(w, formatAuditEntry(&entry))
+}
+
+// formatAuditEntry formats an audit log entry as a single line.
+func formatAuditEntry(entry *gateway.AuditEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %-5s %d %s %s",
+		entry.Time.Local().Format(time.DateTime),
+		entry.Session,
+		entry.Decision,
+		entry.Status,
+		entry.Method,
+		entry.Path,
+	)
+	if entry.Operation != "" {
+		fmt.Fprintf(&b, " op=%q", entry.Operation)
+	}
+	for _, ref := range entry.Refs {
+		fmt.Fprintf(&b, " %s:%s..%s", ref.Ref, shortOID(ref.OldOID), shortOID(ref.NewOID))
+	}
+	fmt.Fprintf(&b, " %dms", entry.DurationMS)
+	if entry.Cache != "" {
+		fmt.Fprintf(&b, " cache=%s", entry.Cache)
+	}
+	if entry.Reason != "" {
+		fmt.Fprintf(&b, " reason=%q", entry.Reason)
+	}
+	if entry.Approval != "" {
+		fmt.Fprintf(&b, " approval=%q", entry.Approval)
+	}
+	return b.String()
+}
+
+// shortOID abbreviates a git object ID for display.
+func shortOID(oid string) string {
+	if len(oid) > 7 {
+		return oid[:7]
+	}
+	return oid
+}
+
+// approvalsPollInterval is how often "approvals --watch" checks for new requests.
+var approvalsPollInterval = 500 * time.Millisecond
+
+// newApprovalsCmd creates the "approvals" subcommand with approve and deny
+// subcommands.
+func newApprovalsCmd() *cobra.Command {
+	var watch bool
+
+	cmd := &cobra.Command{
+		Use:   "approvals",
+		Short: "List gateway requests waiting for approval",
+		Long: `List the gateway requests of the current project's sessions that wait for
+your approval, as required by needs_approval in the gateway policy. Decide on
+them with "approvals approve <id>" or "approvals deny <id>", or use --watch
+to be prompted for each request as it arrives. Requests without a decision
+are denied when they time out.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := gatewayApprovalsDir()
+			if err != nil {
+				return err
+			}
+			if watch {
+				ctx, cancel := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+				defer cancel()
+				return watchApprovals(ctx, dir, cmd.InOrStdin(), cmd.OutOrStdout())
+			}
+
+			requests, err := gateway.ListApprovals(dir)
+			if err != nil {
+				return err
+			}
+			if len(requests) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No requests waiting for approval.")
+				return nil
+			}
+			for _, req := range requests {
+				fmt.Fprintln(cmd.OutOrStdout(), formatApprovalRequest(&req))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Prompt for each request as it arrives")
+	cmd.AddCommand(
+		newApprovalDecisionCmd("approve", gateway.ApprovalApprove, "Approve a gateway request"),
+		newApprovalDecisionCmd("deny", gateway.ApprovalDeny, "Deny a gateway request"),
+	)
+
+	return cmd
+}
+
+// newApprovalDecisionCmd creates an "approvals" subcommand that makes
+// decision on the request with the given ID.
+func newApprovalDecisionCmd(use, decision, short string) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " <id>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := gatewayApprovalsDir()
+			if err != nil {
+				return err
+			}
+			if err := gateway.DecideApproval(dir, args[0], decision); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Request %s: %s\n", args[0], decision)
+			return nil
 		},
 	}
 }
 
+// gatewayApprovalsDir returns the approvals directory of the project in the
+// working directory.
+func gatewayApprovalsDir() (string, error) {
+	orch, cleanup, err := createOrchestrator()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return orch.GatewayApprovalsDir(cwd)
+}
+
+// watchApprovals prompts on w for a decision on each request in dir as it
+// arrives, reading the answers from r, until ctx is cancelled or r ends.
+func watchApprovals(ctx context.Context, dir string, r io.Reader, w io.Writer) error {
+	answers := bufio.NewReader(r)
+	seen := make(map[string]bool)
+	fmt.Fprintln(w, "Waiting for requests that need approval. Press Ctrl-C to stop.")
+	for {
+		requests, err := gateway.ListApprovals(dir)
+		if err != nil {
+			return err
+		}
+		for _, req := range requests {
+			if seen[req.ID] {
+				continue
+			}
+			seen[req.ID] = true
+
+			fmt.Fprintln(w, formatApprovalRequest(&req))
+			fmt.Fprint(w, "Approve? [y/N] ")
+			answer, err := answers.ReadString('\n')
+			if err != nil && answer == "" {
+				fmt.Fprintln(w)
+				return nil
+			}
+			decision := gateway.ApprovalDeny
+			if a := strings.ToLower(strings.TrimSpace(answer)); a == "y" || a == "yes" {
+				decision = gateway.ApprovalApprove
+			}
+			if err := gateway.DecideApproval(dir, req.ID, decision); err != nil {
+				// The request timed out while waiting for the answer.
+				fmt.Fprintf(w, "Request %s: %v\n", req.ID, err)
+				continue
+			}
+			fmt.Fprintf(w, "Request %s: %s\n", req.ID, decision)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(approvalsPollInterval):
+		}
+	}
+}
+
+// formatApprovalRequest formats a request waiting for approval as a single line.
+func formatApprovalRequest(req *gateway.ApprovalRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s %s %s",
+		req.ID,
+		req.Time.Local().Format(time.DateTime),
+		req.Session,
+		req.Method,
+		req.Path,
+	)
+	if req.Operation != "" {
+		fmt.Fprintf(&b, " op=%q", req.Operation)
+	}
+	for _, ref := range req.Refs {
+		fmt.Fprintf(&b, " %s:%s..%s", ref.Ref, shortOID(ref.OldOID), shortOID(ref.NewOID))
+	}
+	fmt.Fprintf(&b, " reason=%q", req.Reason)
+	if !req.Expires.IsZero() {
+		fmt.Fprintf(&b, " expires=%s", req.Expires.Local().Format(time.TimeOnly))
+	}
+	return b.String()
+}
+
 // newBuildCmd creates the "build" subcommand.
 func newBuildCmd() *cobra.Command {
 	return &cobra.Command{
@@ -370,14 +723,123 @@ func newVersionCmd() *cobra.Command {
 	}
 }
 
+// gatewayTLSCertEnv holds the PEM-encoded certificate for the gateway's
+// HTTPS listeners. Its private key is read from the --tls-key-file file,
+// since the environment of a container can be inspected.
+const gatewayTLSCertEnv = "GATEWAY_TLS_CERT"
+
+// gatewayAuthTokenEnv holds the token clients must present to the gateway.
+const gatewayAuthTokenEnv = "GATEWAY_AUTH_TOKEN"
+
+// gatewaySSHAuthorizedKeyEnv holds the public key the gateway's SSH clients
+// authenticate with. The SSH server's host key is read from the
+// --ssh-host-key-file file.
+const gatewaySSHAuthorizedKeyEnv = "GATEWAY_SSH_AUTHORIZED_KEY"
+
+// Environment variables configuring the gateway to authenticate as a GitHub
+// App. Its private key is read from the --app-key-file file.
+const (
+	gitHubAppIDEnv             = "GITHUB_APP_ID"
+	gitHubAppInstallationIDEnv = "GITHUB_APP_INSTALLATION_ID"
+)
+
+// gatewayForges combines the --forge and --forge-url flags into the forge
+// configuration of each host.
+func gatewayForges(kinds, urls map[string]string) (map[string]gateway.ForgeConfig, error) {
+	forges := make(map[string]gateway.ForgeConfig, len(kinds)+len(urls))
+	for host, kind := range kinds {
+		if !gateway.IsForgeKind(kind) {
+			return nil, fmt.Errorf("invalid --forge for %s: unknown forge %q, expected %s, %s, or %s", host, kind, gateway.ForgeGitHub, gateway.ForgeGitLab, gateway.ForgeGitea)
+		}
+		forge := forges[host]
+		forge.Kind = kind
+		forges[host] = forge
+	}
+	for host, url := range urls {
+		forge := forges[host]
+		forge.URL = url
+		forges[host] = forge
+	}
+	return forges, nil
+}
+
+// gitHubAppAuthFromEnv returns GitHub App auth for the project host of
+// config when GITHUB_APP_ID is set, or nil otherwise, with the private key
+// in keyFile. Its tokens are scoped to the repositories and permissions the
+// gateway's policy lets through.
+func gitHubAppAuthFromEnv(config gateway.ProxyConfig, keyFile string) (*gateway.GitHubAuth, error) {
+	appIDValue := os.Getenv(gitHubAppIDEnv)
+	if appIDValue == "" {
+		return nil, nil
+	}
+
+	appID, err := strconv.ParseInt(appIDValue, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", gitHubAppIDEnv, appIDValue, err)
+	}
+
+	var installationID int64
+	if value := os.Getenv(gitHubAppInstallationIDEnv); value != "" {
+		installationID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", gitHubAppInstallationIDEnv, value, err)
+		}
+	}
+
+	if keyFile == "" {
+		return nil, fmt.Errorf("%s requires --app-key-file to be set", gitHubAppIDEnv)
+	}
+	privateKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+
+	return gateway.NewGitHubAuthFromApp(gateway.GitHubAppConfig{
+		Host:           config.Host,
+		AppID:          appID,
+		InstallationID: installationID,
+		PrivateKey:     privateKey,
+		Owner:          config.AllowedOwner,
+		Repo:           config.AllowedRepo,
+		Repositories:   config.GitHubAppRepositories(),
+		Permissions:    config.GitHubAppPermissions(),
+	})
+}
+
 // newGatewayCmd creates the "gateway" subcommand for running inside the
 // gateway container.
 func newGatewayCmd() *cobra.Command {
 	var (
-		owner     string
-		repo      string
-		proxyAddr string
-		apiAddr   string
+		host           string
+		extraHosts     []string
+		forgeKinds     map[string]string
+		forgeURLs      map[string]string
+		owner          string
+		repo           string
+		policyPath     string
+		proxyAddr      string
+		apiAddr        string
+		tlsAddr        string
+		tlsKeyFile     string
+		appKeyFile     string
+		sshAddr        string
+		sshHostKeyFile string
+		auditPath      string
+		sessionID      string
+		egressAddr     string
+		egressAllow    []string
+
+		approvalsDir    string
+		approvalTimeout time.Duration
+		maxPushSize     int64
+		readAllow       []string
+		cacheDir        string
+		mirrors         []string
+
+		rateLimitDir   string
+		rateLimit      float64
+		rateLimitBurst int
+		maxRateWait    time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -390,23 +852,173 @@ entrypoint of the gateway container, not by end users directly.`,
 				return fmt.Errorf("--owner and --repo are required")
 			}
 
-			srv, err := gateway.NewServer(gateway.ProxyConfig{
+			forges, err := gatewayForges(forgeKinds, forgeURLs)
+			if err != nil {
+				return err
+			}
+
+			config := gateway.ProxyConfig{
+				Host:         host,
 				AllowedOwner: owner,
 				AllowedRepo:  repo,
-			})
+				ExtraHosts:   extraHosts,
+				Forges:       forges,
+				ReadRepos:    readAllow,
+				MaxPushSize:  maxPushSize,
+			}
+			if policyPath != "" {
+				policy, err := gateway.LoadPolicy(policyPath)
+				if err != nil {
+					return fmt.Errorf("failed to load gateway policy: %w", err)
+				}
+				config.Policy = policy
+			}
+			for _, repo := range readAllow {
+				if strings.Count(repo, "/") < 2 || strings.Contains(repo, "//") {
+					return fmt.Errorf("invalid --read-allow %q: expected host/owner/repo", repo)
+				}
+			}
+			for _, pattern := range egressAllow {
+				if err := gateway.ValidateEgressPattern(pattern); err != nil {
+					return fmt.Errorf("invalid --egress-allow %q: %w", pattern, err)
+				}
+			}
+			if len(mirrors) > 0 && cacheDir == "" {
+				return fmt.Errorf("--mirror requires --cache-dir")
+			}
+
+			appAuth, err := gitHubAppAuthFromEnv(config, appKeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to authenticate as GitHub App: %w", err)
+			}
+
+			var srv *gateway.Server
+			if appAuth != nil {
+				srv = gateway.NewServerWithAuth(config, appAuth)
+			} else {
+				srv, err = gateway.NewServer(config)
+				if err != nil {
+					return fmt.Errorf("failed to create gateway server: %w", err)
+				}
+			}
+
+			certPEM := os.Getenv(gatewayTLSCertEnv)
+			if tlsAddr != "" && (certPEM == "" || tlsKeyFile == "") {
+				return fmt.Errorf("--tls-addr requires %s and --tls-key-file to be set", gatewayTLSCertEnv)
+			}
+			if certPEM != "" || tlsKeyFile != "" {
+				keyPEM, err := os.ReadFile(tlsKeyFile)
+				if err != nil {
+					return fmt.Errorf("failed to read TLS key: %w", err)
+				}
+				if err := srv.EnableTLS(tlsAddr, []byte(certPEM), keyPEM); err != nil {
+					return err
+				}
+				if tlsAddr != "" {
+					fmt.Printf("Gateway GitHub Enterprise endpoint: https://%s\n", tlsAddr)
+				}
+			}
+
+			if token := os.Getenv(gatewayAuthTokenEnv); token != "" {
+				srv.EnableClientAuth(token)
+				fmt.Printf("Gateway client authentication: enabled\n")
+			}
+
+			if sshAddr != "" {
+				authorizedKey := os.Getenv(gatewaySSHAuthorizedKeyEnv)
+				if sshHostKeyFile == "" || authorizedKey == "" {
+					return fmt.Errorf("--ssh-addr requires --ssh-host-key-file and %s to be set", gatewaySSHAuthorizedKeyEnv)
+				}
+				hostKey, err := os.ReadFile(sshHostKeyFile)
+				if err != nil {
+					return fmt.Errorf("failed to read SSH host key: %w", err)
+				}
+				if err := srv.EnableSSH(sshAddr, hostKey, authorizedKey); err != nil {
+					return err
+				}
+				fmt.Printf("Gateway SSH server: %s\n", sshAddr)
+			}
+
+			if egressAddr != "" {
+				allow := slices.Clone(gateway.DefaultEgressAllow)
+				if config.Policy != nil {
+					allow = append(allow, config.Policy.Egress.Allow...)
+				}
+				allow = append(allow, egressAllow...)
+				srv.EnableEgress(egressAddr, allow)
+				fmt.Printf("Gateway egress proxy: %s\n", egressAddr)
+			}
+
+			if auditPath != "" {
+				auditFile, err := os.OpenFile(auditPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+				if err != nil {
+					return fmt.Errorf("failed to open audit log: %w", err)
+				}
+				defer auditFile.Close()
+				srv.EnableAuditLog(gateway.NewAuditLog(auditFile, sessionID))
+				fmt.Printf("Gateway audit log: %s\n", auditPath)
+			}
+
+			if approvalsDir != "" {
+				queue, err := gateway.NewApprovalQueue(approvalsDir, sessionID, approvalTimeout)
+				if err != nil {
+					return err
+				}
+				srv.EnableApprovals(queue)
+				fmt.Printf("Gateway approvals: %s\n", approvalsDir)
+			}
+
+			limiter, err := gateway.NewRateLimiter(rateLimitDir, rateLimit, rateLimitBurst, maxRateWait)
 			if err != nil {
-				return fmt.Errorf("failed to create gateway server: %w", err)
+				return err
+			}
+			srv.EnableRateLimit(limiter)
+			if rateLimitDir != "" {
+				fmt.Printf("Gateway rate limits: %s\n", rateLimitDir)
+			}
+
+			if cacheDir != "" {
+				cache, err := gateway.NewCache(cacheDir, mirrors)
+				if err != nil {
+					return err
+				}
+				srv.EnableCache(cache)
+				fmt.Printf("Gateway cache: %s\n", cacheDir)
 			}
 
-			fmt.Printf("Gateway starting: proxy=%s api=%s owner=%s repo=%s\n", proxyAddr, apiAddr, owner, repo)
+			fmt.Printf("Gateway starting: proxy=%s api=%s host=%s owner=%s repo=%s\n", proxyAddr, apiAddr, host, owner, repo)
 			return srv.Run(proxyAddr, apiAddr)
 		},
 	}
 
+	cmd.Flags().StringVar(&host, "host", gateway.DefaultHost, "Forge host of the allowed repository, e.g. a GitHub Enterprise Server host")
+	cmd.Flags().StringArrayVar(&extraHosts, "extra-host", nil, "Further forge host git requests can be proxied to (repeatable)")
+	cmd.Flags().StringToStringVar(&forgeKinds, "forge", nil, "Forge of a host as host=github|gitlab|gitea, for hosts not on their default forge (repeatable)")
+	cmd.Flags().StringToStringVar(&forgeURLs, "forge-url", nil, "Base URL of a host as host=url, for hosts not served at https://<host> (repeatable)")
 	cmd.Flags().StringVar(&owner, "owner", "", "Allowed GitHub repository owner")
 	cmd.Flags().StringVar(&repo, "repo", "", "Allowed GitHub repository name")
+	cmd.Flags().StringVar(&policyPath, "policy", "", "Path to a gateway policy file granting access to further repositories")
 	cmd.Flags().StringVar(&proxyAddr, "proxy-addr", ":8080", "Address for the git proxy server")
 	cmd.Flags().StringVar(&apiAddr, "api-addr", ":8083", "Address for the API server")
+	cmd.Flags().StringVar(&tlsAddr, "tls-addr", "", "Address for the GitHub Enterprise compatible HTTPS endpoint used by gh (disabled if empty)")
+	cmd.Flags().StringVar(&appKeyFile, "app-key-file", "", "File holding the PEM private key of the GitHub App in "+gitHubAppIDEnv)
+	cmd.Flags().StringVar(&tlsKeyFile, "tls-key-file", "", "File holding the PEM private key for the certificate in "+gatewayTLSCertEnv)
+	cmd.Flags().StringVar(&sshAddr, "ssh-addr", "", "Address for the SSH server git remotes over SSH go through (disabled if empty)")
+	cmd.Flags().StringVar(&sshHostKeyFile, "ssh-host-key-file", "", "File holding the OpenSSH private host key of the SSH server")
+	cmd.Flags().StringVar(&auditPath, "audit-log", "", "Path of a JSONL file every request is appended to (disabled if empty)")
+	cmd.Flags().StringVar(&sessionID, "session", "", "Session ID recorded in audit log entries")
+	cmd.Flags().StringVar(&egressAddr, "egress-addr", "", "Address for the HTTP forward proxy the agent's other traffic goes through (disabled if empty)")
+	cmd.Flags().StringArrayVar(&egressAllow, "egress-allow", nil, "Further domain the egress proxy allows, e.g. pkg.go.dev or *.docker.io (repeatable)")
+	cmd.Flags().StringArrayVar(&readAllow, "read-allow", nil, "Further repository readable when the policy restricts reads, as host/owner/repo (repeatable)")
+	cmd.Flags().StringVar(&approvalsDir, "approvals-dir", "", "Directory requests that need approval are parked in for claude-forge approvals (denied if empty)")
+	cmd.Flags().DurationVar(&approvalTimeout, "approval-timeout", gateway.DefaultApprovalTimeout, "How long a request waits for approval before it is denied")
+	cmd.Flags().Int64Var(&maxPushSize, "max-push-size", gateway.DefaultMaxPushSize, "Largest push, in bytes, the gateway buffers for inspection before it rejects it")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Directory API responses and repository mirrors are cached in, shared by the project's sessions (disabled if empty)")
+	cmd.Flags().StringVar(&rateLimitDir, "rate-limit-dir", "", "Directory the rate limit state is shared with other gateways through (kept in memory if empty)")
+	cmd.Flags().Float64Var(&rateLimit, "rate-limit", gateway.DefaultRateLimitRate, "API requests per second let through for each token")
+	cmd.Flags().IntVar(&rateLimitBurst, "rate-limit-burst", gateway.DefaultRateLimitBurst, "API requests let through at once for each token")
+	cmd.Flags().DurationVar(&maxRateWait, "max-rate-limit-wait", gateway.DefaultMaxRateLimitWait, "How long an API request waits for a rate limit before it is rejected")
+	cmd.Flags().StringArrayVar(&mirrors, "mirror", nil, "Repository pattern, as owner/repo or host/owner/repo, whose fetches are served from a mirror in the cache (repeatable)")
 
 	return cmd
 }
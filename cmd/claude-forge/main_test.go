@@ -10,11 +10,13 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/michael-freling/claude-code-tools/internal/forge"
 	"github.com/michael-freling/claude-code-tools/internal/forge/container"
+	"github.com/michael-freling/claude-code-tools/internal/gateway"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,7 +28,7 @@ func TestNewRootCmd(t *testing.T) {
 	assert.Equal(t, "claude-forge", cmd.Use)
 
 	expectedSubcommands := []string{
-		"start", "resume", "stop", "status",
+		"start", "resume", "stop", "status", "logs",
 		"build", "auth", "plugins", "version", "gateway", "forge-gh",
 	}
 
@@ -102,6 +104,10 @@ func TestNewGatewayCmd(t *testing.T) {
 	apiAddrFlag := cmd.Flags().Lookup("api-addr")
 	require.NotNil(t, apiAddrFlag)
 	assert.Equal(t, ":8083", apiAddrFlag.DefValue)
+
+	policyFlag := cmd.Flags().Lookup("policy")
+	require.NotNil(t, policyFlag)
+	assert.Equal(t, "", policyFlag.DefValue)
 }
 
 func TestNewVersionCmd(t *testing.T) {
@@ -139,6 +145,273 @@ func TestNewStatusCmd(t *testing.T) {
 	assert.Equal(t, "status", cmd.Use)
 }
 
+func TestLogsCmd(t *testing.T) {
+	entry := gateway.AuditEntry{
+		Time:     time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+		Session:  "abc12345",
+		Server:   "git",
+		Method:   "POST",
+		Path:     "/github.com/test-owner/test-repo.git/git-receive-pack",
+		Refs:     []gateway.AuditRefUpdate{{Ref: "refs/heads/main", OldOID: "1111111111", NewOID: "2222222222"}},
+		Decision: gateway.AuditDeny,
+		Reason:   "refs/heads/main: protected ref cannot be pushed to through the gateway",
+		Status:   200,
+	}
+	line, err := json.Marshal(entry)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		args       []string
+		writeLog   bool
+		wantErr    string
+		wantOutput []string
+	}{
+		{
+			name:    "requires --gateway",
+			wantErr: "--gateway is required",
+		},
+		{
+			name:       "no log yet",
+			args:       []string{"--gateway"},
+			wantOutput: []string{"No gateway logs for this project."},
+		},
+		{
+			name:     "formatted entries",
+			args:     []string{"--gateway"},
+			writeLog: true,
+			wantOutput: []string{
+				"abc12345 deny  200 POST /github.com/test-owner/test-repo.git/git-receive-pack",
+				"refs/heads/main:1111111..2222222",
+				`reason="refs/heads/main: protected ref cannot be pushed to through the gateway"`,
+			},
+		},
+		{
+			name:       "JSON entries",
+			args:       []string{"--gateway", "--json"},
+			writeLog:   true,
+			wantOutput: []string{string(line)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			homeDir := setupTestOrchestrator(t, &stubContainerManager{})
+			repoDir := setupTestGitRepo(t)
+
+			origDir, err := os.Getwd()
+			require.NoError(t, err)
+			require.NoError(t, os.Chdir(repoDir))
+			t.Cleanup(func() { os.Chdir(origDir) })
+
+			if tt.writeLog {
+				logDir := filepath.Join(homeDir, ".claude-forge", "logs", strings.ReplaceAll(repoDir, "/", "-"))
+				require.NoError(t, os.MkdirAll(logDir, 0o755))
+				require.NoError(t, os.WriteFile(filepath.Join(logDir, "gateway.jsonl"), append(line, '\n'), 0o644))
+			}
+
+			cmd := newLogsCmd()
+			cmd.SetArgs(tt.args)
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+
+			err = cmd.Execute()
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			for _, want := range tt.wantOutput {
+				assert.Contains(t, out.String(), want)
+			}
+		})
+	}
+}
+
+func TestPrintAuditLog_Follow(t *testing.T) {
+	original := auditLogPollInterval
+	auditLogPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { auditLogPollInterval = original })
+
+	logPath := filepath.Join(t.TempDir(), "gateway.jsonl")
+	logFile, err := os.Create(logPath)
+	require.NoError(t, err)
+	defer logFile.Close()
+	// A partially written line is held back until it is complete.
+	_, err = logFile.WriteString(`{"decision":"allow","status":200,"method":"GET",`)
+	require.NoError(t, err)
+
+	f, err := os.Open(logPath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan error)
+	go func() {
+		done <- printAuditLog(ctx, f, out, true, false)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, out.String())
+
+	_, err = logFile.WriteString(`"path":"/api/graphql"}` + "\n")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "allow 200 GET /api/graphql")
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestApprovalsCmd(t *testing.T) {
+	request := gateway.ApprovalRequest{
+		ID:        "abcd1234",
+		Time:      time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+		Session:   "abc12345",
+		Method:    "PUT",
+		Path:      "/repos/test-owner/test-repo/pulls/1/merge",
+		Operation: "merge-pr",
+		Reason:    "operation merge-pr requires approval",
+	}
+	line, err := json.Marshal(request)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		args         []string
+		writeRequest bool
+		wantErr      string
+		wantOutput   []string
+		wantDecision string
+	}{
+		{
+			name:       "no requests",
+			wantOutput: []string{"No requests waiting for approval."},
+		},
+		{
+			name:         "pending requests",
+			writeRequest: true,
+			wantOutput: []string{
+				"abcd1234",
+				"abc12345 PUT /repos/test-owner/test-repo/pulls/1/merge",
+				`op="merge-pr"`,
+				`reason="operation merge-pr requires approval"`,
+			},
+		},
+		{
+			name:         "approve",
+			args:         []string{"approve", "abcd1234"},
+			writeRequest: true,
+			wantOutput:   []string{"Request abcd1234: approve"},
+			wantDecision: gateway.ApprovalApprove,
+		},
+		{
+			name:         "deny",
+			args:         []string{"deny", "abcd1234"},
+			writeRequest: true,
+			wantOutput:   []string{"Request abcd1234: deny"},
+			wantDecision: gateway.ApprovalDeny,
+		},
+		{
+			name:    "unknown request",
+			args:    []string{"approve", "abcd1234"},
+			wantErr: "no pending approval request abcd1234",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			homeDir := setupTestOrchestrator(t, &stubContainerManager{})
+			repoDir := setupTestGitRepo(t)
+
+			origDir, err := os.Getwd()
+			require.NoError(t, err)
+			require.NoError(t, os.Chdir(repoDir))
+			t.Cleanup(func() { os.Chdir(origDir) })
+
+			approvalsDir := filepath.Join(homeDir, ".claude-forge", "logs", strings.ReplaceAll(repoDir, "/", "-"), "approvals")
+			if tt.writeRequest {
+				require.NoError(t, os.MkdirAll(approvalsDir, 0o755))
+				require.NoError(t, os.WriteFile(filepath.Join(approvalsDir, "abcd1234.json"), line, 0o644))
+			}
+
+			cmd := newApprovalsCmd()
+			cmd.SetArgs(tt.args)
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+
+			err = cmd.Execute()
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			for _, want := range tt.wantOutput {
+				assert.Contains(t, out.String(), want)
+			}
+			if tt.wantDecision != "" {
+				decision, err := os.ReadFile(filepath.Join(approvalsDir, "abcd1234.decision"))
+				require.NoError(t, err)
+				assert.Contains(t, string(decision), `"decision":"`+tt.wantDecision+`"`)
+			}
+		})
+	}
+}
+
+func TestWatchApprovals(t *testing.T) {
+	original := approvalsPollInterval
+	approvalsPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { approvalsPollInterval = original })
+
+	dir := t.TempDir()
+	for _, id := range []string{"aaaa1111", "bbbb2222"} {
+		line, err := json.Marshal(gateway.ApprovalRequest{ID: id, Path: "/repos/o/r/pulls/1/merge", Reason: "operation merge-pr requires approval"})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, id+".json"), line, 0o644))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan error)
+	go func() {
+		done <- watchApprovals(ctx, dir, strings.NewReader("y\nn\n"), out)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "Request bbbb2222: deny")
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	assert.Contains(t, out.String(), "Request aaaa1111: approve")
+	for id, want := range map[string]string{"aaaa1111": gateway.ApprovalApprove, "bbbb2222": gateway.ApprovalDeny} {
+		decision, err := os.ReadFile(filepath.Join(dir, id+".decision"))
+		require.NoError(t, err)
+		assert.Contains(t, string(decision), `"decision":"`+want+`"`)
+	}
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
 func TestNewBuildCmd(t *testing.T) {
 	cmd := newBuildCmd()
 	assert.Equal(t, "build", cmd.Use)
@@ -333,6 +606,41 @@ func TestStatusCmd_Execute_WithContainers(t *testing.T) {
 	assert.Contains(t, output, "STATUS")
 }
 
+func TestStatusCmd_Execute_WithRateLimits(t *testing.T) {
+	cm := &stubContainerManager{
+		containers: []container.ContainerInfo{
+			{Name: "forge-gateway-testproj-abc12345", Image: "ghcr.io/test/gateway:latest", Status: "running"},
+		},
+	}
+	homeDir := setupTestOrchestrator(t, cm)
+
+	dir := filepath.Join(homeDir, ".claude-forge", "ratelimit")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	data, err := json.Marshal(gateway.RateLimitStatus{
+		Host:  "github.com",
+		Token: "0123456789abcdef",
+		Resources: map[string]gateway.RateLimitResource{
+			"core":    {Limit: 5000, Remaining: 4321, Used: 679, Reset: time.Now().Add(time.Hour)},
+			"graphql": {Limit: 5000, Remaining: 4999, Used: 1, Reset: time.Now().Add(time.Hour)},
+		},
+		Updated: time.Now(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "0123456789abcdef.json"), data, 0o644))
+
+	cmd := newStatusCmd()
+	cmd.SetArgs([]string{})
+
+	output := captureStdout(t, func() {
+		err := cmd.Execute()
+		require.NoError(t, err)
+	})
+	assert.Contains(t, output, "forge-gateway-testproj-abc12345")
+	assert.Contains(t, output, "REMAINING")
+	assert.Regexp(t, `github\.com\s+0123456789abcdef\s+core\s+4321\s+5000`, output)
+	assert.Regexp(t, `github\.com\s+0123456789abcdef\s+graphql\s+4999\s+5000`, output)
+}
+
 func TestBuildCmd_Execute(t *testing.T) {
 	setupTestOrchestrator(t, &stubContainerManager{})
 
@@ -374,6 +682,88 @@ func TestGatewayCmd_MissingRepo(t *testing.T) {
 	assert.Contains(t, err.Error(), "--owner and --repo are required")
 }
 
+func TestGatewayCmd_InvalidPolicy(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "gateway-policy.yaml")
+	require.NoError(t, os.WriteFile(policyPath, []byte("repos:\n  write:\n    allow: [no-slash]\n"), 0o644))
+
+	cmd := newGatewayCmd()
+	cmd.SetArgs([]string{"--owner=test-owner", "--repo=test-repo", "--policy=" + policyPath})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load gateway policy")
+}
+
+func TestGatewayCmd_InvalidForge(t *testing.T) {
+	cmd := newGatewayCmd()
+	cmd.SetArgs([]string{"--owner=test-owner", "--repo=test-repo", "--forge=git.example.com=bitbucket"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid --forge for git.example.com: unknown forge "bitbucket"`)
+}
+
+func TestGatewayCmd_InvalidEgressAllow(t *testing.T) {
+	cmd := newGatewayCmd()
+	cmd.SetArgs([]string{"--owner=test-owner", "--repo=test-repo", "--egress-allow=https://pkg.go.dev"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid --egress-allow "https://pkg.go.dev"`)
+}
+
+func TestGatewayCmd_InvalidReadAllow(t *testing.T) {
+	cmd := newGatewayCmd()
+	cmd.SetArgs([]string{"--owner=test-owner", "--repo=test-repo", "--read-allow=test-owner/lib"})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid --read-allow "test-owner/lib": expected host/owner/repo`)
+}
+
+func TestGatewayCmd_InvalidCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "mirror without cache dir",
+			args:    []string{"--mirror=test-owner/*"},
+			wantErr: "--mirror requires --cache-dir",
+		},
+		{
+			name:    "invalid mirror pattern",
+			args:    []string{"--cache-dir=" + t.TempDir(), "--mirror=test-repo"},
+			wantErr: `invalid mirror pattern "test-repo": expected owner/repo or host/owner/repo`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_TOKEN", "test-token")
+			cmd := newGatewayCmd()
+			cmd.SetArgs(append([]string{"--owner=test-owner", "--repo=test-repo"}, tt.args...))
+
+			err := cmd.Execute()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestGatewayForges(t *testing.T) {
+	got, err := gatewayForges(
+		map[string]string{"gitea": "gitea", "gitlab.example.com": "gitlab"},
+		map[string]string{"gitea": "http://gitea:3000"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]gateway.ForgeConfig{
+		"gitea":              {Kind: gateway.ForgeGitea, URL: "http://gitea:3000"},
+		"gitlab.example.com": {Kind: gateway.ForgeGitLab},
+	}, got)
+}
+
 func TestResumeCmd_List_NoSessions(t *testing.T) {
 	setupTestOrchestrator(t, &stubContainerManager{})
 	repoDir := setupTestGitRepo(t)
@@ -616,6 +1006,219 @@ func TestGatewayCmd_ServerError(t *testing.T) {
 	assert.Contains(t, output, "Gateway starting")
 }
 
+func TestGatewayCmd_AuditLogError(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_test_gateway_token")
+
+	cmd := newGatewayCmd()
+	cmd.SetArgs([]string{
+		"--owner=test-owner",
+		"--repo=test-repo",
+		"--audit-log=" + filepath.Join(t.TempDir(), "missing", "gateway.jsonl"),
+	})
+
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open audit log")
+}
+
+func TestGatewayCmd_GitHubAppErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		appID          string
+		installationID string
+		privateKey     string
+		wantErr        string
+	}{
+		{
+			name:    "invalid app ID",
+			appID:   "abc",
+			wantErr: `invalid GITHUB_APP_ID "abc"`,
+		},
+		{
+			name:           "invalid installation ID",
+			appID:          "123",
+			installationID: "xyz",
+			wantErr:        `invalid GITHUB_APP_INSTALLATION_ID "xyz"`,
+		},
+		{
+			name:    "missing private key file",
+			appID:   "123",
+			wantErr: "GITHUB_APP_ID requires --app-key-file to be set",
+		},
+		{
+			name:       "invalid private key",
+			appID:      "123",
+			privateKey: "not a key",
+			wantErr:    "failed to authenticate as GitHub App: failed to decode GitHub App private key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_APP_ID", tt.appID)
+			t.Setenv("GITHUB_APP_INSTALLATION_ID", tt.installationID)
+
+			args := []string{"--owner=test-owner", "--repo=test-repo"}
+			if tt.privateKey != "" {
+				keyFile := filepath.Join(t.TempDir(), "github-app.key")
+				require.NoError(t, os.WriteFile(keyFile, []byte(tt.privateKey), 0600))
+				args = append(args, "--app-key-file="+keyFile)
+			}
+
+			cmd := newGatewayCmd()
+			cmd.SetArgs(args)
+
+			err := cmd.Execute()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestGatewayCmd_SSH(t *testing.T) {
+	hostKey, _, err := gateway.GenerateSSHKey()
+	require.NoError(t, err)
+	_, clientPublicKey, err := gateway.GenerateSSHKey()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		hostKey       string
+		authorizedKey string
+		wantErr       string
+		wantOutput    string
+	}{
+		{
+			name:          "missing host key file",
+			authorizedKey: clientPublicKey,
+			wantErr:       "--ssh-addr requires --ssh-host-key-file and GATEWAY_SSH_AUTHORIZED_KEY to be set",
+		},
+		{
+			name:    "missing authorized key",
+			hostKey: string(hostKey),
+			wantErr: "--ssh-addr requires --ssh-host-key-file and GATEWAY_SSH_AUTHORIZED_KEY to be set",
+		},
+		{
+			name:          "valid keys",
+			hostKey:       string(hostKey),
+			authorizedKey: clientPublicKey,
+			wantErr:       "server error",
+			wantOutput:    "Gateway SSH server: 127.0.0.1:0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_TOKEN", "ghp_test_gateway_token")
+			t.Setenv("GATEWAY_SSH_AUTHORIZED_KEY", tt.authorizedKey)
+
+			// Use an invalid address so a started server fails immediately
+			args := []string{
+				"--owner=test-owner",
+				"--repo=test-repo",
+				"--proxy-addr=invalid-address-:::::",
+				"--api-addr=invalid-address-:::::",
+				"--ssh-addr=127.0.0.1:0",
+			}
+			if tt.hostKey != "" {
+				hostKeyFile := filepath.Join(t.TempDir(), "ssh_host_key")
+				require.NoError(t, os.WriteFile(hostKeyFile, []byte(tt.hostKey), 0600))
+				args = append(args, "--ssh-host-key-file="+hostKeyFile)
+			}
+
+			cmd := newGatewayCmd()
+			cmd.SetArgs(args)
+
+			output := captureStdout(t, func() {
+				err := cmd.Execute()
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			})
+			assert.Contains(t, output, tt.wantOutput)
+		})
+	}
+}
+
+func TestGatewayCmd_TLS(t *testing.T) {
+	caCertPEM, caKeyPEM, err := gateway.GenerateCA()
+	require.NoError(t, err)
+	certPEM, keyPEM, err := gateway.GenerateCertificate(caCertPEM, caKeyPEM, "gateway")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		cert       string
+		key        string
+		authToken  string
+		wantErr    string
+		wantOutput string
+	}{
+		{
+			name:    "missing certificate",
+			key:     string(keyPEM),
+			wantErr: "--tls-addr requires GATEWAY_TLS_CERT and --tls-key-file to be set",
+		},
+		{
+			name:    "missing key file",
+			cert:    string(certPEM),
+			wantErr: "--tls-addr requires GATEWAY_TLS_CERT and --tls-key-file to be set",
+		},
+		{
+			name:    "invalid key",
+			cert:    string(certPEM),
+			key:     "not a key",
+			wantErr: "failed to load TLS certificate",
+		},
+		{
+			name:       "valid certificate",
+			cert:       string(certPEM),
+			key:        string(keyPEM),
+			wantErr:    "server error",
+			wantOutput: "Gateway GitHub Enterprise endpoint: https://127.0.0.1:0",
+		},
+		{
+			name:       "client token",
+			cert:       string(certPEM),
+			key:        string(keyPEM),
+			authToken:  "session-token",
+			wantErr:    "server error",
+			wantOutput: "Gateway client authentication: enabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_TOKEN", "ghp_test_gateway_token")
+			t.Setenv("GATEWAY_TLS_CERT", tt.cert)
+			t.Setenv("GATEWAY_AUTH_TOKEN", tt.authToken)
+
+			// Use an invalid address so a started server fails immediately
+			args := []string{
+				"--owner=test-owner",
+				"--repo=test-repo",
+				"--proxy-addr=invalid-address-:::::",
+				"--api-addr=invalid-address-:::::",
+				"--tls-addr=127.0.0.1:0",
+			}
+			if tt.key != "" {
+				keyFile := filepath.Join(t.TempDir(), "tls.key")
+				require.NoError(t, os.WriteFile(keyFile, []byte(tt.key), 0600))
+				args = append(args, "--tls-key-file="+keyFile)
+			}
+
+			cmd := newGatewayCmd()
+			cmd.SetArgs(args)
+
+			output := captureStdout(t, func() {
+				err := cmd.Execute()
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			})
+			assert.Contains(t, output, tt.wantOutput)
+		})
+	}
+}
+
 func TestStatusCmd_OrchestratorError(t *testing.T) {
 	original := createOrchestrator
 	createOrchestrator = func() (*forge.Orchestrator, func(), error) {
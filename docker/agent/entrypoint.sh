@@ -17,4 +17,35 @@ if [ -n "$FORGE_UID" ] && [ -n "$FORGE_GID" ]; then
     chown -R user:user /home/user 2>/dev/null || true
 fi
 
+# Trust the session CA, which signs the certificate of the gateway's HTTPS
+# listeners that git, gh, and Claude Code use to reach the forge.
+if [ -n "$FORGE_GATEWAY_CA" ]; then
+    printf '%s\n' "$FORGE_GATEWAY_CA" > /usr/local/share/ca-certificates/forge-gateway.crt
+    update-ca-certificates >/dev/null
+fi
+
+# Present the session token, which the gateway requires, on git's requests
+# to the gateway's GitHub Enterprise endpoint and git proxy.
+if [ -n "$FORGE_GATEWAY_TOKEN" ]; then
+    git config --system http.https://gateway/.extraHeader "Authorization: Bearer $FORGE_GATEWAY_TOKEN"
+    git config --system http.https://gateway:8080/.extraHeader "Authorization: Bearer $FORGE_GATEWAY_TOKEN"
+fi
+
+# Authenticate to the gateway's SSH server, which SSH remotes are rewritten
+# to, with the session key, and trust only the gateway's session host key.
+if [ -n "$FORGE_GATEWAY_SSH_KEY" ]; then
+    mkdir -p /etc/ssh/forge-gateway /etc/ssh/ssh_config.d
+    printf '%s\n' "$FORGE_GATEWAY_SSH_KEY" > /etc/ssh/forge-gateway/id_ed25519
+    chown user:user /etc/ssh/forge-gateway/id_ed25519
+    chmod 600 /etc/ssh/forge-gateway/id_ed25519
+    printf '%s\n' "$FORGE_GATEWAY_SSH_KNOWN_HOSTS" > /etc/ssh/forge-gateway/known_hosts
+    cat > /etc/ssh/ssh_config.d/forge-gateway.conf <<'EOF'
+Host gateway
+    IdentityFile /etc/ssh/forge-gateway/id_ed25519
+    IdentitiesOnly yes
+    UserKnownHostsFile /etc/ssh/forge-gateway/known_hosts
+    StrictHostKeyChecking yes
+EOF
+fi
+
 exec runuser -u user -- "$@"
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // ContainerConfig holds all Claude Code configuration needed for the agent container.
@@ -42,9 +43,12 @@ type Options struct {
 	AuthType  string // "api_key" or "oauth"
 
 	// Project
-	ProjectID string // Project identifier (e.g. "-work")
-	Owner     string // GitHub repo owner
-	Repo      string // GitHub repo name
+	ProjectID  string            // Project identifier (e.g. "-work")
+	Host       string            // Forge host of the repo (default "github.com")
+	ExtraHosts []string          // Further forge hosts fetched through the gateway
+	HostURLs   map[string]string // Base URLs of hosts not served at https://<host>
+	Owner      string            // GitHub repo owner
+	Repo       string            // GitHub repo name
 
 	// Git identity (from host git config)
 	GitUserName  string
@@ -230,18 +234,32 @@ func buildMounts(opts Options) []MountConfig {
 
 // generateGitconfig produces gitconfig content that routes GitHub traffic
 // through the gateway reverse proxy and sets the git user identity.
-// Uses url.insteadOf to rewrite https://github.com/ URLs to plain HTTP
-// requests to the gateway, avoiding CONNECT tunneling.
+// Uses url.insteadOf to rewrite URLs of the project host (https://github.com/
+// by default) to the gateway's GitHub Enterprise compatible HTTPS endpoint,
+// avoiding CONNECT tunneling. Remotes then point at the same host as GH_HOST,
+// so gh recognizes them. URLs of extra hosts are rewritten to the gateway's
+// git proxy, which routes them by host. SSH URLs of every host, such as
+// git@github.com:owner/repo.git, are rewritten to the gateway's SSH server,
+// which routes them by host the same way.
 //
 // worktree.useRelativePaths makes git worktree add (including the one Claude
 // Code runs for --worktree) emit a .git file whose gitdir is relative — so the
 // worktree resolves correctly both at /work in the container and at the host
 // project path. Requires git 2.48+ in the agent image.
 func generateGitconfig(opts Options) string {
-	return fmt.Sprintf(`[url "http://gateway:8080/github.com/"]
-    insteadOf = https://github.com/
+	host := opts.Host
+	if host == "" {
+		host = "github.com"
+	}
+	var urls strings.Builder
+	writeGitconfigURL(&urls, "https://gateway/", host, opts.HostURLs[host])
+	writeGitconfigSSHURL(&urls, host)
+	for _, extra := range opts.ExtraHosts {
+		writeGitconfigURL(&urls, "https://gateway:8080/"+extra+"/", extra, opts.HostURLs[extra])
+		writeGitconfigSSHURL(&urls, extra)
+	}
 
-[user]
+	return urls.String() + fmt.Sprintf(`[user]
     name = %s
     email = %s
 
@@ -250,6 +268,22 @@ func generateGitconfig(opts Options) string {
 `, opts.GitUserName, opts.GitUserEmail)
 }
 
+// writeGitconfigURL writes a url section rewriting https://<host>/, and
+// baseURL if the host is served elsewhere, to gatewayURL.
+func writeGitconfigURL(w *strings.Builder, gatewayURL, host, baseURL string) {
+	fmt.Fprintf(w, "[url \"%s\"]\n    insteadOf = https://%s/\n", gatewayURL, host)
+	if baseURL != "" {
+		fmt.Fprintf(w, "    insteadOf = %s/\n", strings.TrimSuffix(baseURL, "/"))
+	}
+	w.WriteString("\n")
+}
+
+// writeGitconfigSSHURL writes a url section rewriting the SSH URLs of host,
+// in both the scp-like and the ssh:// syntax, to the gateway's SSH server.
+func writeGitconfigSSHURL(w *strings.Builder, host string) {
+	fmt.Fprintf(w, "[url \"ssh://git@gateway:2222/%s/\"]\n    insteadOf = git@%s:\n    insteadOf = ssh://git@%s/\n\n", host, host, host)
+}
+
 // WriteGitconfig writes the generated gitconfig to the config directory.
 // Creates the config directory if it doesn't exist.
 func WriteGitconfig(configDir string, opts Options) error {
@@ -329,6 +363,53 @@ func EnsureUserConfig(configDir, homeDir string) error {
 	return nil
 }
 
+// MCPServerName is the name the gateway's MCP server is registered under, so
+// its tools appear to Claude Code as mcp__github__<operation>.
+const MCPServerName = "github"
+
+// gatewayMCPURL is the gateway's MCP endpoint on the session network.
+const gatewayMCPURL = "https://gateway:8083/mcp"
+
+// gatewayMCPAuthorization authenticates to the gateway with the session
+// token, which Claude Code expands from the agent's environment.
+const gatewayMCPAuthorization = "Bearer ${FORGE_GATEWAY_TOKEN}"
+
+// RegisterMCPServer adds the gateway's MCP server to .claude.json in the
+// config directory, keeping the rest of the file. EnsureUserConfig must have
+// created the file. The file is shared by sessions, so it refers to the
+// session token by its environment variable.
+func RegisterMCPServer(configDir string) error {
+	configPath := filepath.Join(configDir, ".claude.json")
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read .claude.json: %w", err)
+	}
+
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse .claude.json: %w", err)
+	}
+	servers, _ := config["mcpServers"].(map[string]any)
+	if servers == nil {
+		servers = map[string]any{}
+	}
+	servers[MCPServerName] = map[string]any{
+		"type":    "http",
+		"url":     gatewayMCPURL,
+		"headers": map[string]any{"Authorization": gatewayMCPAuthorization},
+	}
+	config["mcpServers"] = servers
+
+	data, err = json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal .claude.json: %w", err)
+	}
+	if err := os.WriteFile(configPath, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write .claude.json: %w", err)
+	}
+	return nil
+}
+
 // readHostTheme reads the theme from the host's ~/.claude.json.
 // Returns "dark" as the default if the file doesn't exist or can't be parsed.
 func readHostTheme(homeDir string) string {
@@ -1,6 +1,7 @@
 package claudecode
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
@@ -334,8 +335,9 @@ func TestGenerateGitconfig(t *testing.T) {
 
 	result := generateGitconfig(opts)
 
-	assert.Contains(t, result, `[url "http://gateway:8080/github.com/"]`)
+	assert.Contains(t, result, `[url "https://gateway/"]`)
 	assert.Contains(t, result, `insteadOf = https://github.com/`)
+	assert.Contains(t, result, "[url \"ssh://git@gateway:2222/github.com/\"]\n    insteadOf = git@github.com:\n    insteadOf = ssh://git@github.com/\n")
 	assert.Contains(t, result, `[user]`)
 	assert.Contains(t, result, `name = Jane Doe`)
 	assert.Contains(t, result, `email = jane@example.com`)
@@ -343,6 +345,22 @@ func TestGenerateGitconfig(t *testing.T) {
 	assert.Contains(t, result, `useRelativePaths = true`)
 }
 
+func TestGenerateGitconfig_Hosts(t *testing.T) {
+	opts := Options{
+		Host:       "github.example.com",
+		ExtraHosts: []string{"github.com", "gitea"},
+		HostURLs:   map[string]string{"gitea": "http://gitea:3000/"},
+	}
+
+	result := generateGitconfig(opts)
+
+	assert.Contains(t, result, "[url \"https://gateway/\"]\n    insteadOf = https://github.example.com/\n")
+	assert.Contains(t, result, "[url \"https://gateway:8080/github.com/\"]\n    insteadOf = https://github.com/\n")
+	assert.Contains(t, result, "[url \"https://gateway:8080/gitea/\"]\n    insteadOf = https://gitea/\n    insteadOf = http://gitea:3000/\n")
+	assert.Contains(t, result, "[url \"ssh://git@gateway:2222/github.example.com/\"]\n    insteadOf = git@github.example.com:\n    insteadOf = ssh://git@github.example.com/\n")
+	assert.Contains(t, result, "[url \"ssh://git@gateway:2222/gitea/\"]\n    insteadOf = git@gitea:\n    insteadOf = ssh://git@gitea/\n")
+}
+
 func TestGenerateGitconfig_EmptyUserInfo(t *testing.T) {
 	opts := Options{}
 
@@ -566,6 +584,77 @@ func TestEnsureUserConfig(t *testing.T) {
 	})
 }
 
+func TestRegisterMCPServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		want     map[string]any
+		wantErr  string
+	}{
+		{
+			name:     "adds the gateway server",
+			existing: `{"theme": "dark"}`,
+			want: map[string]any{
+				"theme": "dark",
+				"mcpServers": map[string]any{
+					"github": map[string]any{
+						"type":    "http",
+						"url":     "https://gateway:8083/mcp",
+						"headers": map[string]any{"Authorization": "Bearer ${FORGE_GATEWAY_TOKEN}"},
+					},
+				},
+			},
+		},
+		{
+			name:     "keeps other servers and replaces a stale entry",
+			existing: `{"mcpServers": {"docs": {"type": "http", "url": "http://docs"}, "github": {"type": "stdio", "command": "gh"}}}`,
+			want: map[string]any{
+				"mcpServers": map[string]any{
+					"docs": map[string]any{"type": "http", "url": "http://docs"},
+					"github": map[string]any{
+						"type":    "http",
+						"url":     "https://gateway:8083/mcp",
+						"headers": map[string]any{"Authorization": "Bearer ${FORGE_GATEWAY_TOKEN}"},
+					},
+				},
+			},
+		},
+		{
+			name:     "invalid JSON",
+			existing: `{invalid`,
+			wantErr:  "failed to parse .claude.json",
+		},
+		{
+			name:    "missing file",
+			wantErr: "failed to read .claude.json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configDir := t.TempDir()
+			configPath := filepath.Join(configDir, ".claude.json")
+			if tt.existing != "" {
+				require.NoError(t, os.WriteFile(configPath, []byte(tt.existing), 0o644))
+			}
+
+			err := RegisterMCPServer(configDir)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(configPath)
+			require.NoError(t, err)
+			var got map[string]any
+			require.NoError(t, json.Unmarshal(data, &got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestBuildEnv_UIDGIDEnvVars(t *testing.T) {
 	tests := []struct {
 		name       string
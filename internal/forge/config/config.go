@@ -18,8 +18,38 @@ const (
 
 // Config holds the claude-forge configuration.
 type Config struct {
-	Images   ImagesConfig   `yaml:"images"`
-	Defaults DefaultsConfig `yaml:"defaults"`
+	Images    ImagesConfig    `yaml:"images"`
+	Defaults  DefaultsConfig  `yaml:"defaults"`
+	GitHubApp GitHubAppConfig `yaml:"github_app"`
+	// Hosts lists further forge hosts, besides the project's own, that the
+	// agent can fetch from through the gateway, e.g. github.com when the
+	// project lives on GitHub Enterprise Server.
+	Hosts []string `yaml:"hosts"`
+	// Forges selects the forge of hosts, keyed by host, for hosts that are
+	// not on their default forge: GitHub, or GitLab for gitlab.com and
+	// Gitea for gitea.com and codeberg.org.
+	Forges map[string]ForgeConfig `yaml:"forges"`
+	Cache  CacheConfig            `yaml:"cache"`
+}
+
+// CacheConfig configures the gateway cache, which the sessions of a project
+// share. It is enabled when Enabled is set or Mirror is not empty.
+type CacheConfig struct {
+	// Enabled caches API responses, which the gateway revalidates with
+	// conditional requests.
+	Enabled bool `yaml:"enabled"`
+	// Mirror lists repositories, as owner/repo or host/owner/repo patterns,
+	// whose clones and fetches are served from a local mirror.
+	Mirror []string `yaml:"mirror"`
+}
+
+// ForgeConfig describes the forge of a host.
+type ForgeConfig struct {
+	// Type is "github", "gitlab", or "gitea".
+	Type string `yaml:"type"`
+	// URL is the base URL of the host when it is not https://<host>,
+	// such as http://gitea.internal:3000.
+	URL string `yaml:"url"`
 }
 
 // ImagesConfig holds Docker image configuration.
@@ -34,6 +64,17 @@ type DefaultsConfig struct {
 	Worktree        bool `yaml:"worktree"`
 }
 
+// GitHubAppConfig configures the gateway to authenticate as a GitHub App
+// instead of with the user's token. It is enabled when AppID is set.
+type GitHubAppConfig struct {
+	AppID int64 `yaml:"app_id"`
+	// InstallationID is optional; the gateway looks it up from the project repository.
+	InstallationID int64 `yaml:"installation_id"`
+	// PrivateKeyPath is the app's private key file. Relative paths are
+	// relative to the config directory.
+	PrivateKeyPath string `yaml:"private_key_path"`
+}
+
 // DefaultConfig returns a Config with all defaults applied.
 func DefaultConfig() *Config {
 	return &Config{
@@ -46,6 +46,74 @@ defaults:
 				},
 			},
 		},
+		{
+			name: "GitHub App",
+			configYAML: `github_app:
+  app_id: 123
+  installation_id: 456
+  private_key_path: /keys/app.pem
+`,
+			want: &Config{
+				Images: ImagesConfig{
+					Agent:   DefaultAgentImage,
+					Gateway: DefaultGatewayImage,
+				},
+				GitHubApp: GitHubAppConfig{
+					AppID:          123,
+					InstallationID: 456,
+					PrivateKeyPath: "/keys/app.pem",
+				},
+			},
+		},
+		{
+			name: "extra hosts",
+			configYAML: `hosts:
+  - github.com
+  - github.example.com
+`,
+			want: &Config{
+				Images: ImagesConfig{
+					Agent:   DefaultAgentImage,
+					Gateway: DefaultGatewayImage,
+				},
+				Hosts: []string{"github.com", "github.example.com"},
+			},
+		},
+		{
+			name: "forges",
+			configYAML: `forges:
+  git.example.com:
+    type: gitea
+    url: http://git.example.com:3000
+  gitlab.example.com:
+    type: gitlab
+`,
+			want: &Config{
+				Images: ImagesConfig{
+					Agent:   DefaultAgentImage,
+					Gateway: DefaultGatewayImage,
+				},
+				Forges: map[string]ForgeConfig{
+					"git.example.com":    {Type: "gitea", URL: "http://git.example.com:3000"},
+					"gitlab.example.com": {Type: "gitlab"},
+				},
+			},
+		},
+		{
+			name: "cache",
+			configYAML: `cache:
+  enabled: true
+  mirror:
+    - my-org/*
+`,
+			want: &Config{
+				Images: ImagesConfig{
+					Agent:   DefaultAgentImage,
+					Gateway: DefaultGatewayImage,
+				},
+				Cache: CacheConfig{Enabled: true, Mirror: []string{"my-org/*"}},
+			},
+		},
 		{
 			name: "partial config fills defaults for images",
 			configYAML: `defaults:
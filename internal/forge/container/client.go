@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -49,6 +51,7 @@ type DockerAPI interface {
 	ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error)
 	NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error)
 	NetworkRemove(ctx context.Context, networkID string) error
+	NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error
 	ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error)
 	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
 	Close() error
@@ -97,6 +100,10 @@ func (w *dockerAPIWrapper) NetworkRemove(ctx context.Context, networkID string)
 	return w.client.NetworkRemove(ctx, networkID)
 }
 
+func (w *dockerAPIWrapper) NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error {
+	return w.client.NetworkConnect(ctx, networkID, containerID, config)
+}
+
 func (w *dockerAPIWrapper) ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error) {
 	return w.client.ImagePull(ctx, refStr, options)
 }
@@ -136,10 +143,13 @@ func (c *Client) Close() error {
 	return c.docker.Close()
 }
 
-// CreateNetwork creates a Docker network with the given name.
+// CreateNetwork creates an internal Docker network with the given name.
+// Containers on it can only reach each other; the gateway is also connected
+// to the default bridge network to reach the outside.
 func (c *Client) CreateNetwork(ctx context.Context, name string) (string, error) {
 	resp, err := c.docker.NetworkCreate(ctx, name, network.CreateOptions{
-		Driver: "bridge",
+		Driver:   "bridge",
+		Internal: true,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to create network %s: %w", name, err)
@@ -340,15 +350,86 @@ func (c *Client) StartAgent(ctx context.Context, opts AgentOptions) (string, err
 
 // GatewayOptions holds configuration for starting a gateway container.
 type GatewayOptions struct {
-	Name        string // container name: forge-gateway-<project-id>-<session-id>
-	Image       string
-	NetworkName string
-	SSHDir      string // host ~/.ssh/ (ro)
-	GHConfigDir string // host ~/.config/gh/ (ro)
-	Owner       string // allowed repo owner
-	Repo        string // allowed repo name
-	Env         map[string]string
-}
+	Name           string // container name: forge-gateway-<project-id>-<session-id>
+	Image          string
+	NetworkName    string
+	SSHDir         string                  // host ~/.ssh/ (ro)
+	GHConfigDir    string                  // host ~/.config/gh/ (ro)
+	Host           string                  // forge host of the allowed repo, optional (default github.com)
+	ExtraHosts     []string                // further forge hosts git requests can be proxied to
+	Forges         map[string]GatewayForge // forges of hosts not on their default forge, keyed by host
+	Owner          string                  // allowed repo owner
+	Repo           string                  // allowed repo name
+	ReadRepos      []string                // further repos readable under a restricted read policy, as host/owner/repo
+	PolicyFile     string                  // host gateway policy file (ro), optional
+	TLSCert        string                  // PEM certificate for the gateway's HTTPS listeners, optional
+	TLSKeyFile     string                  // host file holding the PEM private key for TLSCert (ro), mode 0600
+	AppKeyFile     string                  // host file holding the GitHub App private key (ro), mode 0600, optional
+	AuthToken      string                  // token clients must present to the gateway, optional
+	SSHHostKeyFile string                  // host file holding the OpenSSH private host key for the gateway's SSH server (ro), mode 0600, optional
+	SSHClientKey   string                  // public key, in the authorized_keys format, clients of the SSH server authenticate with
+	LogDir         string                  // host directory the audit log is written to (rw), optional
+	CacheDir       string                  // host directory API responses and mirrors are cached in (rw), optional
+	Mirrors        []string                // repo patterns whose fetches are served from a mirror in CacheDir
+	RateLimitDir   string                  // host directory rate limit state is shared through (rw), optional
+	SessionID      string                  // session ID recorded in the audit log
+	UID            int                     // host user UID the gateway runs as, so it can write to LogDir
+	GID            int                     // host user GID
+	Env            map[string]string
+}
+
+// GatewayForge selects the forge of a host in the gateway.
+type GatewayForge struct {
+	Type string // "github", "gitlab", or "gitea"; empty for the host's default
+	URL  string // base URL of the host, if not https://<host>
+}
+
+// gatewayTLSKeyPath is where the gateway's TLS private key is mounted in the
+// gateway container. The key is passed as a file rather than in the
+// environment, which docker inspect shows.
+const gatewayTLSKeyPath = "/run/secrets/gateway-tls.key"
+
+// gatewaySSHHostKeyPath is where the host key of the gateway's SSH server is
+// mounted in the gateway container.
+const gatewaySSHHostKeyPath = "/run/secrets/gateway-ssh-host.key"
+
+// gatewayAppKeyPath is where the GitHub App private key is mounted in the
+// gateway container.
+const gatewayAppKeyPath = "/run/secrets/github-app.key"
+
+// gatewayPolicyPath is where the gateway policy file is mounted in the gateway container.
+const gatewayPolicyPath = "/home/user/.config/claude-forge/gateway-policy.yaml"
+
+// gatewayLogDir is where the host log directory is mounted in the gateway container.
+const gatewayLogDir = "/var/log/claude-forge"
+
+// gatewayCacheDir is where the host cache directory is mounted in the gateway container.
+const gatewayCacheDir = "/var/cache/claude-forge"
+
+// gatewayRateLimitDir is where the host rate limit directory is mounted in the gateway container.
+const gatewayRateLimitDir = "/var/lib/claude-forge/ratelimit"
+
+// GatewayAuditLogFile is the name of the gateway's audit log in its log directory.
+const GatewayAuditLogFile = "gateway.jsonl"
+
+// GatewayApprovalsDir is the name of the directory in the gateway's log
+// directory that requests waiting for approval are parked in.
+const GatewayApprovalsDir = "approvals"
+
+// GatewayHost is the gateway's host name on the session network.
+const GatewayHost = "gateway"
+
+// GatewayEgressPort is the port of the gateway's egress proxy, which the
+// agent's HTTP_PROXY and HTTPS_PROXY point at.
+const GatewayEgressPort = 3128
+
+// GatewaySSHPort is the port of the gateway's SSH server, which the
+// agent's gitconfig points SSH remotes at.
+const GatewaySSHPort = 2222
+
+// externalNetwork is the Docker network the gateway reaches the outside
+// through.
+const externalNetwork = "bridge"
 
 // StartGateway creates and starts a gateway container.
 func (c *Client) StartGateway(ctx context.Context, opts GatewayOptions) (string, error) {
@@ -377,20 +458,144 @@ func (c *Client) StartGateway(ctx context.Context, opts GatewayOptions) (string,
 		})
 	}
 
-	containerConfig := &container.Config{
-		Image: opts.Image,
-		Env:   env,
-		Cmd:   []string{"gateway", fmt.Sprintf("--owner=%s", opts.Owner), fmt.Sprintf("--repo=%s", opts.Repo)},
+	cmd := []string{
+		"gateway",
+		fmt.Sprintf("--owner=%s", opts.Owner),
+		fmt.Sprintf("--repo=%s", opts.Repo),
+		fmt.Sprintf("--egress-addr=:%d", GatewayEgressPort),
+	}
+	if opts.Host != "" {
+		cmd = append(cmd, fmt.Sprintf("--host=%s", opts.Host))
+	}
+	for _, host := range opts.ExtraHosts {
+		cmd = append(cmd, fmt.Sprintf("--extra-host=%s", host))
+	}
+	for _, repo := range opts.ReadRepos {
+		cmd = append(cmd, fmt.Sprintf("--read-allow=%s", repo))
+	}
+	for _, host := range slices.Sorted(maps.Keys(opts.Forges)) {
+		forge := opts.Forges[host]
+		if forge.Type != "" {
+			cmd = append(cmd, fmt.Sprintf("--forge=%s=%s", host, forge.Type))
+		}
+		if forge.URL != "" {
+			cmd = append(cmd, fmt.Sprintf("--forge-url=%s=%s", host, forge.URL))
+		}
+	}
+
+	if opts.PolicyFile != "" {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   opts.PolicyFile,
+			Target:   gatewayPolicyPath,
+			ReadOnly: true,
+		})
+		cmd = append(cmd, fmt.Sprintf("--policy=%s", gatewayPolicyPath))
+	}
+
+	if opts.LogDir != "" {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: opts.LogDir,
+			Target: gatewayLogDir,
+		})
+		cmd = append(cmd,
+			fmt.Sprintf("--audit-log=%s/%s", gatewayLogDir, GatewayAuditLogFile),
+			fmt.Sprintf("--session=%s", opts.SessionID),
+			fmt.Sprintf("--approvals-dir=%s/%s", gatewayLogDir, GatewayApprovalsDir),
+		)
+	}
+
+	if opts.CacheDir != "" {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: opts.CacheDir,
+			Target: gatewayCacheDir,
+		})
+		cmd = append(cmd, fmt.Sprintf("--cache-dir=%s", gatewayCacheDir))
+		for _, pattern := range opts.Mirrors {
+			cmd = append(cmd, fmt.Sprintf("--mirror=%s", pattern))
+		}
+	}
+
+	if opts.RateLimitDir != "" {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: opts.RateLimitDir,
+			Target: gatewayRateLimitDir,
+		})
+		cmd = append(cmd, fmt.Sprintf("--rate-limit-dir=%s", gatewayRateLimitDir))
 	}
 
 	hostConfig := &container.HostConfig{
 		Mounts: mounts,
 	}
 
+	containerConfig := &container.Config{
+		Image: opts.Image,
+		Cmd:   cmd,
+	}
+
+	// With a certificate, every listener serves HTTPS. Serve the GitHub
+	// Enterprise endpoint on the default port so gh can use the plain host
+	// name as GH_HOST. The gateway runs as a non-root user, so allow it to
+	// bind privileged ports. The image's health check probes plain HTTP, so
+	// probe HTTPS instead; the certificate is not issued for localhost.
+	if opts.TLSCert != "" {
+		env = append(env, "GATEWAY_TLS_CERT="+opts.TLSCert)
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   opts.TLSKeyFile,
+			Target:   gatewayTLSKeyPath,
+			ReadOnly: true,
+		})
+		containerConfig.Cmd = append(containerConfig.Cmd, "--tls-addr=:443", "--tls-key-file="+gatewayTLSKeyPath)
+		hostConfig.Sysctls = map[string]string{"net.ipv4.ip_unprivileged_port_start": "0"}
+		containerConfig.Healthcheck = &container.HealthConfig{
+			Test:          []string{"CMD-SHELL", "wget -qO- --no-check-certificate https://localhost:8083/readyz || exit 1"},
+			Interval:      10 * time.Second,
+			Timeout:       5 * time.Second,
+			StartPeriod:   30 * time.Second,
+			StartInterval: time.Second,
+			Retries:       3,
+		}
+	}
+	if opts.AppKeyFile != "" {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   opts.AppKeyFile,
+			Target:   gatewayAppKeyPath,
+			ReadOnly: true,
+		})
+		containerConfig.Cmd = append(containerConfig.Cmd, "--app-key-file="+gatewayAppKeyPath)
+	}
+	if opts.AuthToken != "" {
+		env = append(env, "GATEWAY_AUTH_TOKEN="+opts.AuthToken)
+	}
+	if opts.SSHHostKeyFile != "" {
+		env = append(env, "GATEWAY_SSH_AUTHORIZED_KEY="+opts.SSHClientKey)
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   opts.SSHHostKeyFile,
+			Target:   gatewaySSHHostKeyPath,
+			ReadOnly: true,
+		})
+		containerConfig.Cmd = append(containerConfig.Cmd, fmt.Sprintf("--ssh-addr=:%d", GatewaySSHPort), "--ssh-host-key-file="+gatewaySSHHostKeyPath)
+	}
+	containerConfig.Env = env
+
+	// Run as the host user so files written to the mounted log directory
+	// are owned by them. The user has no passwd entry, so set HOME to where
+	// the gh config is mounted.
+	if opts.UID > 0 {
+		containerConfig.User = fmt.Sprintf("%d:%d", opts.UID, opts.GID)
+		containerConfig.Env = append(containerConfig.Env, "HOME=/home/user")
+	}
+
 	networkingConfig := &network.NetworkingConfig{
 		EndpointsConfig: map[string]*network.EndpointSettings{
 			opts.NetworkName: {
-				Aliases: []string{"gateway"},
+				Aliases: []string{GatewayHost},
 			},
 		},
 	}
@@ -400,6 +605,12 @@ func (c *Client) StartGateway(ctx context.Context, opts GatewayOptions) (string,
 		return "", fmt.Errorf("failed to create gateway container: %w", err)
 	}
 
+	// The session network is internal, so the gateway needs a second network
+	// to reach forges and the destinations its egress proxy allows.
+	if err := c.docker.NetworkConnect(ctx, externalNetwork, resp.ID, nil); err != nil {
+		return "", fmt.Errorf("failed to connect gateway container to the %s network: %w", externalNetwork, err)
+	}
+
 	if err := c.docker.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		return "", fmt.Errorf("failed to start gateway container: %w", err)
 	}
@@ -407,10 +618,12 @@ func (c *Client) StartGateway(ctx context.Context, opts GatewayOptions) (string,
 	return resp.ID, nil
 }
 
-// WaitForReady polls the container state until it is running or exits.
-// After the container first appears running, it re-checks after a short
-// stabilization delay to catch processes that crash immediately on startup.
-// Returns an error if the container exits before the timeout.
+// WaitForReady polls the container state until it is ready or exits. A
+// container whose image has a health check is ready once it is healthy.
+// Otherwise, after the container first appears running, it re-checks after a
+// short stabilization delay to catch processes that crash immediately on
+// startup. Returns an error if the container exits or becomes unhealthy
+// before the timeout.
 func (c *Client) WaitForReady(ctx context.Context, containerID string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	pollInterval := 200 * time.Millisecond
@@ -423,7 +636,17 @@ func (c *Client) WaitForReady(ctx context.Context, containerID string, timeout t
 		}
 
 		if info.State != nil {
-			if info.State.Running {
+			if info.State.Status == "exited" || info.State.Status == "dead" {
+				return fmt.Errorf("container %s exited with code %d", containerID, info.State.ExitCode)
+			}
+			if health := info.State.Health; health != nil && health.Status != container.NoHealthcheck {
+				switch health.Status {
+				case container.Healthy:
+					return nil
+				case container.Unhealthy:
+					return fmt.Errorf("container %s is unhealthy%s", containerID, lastHealthcheckOutput(health))
+				}
+			} else if info.State.Running {
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
@@ -438,9 +661,6 @@ func (c *Client) WaitForReady(ctx context.Context, containerID string, timeout t
 				}
 				return nil
 			}
-			if info.State.Status == "exited" || info.State.Status == "dead" {
-				return fmt.Errorf("container %s exited with code %d", containerID, info.State.ExitCode)
-			}
 		}
 
 		select {
@@ -453,6 +673,19 @@ func (c *Client) WaitForReady(ctx context.Context, containerID string, timeout t
 	return fmt.Errorf("timed out waiting for container %s to be ready", containerID)
 }
 
+// lastHealthcheckOutput returns the output of the container's last health
+// check as an error message suffix, if there is any.
+func lastHealthcheckOutput(health *container.Health) string {
+	if len(health.Log) == 0 {
+		return ""
+	}
+	output := strings.TrimSpace(health.Log[len(health.Log)-1].Output)
+	if output == "" {
+		return ""
+	}
+	return ": " + output
+}
+
 // ContainerLogs returns the stdout/stderr logs from a container.
 func (c *Client) ContainerLogs(ctx context.Context, containerID string) (string, error) {
 	reader, err := c.docker.ContainerLogs(ctx, containerID, container.LogsOptions{
@@ -13,6 +13,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -33,7 +34,7 @@ func TestCreateNetwork(t *testing.T) {
 			networkName: "forge_net",
 			setupMock: func(m *MockDockerAPI) {
 				m.EXPECT().
-					NetworkCreate(gomock.Any(), "forge_net", network.CreateOptions{Driver: "bridge"}).
+					NetworkCreate(gomock.Any(), "forge_net", network.CreateOptions{Driver: "bridge", Internal: true}).
 					Return(network.CreateResponse{ID: "net-123"}, nil)
 			},
 			wantID: "net-123",
@@ -43,7 +44,7 @@ func TestCreateNetwork(t *testing.T) {
 			networkName: "forge_net",
 			setupMock: func(m *MockDockerAPI) {
 				m.EXPECT().
-					NetworkCreate(gomock.Any(), "forge_net", network.CreateOptions{Driver: "bridge"}).
+					NetworkCreate(gomock.Any(), "forge_net", network.CreateOptions{Driver: "bridge", Internal: true}).
 					Return(network.CreateResponse{}, fmt.Errorf("network already exists"))
 			},
 			wantErr:     true,
@@ -778,7 +779,7 @@ func TestStartGateway(t *testing.T) {
 					).
 					DoAndReturn(func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
 						assert.Equal(t, "gateway:latest", config.Image)
-						assert.Equal(t, []string{"gateway", "--owner=michael-freling", "--repo=claude-code-tools"}, []string(config.Cmd))
+						assert.Equal(t, []string{"gateway", "--owner=michael-freling", "--repo=claude-code-tools", "--egress-addr=:3128"}, []string(config.Cmd))
 						assert.Contains(t, netConfig.EndpointsConfig, "forge_net")
 
 						// Check SSH mount
@@ -797,12 +798,317 @@ func TestStartGateway(t *testing.T) {
 
 						return container.CreateResponse{ID: "gw-123"}, nil
 					})
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-123", nil).
+					Return(nil)
 				m.EXPECT().
 					ContainerStart(gomock.Any(), "gw-123", container.StartOptions{}).
 					Return(nil)
 			},
 			wantID: "gw-123",
 		},
+		{
+			name: "mounts policy file and passes it to the gateway",
+			opts: GatewayOptions{
+				Name:        "forge-gateway-test",
+				Image:       "gateway:latest",
+				NetworkName: "forge_net",
+				Owner:       "owner",
+				Repo:        "repo",
+				PolicyFile:  "/home/user/.config/claude-forge/gateway-policy.yaml",
+			},
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "forge-gateway-test").
+					DoAndReturn(func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
+						assert.Equal(t, []string{
+							"gateway", "--owner=owner", "--repo=repo", "--egress-addr=:3128",
+							"--policy=/home/user/.config/claude-forge/gateway-policy.yaml",
+						}, []string(config.Cmd))
+						assert.Contains(t, hostConfig.Mounts, mount.Mount{
+							Type:     mount.TypeBind,
+							Source:   "/home/user/.config/claude-forge/gateway-policy.yaml",
+							Target:   "/home/user/.config/claude-forge/gateway-policy.yaml",
+							ReadOnly: true,
+						})
+						return container.CreateResponse{ID: "gw-456"}, nil
+					})
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-456", nil).
+					Return(nil)
+				m.EXPECT().
+					ContainerStart(gomock.Any(), "gw-456", container.StartOptions{}).
+					Return(nil)
+			},
+			wantID: "gw-456",
+		},
+		{
+			name: "with TLS certificate",
+			opts: GatewayOptions{
+				Name:        "forge-gateway-test",
+				Image:       "gateway:latest",
+				NetworkName: "forge_net",
+				Owner:       "owner",
+				Repo:        "repo",
+				TLSCert:     "cert-pem",
+				TLSKeyFile:  "/home/user/.claude-forge/secrets/test/tls.key",
+				AuthToken:   "session-token",
+			},
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "forge-gateway-test").
+					DoAndReturn(func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
+						assert.Equal(t, []string{
+							"gateway", "--owner=owner", "--repo=repo", "--egress-addr=:3128", "--tls-addr=:443", "--tls-key-file=/run/secrets/gateway-tls.key",
+						}, []string(config.Cmd))
+						assert.Contains(t, config.Env, "GATEWAY_TLS_CERT=cert-pem")
+						for _, env := range config.Env {
+							assert.NotContains(t, env, "GATEWAY_TLS_KEY")
+						}
+						assert.Contains(t, hostConfig.Mounts, mount.Mount{
+							Type:     mount.TypeBind,
+							Source:   "/home/user/.claude-forge/secrets/test/tls.key",
+							Target:   "/run/secrets/gateway-tls.key",
+							ReadOnly: true,
+						})
+						assert.Contains(t, config.Env, "GATEWAY_AUTH_TOKEN=session-token")
+						assert.Equal(t, map[string]string{"net.ipv4.ip_unprivileged_port_start": "0"}, hostConfig.Sysctls)
+						require.NotNil(t, config.Healthcheck)
+						assert.Equal(t, []string{"CMD-SHELL", "wget -qO- --no-check-certificate https://localhost:8083/readyz || exit 1"}, config.Healthcheck.Test)
+						return container.CreateResponse{ID: "gw-789"}, nil
+					})
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-789", nil).
+					Return(nil)
+				m.EXPECT().
+					ContainerStart(gomock.Any(), "gw-789", container.StartOptions{}).
+					Return(nil)
+			},
+			wantID: "gw-789",
+		},
+		{
+			name: "with GitHub App private key",
+			opts: GatewayOptions{
+				Name:        "forge-gateway-test",
+				Image:       "gateway:latest",
+				NetworkName: "forge_net",
+				Owner:       "owner",
+				Repo:        "repo",
+				AppKeyFile:  "/home/user/.claude-forge/secrets/test/github-app.key",
+				Env:         map[string]string{"GITHUB_APP_ID": "123"},
+			},
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "forge-gateway-test").
+					DoAndReturn(func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
+						assert.Equal(t, []string{
+							"gateway", "--owner=owner", "--repo=repo", "--egress-addr=:3128", "--app-key-file=/run/secrets/github-app.key",
+						}, []string(config.Cmd))
+						assert.Contains(t, config.Env, "GITHUB_APP_ID=123")
+						assert.Contains(t, hostConfig.Mounts, mount.Mount{
+							Type:     mount.TypeBind,
+							Source:   "/home/user/.claude-forge/secrets/test/github-app.key",
+							Target:   "/run/secrets/github-app.key",
+							ReadOnly: true,
+						})
+						return container.CreateResponse{ID: "gw-app"}, nil
+					})
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-app", nil).
+					Return(nil)
+				m.EXPECT().
+					ContainerStart(gomock.Any(), "gw-app", container.StartOptions{}).
+					Return(nil)
+			},
+			wantID: "gw-app",
+		},
+		{
+			name: "with SSH keys",
+			opts: GatewayOptions{
+				Name:           "forge-gateway-test",
+				Image:          "gateway:latest",
+				NetworkName:    "forge_net",
+				Owner:          "owner",
+				Repo:           "repo",
+				SSHHostKeyFile: "/home/user/.claude-forge/secrets/test/ssh_host_key",
+				SSHClientKey:   "ssh-ed25519 AAAA",
+			},
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "forge-gateway-test").
+					DoAndReturn(func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
+						assert.Equal(t, []string{
+							"gateway", "--owner=owner", "--repo=repo", "--egress-addr=:3128", "--ssh-addr=:2222", "--ssh-host-key-file=/run/secrets/gateway-ssh-host.key",
+						}, []string(config.Cmd))
+						for _, env := range config.Env {
+							assert.NotContains(t, env, "GATEWAY_SSH_HOST_KEY")
+						}
+						assert.Contains(t, hostConfig.Mounts, mount.Mount{
+							Type:     mount.TypeBind,
+							Source:   "/home/user/.claude-forge/secrets/test/ssh_host_key",
+							Target:   "/run/secrets/gateway-ssh-host.key",
+							ReadOnly: true,
+						})
+						assert.Contains(t, config.Env, "GATEWAY_SSH_AUTHORIZED_KEY=ssh-ed25519 AAAA")
+						return container.CreateResponse{ID: "gw-ssh"}, nil
+					})
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-ssh", nil).
+					Return(nil)
+				m.EXPECT().
+					ContainerStart(gomock.Any(), "gw-ssh", container.StartOptions{}).
+					Return(nil)
+			},
+			wantID: "gw-ssh",
+		},
+		{
+			name: "with GitHub Enterprise Server host, extra hosts, and readable repos",
+			opts: GatewayOptions{
+				Name:        "forge-gateway-test",
+				Image:       "gateway:latest",
+				NetworkName: "forge_net",
+				Host:        "github.example.com",
+				ExtraHosts:  []string{"github.com", "gitea"},
+				Forges: map[string]GatewayForge{
+					"gitea":              {Type: "gitea", URL: "http://gitea:3000"},
+					"github.example.com": {Type: "github"},
+				},
+				Owner:     "owner",
+				Repo:      "repo",
+				ReadRepos: []string{"github.example.com/owner/lib"},
+			},
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "forge-gateway-test").
+					DoAndReturn(func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
+						assert.Equal(t, []string{
+							"gateway", "--owner=owner", "--repo=repo", "--egress-addr=:3128",
+							"--host=github.example.com", "--extra-host=github.com", "--extra-host=gitea",
+							"--read-allow=github.example.com/owner/lib",
+							"--forge=gitea=gitea", "--forge-url=gitea=http://gitea:3000",
+							"--forge=github.example.com=github",
+						}, []string(config.Cmd))
+						return container.CreateResponse{ID: "gw-ghes"}, nil
+					})
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-ghes", nil).
+					Return(nil)
+				m.EXPECT().
+					ContainerStart(gomock.Any(), "gw-ghes", container.StartOptions{}).
+					Return(nil)
+			},
+			wantID: "gw-ghes",
+		},
+		{
+			name: "with audit log directory as the host user",
+			opts: GatewayOptions{
+				Name:        "forge-gateway-test",
+				Image:       "gateway:latest",
+				NetworkName: "forge_net",
+				Owner:       "owner",
+				Repo:        "repo",
+				LogDir:      "/home/user/.claude-forge/logs/proj",
+				SessionID:   "abc12345",
+				UID:         1001,
+				GID:         1002,
+			},
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "forge-gateway-test").
+					DoAndReturn(func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
+						assert.Equal(t, []string{
+							"gateway", "--owner=owner", "--repo=repo", "--egress-addr=:3128",
+							"--audit-log=/var/log/claude-forge/gateway.jsonl", "--session=abc12345",
+							"--approvals-dir=/var/log/claude-forge/approvals",
+						}, []string(config.Cmd))
+						assert.Contains(t, hostConfig.Mounts, mount.Mount{
+							Type:   mount.TypeBind,
+							Source: "/home/user/.claude-forge/logs/proj",
+							Target: "/var/log/claude-forge",
+						})
+						assert.Equal(t, "1001:1002", config.User)
+						assert.Contains(t, config.Env, "HOME=/home/user")
+						return container.CreateResponse{ID: "gw-abc"}, nil
+					})
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-abc", nil).
+					Return(nil)
+				m.EXPECT().
+					ContainerStart(gomock.Any(), "gw-abc", container.StartOptions{}).
+					Return(nil)
+			},
+			wantID: "gw-abc",
+		},
+		{
+			name: "with cache directory and mirrors",
+			opts: GatewayOptions{
+				Name:        "forge-gateway-test",
+				Image:       "gateway:latest",
+				NetworkName: "forge_net",
+				Owner:       "owner",
+				Repo:        "repo",
+				CacheDir:    "/home/user/.claude-forge/cache/proj",
+				Mirrors:     []string{"owner/*", "github.com/golang/go"},
+			},
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "forge-gateway-test").
+					DoAndReturn(func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
+						assert.Equal(t, []string{
+							"gateway", "--owner=owner", "--repo=repo", "--egress-addr=:3128",
+							"--cache-dir=/var/cache/claude-forge",
+							"--mirror=owner/*", "--mirror=github.com/golang/go",
+						}, []string(config.Cmd))
+						assert.Contains(t, hostConfig.Mounts, mount.Mount{
+							Type:   mount.TypeBind,
+							Source: "/home/user/.claude-forge/cache/proj",
+							Target: "/var/cache/claude-forge",
+						})
+						return container.CreateResponse{ID: "gw-cache"}, nil
+					})
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-cache", nil).
+					Return(nil)
+				m.EXPECT().
+					ContainerStart(gomock.Any(), "gw-cache", container.StartOptions{}).
+					Return(nil)
+			},
+			wantID: "gw-cache",
+		},
+		{
+			name: "with rate limit directory",
+			opts: GatewayOptions{
+				Name:         "forge-gateway-test",
+				Image:        "gateway:latest",
+				NetworkName:  "forge_net",
+				Owner:        "owner",
+				Repo:         "repo",
+				RateLimitDir: "/home/user/.claude-forge/ratelimit",
+			},
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), "forge-gateway-test").
+					DoAndReturn(func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, name string) (container.CreateResponse, error) {
+						assert.Equal(t, []string{
+							"gateway", "--owner=owner", "--repo=repo", "--egress-addr=:3128",
+							"--rate-limit-dir=/var/lib/claude-forge/ratelimit",
+						}, []string(config.Cmd))
+						assert.Contains(t, hostConfig.Mounts, mount.Mount{
+							Type:   mount.TypeBind,
+							Source: "/home/user/.claude-forge/ratelimit",
+							Target: "/var/lib/claude-forge/ratelimit",
+						})
+						return container.CreateResponse{ID: "gw-rate"}, nil
+					})
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-rate", nil).
+					Return(nil)
+				m.EXPECT().
+					ContainerStart(gomock.Any(), "gw-rate", container.StartOptions{}).
+					Return(nil)
+			},
+			wantID: "gw-rate",
+		},
 		{
 			name: "fails when container create fails",
 			opts: GatewayOptions{
@@ -833,6 +1139,9 @@ func TestStartGateway(t *testing.T) {
 				m.EXPECT().
 					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(container.CreateResponse{ID: "gw-123"}, nil)
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-123", nil).
+					Return(nil)
 				m.EXPECT().
 					ContainerStart(gomock.Any(), "gw-123", container.StartOptions{}).
 					Return(fmt.Errorf("start failed"))
@@ -840,6 +1149,26 @@ func TestStartGateway(t *testing.T) {
 			wantErr:     true,
 			errContains: "failed to start gateway container",
 		},
+		{
+			name: "fails when connecting to the bridge network fails",
+			opts: GatewayOptions{
+				Name:        "forge-gateway-test",
+				Image:       "gateway:latest",
+				NetworkName: "forge_net",
+				Owner:       "owner",
+				Repo:        "repo",
+			},
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerCreate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(container.CreateResponse{ID: "gw-123"}, nil)
+				m.EXPECT().
+					NetworkConnect(gomock.Any(), "bridge", "gw-123", nil).
+					Return(fmt.Errorf("connect failed"))
+			},
+			wantErr:     true,
+			errContains: "failed to connect gateway container to the bridge network",
+		},
 	}
 
 	for _, tt := range tests {
@@ -1306,6 +1635,65 @@ func TestWaitForReady(t *testing.T) {
 			wantErr:     true,
 			errContains: "exited with code 137",
 		},
+		{
+			name: "waits until container with health check is healthy",
+			setupMock: func(m *MockDockerAPI) {
+				starting := m.EXPECT().
+					ContainerInspect(gomock.Any(), "c-123").
+					Return(container.InspectResponse{
+						ContainerJSONBase: &container.ContainerJSONBase{
+							State: &container.State{Status: "running", Running: true, Health: &container.Health{Status: container.Starting}},
+						},
+					}, nil).
+					Times(2)
+				m.EXPECT().
+					ContainerInspect(gomock.Any(), "c-123").
+					After(starting).
+					Return(container.InspectResponse{
+						ContainerJSONBase: &container.ContainerJSONBase{
+							State: &container.State{Status: "running", Running: true, Health: &container.Health{Status: container.Healthy}},
+						},
+					}, nil)
+			},
+		},
+		{
+			name: "returns error when container is unhealthy",
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerInspect(gomock.Any(), "c-123").
+					Return(container.InspectResponse{
+						ContainerJSONBase: &container.ContainerJSONBase{
+							State: &container.State{
+								Status:  "running",
+								Running: true,
+								Health: &container.Health{
+									Status: container.Unhealthy,
+									Log: []*container.HealthcheckResult{
+										{ExitCode: 1, Output: "wget: server returned error: HTTP/1.1 503 Service Unavailable\n"},
+									},
+								},
+							},
+						},
+					}, nil)
+			},
+			wantErr:     true,
+			errContains: "container c-123 is unhealthy: wget: server returned error: HTTP/1.1 503 Service Unavailable",
+		},
+		{
+			name: "times out when container stays unready",
+			setupMock: func(m *MockDockerAPI) {
+				m.EXPECT().
+					ContainerInspect(gomock.Any(), "c-123").
+					Return(container.InspectResponse{
+						ContainerJSONBase: &container.ContainerJSONBase{
+							State: &container.State{Status: "running", Running: true, Health: &container.Health{Status: container.Starting}},
+						},
+					}, nil).
+					AnyTimes()
+			},
+			wantErr:     true,
+			errContains: "timed out waiting",
+		},
 		{
 			name: "returns error when inspect fails",
 			setupMock: func(m *MockDockerAPI) {
@@ -3,10 +3,10 @@
 //
 // Generated by this command:
 //
-//	mockgen -destination=mock_docker_test.go -package=docker github.com/michael-freling/claude-code-tools/internal/forge/container DockerAPI
+//	mockgen -destination=mock_docker_test.go -package=container github.com/michael-freling/claude-code-tools/internal/forge/container DockerAPI
 //
 
-// Package docker is a generated GoMock package.
+// Package container is a generated GoMock package.
 package container
 
 import (
@@ -190,6 +190,20 @@ func (mr *MockDockerAPIMockRecorder) ImagePull(ctx, refStr, options any) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImagePull", reflect.TypeOf((*MockDockerAPI)(nil).ImagePull), ctx, refStr, options)
 }
 
+// NetworkConnect mocks base method.
+func (m *MockDockerAPI) NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NetworkConnect", ctx, networkID, containerID, config)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NetworkConnect indicates an expected call of NetworkConnect.
+func (mr *MockDockerAPIMockRecorder) NetworkConnect(ctx, networkID, containerID, config any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkConnect", reflect.TypeOf((*MockDockerAPI)(nil).NetworkConnect), ctx, networkID, containerID, config)
+}
+
 // NetworkCreate mocks base method.
 func (m *MockDockerAPI) NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
 	m.ctrl.T.Helper()
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,9 +17,15 @@ import (
 	"github.com/michael-freling/claude-code-tools/internal/forge/container"
 	"github.com/michael-freling/claude-code-tools/internal/forge/project"
 	"github.com/michael-freling/claude-code-tools/internal/forge/session"
+	"github.com/michael-freling/claude-code-tools/internal/gateway"
 	"gopkg.in/yaml.v3"
 )
 
+// gatewayReadyTimeout bounds how long starting a session waits for the
+// gateway to become ready, which its health check reports once the forge
+// accepts its token.
+const gatewayReadyTimeout = time.Minute
+
 // Orchestrator manages the lifecycle of claude-forge sessions.
 type Orchestrator struct {
 	Containers container.ContainerManager
@@ -96,6 +103,13 @@ func (o *Orchestrator) Start(ctx context.Context, opts StartOptions) (*Session,
 	}
 	o.Log("Auth: %s", creds.AuthType)
 
+	// The gateway lets the agent read the project's submodules when the
+	// policy restricts reads.
+	submodules, err := proj.Submodules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read submodules: %w", err)
+	}
+
 	// Detect dependency cache directories
 	cacheDirs := claudecode.DetectCacheDirs(o.HomeDir)
 	if len(cacheDirs) > 0 {
@@ -123,6 +137,30 @@ func (o *Orchestrator) Start(ctx context.Context, opts StartOptions) (*Session,
 		return nil, fmt.Errorf("failed to create session directory: %w", err)
 	}
 
+	// Create the gateway log directory. It is only mounted into the gateway,
+	// so the agent cannot tamper with the audit log.
+	gatewayLogDir := o.gatewayLogDir(proj.ID)
+	if err := os.MkdirAll(gatewayLogDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create gateway log directory: %w", err)
+	}
+
+	// Create the gateway cache directory. Parallel sessions of the project
+	// share it, but not sessions of other projects, whose gateways read with
+	// other tokens and policies.
+	var gatewayCacheDir string
+	if cfg.Cache.Enabled || len(cfg.Cache.Mirror) > 0 {
+		gatewayCacheDir = filepath.Join(o.HomeDir, ".claude-forge", "cache", proj.ID)
+		if err := os.MkdirAll(gatewayCacheDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create gateway cache directory: %w", err)
+		}
+	}
+
+	// Create the rate limit directory, shared by the gateways of every
+	// session so that they keep within the forge's rate limits together.
+	if err := os.MkdirAll(o.RateLimitDir(), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create rate limit directory: %w", err)
+	}
+
 	// Create plugins directory (persists across sessions, managed from inside the container)
 	pluginsDir := filepath.Join(o.HomeDir, ".claude-forge", "plugins")
 	if err := os.MkdirAll(pluginsDir, 0o755); err != nil {
@@ -133,6 +171,9 @@ func (o *Orchestrator) Start(ctx context.Context, opts StartOptions) (*Session,
 	gitUserName := project.GitConfig("user.name")
 	gitUserEmail := project.GitConfig("user.email")
 	ccOpts := claudecode.Options{
+		Host:         proj.Host,
+		ExtraHosts:   cfg.Hosts,
+		HostURLs:     forgeURLs(cfg.Forges),
 		GitUserName:  gitUserName,
 		GitUserEmail: gitUserEmail,
 	}
@@ -150,6 +191,11 @@ func (o *Orchestrator) Start(ctx context.Context, opts StartOptions) (*Session,
 		return nil, fmt.Errorf("failed to ensure .claude.json: %w", err)
 	}
 
+	// Register the gateway's GitHub tools with Claude Code
+	if err := claudecode.RegisterMCPServer(o.ConfigDir); err != nil {
+		return nil, fmt.Errorf("failed to register the gateway MCP server: %w", err)
+	}
+
 	// Pull images if not present
 	for _, img := range []string{cfg.Images.Agent, cfg.Images.Gateway} {
 		exists, err := o.Containers.ImageExists(ctx, img)
@@ -174,28 +220,124 @@ func (o *Orchestrator) Start(ctx context.Context, opts StartOptions) (*Session,
 	o.Log("Starting gateway: %s", sess.GatewayName)
 	sshDir := filepath.Join(o.HomeDir, ".ssh")
 	ghConfigDir := filepath.Join(o.HomeDir, ".config", "gh")
+	// Private keys are passed to the gateway as files only the host user
+	// can read, outside the directories mounted into the agent.
+	gatewaySecretsDir := o.gatewaySecretsDir(proj.ID, sessionID)
+	if err := os.MkdirAll(gatewaySecretsDir, 0o700); err != nil {
+		o.Cleanup(ctx, sess)
+		return nil, fmt.Errorf("failed to create gateway secrets directory: %w", err)
+	}
 	gatewayEnv := map[string]string{}
-	if ghToken := os.Getenv("GITHUB_TOKEN"); ghToken != "" {
+	var gatewayAppKeyFile string
+	if app := cfg.GitHubApp; app.AppID != 0 {
+		// The gateway mints its own tokens, so it gets no user credentials.
+		keyPath := app.PrivateKeyPath
+		if !filepath.IsAbs(keyPath) {
+			keyPath = filepath.Join(o.ConfigDir, keyPath)
+		}
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			o.Cleanup(ctx, sess)
+			return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+		}
+		o.Log("GitHub App: %d", app.AppID)
+		gatewayEnv["GITHUB_APP_ID"] = strconv.FormatInt(app.AppID, 10)
+		if app.InstallationID != 0 {
+			gatewayEnv["GITHUB_APP_INSTALLATION_ID"] = strconv.FormatInt(app.InstallationID, 10)
+		}
+		gatewayAppKeyFile = filepath.Join(gatewaySecretsDir, "github-app.key")
+		if err := os.WriteFile(gatewayAppKeyFile, key, 0o600); err != nil {
+			o.Cleanup(ctx, sess)
+			return nil, fmt.Errorf("failed to write GitHub App private key: %w", err)
+		}
+		ghConfigDir = ""
+	} else if ghToken := hostTokenFromEnv(forgeType(cfg.Forges, proj.Host), proj.Host); ghToken != "" {
+		// The gateway reads the project host's token from GITHUB_TOKEN
+		// whatever the forge.
 		gatewayEnv["GITHUB_TOKEN"] = ghToken
-	} else if token := readGHToken(ghConfigDir); token != "" {
+	} else if token := readGHToken(ghConfigDir, proj.Host); token != "" {
 		gatewayEnv["GITHUB_TOKEN"] = token
 	}
+	gatewayPolicyFile := filepath.Join(o.ConfigDir, "gateway-policy.yaml")
+	if _, err := os.Stat(gatewayPolicyFile); err != nil {
+		gatewayPolicyFile = ""
+	} else {
+		o.Log("Gateway policy: %s", gatewayPolicyFile)
+	}
+	// The CA signing the gateway's certificate and the token the agent
+	// presents to the gateway are generated per session, so only this
+	// session's agent trusts the gateway and can use it.
+	caCert, caKey, err := gateway.GenerateCA()
+	if err != nil {
+		o.Cleanup(ctx, sess)
+		return nil, fmt.Errorf("failed to generate session CA: %w", err)
+	}
+	gatewayCert, gatewayKey, err := gateway.GenerateCertificate(caCert, caKey, container.GatewayHost)
+	if err != nil {
+		o.Cleanup(ctx, sess)
+		return nil, fmt.Errorf("failed to generate gateway certificate: %w", err)
+	}
+	gatewayKeyFile := filepath.Join(gatewaySecretsDir, "tls.key")
+	if err := os.WriteFile(gatewayKeyFile, gatewayKey, 0o600); err != nil {
+		o.Cleanup(ctx, sess)
+		return nil, fmt.Errorf("failed to write gateway TLS key: %w", err)
+	}
+	gatewayToken, err := gateway.GenerateToken()
+	if err != nil {
+		o.Cleanup(ctx, sess)
+		return nil, fmt.Errorf("failed to generate gateway token: %w", err)
+	}
+	// SSH remotes go through the gateway's SSH server, which only this
+	// session's agent can authenticate to and verify.
+	sshHostKey, sshHostPublicKey, err := gateway.GenerateSSHKey()
+	if err != nil {
+		o.Cleanup(ctx, sess)
+		return nil, fmt.Errorf("failed to generate gateway SSH host key: %w", err)
+	}
+	gatewaySSHHostKeyFile := filepath.Join(gatewaySecretsDir, "ssh_host_key")
+	if err := os.WriteFile(gatewaySSHHostKeyFile, sshHostKey, 0o600); err != nil {
+		o.Cleanup(ctx, sess)
+		return nil, fmt.Errorf("failed to write gateway SSH host key: %w", err)
+	}
+	sshClientKey, sshClientPublicKey, err := gateway.GenerateSSHKey()
+	if err != nil {
+		o.Cleanup(ctx, sess)
+		return nil, fmt.Errorf("failed to generate gateway SSH client key: %w", err)
+	}
 	gatewayID, err := o.Containers.StartGateway(ctx, container.GatewayOptions{
-		Name:        sess.GatewayName,
-		Image:       cfg.Images.Gateway,
-		NetworkName: sess.NetworkName,
-		SSHDir:      sshDir,
-		GHConfigDir: ghConfigDir,
-		Owner:       proj.Owner,
-		Repo:        proj.Repo,
-		Env:         gatewayEnv,
+		Name:           sess.GatewayName,
+		Image:          cfg.Images.Gateway,
+		NetworkName:    sess.NetworkName,
+		SSHDir:         sshDir,
+		GHConfigDir:    ghConfigDir,
+		Host:           proj.Host,
+		ExtraHosts:     cfg.Hosts,
+		Forges:         gatewayForges(cfg.Forges),
+		Owner:          proj.Owner,
+		Repo:           proj.Repo,
+		ReadRepos:      submodules,
+		PolicyFile:     gatewayPolicyFile,
+		TLSCert:        string(gatewayCert),
+		TLSKeyFile:     gatewayKeyFile,
+		AppKeyFile:     gatewayAppKeyFile,
+		AuthToken:      gatewayToken,
+		SSHHostKeyFile: gatewaySSHHostKeyFile,
+		SSHClientKey:   sshClientPublicKey,
+		LogDir:         gatewayLogDir,
+		CacheDir:       gatewayCacheDir,
+		Mirrors:        cfg.Cache.Mirror,
+		RateLimitDir:   o.RateLimitDir(),
+		SessionID:      sessionID,
+		UID:            opts.UID,
+		GID:            opts.GID,
+		Env:            gatewayEnv,
 	})
 	if err != nil {
 		o.Cleanup(ctx, sess)
 		return nil, fmt.Errorf("failed to start gateway: %w", err)
 	}
 
-	if err := o.Containers.WaitForReady(ctx, gatewayID, 5*time.Second); err != nil {
+	if err := o.Containers.WaitForReady(ctx, gatewayID, gatewayReadyTimeout); err != nil {
 		logs, _ := o.Containers.ContainerLogs(ctx, gatewayID)
 		o.Cleanup(ctx, sess)
 		if logs != "" {
@@ -227,7 +369,33 @@ func (o *Orchestrator) Start(ctx context.Context, opts StartOptions) (*Session,
 		"GIT_TERMINAL_PROMPT": "0",
 		"FORGE_PROJECT_OWNER": proj.Owner,
 		"FORGE_PROJECT_REPO":  proj.Repo,
-	}
+		// gh talks to the gateway as a GitHub Enterprise Server host. The
+		// gateway checks the session token and replaces it with real
+		// credentials.
+		"GH_HOST":             container.GatewayHost,
+		"GH_ENTERPRISE_TOKEN": gatewayToken,
+		// The entrypoint adds the session CA to the trust store, and the
+		// token to the system gitconfig for requests to the gateway.
+		"FORGE_GATEWAY_CA":    string(caCert),
+		"FORGE_GATEWAY_TOKEN": gatewayToken,
+		// The entrypoint configures ssh to authenticate to the gateway's
+		// SSH server with this key, and to trust only its host key.
+		"FORGE_GATEWAY_SSH_KEY":         string(sshClientKey),
+		"FORGE_GATEWAY_SSH_KNOWN_HOSTS": fmt.Sprintf("[%s]:%d %s", container.GatewayHost, container.GatewaySSHPort, sshHostPublicKey),
+		// Node does not read the system trust store, so Claude Code trusts
+		// the session CA through this file, which the entrypoint writes.
+		"NODE_EXTRA_CA_CERTS": "/usr/local/share/ca-certificates/forge-gateway.crt",
+	}
+	// The session network is internal: everything else goes through the
+	// gateway's egress proxy, which allows only the configured domains.
+	// Clients send the session token from the URL as Proxy-Authorization.
+	egressProxy := fmt.Sprintf("http://forge:%s@%s:%d", gatewayToken, container.GatewayHost, container.GatewayEgressPort)
+	noProxy := container.GatewayHost + ",localhost,127.0.0.1"
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		agentEnv[name] = egressProxy
+	}
+	agentEnv["NO_PROXY"] = noProxy
+	agentEnv["no_proxy"] = noProxy
 	switch creds.AuthType {
 	case "api_key":
 		agentEnv["ANTHROPIC_API_KEY"] = creds.Token
@@ -313,6 +481,7 @@ func (o *Orchestrator) Cleanup(ctx context.Context, sess *Session) {
 	_ = o.Containers.StopContainer(ctx, sess.GatewayName)
 	_ = o.Containers.RemoveContainer(ctx, sess.GatewayName)
 	_ = o.Containers.RemoveNetwork(ctx, sess.NetworkName)
+	_ = os.RemoveAll(o.gatewaySecretsDir(sess.ProjectID, sess.SessionID))
 	o.Log("Cleanup complete.")
 }
 
@@ -362,12 +531,51 @@ func (o *Orchestrator) Stop(ctx context.Context, projectDir string) error {
 		netName := fmt.Sprintf("forge_net_%s_%s", proj.ID, sid)
 		o.Log("Removing network: %s", netName)
 		_ = o.Containers.RemoveNetwork(ctx, netName)
+		_ = os.RemoveAll(o.gatewaySecretsDir(proj.ID, sid))
 	}
 
 	o.Log("Stopped.")
 	return nil
 }
 
+// gatewayLogDir returns the host directory the gateway of a project's
+// sessions writes its audit log to.
+func (o *Orchestrator) gatewayLogDir(projectID string) string {
+	return filepath.Join(o.HomeDir, ".claude-forge", "logs", projectID)
+}
+
+// gatewaySecretsDir returns the host directory holding the secrets of a
+// session's gateway, such as its TLS key.
+func (o *Orchestrator) gatewaySecretsDir(projectID, sessionID string) string {
+	return filepath.Join(o.HomeDir, ".claude-forge", "secrets", projectID+"-"+sessionID)
+}
+
+// GatewayLogPath returns the path of the gateway audit log for the project
+// in the given directory. Every session of the project appends to it.
+func (o *Orchestrator) GatewayLogPath(projectDir string) (string, error) {
+	proj, err := project.Identify(projectDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to identify project: %w", err)
+	}
+	return filepath.Join(o.gatewayLogDir(proj.ID), container.GatewayAuditLogFile), nil
+}
+
+// GatewayApprovalsDir returns the directory the gateway of the project in
+// the given directory parks requests that need approval in.
+func (o *Orchestrator) GatewayApprovalsDir(projectDir string) (string, error) {
+	proj, err := project.Identify(projectDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to identify project: %w", err)
+	}
+	return filepath.Join(o.gatewayLogDir(proj.ID), container.GatewayApprovalsDir), nil
+}
+
+// RateLimitDir returns the host directory the gateways share their rate
+// limit state through.
+func (o *Orchestrator) RateLimitDir() string {
+	return filepath.Join(o.HomeDir, ".claude-forge", "ratelimit")
+}
+
 // StatusEntry holds info about a running forge container.
 type StatusEntry = container.ContainerInfo
 
@@ -376,9 +584,64 @@ func (o *Orchestrator) Status(ctx context.Context) ([]StatusEntry, error) {
 	return o.Containers.ListForgeContainers(ctx)
 }
 
-// readGHToken reads the GitHub OAuth token from gh CLI's hosts.yml file.
+// forgeType returns the forge of host: the configured one, or the host's
+// default.
+func forgeType(forges map[string]config.ForgeConfig, host string) string {
+	for h, forge := range forges {
+		if strings.EqualFold(h, host) && forge.Type != "" {
+			return forge.Type
+		}
+	}
+	return gateway.DefaultForgeKind(host)
+}
+
+// forgeURLs returns the base URLs of hosts not served at https://<host>.
+func forgeURLs(forges map[string]config.ForgeConfig) map[string]string {
+	urls := make(map[string]string)
+	for host, forge := range forges {
+		if forge.URL != "" {
+			urls[host] = forge.URL
+		}
+	}
+	return urls
+}
+
+// gatewayForges converts the configured forges to gateway container options.
+func gatewayForges(forges map[string]config.ForgeConfig) map[string]container.GatewayForge {
+	if len(forges) == 0 {
+		return nil
+	}
+	result := make(map[string]container.GatewayForge, len(forges))
+	for host, forge := range forges {
+		result[host] = container.GatewayForge{Type: forge.Type, URL: forge.URL}
+	}
+	return result
+}
+
+// hostTokenFromEnv returns the token for host on a forge of the given type
+// from the environment, using the same variables as each forge's CLI:
+// GITLAB_TOKEN for GitLab, GITEA_TOKEN for Gitea, and for GitHub,
+// GITHUB_TOKEN for github.com and GH_ENTERPRISE_TOKEN or
+// GITHUB_ENTERPRISE_TOKEN for other hosts.
+func hostTokenFromEnv(forge, host string) string {
+	switch forge {
+	case gateway.ForgeGitLab:
+		return os.Getenv("GITLAB_TOKEN")
+	case gateway.ForgeGitea:
+		return os.Getenv("GITEA_TOKEN")
+	}
+	if host == "" || strings.EqualFold(host, "github.com") {
+		return os.Getenv("GITHUB_TOKEN")
+	}
+	if token := os.Getenv("GH_ENTERPRISE_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GITHUB_ENTERPRISE_TOKEN")
+}
+
+// readGHToken reads the OAuth token for host from gh CLI's hosts.yml file.
 // Returns empty string if the file doesn't exist or can't be read.
-func readGHToken(ghConfigDir string) string {
+func readGHToken(ghConfigDir, host string) string {
 	hostsPath := filepath.Join(ghConfigDir, "hosts.yml")
 	data, err := os.ReadFile(hostsPath)
 	if err != nil {
@@ -392,8 +655,13 @@ func readGHToken(ghConfigDir string) string {
 		return ""
 	}
 
-	if gh, ok := hosts["github.com"]; ok {
-		return gh.OAuthToken
+	if host == "" {
+		host = "github.com"
+	}
+	for name, entry := range hosts {
+		if strings.EqualFold(name, host) {
+			return entry.OAuthToken
+		}
 	}
 	return ""
 }
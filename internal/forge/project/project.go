@@ -1,8 +1,12 @@
 package project
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -10,17 +14,24 @@ import (
 // Project holds metadata about a project derived from its git remote.
 type Project struct {
 	ID    string // derived from host dir path, e.g. "-home-user-my-project"
-	Owner string // GitHub owner from remote URL
-	Repo  string // GitHub repo name from remote URL
+	Host  string // forge host from remote URL, e.g. "github.com"
+	Owner string // owner from remote URL; the full group path for GitLab subgroups
+	Repo  string // repo name from remote URL
 	Dir   string // host directory path
 }
 
+// defaultHost is the forge host of remotes that do not name one, such as the
+// gateway's HTTPS endpoint.
+const defaultHost = "github.com"
+
 // sshRemoteRegexp matches SSH remote URLs like git@github.com:owner/repo.git
-var sshRemoteRegexp = regexp.MustCompile(`^git@[^:]+:([^/]+)/([^/]+?)(?:\.git)?$`)
+// and git@gitlab.com:group/subgroup/repo.git
+var sshRemoteRegexp = regexp.MustCompile(`^git@([^:]+):(.+)/([^/]+?)(?:\.git)?$`)
 
 // httpsRemoteRegexp matches HTTPS remote URLs like https://github.com/owner/repo.git
-// Also matches gateway-proxied URLs like http://gateway:8080/github.com/owner/repo.git
-var httpsRemoteRegexp = regexp.MustCompile(`^https?://[^/]+/(?:github\.com/)?([^/]+)/([^/]+?)(?:\.git)?$`)
+// Also matches gateway-proxied URLs like https://gateway:8080/github.com/owner/repo.git
+// and https://gateway/owner/repo.git
+var httpsRemoteRegexp = regexp.MustCompile(`^https?://([^/]+)/(.+)/([^/]+?)(?:\.git)?$`)
 
 // GitConfig reads a git config value from the host's git configuration.
 // It returns an empty string if the key is not set or git is not available.
@@ -36,7 +47,8 @@ func GitConfig(key string) string {
 // Identify extracts project info from a directory by reading its git remote.
 // dir is the host path to the project directory.
 // It runs `git -C <dir> remote get-url origin` and parses the result.
-// Supports SSH (git@github.com:owner/repo.git) and HTTPS (https://github.com/owner/repo.git) URLs.
+// Supports SSH (git@github.com:owner/repo.git) and HTTPS (https://github.com/owner/repo.git) URLs,
+// on github.com or a GitHub Enterprise Server host.
 // Project ID is derived by replacing "/" with "-" in the dir path.
 func Identify(dir string) (*Project, error) {
 	cmd := exec.Command("git", "-C", dir, "remote", "get-url", "origin")
@@ -46,28 +58,95 @@ func Identify(dir string) (*Project, error) {
 	}
 
 	remoteURL := strings.TrimSpace(string(output))
-	owner, repo, err := parseRemoteURL(remoteURL)
+	host, owner, repo, err := parseRemoteURL(remoteURL)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Project{
 		ID:    strings.ReplaceAll(dir, "/", "-"),
+		Host:  host,
 		Owner: owner,
 		Repo:  repo,
 		Dir:   dir,
 	}, nil
 }
 
-// parseRemoteURL parses a git remote URL and returns the owner and repo name.
-func parseRemoteURL(remoteURL string) (string, string, error) {
+// Submodules returns the repositories of the submodules declared in the
+// project's .gitmodules, as host/owner/repo. Relative URLs are resolved
+// against the project's repository; other URLs that are not on a forge,
+// such as local paths, are skipped.
+func (p *Project) Submodules() ([]string, error) {
+	gitmodules := filepath.Join(p.Dir, ".gitmodules")
+	if _, err := os.Stat(gitmodules); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	cmd := exec.Command("git", "config", "--file", gitmodules, "--get-regexp", `^submodule\..*\.url$`)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			// No submodule has a URL.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+
+	var repos []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		_, url, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+		if repo, ok := p.submoduleRepo(url); ok {
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+// submoduleRepo returns the repository of a submodule URL as
+// host/owner/repo. A relative URL such as ../lib.git is relative to the
+// project's repository, as git resolves it against the origin remote.
+func (p *Project) submoduleRepo(url string) (string, bool) {
+	if strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../") {
+		name := strings.TrimSuffix(path.Join(p.Owner, p.Repo, url), ".git")
+		if strings.HasPrefix(name, "..") || !strings.Contains(name, "/") {
+			return "", false
+		}
+		return p.Host + "/" + name, true
+	}
+
+	host, owner, repo, err := parseRemoteURL(url)
+	if err != nil {
+		return "", false
+	}
+	return host + "/" + owner + "/" + repo, true
+}
+
+// parseRemoteURL parses a git remote URL and returns the forge host, owner,
+// and repo name. For URLs of the gateway's git proxy the host is taken from
+// the path; URLs of its HTTPS endpoint are on the default host.
+func parseRemoteURL(remoteURL string) (string, string, string, error) {
 	if matches := sshRemoteRegexp.FindStringSubmatch(remoteURL); matches != nil {
-		return matches[1], matches[2], nil
+		return matches[1], matches[2], matches[3], nil
 	}
 
 	if matches := httpsRemoteRegexp.FindStringSubmatch(remoteURL); matches != nil {
-		return matches[1], matches[2], nil
+		host, owner, repo := matches[1], matches[2], matches[3]
+		switch {
+		case host == "gateway":
+			host = defaultHost
+		case strings.HasPrefix(host, "gateway:"):
+			pathHost, pathOwner, found := strings.Cut(owner, "/")
+			if !found {
+				return "", "", "", fmt.Errorf("unsupported remote URL format: %s", remoteURL)
+			}
+			host, owner = pathHost, pathOwner
+		}
+		return host, owner, repo, nil
 	}
 
-	return "", "", fmt.Errorf("unsupported remote URL format: %s", remoteURL)
+	return "", "", "", fmt.Errorf("unsupported remote URL format: %s", remoteURL)
 }
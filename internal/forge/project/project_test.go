@@ -23,6 +23,7 @@ func TestIdentify(t *testing.T) {
 			name:      "SSH URL with .git suffix",
 			remoteURL: "git@github.com:michael-freling/claude-code-tools.git",
 			want: &Project{
+				Host:  "github.com",
 				Owner: "michael-freling",
 				Repo:  "claude-code-tools",
 			},
@@ -31,6 +32,7 @@ func TestIdentify(t *testing.T) {
 			name:      "SSH URL without .git suffix",
 			remoteURL: "git@github.com:michael-freling/claude-code-tools",
 			want: &Project{
+				Host:  "github.com",
 				Owner: "michael-freling",
 				Repo:  "claude-code-tools",
 			},
@@ -39,6 +41,7 @@ func TestIdentify(t *testing.T) {
 			name:      "HTTPS URL with .git suffix",
 			remoteURL: "https://github.com/michael-freling/claude-code-tools.git",
 			want: &Project{
+				Host:  "github.com",
 				Owner: "michael-freling",
 				Repo:  "claude-code-tools",
 			},
@@ -47,6 +50,16 @@ func TestIdentify(t *testing.T) {
 			name:      "HTTPS URL without .git suffix",
 			remoteURL: "https://github.com/michael-freling/claude-code-tools",
 			want: &Project{
+				Host:  "github.com",
+				Owner: "michael-freling",
+				Repo:  "claude-code-tools",
+			},
+		},
+		{
+			name:      "Gateway HTTPS endpoint URL",
+			remoteURL: "https://gateway/michael-freling/claude-code-tools.git",
+			want: &Project{
+				Host:  "github.com",
 				Owner: "michael-freling",
 				Repo:  "claude-code-tools",
 			},
@@ -55,6 +68,25 @@ func TestIdentify(t *testing.T) {
 			name:      "Gateway-proxied URL",
 			remoteURL: "http://gateway:8080/github.com/michael-freling/claude-code-tools.git",
 			want: &Project{
+				Host:  "github.com",
+				Owner: "michael-freling",
+				Repo:  "claude-code-tools",
+			},
+		},
+		{
+			name:      "GitHub Enterprise Server SSH URL",
+			remoteURL: "git@github.example.com:michael-freling/claude-code-tools.git",
+			want: &Project{
+				Host:  "github.example.com",
+				Owner: "michael-freling",
+				Repo:  "claude-code-tools",
+			},
+		},
+		{
+			name:      "GitHub Enterprise Server gateway-proxied URL",
+			remoteURL: "http://gateway:8080/github.example.com/michael-freling/claude-code-tools.git",
+			want: &Project{
+				Host:  "github.example.com",
 				Owner: "michael-freling",
 				Repo:  "claude-code-tools",
 			},
@@ -78,6 +110,7 @@ func TestIdentify(t *testing.T) {
 			}
 
 			require.NoError(t, err)
+			assert.Equal(t, tt.want.Host, got.Host)
 			assert.Equal(t, tt.want.Owner, got.Owner)
 			assert.Equal(t, tt.want.Repo, got.Repo)
 			assert.Equal(t, tmpDir, got.Dir)
@@ -115,6 +148,7 @@ func TestParseRemoteURL(t *testing.T) {
 	tests := []struct {
 		name        string
 		url         string
+		wantHost    string
 		wantOwner   string
 		wantRepo    string
 		wantErr     bool
@@ -123,39 +157,79 @@ func TestParseRemoteURL(t *testing.T) {
 		{
 			name:      "SSH URL with .git",
 			url:       "git@github.com:owner/repo.git",
+			wantHost:  "github.com",
 			wantOwner: "owner",
 			wantRepo:  "repo",
 		},
 		{
 			name:      "SSH URL without .git",
 			url:       "git@github.com:owner/repo",
+			wantHost:  "github.com",
 			wantOwner: "owner",
 			wantRepo:  "repo",
 		},
 		{
 			name:      "HTTPS URL with .git",
 			url:       "https://github.com/owner/repo.git",
+			wantHost:  "github.com",
 			wantOwner: "owner",
 			wantRepo:  "repo",
 		},
 		{
 			name:      "HTTPS URL without .git",
 			url:       "https://github.com/owner/repo",
+			wantHost:  "github.com",
 			wantOwner: "owner",
 			wantRepo:  "repo",
 		},
 		{
 			name:      "SSH URL with hyphenated names",
 			url:       "git@github.com:my-org/my-repo.git",
+			wantHost:  "github.com",
 			wantOwner: "my-org",
 			wantRepo:  "my-repo",
 		},
 		{
 			name:      "HTTPS URL with hyphenated names",
 			url:       "https://github.com/my-org/my-repo.git",
+			wantHost:  "github.com",
 			wantOwner: "my-org",
 			wantRepo:  "my-repo",
 		},
+		{
+			name:      "HTTPS URL on a GitHub Enterprise Server host",
+			url:       "https://github.example.com/owner/repo.git",
+			wantHost:  "github.example.com",
+			wantOwner: "owner",
+			wantRepo:  "repo",
+		},
+		{
+			name:      "SSH URL in a GitLab nested group",
+			url:       "git@gitlab.com:group/subgroup/repo.git",
+			wantHost:  "gitlab.com",
+			wantOwner: "group/subgroup",
+			wantRepo:  "repo",
+		},
+		{
+			name:      "HTTPS URL in a GitLab nested group",
+			url:       "https://gitlab.com/group/subgroup/repo.git",
+			wantHost:  "gitlab.com",
+			wantOwner: "group/subgroup",
+			wantRepo:  "repo",
+		},
+		{
+			name:      "gateway-proxied URL in a GitLab nested group",
+			url:       "http://gateway:8080/gitlab.com/group/subgroup/repo.git",
+			wantHost:  "gitlab.com",
+			wantOwner: "group/subgroup",
+			wantRepo:  "repo",
+		},
+		{
+			name:        "gateway-proxied URL without a host",
+			url:         "http://gateway:8080/owner/repo.git",
+			wantErr:     true,
+			errContains: "unsupported remote URL format",
+		},
 		{
 			name:        "unsupported URL format",
 			url:         "not-a-valid-url",
@@ -166,7 +240,7 @@ func TestParseRemoteURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			owner, repo, err := parseRemoteURL(tt.url)
+			host, owner, repo, err := parseRemoteURL(tt.url)
 
 			if tt.wantErr {
 				require.Error(t, err)
@@ -175,6 +249,7 @@ func TestParseRemoteURL(t *testing.T) {
 			}
 
 			require.NoError(t, err)
+			assert.Equal(t, tt.wantHost, host)
 			assert.Equal(t, tt.wantOwner, owner)
 			assert.Equal(t, tt.wantRepo, repo)
 		})
@@ -200,3 +275,58 @@ func runGit(t *testing.T, dir string, args ...string) {
 	output, err := cmd.CombinedOutput()
 	require.NoError(t, err, "git %v failed: %s", args, string(output))
 }
+
+func TestProject_Submodules(t *testing.T) {
+	tests := []struct {
+		name       string
+		gitmodules string
+		want       []string
+	}{
+		{
+			name: "no .gitmodules",
+		},
+		{
+			name: "absolute and relative URLs",
+			gitmodules: `[submodule "lib"]
+	path = lib
+	url = https://github.com/other-owner/lib.git
+[submodule "docs"]
+	path = docs
+	url = ../docs.git
+[submodule "tools"]
+	path = tools
+	url = git@gitlab.com:group/subgroup/tools.git
+[submodule "local"]
+	path = local
+	url = /srv/git/local.git
+[submodule "outside"]
+	path = outside
+	url = ../../../outside.git
+`,
+			want: []string{
+				"github.com/other-owner/lib",
+				"github.com/my-owner/docs",
+				"gitlab.com/group/subgroup/tools",
+			},
+		},
+		{
+			name:       "submodules without URLs",
+			gitmodules: "[submodule \"lib\"]\n\tpath = lib\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.gitmodules != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitmodules"), []byte(tt.gitmodules), 0o644))
+			}
+			p := &Project{Host: "github.com", Owner: "my-owner", Repo: "my-repo", Dir: dir}
+
+			got, err := p.Submodules()
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
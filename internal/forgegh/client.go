@@ -14,16 +14,22 @@ import (
 // aliased as `gh`. It queries the gateway's API server for schema discovery
 // and translates gh-style commands to API calls.
 type Client struct {
-	gatewayURL string // e.g. http://gateway:8083
+	gatewayURL string // e.g. https://gateway:8083
+	token      string // session token the gateway requires, if any
 	httpClient *http.Client
 	stdout     io.Writer
 	stderr     io.Writer
 }
 
+// gatewayTokenEnv holds the session token the gateway requires.
+const gatewayTokenEnv = "FORGE_GATEWAY_TOKEN"
+
 // NewClient creates a new forge-gh client targeting the given gateway URL.
+// It authenticates to the gateway with the token in FORGE_GATEWAY_TOKEN.
 func NewClient(gatewayURL string) *Client {
 	return &Client{
 		gatewayURL: strings.TrimRight(gatewayURL, "/"),
+		token:      os.Getenv(gatewayTokenEnv),
 		httpClient: http.DefaultClient,
 		stdout:     os.Stdout,
 		stderr:     os.Stderr,
@@ -134,7 +140,11 @@ func (c *Client) resolveOwnerRepo(flags map[string]string) (string, string) {
 
 // fetchSchema retrieves the operation schema from the gateway.
 func (c *Client) fetchSchema() (*schemaResponse, error) {
-	resp, err := c.httpClient.Get(c.gatewayURL + "/api/schema")
+	req, err := c.newRequest(http.MethodGet, c.gatewayURL+"/api/schema", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to gateway: %w", err)
 	}
@@ -153,6 +163,19 @@ func (c *Client) fetchSchema() (*schemaResponse, error) {
 	return &schema, nil
 }
 
+// newRequest creates a request to the gateway, authenticated with the
+// session token.
+func (c *Client) newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
 // mapCommand maps a parsed command to an API operation from the schema.
 func mapCommand(cmd *parsedCommand, schema *schemaResponse) (*operation, error) {
 	opName := commandToOperationName(cmd)
@@ -256,9 +279,9 @@ func (c *Client) executeOperation(op *operation, cmd *parsedCommand, owner, repo
 		}
 	}
 
-	req, err := http.NewRequest(op.Method, url, body)
+	req, err := c.newRequest(op.Method, url, body)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
 	if body != nil {
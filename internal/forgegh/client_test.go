@@ -73,6 +73,35 @@ func TestClient_SchemaDiscovery(t *testing.T) {
 	assert.True(t, opNames["get-repo"])
 }
 
+func TestClient_GatewayToken(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{name: "sends the session token", env: "session-token", want: "Bearer session-token"},
+		{name: "without a session token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FORGE_GATEWAY_TOKEN", tt.env)
+			var got []string
+			gw := testGateway(t, func(w http.ResponseWriter, r *http.Request) {
+				got = append(got, r.Header.Get("Authorization"))
+				w.Write([]byte(`[]`))
+			})
+			defer gw.Close()
+
+			client := NewClient(gw.URL)
+			client.stdout = io.Discard
+			require.NoError(t, client.Run([]string{"pr", "list", "--repo", "owner/repo"}))
+
+			assert.Equal(t, []string{tt.want}, got)
+		})
+	}
+}
+
 func TestClient_PRList(t *testing.T) {
 	var capturedPath string
 	var capturedMethod string
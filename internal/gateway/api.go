@@ -1,20 +1,52 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Operation describes a single GitHub API operation exposed by the gateway.
 type Operation struct {
-	Name        string `json:"name"`
-	Method      string `json:"method"`
-	Path        string `json:"path"`
-	Description string `json:"description"`
-	Type        string `json:"type"` // "read" or "write"
+	Name        string  `json:"name"`
+	Method      string  `json:"method"`
+	Path        string  `json:"path"`
+	Description string  `json:"description"`
+	Type        string  `json:"type"`             // "read" or "write"
+	Params      []Param `json:"params,omitempty"` // query and body parameters; path parameters come from Path
+	Policy      string  `json:"policy,omitempty"` // "allow", "deny", or "needs-approval"; set in /api/schema
+}
+
+// Param describes a query or body parameter of an operation.
+type Param struct {
+	Name        string   `json:"name"`
+	In          string   `json:"in"`   // "query" or "body"
+	Type        string   `json:"type"` // JSON schema type: "string", "integer", "boolean", or "array" of strings
+	Description string   `json:"description,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// withPagination appends the page parameters of list operations to params.
+func withPagination(params ...Param) []Param {
+	return append(params,
+		Param{Name: "per_page", In: "query", Type: "integer", Description: "Results per page, at most 100"},
+		Param{Name: "page", In: "query", Type: "integer", Description: "Page of results to return, starting at 1"},
+	)
+}
+
+// sortParams are the ordering parameters of pull request and issue lists.
+var sortParams = []Param{
+	{Name: "sort", In: "query", Type: "string", Enum: []string{"created", "updated", "comments"}},
+	{Name: "direction", In: "query", Type: "string", Enum: []string{"asc", "desc"}},
 }
 
 // SchemaResponse is the JSON response returned by GET /api/schema.
@@ -22,99 +54,344 @@ type SchemaResponse struct {
 	Operations []Operation `json:"operations"`
 }
 
-// operations is the list of supported GitHub API operations.
+// operations is the list of supported GitHub API operations. A path
+// parameter ending in "..." matches the rest of the path, such as a file path.
 var operations = []Operation{
-	{Name: "list-prs", Method: "GET", Path: "/repos/{owner}/{repo}/pulls", Description: "List pull requests", Type: "read"},
-	{Name: "create-pr", Method: "POST", Path: "/repos/{owner}/{repo}/pulls", Description: "Create a pull request", Type: "write"},
+	{Name: "list-prs", Method: "GET", Path: "/repos/{owner}/{repo}/pulls", Description: "List pull requests", Type: "read", Params: withPagination(append([]Param{
+		{Name: "state", In: "query", Type: "string", Enum: []string{"open", "closed", "all"}},
+		{Name: "head", In: "query", Type: "string", Description: "Filter by head branch as user:branch"},
+		{Name: "base", In: "query", Type: "string", Description: "Filter by base branch"},
+	}, sortParams...)...)},
+	{Name: "create-pr", Method: "POST", Path: "/repos/{owner}/{repo}/pulls", Description: "Create a pull request", Type: "write", Params: []Param{
+		{Name: "title", In: "body", Type: "string", Required: true},
+		{Name: "head", In: "body", Type: "string", Required: true, Description: "Branch with the changes"},
+		{Name: "base", In: "body", Type: "string", Required: true, Description: "Branch to merge the changes into"},
+		{Name: "body", In: "body", Type: "string", Description: "Description in Markdown"},
+		{Name: "draft", In: "body", Type: "boolean"},
+	}},
 	{Name: "get-pr", Method: "GET", Path: "/repos/{owner}/{repo}/pulls/{number}", Description: "Get a pull request", Type: "read"},
-	{Name: "update-pr", Method: "PATCH", Path: "/repos/{owner}/{repo}/pulls/{number}", Description: "Update a pull request", Type: "write"},
-	{Name: "list-pr-comments", Method: "GET", Path: "/repos/{owner}/{repo}/pulls/{number}/comments", Description: "List PR review comments", Type: "read"},
-	{Name: "create-pr-comment", Method: "POST", Path: "/repos/{owner}/{repo}/pulls/{number}/comments", Description: "Create a PR review comment", Type: "write"},
-	{Name: "list-issues", Method: "GET", Path: "/repos/{owner}/{repo}/issues", Description: "List issues", Type: "read"},
-	{Name: "create-issue", Method: "POST", Path: "/repos/{owner}/{repo}/issues", Description: "Create an issue", Type: "write"},
+	{Name: "update-pr", Method: "PATCH", Path: "/repos/{owner}/{repo}/pulls/{number}", Description: "Update a pull request", Type: "write", Params: []Param{
+		{Name: "title", In: "body", Type: "string"},
+		{Name: "body", In: "body", Type: "string", Description: "Description in Markdown"},
+		{Name: "base", In: "body", Type: "string", Description: "Branch to merge the changes into"},
+		{Name: "state", In: "body", Type: "string", Enum: []string{"open", "closed"}},
+	}},
+	{Name: "list-pr-comments", Method: "GET", Path: "/repos/{owner}/{repo}/pulls/{number}/comments", Description: "List PR review comments", Type: "read", Params: withPagination()},
+	{Name: "create-pr-comment", Method: "POST", Path: "/repos/{owner}/{repo}/pulls/{number}/comments", Description: "Create a PR review comment", Type: "write", Params: []Param{
+		{Name: "body", In: "body", Type: "string", Required: true},
+		{Name: "commit_id", In: "body", Type: "string", Required: true, Description: "SHA of the commit to comment on"},
+		{Name: "path", In: "body", Type: "string", Required: true, Description: "File to comment on"},
+		{Name: "line", In: "body", Type: "integer", Description: "Line of the diff to comment on"},
+		{Name: "side", In: "body", Type: "string", Enum: []string{"LEFT", "RIGHT"}},
+		{Name: "in_reply_to", In: "body", Type: "integer", Description: "ID of the review comment to reply to"},
+	}},
+	{Name: "list-pr-reviews", Method: "GET", Path: "/repos/{owner}/{repo}/pulls/{number}/reviews", Description: "List reviews of a pull request", Type: "read", Params: withPagination()},
+	{Name: "create-pr-review", Method: "POST", Path: "/repos/{owner}/{repo}/pulls/{number}/reviews", Description: "Review a pull request", Type: "write", Params: []Param{
+		{Name: "event", In: "body", Type: "string", Required: true, Enum: []string{"APPROVE", "REQUEST_CHANGES", "COMMENT"}},
+		{Name: "body", In: "body", Type: "string", Description: "Review summary in Markdown"},
+		{Name: "commit_id", In: "body", Type: "string", Description: "SHA of the commit to review; defaults to the head"},
+	}},
+	{Name: "list-issues", Method: "GET", Path: "/repos/{owner}/{repo}/issues", Description: "List issues", Type: "read", Params: withPagination(append([]Param{
+		{Name: "state", In: "query", Type: "string", Enum: []string{"open", "closed", "all"}},
+		{Name: "labels", In: "query", Type: "string", Description: "Comma-separated label names"},
+		{Name: "assignee", In: "query", Type: "string"},
+	}, sortParams...)...)},
+	{Name: "create-issue", Method: "POST", Path: "/repos/{owner}/{repo}/issues", Description: "Create an issue", Type: "write", Params: []Param{
+		{Name: "title", In: "body", Type: "string", Required: true},
+		{Name: "body", In: "body", Type: "string", Description: "Description in Markdown"},
+		{Name: "labels", In: "body", Type: "array"},
+		{Name: "assignees", In: "body", Type: "array"},
+	}},
 	{Name: "get-issue", Method: "GET", Path: "/repos/{owner}/{repo}/issues/{number}", Description: "Get an issue", Type: "read"},
-	{Name: "create-issue-comment", Method: "POST", Path: "/repos/{owner}/{repo}/issues/{number}/comments", Description: "Comment on an issue", Type: "write"},
+	{Name: "create-issue-comment", Method: "POST", Path: "/repos/{owner}/{repo}/issues/{number}/comments", Description: "Comment on an issue", Type: "write", Params: []Param{
+		{Name: "body", In: "body", Type: "string", Required: true},
+	}},
 	{Name: "get-repo", Method: "GET", Path: "/repos/{owner}/{repo}", Description: "Get repository info", Type: "read"},
-	{Name: "list-releases", Method: "GET", Path: "/repos/{owner}/{repo}/releases", Description: "List releases", Type: "read"},
-	{Name: "list-checks", Method: "GET", Path: "/repos/{owner}/{repo}/commits/{ref}/check-runs", Description: "List check runs", Type: "read"},
-	{Name: "list-workflow-runs", Method: "GET", Path: "/repos/{owner}/{repo}/actions/runs", Description: "List workflow runs", Type: "read"},
+	{Name: "get-file-contents", Method: "GET", Path: "/repos/{owner}/{repo}/contents/{path...}", Description: "Get a file or directory listing", Type: "read", Params: []Param{
+		{Name: "ref", In: "query", Type: "string", Description: "Branch, tag, or commit; defaults to the default branch"},
+	}},
+	{Name: "list-releases", Method: "GET", Path: "/repos/{owner}/{repo}/releases", Description: "List releases", Type: "read", Params: withPagination()},
+	{Name: "list-checks", Method: "GET", Path: "/repos/{owner}/{repo}/commits/{ref}/check-runs", Description: "List check runs", Type: "read", Params: withPagination(
+		Param{Name: "check_name", In: "query", Type: "string"},
+		Param{Name: "status", In: "query", Type: "string", Enum: []string{"queued", "in_progress", "completed"}},
+	)},
+	{Name: "list-workflow-runs", Method: "GET", Path: "/repos/{owner}/{repo}/actions/runs", Description: "List workflow runs", Type: "read", Params: withPagination(
+		Param{Name: "branch", In: "query", Type: "string"},
+		Param{Name: "event", In: "query", Type: "string", Description: "Event that triggered the run, such as push or pull_request"},
+		Param{Name: "status", In: "query", Type: "string", Description: "Status or conclusion, such as in_progress or failure"},
+		Param{Name: "head_sha", In: "query", Type: "string"},
+	)},
 	{Name: "get-workflow-run", Method: "GET", Path: "/repos/{owner}/{repo}/actions/runs/{run_id}", Description: "Get a workflow run", Type: "read"},
-	{Name: "list-workflow-run-jobs", Method: "GET", Path: "/repos/{owner}/{repo}/actions/runs/{run_id}/jobs", Description: "List jobs for a workflow run", Type: "read"},
+	{Name: "list-workflow-run-jobs", Method: "GET", Path: "/repos/{owner}/{repo}/actions/runs/{run_id}/jobs", Description: "List jobs for a workflow run", Type: "read", Params: withPagination(
+		Param{Name: "filter", In: "query", Type: "string", Enum: []string{"latest", "all"}},
+	)},
 	{Name: "get-workflow-run-job-logs", Method: "GET", Path: "/repos/{owner}/{repo}/actions/jobs/{job_id}/logs", Description: "Get job logs", Type: "read"},
-	{Name: "merge-pr", Method: "PUT", Path: "/repos/{owner}/{repo}/pulls/{number}/merge", Description: "Merge a pull request", Type: "write"},
+	{Name: "merge-pr", Method: "PUT", Path: "/repos/{owner}/{repo}/pulls/{number}/merge", Description: "Merge a pull request", Type: "write", Params: []Param{
+		{Name: "merge_method", In: "body", Type: "string", Enum: []string{"merge", "squash", "rebase"}},
+		{Name: "commit_title", In: "body", Type: "string"},
+		{Name: "commit_message", In: "body", Type: "string"},
+		{Name: "sha", In: "body", Type: "string", Description: "Head SHA the pull request must match to be merged"},
+	}},
 }
 
 // defaultGitHubAPIBaseURL is the default upstream base URL for GitHub API.
 const defaultGitHubAPIBaseURL = "https://api.github.com"
 
 // APIServer is the REST API server that forge-gh calls. It proxies GitHub API
-// requests with policy enforcement.
+// requests with policy enforcement, and serves the same operations as MCP
+// tools at /mcp.
 type APIServer struct {
 	config      ProxyConfig
 	ghAuth      *GitHubAuth
-	upstreamURL string // base URL for upstream GitHub API, defaults to https://api.github.com
+	forge       forge  // forge of the project host
+	upstreamURL string // base URL for the project host's API, defaults to https://api.github.com
 	httpClient  *http.Client
+	audit       *AuditLog
+	approvals   *ApprovalQueue
+	visibility  *visibilityCache
+	cache       *Cache
+	rateLimit   *RateLimiter
 }
 
 // NewAPIServer creates a new API server with the given config and auth.
 func NewAPIServer(config ProxyConfig, ghAuth *GitHubAuth) *APIServer {
+	f := newForge(config.host(), config.forgeConfig(config.host()))
+	// The defaults are valid, so this cannot fail.
+	rateLimit, _ := NewRateLimiter("", DefaultRateLimitRate, DefaultRateLimitBurst, DefaultMaxRateLimitWait)
 	return &APIServer{
 		config:      config,
 		ghAuth:      ghAuth,
-		upstreamURL: defaultGitHubAPIBaseURL,
+		forge:       f,
+		upstreamURL: f.apiURL(),
 		httpClient:  http.DefaultClient,
+		visibility:  newVisibilityCache(),
+		rateLimit:   rateLimit,
 	}
 }
 
-// ServeHTTP routes requests to the appropriate handler.
+// ServeHTTP routes requests to the appropriate handler. Every request is
+// recorded in the audit log, if one is set.
 func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.audit.serve(w, r, "api", s.route)
+}
+
+// route dispatches a request to the handler for its path.
+func (s *APIServer) route(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case r.URL.Path == "/api/schema" && r.Method == http.MethodGet:
 		s.handleSchema(w, r)
+	case r.URL.Path == "/api/ratelimit" && r.Method == http.MethodGet:
+		s.handleRateLimit(w, r)
+	case r.URL.Path == "/api/graphql":
+		s.handleGraphQL(w, r)
+	case r.URL.Path == "/mcp":
+		s.handleMCP(w, r)
 	case strings.HasPrefix(r.URL.Path, "/api/github/"):
-		s.handleGitHubProxy(w, r)
+		s.handleGitHubProxy(w, r, "/api/github")
+	case strings.HasPrefix(r.URL.Path, "/api/v3/"):
+		// GitHub Enterprise Server REST layout, used by gh with GH_HOST
+		s.handleGitHubProxy(w, r, "/api/v3")
 	default:
 		http.Error(w, "not found", http.StatusNotFound)
 	}
 }
 
-// handleSchema returns the JSON schema of available operations.
+// handleSchema returns the JSON schema of available operations, with the
+// policy decision for each.
 func (s *APIServer) handleSchema(w http.ResponseWriter, _ *http.Request) {
-	resp := SchemaResponse{Operations: operations}
+	ops := make([]Operation, len(operations))
+	for i, op := range operations {
+		op.Policy = s.config.operationDecision(op.Name)
+		ops[i] = op
+	}
+	resp := SchemaResponse{Operations: ops}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// handleRateLimit returns the rate limits of the gateway's token, as last
+// reported by the forge.
+func (s *APIServer) handleRateLimit(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.rateLimit.status(s.config.host(), s.ghAuth.Token()))
+}
+
+// writeRateLimitError responds to a request the rate limiter did not let
+// through.
+func writeRateLimitError(w http.ResponseWriter, err error) {
+	var limitErr *rateLimitError
+	if errors.As(err, &limitErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(limitErr.wait.Round(time.Second).Seconds())))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	http.Error(w, fmt.Sprintf("request cancelled while waiting for the rate limit: %v", err), http.StatusServiceUnavailable)
+}
+
 // handleGitHubProxy proxies requests to the GitHub API with policy enforcement.
-func (s *APIServer) handleGitHubProxy(w http.ResponseWriter, r *http.Request) {
-	// Strip the /api/github prefix to get the GitHub API path
-	ghPath := strings.TrimPrefix(r.URL.Path, "/api/github")
+// Only requests matching a declared operation are forwarded. Forges whose API
+// follows GitHub's paths, such as Gitea, are proxied the same way.
+func (s *APIServer) handleGitHubProxy(w http.ResponseWriter, r *http.Request, prefix string) {
+	if !s.forge.githubAPI() {
+		http.Error(w, fmt.Sprintf("not implemented: the API is not supported for %s hosts", s.forge.kind()), http.StatusNotImplemented)
+		return
+	}
 
-	if !s.isAllowed(r.Method, ghPath) {
-		http.Error(w, "forbidden: write access denied for this repository", http.StatusForbidden)
+	// Strip the prefix to get the GitHub API path. The policy checks the
+	// same path that is sent upstream, so dot segments cannot step outside
+	// the repository they were authorized for.
+	ghPath, ok := cleanAPIPath(strings.TrimPrefix(r.URL.Path, prefix))
+	if !ok {
+		http.Error(w, "bad request: path must not contain empty, . or .. segments", http.StatusBadRequest)
 		return
 	}
 
-	s.forwardToGitHubAPI(w, r, ghPath)
-}
+	owner, repo := extractOwnerRepo(ghPath)
+	op := matchOperation(r.Method, ghPath)
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.Host = s.config.host()
+		entry.Owner = owner
+		entry.Repo = repo
+		if op != nil {
+			entry.Operation = op.Name
+		}
+	})
+	if op == nil {
+		http.Error(w, "forbidden: operation not supported by the gateway", http.StatusForbidden)
+		return
+	}
+
+	var approvals []string
+	switch s.config.operationDecision(op.Name) {
+	case OperationDeny:
+		http.Error(w, fmt.Sprintf("forbidden: operation %s is denied by policy", op.Name), http.StatusForbidden)
+		return
+	case OperationNeedsApproval:
+		approvals = append(approvals, fmt.Sprintf("operation %s requires approval", op.Name))
+	}
+
+	allowed, err := s.isAllowed(r.Context(), op, ghPath)
+	if err != nil {
+		http.Error(w, redact(fmt.Sprintf("forbidden: failed to check repository visibility: %v", err), s.ghAuth.Token()), http.StatusForbidden)
+		return
+	}
+	if !allowed {
+		if op.Type == "read" || !s.config.repoPolicy().NeedsWriteApproval(s.config.host(), owner, repo) {
+			http.Error(w, "forbidden: access denied for this repository", http.StatusForbidden)
+			return
+		}
+		approvals = append(approvals, fmt.Sprintf("writes to %s/%s require approval", owner, repo))
+	}
 
-// isAllowed checks whether a GitHub API request is permitted.
-// GET requests are always allowed (read).
-// POST/PUT/PATCH/DELETE: extract owner/repo from path, check against allowed.
-func (s *APIServer) isAllowed(method, path string) bool {
-	if method == http.MethodGet {
-		return true
+	if len(approvals) > 0 {
+		approved, reason := s.approvals.approve(r.Context(), ApprovalRequest{
+			Method:    r.Method,
+			Path:      ghPath,
+			Host:      s.config.host(),
+			Owner:     owner,
+			Repo:      repo,
+			Operation: op.Name,
+			Reason:    strings.Join(approvals, "; "),
+		})
+		if !approved {
+			http.Error(w, "forbidden: "+reason, http.StatusForbidden)
+			return
+		}
 	}
 
-	// Write operation: extract owner/repo and check
+	s.forwardToGitHubAPI(w, r, prefix, ghPath)
+}
+
+// isAllowed checks whether the repository in path permits the operation.
+// Read operations need a readable repo; write operations need a writable one.
+func (s *APIServer) isAllowed(ctx context.Context, op *Operation, path string) (bool, error) {
 	owner, repo := extractOwnerRepo(path)
 	if owner == "" || repo == "" {
 		// Cannot determine target repo, deny by default
+		return false, nil
+	}
+
+	if op.Type == "read" {
+		return s.canRead(ctx, owner, repo)
+	}
+	return s.config.repoPolicy().CanWrite(s.config.host(), owner, repo), nil
+}
+
+// canRead reports whether owner/repo on the project host can be read: the
+// policy allows it, or the policy allows public repositories and the forge
+// reports it as public.
+func (s *APIServer) canRead(ctx context.Context, owner, repo string) (bool, error) {
+	policy := s.config.repoPolicy()
+	host := s.config.host()
+	if policy.CanRead(host, owner, repo) {
+		return true, nil
+	}
+	if !policy.ReadsPublic(host, owner, repo) {
+		return false, nil
+	}
+	return s.visibility.isPublic(ctx, s.httpClient, s.forge, s.ghAuth.Token(), host, owner, repo)
+}
+
+// cleanAPIPath returns path with each segment escaped, or false if path has
+// an empty, "." or ".." segment. The forge would resolve dot segments to a
+// different resource than the one the policy matched.
+func cleanAPIPath(path string) (string, bool) {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", false
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/" + strings.Join(segments, "/"), true
+}
+
+// matchOperation returns the declared operation whose method and path
+// template match the request, or nil if none does.
+func matchOperation(method, path string) *Operation {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := range operations {
+		op := &operations[i]
+		if op.Method == method && matchPathTemplate(op.Path, segments) {
+			return op
+		}
+	}
+	return nil
+}
+
+// matchPathTemplate reports whether path segments match a template such as
+// /repos/{owner}/{repo}/pulls/{number}. Parameters match any non-empty segment,
+// and a final parameter such as {path...} matches one or more segments.
+func matchPathTemplate(template string, segments []string) bool {
+	parts := strings.Split(strings.TrimPrefix(template, "/"), "/")
+	if last := parts[len(parts)-1]; strings.HasSuffix(last, "...}") && len(segments) > len(parts) {
+		segments = append(segments[:len(parts)-1:len(parts)-1], strings.Join(segments[len(parts)-1:], "/"))
+	}
+	if len(parts) != len(segments) {
 		return false
 	}
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return false
+		}
+	}
+	return true
+}
 
-	return strings.EqualFold(owner, s.config.AllowedOwner) &&
-		strings.EqualFold(repo, s.config.AllowedRepo)
+// findOperation returns the declared operation with the given name, or nil.
+func findOperation(name string) *Operation {
+	for i := range operations {
+		if operations[i].Name == name {
+			return &operations[i]
+		}
+	}
+	return nil
 }
 
 // extractOwnerRepo extracts the owner and repo from a GitHub API path.
@@ -134,44 +411,111 @@ func extractOwnerRepo(path string) (string, string) {
 	return "", ""
 }
 
-// forwardToGitHubAPI forwards a request to the GitHub API.
-func (s *APIServer) forwardToGitHubAPI(w http.ResponseWriter, r *http.Request, ghPath string) {
+// forwardToGitHubAPI forwards a request to the GitHub API. The client reached
+// ghPath under prefix, which is where pagination links are pointed back to.
+func (s *APIServer) forwardToGitHubAPI(w http.ResponseWriter, r *http.Request, prefix, ghPath string) {
 	targetURL := s.upstreamURL + ghPath
+	if ghPath == "/graphql" {
+		// GitHub Enterprise Server serves GraphQL outside the REST API's /api/v3.
+		targetURL = graphQLURL(s.upstreamURL)
+	}
 	if r.URL.RawQuery != "" {
 		targetURL += "?" + r.URL.RawQuery
 	}
 
-	upstreamReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, r.Body)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to create upstream request: %v", err), http.StatusInternalServerError)
-		return
+	// Buffer the request body, so that the request can be retried after a
+	// rate limit response.
+	var reqBody []byte
+	if r.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(r.Body); err != nil {
+			http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+			return
+		}
 	}
 
-	// Copy request headers
-	for key, values := range r.Header {
-		for _, value := range values {
-			upstreamReq.Header.Add(key, value)
-		}
+	token := s.ghAuth.Token()
+	host := s.config.host()
+	resource := rateLimitResource(ghPath)
+
+	// Revalidate a cached response instead of reading it again.
+	var cacheKey string
+	var cached *cachedResponse
+	if s.cache.cachesAPI(r, ghPath) {
+		cacheKey = apiKey(targetURL, r.Header.Get("Accept-Encoding"), token)
+		cached = s.cache.loadResponse(cacheKey)
 	}
 
-	// Set GitHub API headers
-	upstreamReq.Header.Set("Authorization", "Bearer "+s.ghAuth.Token())
-	upstreamReq.Header.Set("Accept", "application/vnd.github+json")
-	upstreamReq.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		if err := s.rateLimit.wait(r.Context(), host, token, resource); err != nil {
+			writeRateLimitError(w, err)
+			return
+		}
 
-	resp, err := s.httpClient.Do(upstreamReq)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to contact GitHub API: %v", err), http.StatusBadGateway)
-		return
+		upstreamReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, bytes.NewReader(reqBody))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to create upstream request: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Copy request headers, except the client's credentials
+		copyRequestHeader(upstreamReq.Header, r.Header)
+
+		// Set GitHub API headers
+		s.forge.authorizeAPI(upstreamReq, token)
+		upstreamReq.Header.Set("Accept", "application/vnd.github+json")
+		upstreamReq.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if cached != nil {
+			cached.setConditional(upstreamReq)
+		}
+
+		resp, err = s.httpClient.Do(upstreamReq)
+		if err != nil {
+			http.Error(w, redact(fmt.Sprintf("failed to contact %s API: %v", host, err), token), http.StatusBadGateway)
+			return
+		}
+
+		// Retry rate limit responses that say to wait briefly; the wait
+		// before the next attempt holds the request until then.
+		retryAfter, limited := s.rateLimit.record(host, token, resource, resp)
+		if !limited || attempt == maxRateLimitRetries || retryAfter > s.rateLimit.maxWait {
+			break
+		}
+		resp.Body.Close()
 	}
 	defer resp.Body.Close()
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.UpstreamStatus = resp.StatusCode
+	})
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
+	status, header, body := resp.StatusCode, resp.Header, io.Reader(resp.Body)
+	switch {
+	case cached != nil && resp.StatusCode == http.StatusNotModified:
+		status, header, body = cached.Status, cached.revalidated(resp.Header), bytes.NewReader(cached.Body)
+		annotateAudit(r.Context(), func(entry *AuditEntry) {
+			entry.Cache = "hit"
+		})
+	case cacheKey != "" && cacheable(resp):
+		body = s.cache.storeResponse(cacheKey, resp)
+	}
+
+	// Copy response headers, except those about the credentials. Pagination
+	// links point at the upstream API, so rewrite them to come back through
+	// the gateway.
+	copyResponseHeader(w.Header(), header)
+	gatewayURL := requestBaseURL(r) + prefix
+	for i, value := range w.Header()["Link"] {
+		w.Header()["Link"][i] = strings.ReplaceAll(value, s.upstreamURL, gatewayURL)
+	}
+	w.WriteHeader(status)
+	io.Copy(w, body)
+}
+
+// requestBaseURL returns the scheme and host the client used to reach the gateway.
+func requestBaseURL(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
 	}
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	return "http://" + r.Host
 }
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -340,6 +341,37 @@ func TestAPIServer_ForwardsResponseHeaders(t *testing.T) {
 	assert.Equal(t, "custom-value", w.Header().Get("X-Custom-Header"))
 }
 
+func TestAPIServer_StripsSensitiveHeaders(t *testing.T) {
+	var capturedHeaders http.Header
+	ghAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedHeaders = r.Header
+		w.Header().Set("Set-Cookie", "_gh_sess=abc")
+		w.Header().Set("X-OAuth-Scopes", "repo, workflow")
+		w.Header().Set("GitHub-Authentication-Token-Expiration", "2026-01-01 00:00:00 UTC")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer ghAPI.Close()
+
+	server := newTestAPIServer(ghAPI.URL)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/github/repos/owner/repo", nil)
+	req.Header.Set("Authorization", "token client-token")
+	req.Header.Set("Private-Token", "client-token")
+	w := httptest.NewRecorder()
+
+	server.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Bearer test-token", capturedHeaders.Get("Authorization"))
+	assert.Empty(t, capturedHeaders.Get("Private-Token"))
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+	assert.Empty(t, w.Header().Get("X-OAuth-Scopes"))
+	assert.Empty(t, w.Header().Get("GitHub-Authentication-Token-Expiration"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
 func TestAPIServer_UpstreamError(t *testing.T) {
 	server := NewAPIServer(
 		ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"},
@@ -353,7 +385,7 @@ func TestAPIServer_UpstreamError(t *testing.T) {
 	server.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusBadGateway, w.Code)
-	assert.Contains(t, w.Body.String(), "failed to contact GitHub API")
+	assert.Contains(t, w.Body.String(), "failed to contact github.com API")
 }
 
 func TestExtractOwnerRepo(t *testing.T) {
@@ -451,3 +483,320 @@ func newTestAPIServer(testServerURL string) *APIServer {
 	server.upstreamURL = testServerURL
 	return server
 }
+
+func TestAPIServer_OperationPolicy(t *testing.T) {
+	ghAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ghAPI.Close()
+
+	config := ProxyConfig{
+		AllowedOwner: "my-owner",
+		AllowedRepo:  "my-repo",
+		Policy: &Policy{
+			Operations: map[string]string{
+				"merge-pr":     OperationNeedsApproval,
+				"create-issue": OperationDeny,
+				"list-prs":     OperationAllow,
+			},
+		},
+	}
+	server := NewTestAPIServer(config, NewGitHubAuthFromToken("test-token"), ghAPI.URL)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "explicitly allowed operation",
+			method:     http.MethodGet,
+			path:       "/api/github/repos/my-owner/my-repo/pulls",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "operation not listed in policy is allowed",
+			method:     http.MethodPost,
+			path:       "/api/github/repos/my-owner/my-repo/pulls",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "denied operation",
+			method:     http.MethodPost,
+			path:       "/api/github/repos/my-owner/my-repo/issues",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "operation create-issue is denied by policy",
+		},
+		{
+			name:       "operation needing approval",
+			method:     http.MethodPut,
+			path:       "/api/github/repos/my-owner/my-repo/pulls/1/merge",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "operation merge-pr requires approval",
+		},
+		{
+			name:       "delete repository is not an operation",
+			method:     http.MethodDelete,
+			path:       "/api/github/repos/my-owner/my-repo",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "operation not supported by the gateway",
+		},
+		{
+			name:       "secrets are not an operation",
+			method:     http.MethodGet,
+			path:       "/api/github/repos/my-owner/my-repo/actions/secrets",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "operation not supported by the gateway",
+		},
+		{
+			name:       "workflow dispatch is not an operation",
+			method:     http.MethodPost,
+			path:       "/api/github/repos/my-owner/my-repo/actions/workflows/ci.yml/dispatches",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "operation not supported by the gateway",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestAPIServer_Approval(t *testing.T) {
+	ghAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ghAPI.Close()
+
+	config := ProxyConfig{
+		AllowedOwner: "my-owner",
+		AllowedRepo:  "my-repo",
+		Policy: &Policy{
+			Repos:      RepoPolicy{Write: AccessList{NeedsApproval: []string{"other-owner/*"}}},
+			Operations: map[string]string{"merge-pr": OperationNeedsApproval},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		approval   string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "operation approved",
+			approval:   ApprovalApprove,
+			method:     http.MethodPut,
+			path:       "/api/github/repos/my-owner/my-repo/pulls/1/merge",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "operation denied by the host user",
+			approval:   ApprovalDeny,
+			method:     http.MethodPut,
+			path:       "/api/github/repos/my-owner/my-repo/pulls/1/merge",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "forbidden: operation merge-pr requires approval: denied by the host user",
+		},
+		{
+			name:       "write to a repository needing approval",
+			approval:   ApprovalApprove,
+			method:     http.MethodPost,
+			path:       "/api/github/repos/other-owner/lib/issues",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "both approvals are asked for at once",
+			approval:   ApprovalDeny,
+			method:     http.MethodPut,
+			path:       "/api/github/repos/other-owner/lib/pulls/1/merge",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "forbidden: operation merge-pr requires approval; writes to other-owner/lib require approval: denied by the host user",
+		},
+		{
+			name:       "write to a repository outside the approval list",
+			approval:   ApprovalApprove,
+			method:     http.MethodPost,
+			path:       "/api/github/repos/third-owner/lib/issues",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "forbidden: access denied for this repository",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewTestAPIServer(config, NewGitHubAuthFromToken("test-token"), ghAPI.URL)
+			server.approvals = newTestApprovalQueue(t, tt.approval, 5*time.Second)
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestAPIServer_ReadScope(t *testing.T) {
+	upstream := newReadScopeUpstream(t)
+	server := NewTestAPIServer(readScopeConfig, NewGitHubAuthFromToken("test-token"), upstream.URL)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "read the project repo", method: http.MethodGet, path: "/api/github/repos/my-owner/my-repo/issues", wantStatus: http.StatusOK},
+		{name: "read a submodule", method: http.MethodGet, path: "/api/github/repos/my-owner/lib/pulls", wantStatus: http.StatusOK},
+		{name: "read a public repo", method: http.MethodGet, path: "/api/github/repos/other-owner/public-tools/issues", wantStatus: http.StatusOK},
+		{
+			name:       "read a private repo",
+			method:     http.MethodGet,
+			path:       "/api/github/repos/my-owner/private-tools/issues",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "access denied for this repository",
+		},
+		{
+			name:       "write to a public repo",
+			method:     http.MethodPost,
+			path:       "/api/github/repos/other-owner/public-tools/issues",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "access denied for this repository",
+		},
+		{
+			name:       "dot segments out of the project repo",
+			method:     http.MethodGet,
+			path:       "/api/github/repos/my-owner/my-repo/contents/../../../my-owner/private-tools/contents/x",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "must not contain empty, . or .. segments",
+		},
+		{
+			name:       "escaped dot segments out of the project repo",
+			method:     http.MethodGet,
+			path:       "/api/github/repos/my-owner/my-repo/contents/%2e%2e/%2E%2E/%2e%2e/my-owner/private-tools/contents/x",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "must not contain empty, . or .. segments",
+		},
+		{
+			name:       "single dot segment",
+			method:     http.MethodGet,
+			path:       "/api/github/repos/my-owner/./my-repo/issues",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "must not contain empty, . or .. segments",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestAPIServer_SchemaIncludesPolicy(t *testing.T) {
+	server := NewAPIServer(
+		ProxyConfig{
+			AllowedOwner: "my-owner",
+			AllowedRepo:  "my-repo",
+			Policy:       &Policy{Operations: map[string]string{"merge-pr": OperationDeny}},
+		},
+		NewGitHubAuthFromToken("test-token"),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/schema", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	var resp SchemaResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+
+	policies := make(map[string]string)
+	for _, op := range resp.Operations {
+		policies[op.Name] = op.Policy
+	}
+	assert.Equal(t, OperationDeny, policies["merge-pr"])
+	assert.Equal(t, OperationAllow, policies["create-pr"])
+	// The declared operations are not modified.
+	assert.Empty(t, findOperation("merge-pr").Policy)
+}
+
+func TestCleanAPIPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{path: "/repos/o/r/pulls", want: "/repos/o/r/pulls", wantOK: true},
+		{path: "/repos/o/r/contents/docs/getting started.md", want: "/repos/o/r/contents/docs/getting%20started.md", wantOK: true},
+		{path: "/repos/o/r/contents/a?b#c", want: "/repos/o/r/contents/a%3Fb%23c", wantOK: true},
+		{path: "/repos/o/r/contents/.github/workflows", want: "/repos/o/r/contents/.github/workflows", wantOK: true},
+		{path: "/repos/o/r/contents/../../x/y"},
+		{path: "/repos/o/r/contents/./README.md"},
+		{path: "/repos/o//pulls"},
+		{path: "/repos/o/r/pulls/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := cleanAPIPath(tt.path)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchOperation(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodGet, path: "/repos/o/r/pulls", want: "list-prs"},
+		{method: http.MethodPost, path: "/repos/o/r/pulls", want: "create-pr"},
+		{method: http.MethodGet, path: "/repos/o/r/pulls/1", want: "get-pr"},
+		{method: http.MethodPut, path: "/repos/o/r/pulls/1/merge", want: "merge-pr"},
+		{method: http.MethodGet, path: "/repos/o/r", want: "get-repo"},
+		{method: http.MethodGet, path: "/repos/o/r/actions/jobs/5/logs", want: "get-workflow-run-job-logs"},
+		{method: http.MethodGet, path: "/repos/o/r/contents/README.md", want: "get-file-contents"},
+		{method: http.MethodGet, path: "/repos/o/r/contents/docs/guide/intro.md", want: "get-file-contents"},
+		{method: http.MethodGet, path: "/repos/o/r/contents/"},
+		{method: http.MethodGet, path: "/repos/o/r/pulls/1/reviews", want: "list-pr-reviews"},
+		{method: http.MethodDelete, path: "/repos/o/r"},
+		{method: http.MethodGet, path: "/repos/o/r/pulls/"},
+		{method: http.MethodGet, path: "/repos/o//pulls"},
+		{method: http.MethodGet, path: "/user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			got := matchOperation(tt.method, tt.path)
+			if tt.want == "" {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, tt.want, got.Name)
+		})
+	}
+}
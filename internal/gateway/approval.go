@@ -0,0 +1,237 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultApprovalTimeout is how long a request waits for the host user's
+// decision before it is denied.
+const DefaultApprovalTimeout = 5 * time.Minute
+
+// approvalPollInterval is how often a parked request checks for a decision.
+const approvalPollInterval = 250 * time.Millisecond
+
+// Decisions the host user can make on an approval request.
+const (
+	ApprovalApprove = "approve"
+	ApprovalDeny    = "deny"
+)
+
+// ApprovalRequest is a gateway request parked until the host user decides
+// on it. It is written to the approvals directory as {id}.json, and the
+// decision is written next to it as {id}.decision.
+type ApprovalRequest struct {
+	ID        string           `json:"id"`
+	Time      time.Time        `json:"time"`
+	Expires   time.Time        `json:"expires"`
+	Session   string           `json:"session,omitempty"`
+	Method    string           `json:"method"`
+	Path      string           `json:"path"`
+	Host      string           `json:"host,omitempty"`
+	Owner     string           `json:"owner,omitempty"`
+	Repo      string           `json:"repo,omitempty"`
+	Operation string           `json:"operation,omitempty"`
+	Refs      []AuditRefUpdate `json:"refs,omitempty"`
+	// Reason says why the request needs approval, such as "operation
+	// merge-pr requires approval".
+	Reason string `json:"reason"`
+}
+
+// approvalDecision is the content of a decision file.
+type approvalDecision struct {
+	Decision string    `json:"decision"`
+	Time     time.Time `json:"time"`
+}
+
+// ApprovalQueue parks requests that need approval in a directory shared
+// with the host, and waits for the host user to decide on them with
+// claude-forge approvals. A nil queue denies every request that needs
+// approval.
+type ApprovalQueue struct {
+	dir          string
+	session      string
+	timeout      time.Duration
+	pollInterval time.Duration
+	now          func() time.Time
+}
+
+// NewApprovalQueue creates an approval queue in dir, recording session in
+// every request. Requests without a decision after timeout are denied.
+func NewApprovalQueue(dir, session string, timeout time.Duration) (*ApprovalQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create approvals directory: %w", err)
+	}
+	return &ApprovalQueue{
+		dir:          dir,
+		session:      session,
+		timeout:      timeout,
+		pollInterval: approvalPollInterval,
+		now:          time.Now,
+	}, nil
+}
+
+// approve parks req until the host user decides on it, and reports whether
+// they approved it. When it returns false, the message says why, prefixed
+// with req.Reason. The outcome is recorded in the request's audit entry.
+func (q *ApprovalQueue) approve(ctx context.Context, req ApprovalRequest) (bool, string) {
+	if q == nil {
+		return false, req.Reason
+	}
+
+	approved, message := q.wait(ctx, req)
+	annotateAudit(ctx, func(entry *AuditEntry) {
+		entry.Approval = message
+		if approved {
+			entry.Approval = "approved by the host user"
+		}
+	})
+	if approved {
+		return true, ""
+	}
+	return false, req.Reason + ": " + message
+}
+
+// wait writes req to the queue and polls for its decision. It returns
+// whether the request was approved, or a message saying why not.
+func (q *ApprovalQueue) wait(ctx context.Context, req ApprovalRequest) (bool, string) {
+	id, err := newApprovalID()
+	if err != nil {
+		return false, err.Error()
+	}
+	req.ID = id
+	req.Session = q.session
+	req.Time = q.now().UTC()
+	req.Expires = req.Time.Add(q.timeout)
+
+	requestPath := filepath.Join(q.dir, id+".json")
+	decisionPath := filepath.Join(q.dir, id+".decision")
+	if err := writeFileAtomic(requestPath, req); err != nil {
+		return false, fmt.Sprintf("failed to queue approval request: %v", err)
+	}
+	defer os.Remove(requestPath)
+	defer os.Remove(decisionPath)
+
+	timeout := time.NewTimer(q.timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		data, err := os.ReadFile(decisionPath)
+		if err == nil {
+			var decision approvalDecision
+			if err := json.Unmarshal(data, &decision); err != nil {
+				return false, fmt.Sprintf("invalid decision: %v", err)
+			}
+			if decision.Decision == ApprovalApprove {
+				return true, ""
+			}
+			return false, "denied by the host user"
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, "request cancelled while waiting for approval"
+		case <-timeout.C:
+			return false, fmt.Sprintf("no decision from the host user within %s", q.timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// newApprovalID returns a random ID for an approval request.
+func newApprovalID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate approval ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// writeFileAtomic writes v as JSON to a temporary file and renames it to
+// path, so that readers never see a partial file.
+func writeFileAtomic(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ListApprovals returns the requests in dir waiting for a decision, oldest
+// first. A missing directory has no requests.
+func ListApprovals(dir string) ([]ApprovalRequest, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approvals directory: %w", err)
+	}
+
+	var requests []ApprovalRequest
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || strings.HasPrefix(id, ".") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, id+".decision")); err == nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			// The gateway removed it after a decision or timeout.
+			continue
+		}
+		var req ApprovalRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			continue
+		}
+		requests = append(requests, req)
+	}
+
+	slices.SortFunc(requests, func(a, b ApprovalRequest) int {
+		return a.Time.Compare(b.Time)
+	})
+	return requests, nil
+}
+
+// DecideApproval records the host user's decision, ApprovalApprove or
+// ApprovalDeny, on the pending request id in dir.
+func DecideApproval(dir, id, decision string) error {
+	if decision != ApprovalApprove && decision != ApprovalDeny {
+		return fmt.Errorf("invalid decision %q: expected %q or %q", decision, ApprovalApprove, ApprovalDeny)
+	}
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return fmt.Errorf("invalid approval ID %q", id)
+	}
+	if _, err := os.Stat(filepath.Join(dir, id+".json")); err != nil {
+		return fmt.Errorf("no pending approval request %s", id)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, id+".decision"), approvalDecision{Decision: decision, Time: time.Now().UTC()}); err != nil {
+		return fmt.Errorf("failed to write decision: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package gateway
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestApprovalQueue creates an approval queue in a temporary directory.
+// Unless decision is empty, the host user makes decision on every request
+// as it arrives.
+func newTestApprovalQueue(t *testing.T, decision string, timeout time.Duration) *ApprovalQueue {
+	t.Helper()
+	queue, err := NewApprovalQueue(filepath.Join(t.TempDir(), "approvals"), "abc12345", timeout)
+	require.NoError(t, err)
+	queue.pollInterval = 5 * time.Millisecond
+	if decision == "" {
+		return queue
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		for {
+			requests, _ := ListApprovals(queue.dir)
+			for _, req := range requests {
+				DecideApproval(queue.dir, req.ID, decision)
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+	return queue
+}
+
+func TestApprovalQueue_Approve(t *testing.T) {
+	tests := []struct {
+		name         string
+		decision     string
+		timeout      time.Duration
+		wantApproved bool
+		wantReason   string
+		wantApproval string
+	}{
+		{
+			name:         "approved",
+			decision:     ApprovalApprove,
+			timeout:      5 * time.Second,
+			wantApproved: true,
+			wantApproval: "approved by the host user",
+		},
+		{
+			name:         "denied",
+			decision:     ApprovalDeny,
+			timeout:      5 * time.Second,
+			wantReason:   "operation merge-pr requires approval: denied by the host user",
+			wantApproval: "denied by the host user",
+		},
+		{
+			name:         "timed out",
+			timeout:      20 * time.Millisecond,
+			wantReason:   "operation merge-pr requires approval: no decision from the host user within 20ms",
+			wantApproval: "no decision from the host user within 20ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := newTestApprovalQueue(t, tt.decision, tt.timeout)
+			entry := &AuditEntry{}
+			ctx := context.WithValue(context.Background(), auditEntryKey{}, entry)
+
+			approved, reason := queue.approve(ctx, ApprovalRequest{
+				Method:    "PUT",
+				Path:      "/repos/my-owner/my-repo/pulls/1/merge",
+				Operation: "merge-pr",
+				Reason:    "operation merge-pr requires approval",
+			})
+
+			assert.Equal(t, tt.wantApproved, approved)
+			assert.Equal(t, tt.wantReason, reason)
+			assert.Equal(t, tt.wantApproval, entry.Approval)
+
+			// The request and its decision are removed once handled.
+			files, err := os.ReadDir(queue.dir)
+			require.NoError(t, err)
+			assert.Empty(t, files)
+		})
+	}
+}
+
+func TestApprovalQueue_Nil(t *testing.T) {
+	var queue *ApprovalQueue
+
+	approved, reason := queue.approve(context.Background(), ApprovalRequest{Reason: "operation merge-pr requires approval"})
+
+	assert.False(t, approved)
+	assert.Equal(t, "operation merge-pr requires approval", reason)
+}
+
+func TestApprovalQueue_Cancelled(t *testing.T) {
+	queue := newTestApprovalQueue(t, "", time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	approved, reason := queue.approve(ctx, ApprovalRequest{Reason: "writes to other/repo require approval"})
+
+	assert.False(t, approved)
+	assert.Equal(t, "writes to other/repo require approval: request cancelled while waiting for approval", reason)
+}
+
+func TestListApprovals(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	require.NoError(t, writeFileAtomic(filepath.Join(dir, "bbbb.json"), ApprovalRequest{ID: "bbbb", Time: now.Add(time.Second)}))
+	require.NoError(t, writeFileAtomic(filepath.Join(dir, "aaaa.json"), ApprovalRequest{ID: "aaaa", Time: now}))
+	require.NoError(t, writeFileAtomic(filepath.Join(dir, "cccc.json"), ApprovalRequest{ID: "cccc", Time: now}))
+	require.NoError(t, writeFileAtomic(filepath.Join(dir, "cccc.decision"), approvalDecision{Decision: ApprovalApprove}))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dddd.json"), []byte("{"), 0o644))
+
+	requests, err := ListApprovals(dir)
+
+	require.NoError(t, err)
+	var ids []string
+	for _, req := range requests {
+		ids = append(ids, req.ID)
+	}
+	assert.Equal(t, []string{"aaaa", "bbbb"}, ids)
+
+	requests, err = ListApprovals(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, requests)
+}
+
+func TestDecideApproval(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, writeFileAtomic(filepath.Join(dir, "aaaa.json"), ApprovalRequest{ID: "aaaa"}))
+
+	tests := []struct {
+		name     string
+		id       string
+		decision string
+		wantErr  string
+	}{
+		{name: "approve", id: "aaaa", decision: ApprovalApprove},
+		{name: "invalid decision", id: "aaaa", decision: "maybe", wantErr: `invalid decision "maybe"`},
+		{name: "unknown request", id: "bbbb", decision: ApprovalDeny, wantErr: "no pending approval request bbbb"},
+		{name: "path in ID", id: "../aaaa", decision: ApprovalDeny, wantErr: `invalid approval ID "../aaaa"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DecideApproval(dir, tt.id, tt.decision)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.FileExists(t, filepath.Join(dir, tt.id+".decision"))
+		})
+	}
+}
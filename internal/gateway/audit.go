@@ -0,0 +1,254 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAuditReasonSize bounds how much of an error response is kept as the
+// reason of a denied or failed request.
+const maxAuditReasonSize = 512
+
+// Audit decisions.
+const (
+	AuditAllow = "allow"
+	AuditDeny  = "deny"
+	AuditError = "error"
+)
+
+// AuditEntry is a single line of the gateway audit log, describing one
+// request and how the gateway handled it.
+type AuditEntry struct {
+	Time      time.Time        `json:"time"`
+	Session   string           `json:"session,omitempty"`
+	Server    string           `json:"server"` // "git", "api", "egress", or "ssh"
+	Method    string           `json:"method"`
+	Path      string           `json:"path"`
+	Host      string           `json:"host,omitempty"`
+	Owner     string           `json:"owner,omitempty"`
+	Repo      string           `json:"repo,omitempty"`
+	Service   string           `json:"service,omitempty"`   // git service, e.g. git-receive-pack or git-lfs
+	Operation string           `json:"operation,omitempty"` // API operation or GraphQL root fields
+	Refs      []AuditRefUpdate `json:"refs,omitempty"`
+	Decision  string           `json:"decision"`
+	Reason    string           `json:"reason,omitempty"`
+	// Approval is the outcome of asking the host user to approve the
+	// request, if it needed approval.
+	Approval string `json:"approval,omitempty"`
+	// Cache is "mirror" for git requests served from a mirror, and "hit"
+	// for API requests served from the cache after revalidation.
+	Cache  string `json:"cache,omitempty"`
+	Status int    `json:"status"`
+	// UpstreamStatus is the status GitHub responded with, or 0 if the
+	// request was not forwarded.
+	UpstreamStatus int   `json:"upstream_status,omitempty"`
+	BytesIn        int64 `json:"bytes_in"`
+	BytesOut       int64 `json:"bytes_out"`
+	DurationMS     int64 `json:"duration_ms"`
+}
+
+// AuditRefUpdate is a ref update requested by a push.
+type AuditRefUpdate struct {
+	Ref    string `json:"ref"`
+	OldOID string `json:"old"`
+	NewOID string `json:"new"`
+}
+
+// AuditLog writes an AuditEntry as a JSON line for every request the
+// gateway handles, and feeds the gateway's metrics. A nil *AuditLog logs
+// nothing, and one without a writer only feeds the metrics.
+type AuditLog struct {
+	session string
+	now     func() time.Time
+	metrics *Metrics
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAuditLog creates an audit log writing to w, recording session in every
+// entry.
+func NewAuditLog(w io.Writer, session string) *AuditLog {
+	return &AuditLog{
+		session: session,
+		now:     time.Now,
+		w:       w,
+	}
+}
+
+// auditEntryKey is the context key of the request's *AuditEntry.
+type auditEntryKey struct{}
+
+// annotateAudit lets a handler record what it learned about the request in
+// the request's audit entry. It does nothing when auditing is disabled.
+func annotateAudit(ctx context.Context, annotate func(entry *AuditEntry)) {
+	if entry, ok := ctx.Value(auditEntryKey{}).(*AuditEntry); ok {
+		annotate(entry)
+	}
+}
+
+// serve runs handler for the request and logs the outcome. Handlers fill in
+// details with annotateAudit; method, path, status, sizes, and duration are
+// recorded here.
+func (l *AuditLog) serve(w http.ResponseWriter, r *http.Request, server string, handler func(http.ResponseWriter, *http.Request)) {
+	if l == nil {
+		handler(w, r)
+		return
+	}
+
+	start := l.now()
+	entry := &AuditEntry{
+		Time:    start.UTC(),
+		Session: l.session,
+		Server:  server,
+		Method:  r.Method,
+		Path:    r.URL.Path,
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), auditEntryKey{}, entry))
+	body := &countingBody{r: r.Body}
+	if r.Body != nil {
+		r.Body = body
+	}
+	rw := &auditResponseWriter{ResponseWriter: w}
+
+	handler(rw, r)
+
+	entry.Status = rw.status
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK
+	}
+	// Handlers that hijack the connection add the bytes they copied.
+	entry.BytesIn += body.n
+	entry.BytesOut += rw.n
+	if entry.Reason == "" && entry.UpstreamStatus == 0 && entry.Status >= http.StatusBadRequest {
+		entry.Reason = auditReason(rw.errBody)
+	}
+	l.finish(entry, start)
+}
+
+// record runs handler for a request that did not arrive over HTTP, such as a
+// git command over SSH, and logs the outcome. entry describes the request,
+// and handler returns the HTTP status equivalent to its outcome; handlers
+// fill in details with annotateAudit, including the sizes.
+func (l *AuditLog) record(ctx context.Context, entry *AuditEntry, handler func(ctx context.Context) int) {
+	if l == nil {
+		handler(ctx)
+		return
+	}
+
+	start := l.now()
+	entry.Time = start.UTC()
+	entry.Session = l.session
+	entry.Status = handler(context.WithValue(ctx, auditEntryKey{}, entry))
+	l.finish(entry, start)
+}
+
+// finish completes entry for a request that started at start, and logs it.
+func (l *AuditLog) finish(entry *AuditEntry, start time.Time) {
+	duration := l.now().Sub(start)
+	entry.DurationMS = duration.Milliseconds()
+	if entry.Decision == "" {
+		entry.Decision = auditDecision(entry)
+	}
+	entry.Reason = redact(entry.Reason)
+
+	l.metrics.observe(entry, duration)
+	if l.w != nil {
+		l.write(entry)
+	}
+}
+
+// write appends entry to the log. Failures are ignored, so that a full disk
+// does not take the gateway down.
+func (l *AuditLog) write(entry *AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+}
+
+// auditDecision derives the decision for a request no handler decided on.
+// Forwarded requests were allowed; a 403 from the gateway itself is a policy
+// denial; anything else the gateway answered is an error.
+func auditDecision(entry *AuditEntry) string {
+	switch {
+	case entry.UpstreamStatus != 0:
+		return AuditAllow
+	case entry.Status == http.StatusForbidden:
+		return AuditDeny
+	case entry.Status < http.StatusBadRequest:
+		return AuditAllow
+	default:
+		return AuditError
+	}
+}
+
+// auditReason extracts the message from an error response written by the
+// gateway, either plain text or a GraphQL error.
+func auditReason(body []byte) string {
+	var graphQLErr graphQLErrorResponse
+	if json.Unmarshal(body, &graphQLErr) == nil && len(graphQLErr.Errors) > 0 {
+		return graphQLErr.Errors[0].Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingBody) Close() error {
+	return c.r.Close()
+}
+
+// auditResponseWriter records the status and size of a response, and the
+// start of error responses.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	n       int64
+	errBody []byte
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= http.StatusBadRequest && len(w.errBody) < maxAuditReasonSize {
+		w.errBody = append(w.errBody, p[:min(len(p), maxAuditReasonSize-len(w.errBody))]...)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *auditResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,204 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("upstream body"))
+	}))
+	defer upstream.Close()
+
+	pushBody := pktLine(testOID1+" "+testOID2+" refs/heads/main\x00report-status\n") + "0000"
+
+	tests := []struct {
+		name   string
+		server string
+		method string
+		path   string
+		body   string
+		want   AuditEntry
+	}{
+		{
+			name:   "git fetch forwarded",
+			server: "git",
+			method: http.MethodGet,
+			path:   "/github.com/other-owner/other-repo.git/info/refs?service=git-upload-pack",
+			want: AuditEntry{
+				Server:         "git",
+				Method:         http.MethodGet,
+				Path:           "/github.com/other-owner/other-repo.git/info/refs",
+				Host:           "github.com",
+				Owner:          "other-owner",
+				Repo:           "other-repo",
+				Service:        "git-upload-pack",
+				Decision:       AuditAllow,
+				Status:         http.StatusAccepted,
+				UpstreamStatus: http.StatusAccepted,
+				BytesOut:       int64(len("upstream body")),
+			},
+		},
+		{
+			name:   "git push to another repository denied",
+			server: "git",
+			method: http.MethodPost,
+			path:   "/github.com/other-owner/other-repo.git/git-receive-pack",
+			body:   pushBody,
+			want: AuditEntry{
+				Server:   "git",
+				Method:   http.MethodPost,
+				Path:     "/github.com/other-owner/other-repo.git/git-receive-pack",
+				Host:     "github.com",
+				Owner:    "other-owner",
+				Repo:     "other-repo",
+				Service:  "git-receive-pack",
+				Decision: AuditDeny,
+				Reason:   "forbidden: access denied for this repository",
+				Status:   http.StatusForbidden,
+				BytesOut: int64(len("forbidden: access denied for this repository\n")),
+			},
+		},
+		{
+			name:   "git push to a protected ref rejected",
+			server: "git",
+			method: http.MethodPost,
+			path:   "/github.com/my-owner/my-repo.git/git-receive-pack",
+			body:   pushBody,
+			want: AuditEntry{
+				Server:   "git",
+				Method:   http.MethodPost,
+				Path:     "/github.com/my-owner/my-repo.git/git-receive-pack",
+				Host:     "github.com",
+				Owner:    "my-owner",
+				Repo:     "my-repo",
+				Service:  "git-receive-pack",
+				Refs:     []AuditRefUpdate{{Ref: "refs/heads/main", OldOID: testOID1, NewOID: testOID2}},
+				Decision: AuditDeny,
+				Reason:   "refs/heads/main: protected ref cannot be pushed to through the gateway",
+				Status:   http.StatusOK,
+				BytesIn:  int64(len(pushBody)),
+				BytesOut: int64(len(pktLine("unpack ok\n") + pktLine("ng refs/heads/main protected ref cannot be pushed to through the gateway\n") + "0000")),
+			},
+		},
+		{
+			name:   "API operation forwarded",
+			server: "api",
+			method: http.MethodPost,
+			path:   "/api/github/repos/my-owner/my-repo/pulls",
+			body:   `{"title":"t"}`,
+			want: AuditEntry{
+				Server:         "api",
+				Method:         http.MethodPost,
+				Path:           "/api/github/repos/my-owner/my-repo/pulls",
+				Host:           "github.com",
+				Owner:          "my-owner",
+				Repo:           "my-repo",
+				Operation:      "create-pr",
+				Decision:       AuditAllow,
+				Status:         http.StatusAccepted,
+				UpstreamStatus: http.StatusAccepted,
+				BytesIn:        int64(len(`{"title":"t"}`)),
+				BytesOut:       int64(len("upstream body")),
+			},
+		},
+		{
+			name:   "GraphQL mutation denied",
+			server: "api",
+			method: http.MethodPost,
+			path:   "/api/graphql",
+			body:   `{"query":"mutation { deleteRepository(input: {}) { clientMutationId } }"}`,
+			want: AuditEntry{
+				Server:    "api",
+				Method:    http.MethodPost,
+				Path:      "/api/graphql",
+				Host:      "github.com",
+				Operation: "mutation deleteRepository",
+				Decision:  AuditDeny,
+				Reason:    "forbidden: mutation deleteRepository not supported by the gateway",
+				Status:    http.StatusForbidden,
+				BytesIn:   int64(len(`{"query":"mutation { deleteRepository(input: {}) { clientMutationId } }"}`)),
+				BytesOut:  int64(len(`{"errors":[{"message":"forbidden: mutation deleteRepository not supported by the gateway"}]}` + "\n")),
+			},
+		},
+		{
+			name:   "unknown API path",
+			server: "api",
+			method: http.MethodGet,
+			path:   "/api/unknown",
+			want: AuditEntry{
+				Server:   "api",
+				Method:   http.MethodGet,
+				Path:     "/api/unknown",
+				Decision: AuditError,
+				Reason:   "not found",
+				Status:   http.StatusNotFound,
+				BytesOut: int64(len("not found\n")),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			auditLog := NewAuditLog(&logBuf, "abc12345")
+			start := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+			calls := 0
+			auditLog.now = func() time.Time {
+				calls++
+				return start.Add(time.Duration(calls-1) * 25 * time.Millisecond)
+			}
+
+			config := ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}
+			auth := NewGitHubAuthFromToken("test-token")
+			var handler http.Handler
+			if tt.server == "git" {
+				proxy := NewTestProxy(config, auth, upstream.URL)
+				proxy.audit = auditLog
+				handler = proxy
+			} else {
+				apiServer := NewTestAPIServer(config, auth, upstream.URL)
+				apiServer.audit = auditLog
+				handler = apiServer
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			lines := strings.Split(strings.TrimSuffix(logBuf.String(), "\n"), "\n")
+			require.Len(t, lines, 1)
+			var got AuditEntry
+			require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+
+			want := tt.want
+			want.Time = start
+			want.Session = "abc12345"
+			want.DurationMS = 25
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestAuditLog_Disabled(t *testing.T) {
+	var nilLog *AuditLog
+	called := false
+	nilLog.serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), "git", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		// Annotations are ignored without an audit log.
+		annotateAudit(r.Context(), func(entry *AuditEntry) {
+			t.Error("unexpected audit entry")
+		})
+	})
+	assert.True(t, called)
+}
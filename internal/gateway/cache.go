@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultMirrorRefreshInterval is how long a mirror serves fetches before
+// it is fetched from the upstream again.
+const DefaultMirrorRefreshInterval = 10 * time.Second
+
+// maxCachedResponseSize is the largest API response body that is cached.
+const maxCachedResponseSize = 10 << 20
+
+// Cache is the gateway's on-disk cache, which the gateways of parallel
+// sessions of a project share. It keeps bare mirrors of the repositories
+// matching its mirror patterns, which git-upload-pack requests are served
+// from, and API GET responses, which are revalidated with conditional
+// requests so that unchanged responses do not count against the rate limit.
+// A nil *Cache caches nothing.
+type Cache struct {
+	dir             string
+	mirrorPatterns  []string
+	refreshInterval time.Duration
+	now             func() time.Time
+}
+
+// NewCache creates a cache in dir that mirrors the repositories matching
+// the patterns in mirrors, which are owner/repo or host/owner/repo globs
+// like the policy's repository patterns.
+func NewCache(dir string, mirrors []string) (*Cache, error) {
+	for _, pattern := range mirrors {
+		if !strings.Contains(pattern, "/") {
+			return nil, fmt.Errorf("invalid mirror pattern %q: expected owner/repo or host/owner/repo", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid mirror pattern %q: %w", pattern, err)
+		}
+	}
+	for _, sub := range []string{"git", "api"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	}
+	return &Cache{
+		dir:             dir,
+		mirrorPatterns:  mirrors,
+		refreshInterval: DefaultMirrorRefreshInterval,
+		now:             time.Now,
+	}, nil
+}
+
+// cachedResponse is an API response stored in the cache.
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// cachesAPI reports whether the response to the API request r for ghPath
+// can be served from the cache. Only REST GETs are cached, and requests
+// that are already conditional are left to the client.
+func (c *Cache) cachesAPI(r *http.Request, ghPath string) bool {
+	return c != nil && r.Method == http.MethodGet && ghPath != "/graphql" &&
+		r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == ""
+}
+
+// apiKey returns the cache key of a GET of targetURL. Responses depend on
+// the token they were read with and on the encoding the client accepts.
+func apiKey(targetURL, acceptEncoding, token string) string {
+	tokenSum := sha256.Sum256([]byte(token))
+	sum := sha256.Sum256([]byte(targetURL + "\n" + acceptEncoding + "\n" + hex.EncodeToString(tokenSum[:])))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiPath returns the path the response with key is stored at.
+func (c *Cache) apiPath(key string) string {
+	return filepath.Join(c.dir, "api", key+".json")
+}
+
+// loadResponse returns the cached response with key, or nil if there is
+// none.
+func (c *Cache) loadResponse(key string) *cachedResponse {
+	data, err := os.ReadFile(c.apiPath(key))
+	if err != nil {
+		return nil
+	}
+	var cached cachedResponse
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil
+	}
+	return &cached
+}
+
+// storeResponse caches resp, a 200 response with a validator, under key.
+// It reads the body to store it, and returns a reader of the body to send
+// to the client. Responses larger than maxCachedResponseSize are not
+// stored.
+func (c *Cache) storeResponse(key string, resp *http.Response) io.Reader {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedResponseSize+1))
+	if err != nil || len(body) > maxCachedResponseSize {
+		return io.MultiReader(bytes.NewReader(body), resp.Body)
+	}
+	// A failure to store only costs the next request its conditional
+	// header.
+	_ = writeFileAtomic(c.apiPath(key), cachedResponse{Status: resp.StatusCode, Header: resp.Header, Body: body})
+	return bytes.NewReader(body)
+}
+
+// cacheable reports whether resp can be stored and revalidated later.
+func cacheable(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusOK &&
+		(resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "") &&
+		!strings.Contains(resp.Header.Get("Cache-Control"), "no-store")
+}
+
+// setConditional makes req revalidate the cached response.
+func (cached *cachedResponse) setConditional(req *http.Request) {
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified := cached.Header.Get("Last-Modified"); modified != "" {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+}
+
+// revalidated returns the headers of the cached response updated with those
+// of notModified, the upstream's 304 response, such as its rate limit.
+func (cached *cachedResponse) revalidated(notModified http.Header) http.Header {
+	header := cached.Header.Clone()
+	for key, values := range notModified {
+		if key == "Content-Length" {
+			continue
+		}
+		header[key] = values
+	}
+	return header
+}
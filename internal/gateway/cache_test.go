@@ -0,0 +1,202 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		mirrors []string
+		wantErr string
+	}{
+		{name: "no mirrors"},
+		{name: "valid patterns", mirrors: []string{"my-owner/*", "github.com/golang/go"}},
+		{name: "pattern without owner", mirrors: []string{"my-repo"}, wantErr: `invalid mirror pattern "my-repo": expected owner/repo or host/owner/repo`},
+		{name: "malformed pattern", mirrors: []string{"my-owner/["}, wantErr: `invalid mirror pattern "my-owner/["`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := NewCache(filepath.Join(t.TempDir(), "cache"), tt.mirrors)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.DirExists(t, filepath.Join(cache.dir, "git"))
+			assert.DirExists(t, filepath.Join(cache.dir, "api"))
+		})
+	}
+}
+
+func TestCache_Mirrors(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), []string{"my-owner/*", "github.com/golang/go"})
+	require.NoError(t, err)
+
+	assert.True(t, cache.mirrors("github.com", "my-owner", "my-repo"))
+	assert.True(t, cache.mirrors("github.example.corp", "My-Owner", "lib"))
+	assert.True(t, cache.mirrors("github.com", "golang", "go"))
+	assert.False(t, cache.mirrors("github.example.corp", "golang", "go"))
+	assert.False(t, cache.mirrors("github.com", "other-owner", "my-repo"))
+	assert.False(t, (*Cache)(nil).mirrors("github.com", "my-owner", "my-repo"))
+}
+
+// etagUpstream serves an issue list whose ETag is its version, answering
+// requests with a matching If-None-Match with 304 Not Modified.
+type etagUpstream struct {
+	*httptest.Server
+	version     atomic.Int32
+	requests    atomic.Int32
+	notModified atomic.Int32
+}
+
+func newETagUpstream(t *testing.T) *etagUpstream {
+	t.Helper()
+	u := &etagUpstream{}
+	u.version.Store(1)
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := u.requests.Add(1)
+		w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(5000-n))
+		if r.URL.Path == "/repos/my-owner/my-repo/pulls" {
+			// No validator, so the response cannot be revalidated.
+			fmt.Fprintf(w, `[{"number": %d}]`, n)
+			return
+		}
+		etag := fmt.Sprintf(`"v%d"`, u.version.Load())
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			u.notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"title": "version %d"}]`, u.version.Load())
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+func TestAPIServer_Cache(t *testing.T) {
+	issues := "/api/github/repos/my-owner/my-repo/issues"
+
+	tests := []struct {
+		name            string
+		first           *http.Request
+		second          *http.Request
+		update          bool // whether the upstream changes between the requests
+		wantStatus      int
+		wantBody        string
+		wantNotModified int32
+		wantCache       string // cache outcome of the second request in the audit log
+	}{
+		{
+			name:            "unchanged response is served from the cache",
+			first:           httptest.NewRequest(http.MethodGet, issues, nil),
+			second:          httptest.NewRequest(http.MethodGet, issues, nil),
+			wantStatus:      http.StatusOK,
+			wantBody:        `[{"title": "version 1"}]`,
+			wantNotModified: 1,
+			wantCache:       "hit",
+		},
+		{
+			name:       "changed response is read again",
+			first:      httptest.NewRequest(http.MethodGet, issues, nil),
+			second:     httptest.NewRequest(http.MethodGet, issues, nil),
+			update:     true,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"title": "version 2"}]`,
+		},
+		{
+			name:       "response without a validator is not cached",
+			first:      httptest.NewRequest(http.MethodGet, "/api/github/repos/my-owner/my-repo/pulls", nil),
+			second:     httptest.NewRequest(http.MethodGet, "/api/github/repos/my-owner/my-repo/pulls", nil),
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"number": 2}]`,
+		},
+		{
+			name:  "conditional request from the client is passed through",
+			first: httptest.NewRequest(http.MethodGet, issues, nil),
+			second: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, issues, nil)
+				r.Header.Set("If-None-Match", `"v1"`)
+				return r
+			}(),
+			wantStatus:      http.StatusNotModified,
+			wantNotModified: 1,
+		},
+		{
+			name:       "different query is cached separately",
+			first:      httptest.NewRequest(http.MethodGet, issues, nil),
+			second:     httptest.NewRequest(http.MethodGet, issues+"?state=closed", nil),
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"title": "version 1"}]`,
+		},
+		{
+			name:       "writes are not cached",
+			first:      httptest.NewRequest(http.MethodPost, issues, strings.NewReader(`{"title": "bug"}`)),
+			second:     httptest.NewRequest(http.MethodPost, issues, strings.NewReader(`{"title": "bug"}`)),
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"title": "version 1"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newETagUpstream(t)
+			cache, err := NewCache(t.TempDir(), nil)
+			require.NoError(t, err)
+			server := NewTestAPIServer(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}, NewGitHubAuthFromToken("test-token"), upstream.URL)
+			server.cache = cache
+			var logBuf bytes.Buffer
+			server.audit = NewAuditLog(&logBuf, "abc12345")
+
+			server.ServeHTTP(httptest.NewRecorder(), tt.first)
+			if tt.update {
+				upstream.version.Add(1)
+			}
+			logBuf.Reset()
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, tt.second)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantNotModified, upstream.notModified.Load())
+			// The rate limit comes from the latest upstream response.
+			assert.Equal(t, "4998", w.Header().Get("X-RateLimit-Remaining"))
+
+			var entry AuditEntry
+			require.NoError(t, json.Unmarshal(logBuf.Bytes(), &entry))
+			assert.Equal(t, tt.wantCache, entry.Cache)
+		})
+	}
+}
+
+func TestAPIServer_CacheSharedAcrossServers(t *testing.T) {
+	upstream := newETagUpstream(t)
+	cache, err := NewCache(t.TempDir(), nil)
+	require.NoError(t, err)
+
+	for _, token := range []string{"test-token", "test-token", "other-token"} {
+		server := NewTestAPIServer(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}, NewGitHubAuthFromToken(token), upstream.URL)
+		server.cache = cache
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/github/repos/my-owner/my-repo/issues", nil))
+		assert.Equal(t, `[{"title": "version 1"}]`, w.Body.String())
+	}
+
+	// Responses read with another token are not revalidated with it.
+	assert.Equal(t, int32(1), upstream.notModified.Load())
+}
@@ -0,0 +1,174 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, err := GenerateToken()
+	require.NoError(t, err)
+	assert.Len(t, token, 64)
+
+	other, err := GenerateToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestServer_RequireToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		clientToken   string
+		path          string
+		authorization string
+		basicAuth     []string
+		wantStatus    int
+	}{
+		{name: "bearer token", clientToken: "secret", path: "/api/schema", authorization: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "gh token", clientToken: "secret", path: "/api/schema", authorization: "token secret", wantStatus: http.StatusOK},
+		{name: "basic auth password", clientToken: "secret", path: "/api/schema", basicAuth: []string{"x-access-token", "secret"}, wantStatus: http.StatusOK},
+		{name: "missing token", clientToken: "secret", path: "/api/schema", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", clientToken: "secret", path: "/api/schema", authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "metrics require the token", clientToken: "secret", path: "/metrics", wantStatus: http.StatusUnauthorized},
+		{name: "healthz is open", clientToken: "secret", path: "/healthz", wantStatus: http.StatusOK},
+		{name: "without a client token", path: "/api/schema", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServerWithAuth(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}, NewGitHubAuthFromToken("test-token"))
+			server.EnableClientAuth(tt.clientToken)
+			var gotAuthorization []string
+			handler := server.withHealth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuthorization = r.Header.Values("Authorization")
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.basicAuth != nil {
+				req.SetBasicAuth(tt.basicAuth[0], tt.basicAuth[1])
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="claude-forge gateway"`, w.Header().Get("WWW-Authenticate"))
+			}
+			// The session token is not passed on.
+			assert.Empty(t, gotAuthorization)
+		})
+	}
+}
+
+func TestServer_RequireProxyToken(t *testing.T) {
+	tests := []struct {
+		name               string
+		clientToken        string
+		proxyAuthorization string
+		wantStatus         int
+	}{
+		{name: "basic auth password", clientToken: "secret", proxyAuthorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("forge:secret")), wantStatus: http.StatusOK},
+		{name: "bearer token", clientToken: "secret", proxyAuthorization: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "missing token", clientToken: "secret", wantStatus: http.StatusProxyAuthRequired},
+		{name: "wrong token", clientToken: "secret", proxyAuthorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("forge:guess")), wantStatus: http.StatusProxyAuthRequired},
+		{name: "invalid basic auth", clientToken: "secret", proxyAuthorization: "Basic !!!", wantStatus: http.StatusProxyAuthRequired},
+		{name: "without a client token", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServerWithAuth(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}, NewGitHubAuthFromToken("test-token"))
+			server.EnableClientAuth(tt.clientToken)
+			handler := server.requireProxyToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodConnect, "http://example.com:443", nil)
+			req.Host = "example.com:443"
+			if tt.proxyAuthorization != "" {
+				req.Header.Set("Proxy-Authorization", tt.proxyAuthorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusProxyAuthRequired {
+				assert.Equal(t, `Basic realm="claude-forge gateway"`, w.Header().Get("Proxy-Authenticate"))
+			}
+		})
+	}
+}
+
+// freePort returns a local TCP port that is free to listen on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestServer_RunWithContext_TLSAndClientAuth(t *testing.T) {
+	caCertPEM, certPEM, keyPEM := generateTestCertificate(t, "127.0.0.1")
+	srv := NewServerWithAuth(ProxyConfig{AllowedOwner: "test-owner", AllowedRepo: "test-repo"}, NewGitHubAuthFromToken("test-token"))
+	require.NoError(t, srv.EnableTLS("", certPEM, keyPEM))
+	srv.EnableClientAuth("session-token")
+
+	proxyAddr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	apiAddr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.RunWithContext(ctx, proxyAddr, apiAddr)
+	}()
+	defer func() {
+		cancel()
+		select {
+		case err := <-errCh:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("RunWithContext did not return after context cancellation")
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caCertPEM))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	get := func(url, token string) int {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		var resp *http.Response
+		require.Eventually(t, func() bool {
+			resp, err = client.Do(req)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get("https://"+apiAddr+"/healthz", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("https://"+apiAddr+"/api/schema", ""))
+	assert.Equal(t, http.StatusOK, get("https://"+apiAddr+"/api/schema", "session-token"))
+	assert.Equal(t, http.StatusUnauthorized, get("https://"+proxyAddr+"/github.com/test-owner/test-repo.git/info/refs?service=git-upload-pack", ""))
+
+	// Plain HTTP is not served.
+	resp, err := http.Get("http://" + apiAddr + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
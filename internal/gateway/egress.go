@@ -0,0 +1,249 @@
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// egressDialTimeout bounds connecting to an allowed destination.
+const egressDialTimeout = 10 * time.Second
+
+// DefaultEgressAllow lists the domains the egress proxy always allows:
+// Claude Code's API and telemetry, and common package registries.
+var DefaultEgressAllow = []string{
+	"api.anthropic.com",
+	"statsig.anthropic.com",
+	"sentry.io",
+	"proxy.golang.org",
+	"sum.golang.org",
+	"storage.googleapis.com",
+	"registry.npmjs.org",
+	"pypi.org",
+	"files.pythonhosted.org",
+}
+
+// EgressPolicy controls which destinations the agent can reach through the
+// egress proxy. Patterns are domains, such as "pkg.go.dev", or wildcards
+// matching subdomains, such as "*.docker.io", optionally with a port, such
+// as "example.com:8443". Without a port, ports 80 and 443 are allowed.
+type EgressPolicy struct {
+	Allow []string `yaml:"allow"`
+}
+
+// ValidateEgressPattern checks that pattern is a domain or wildcard domain
+// with an optional port.
+func ValidateEgressPattern(pattern string) error {
+	if strings.ContainsAny(pattern, "/@") {
+		return fmt.Errorf("expected a domain such as example.com or *.example.com, not a URL")
+	}
+	host, port, err := splitEgressPattern(pattern)
+	if err != nil {
+		return err
+	}
+	if host == "" || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+		return fmt.Errorf("expected a domain such as example.com or *.example.com")
+	}
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+	return nil
+}
+
+// splitEgressPattern splits an egress pattern into host and optional port.
+func splitEgressPattern(pattern string) (string, string, error) {
+	if !strings.Contains(pattern, ":") {
+		return pattern, "", nil
+	}
+	host, port, err := net.SplitHostPort(pattern)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid pattern: %w", err)
+	}
+	return host, port, nil
+}
+
+// matchEgress reports whether host:port matches any of the patterns.
+func matchEgress(patterns []string, host, port string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		patternHost, patternPort, err := splitEgressPattern(strings.ToLower(pattern))
+		if err != nil {
+			continue
+		}
+		if patternPort == "" {
+			if port != "80" && port != "443" {
+				continue
+			}
+		} else if patternPort != port {
+			continue
+		}
+
+		if suffix, ok := strings.CutPrefix(patternHost, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == patternHost {
+			return true
+		}
+	}
+	return false
+}
+
+// EgressProxy is an HTTP forward proxy for the agent's other network
+// traffic. It tunnels CONNECT requests and forwards plain HTTP requests to
+// allowed destinations only, so that the agent can reach package registries
+// and Claude's API from an internal network. Every request is recorded in
+// the audit log, if one is set.
+type EgressProxy struct {
+	allow     []string
+	dial      func(network, address string) (net.Conn, error)
+	transport http.RoundTripper
+	audit     *AuditLog
+}
+
+// NewEgressProxy creates an egress proxy allowing the destinations that
+// match allow.
+func NewEgressProxy(allow []string) *EgressProxy {
+	dialer := &net.Dialer{Timeout: egressDialTimeout}
+	return &EgressProxy{
+		allow: allow,
+		dial:  dialer.Dial,
+		transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: egressDialTimeout,
+		},
+	}
+}
+
+// ServeHTTP handles a proxy request.
+func (p *EgressProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.audit.serve(w, r, "egress", p.handle)
+}
+
+// handle checks the destination against the allow list, then tunnels or
+// forwards the request.
+func (p *EgressProxy) handle(w http.ResponseWriter, r *http.Request) {
+	host, port, err := egressDestination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.Host = net.JoinHostPort(host, port)
+	})
+
+	if !matchEgress(p.allow, host, port) {
+		http.Error(w, fmt.Sprintf("forbidden: %s is not in the gateway's egress allow list", net.JoinHostPort(host, port)), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r, net.JoinHostPort(host, port))
+		return
+	}
+	p.forward(w, r)
+}
+
+// egressDestination returns the host and port a proxy request is for.
+func egressDestination(r *http.Request) (string, string, error) {
+	if r.Method == http.MethodConnect {
+		host, port, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid CONNECT target %q: expected host:port", r.Host)
+		}
+		return host, port, nil
+	}
+
+	if r.URL.Scheme != "http" || r.URL.Host == "" {
+		return "", "", fmt.Errorf("invalid proxy request: expected an absolute http:// URL or CONNECT")
+	}
+	port := r.URL.Port()
+	if port == "" {
+		port = "80"
+	}
+	return r.URL.Hostname(), port, nil
+}
+
+// tunnel connects to address and copies bytes in both directions until
+// either side closes.
+func (p *EgressProxy) tunnel(w http.ResponseWriter, r *http.Request, address string) {
+	upstream, err := p.dial("tcp", address)
+	if err != nil {
+		http.Error(w, redact(fmt.Sprintf("failed to connect to %s: %v", address, err)), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	client, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to hijack connection: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	var bytesIn, bytesOut int64
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// Bytes the client sent before the tunnel was established are
+		// buffered in buf.
+		bytesIn, _ = io.Copy(upstream, buf.Reader)
+		closeWrite(upstream)
+	}()
+	go func() {
+		defer wg.Done()
+		bytesOut, _ = io.Copy(client, upstream)
+		closeWrite(client)
+	}()
+	wg.Wait()
+
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.BytesIn += bytesIn
+		entry.BytesOut += bytesOut
+	})
+}
+
+// closeWrite half-closes conn so the other side sees EOF, or closes it if
+// it does not support half-closing.
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+// forward sends a plain HTTP proxy request upstream and copies the response.
+func (p *EgressProxy) forward(w http.ResponseWriter, r *http.Request) {
+	upstreamReq := r.Clone(r.Context())
+	upstreamReq.RequestURI = ""
+	upstreamReq.Header = make(http.Header)
+	copyHeader(upstreamReq.Header, r.Header, nil)
+
+	resp, err := p.transport.RoundTrip(upstreamReq)
+	if err != nil {
+		http.Error(w, redact(fmt.Sprintf("failed to contact %s: %v", r.URL.Host, err)), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.UpstreamStatus = resp.StatusCode
+	})
+
+	copyHeader(w.Header(), resp.Header, nil)
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,270 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchEgress(t *testing.T) {
+	patterns := []string{"api.anthropic.com", "*.docker.io", "example.com:8443"}
+
+	tests := []struct {
+		name string
+		host string
+		port string
+		want bool
+	}{
+		{name: "exact domain on 443", host: "api.anthropic.com", port: "443", want: true},
+		{name: "exact domain on 80", host: "api.anthropic.com", port: "80", want: true},
+		{name: "case and trailing dot are ignored", host: "API.Anthropic.com.", port: "443", want: true},
+		{name: "exact domain on another port", host: "api.anthropic.com", port: "22"},
+		{name: "subdomain of exact domain", host: "evil.api.anthropic.com", port: "443"},
+		{name: "wildcard subdomain", host: "registry-1.docker.io", port: "443", want: true},
+		{name: "wildcard does not match the domain itself", host: "docker.io", port: "443"},
+		{name: "wildcard does not match a suffix", host: "notdocker.io", port: "443"},
+		{name: "explicit port", host: "example.com", port: "8443", want: true},
+		{name: "explicit port only", host: "example.com", port: "443"},
+		{name: "unlisted domain", host: "example.org", port: "443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchEgress(patterns, tt.host, tt.port))
+		})
+	}
+}
+
+func TestValidateEgressPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr string
+	}{
+		{name: "domain", pattern: "pkg.go.dev"},
+		{name: "wildcard", pattern: "*.docker.io"},
+		{name: "domain with port", pattern: "example.com:8443"},
+		{name: "empty", pattern: "", wantErr: "expected a domain"},
+		{name: "URL", pattern: "https://example.com/path", wantErr: "not a URL"},
+		{name: "path", pattern: "example.com/path", wantErr: "expected a domain"},
+		{name: "inner wildcard", pattern: "api.*.com", wantErr: "expected a domain"},
+		{name: "invalid port", pattern: "example.com:http", wantErr: `invalid port "http"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEgressPattern(tt.pattern)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+// startEchoServer starts a TCP server that echoes what it reads and returns
+// its port.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	return port
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, since a tunnel's
+// audit entry is written after the server has closed its connections.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// readAuditEntry waits for the single entry written to logBuf and decodes it.
+func readAuditEntry(t *testing.T, logBuf *syncBuffer) AuditEntry {
+	t.Helper()
+	require.Eventually(t, func() bool { return logBuf.String() != "" }, 5*time.Second, 10*time.Millisecond)
+	lines := strings.Split(strings.TrimSuffix(logBuf.String(), "\n"), "\n")
+	require.Len(t, lines, 1)
+	var entry AuditEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	return entry
+}
+
+func TestEgressProxy_Connect(t *testing.T) {
+	echoPort := startEchoServer(t)
+
+	tests := []struct {
+		name         string
+		allow        []string
+		target       string
+		wantStatus   int
+		wantDecision string
+		wantReason   string
+	}{
+		{
+			name:         "allowed destination is tunneled",
+			allow:        []string{"localhost:" + echoPort},
+			target:       "localhost:" + echoPort,
+			wantStatus:   http.StatusOK,
+			wantDecision: AuditAllow,
+		},
+		{
+			name:         "unlisted destination is denied",
+			allow:        []string{"api.anthropic.com"},
+			target:       "localhost:" + echoPort,
+			wantStatus:   http.StatusForbidden,
+			wantDecision: AuditDeny,
+			wantReason:   "forbidden: localhost:" + echoPort + " is not in the gateway's egress allow list",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logBuf syncBuffer
+			proxy := NewEgressProxy(tt.allow)
+			proxy.audit = NewAuditLog(&logBuf, "abc12345")
+			server := httptest.NewServer(proxy)
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = io.WriteString(conn, "CONNECT "+tt.target+" HTTP/1.1\r\nHost: "+tt.target+"\r\n\r\n")
+			require.NoError(t, err)
+
+			reader := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			if tt.wantStatus == http.StatusOK {
+				_, err = io.WriteString(conn, "ping")
+				require.NoError(t, err)
+				got := make([]byte, 4)
+				_, err = io.ReadFull(reader, got)
+				require.NoError(t, err)
+				assert.Equal(t, "ping", string(got))
+				conn.(*net.TCPConn).CloseWrite()
+				_, err = io.ReadAll(reader)
+				require.NoError(t, err)
+			}
+			conn.Close()
+			server.Close()
+
+			entry := readAuditEntry(t, &logBuf)
+			assert.Equal(t, "egress", entry.Server)
+			assert.Equal(t, http.MethodConnect, entry.Method)
+			assert.Equal(t, tt.target, entry.Host)
+			assert.Equal(t, tt.wantDecision, entry.Decision)
+			assert.Equal(t, tt.wantReason, entry.Reason)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, int64(4), entry.BytesIn)
+				assert.Equal(t, int64(4), entry.BytesOut)
+			}
+		})
+	}
+}
+
+func TestEgressProxy_Forward(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Proxy-Authorization"))
+		w.Header().Set("X-Upstream", "yes")
+		w.Write([]byte("hello from " + r.URL.Path))
+	}))
+	defer upstream.Close()
+	upstreamURL, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		allow      []string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "allowed destination is forwarded",
+			allow:      []string{upstreamURL.Host},
+			wantStatus: http.StatusOK,
+			wantBody:   "hello from /simple/",
+		},
+		{
+			name:       "unlisted destination is denied",
+			allow:      []string{"pypi.org"},
+			wantStatus: http.StatusForbidden,
+			wantBody:   "is not in the gateway's egress allow list",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := NewEgressProxy(tt.allow)
+			server := httptest.NewServer(proxy)
+			defer server.Close()
+			proxyURL, err := url.Parse(server.URL)
+			require.NoError(t, err)
+
+			client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+			req, err := http.NewRequest(http.MethodGet, upstream.URL+"/simple/", nil)
+			require.NoError(t, err)
+			req.Header.Set("Proxy-Authorization", "Basic secret")
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Contains(t, string(body), tt.wantBody)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, "yes", resp.Header.Get("X-Upstream"))
+			}
+		})
+	}
+}
+
+func TestEgressProxy_InvalidRequest(t *testing.T) {
+	proxy := NewEgressProxy(DefaultEgressAllow)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/not-a-proxy-request", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "expected an absolute http:// URL or CONNECT")
+}
@@ -0,0 +1,348 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Forge kinds supported by the gateway.
+const (
+	ForgeGitHub = "github"
+	ForgeGitLab = "gitlab"
+	ForgeGitea  = "gitea"
+)
+
+// ForgeConfig selects how the gateway talks to a forge host.
+type ForgeConfig struct {
+	// Kind is ForgeGitHub, ForgeGitLab, or ForgeGitea. Defaults to
+	// DefaultForgeKind of the host.
+	Kind string
+	// URL is the base URL of the host, such as http://gitea:3000.
+	// Defaults to https://{host}.
+	URL string
+}
+
+// IsForgeKind reports whether kind is a supported forge kind.
+func IsForgeKind(kind string) bool {
+	switch kind {
+	case ForgeGitHub, ForgeGitLab, ForgeGitea:
+		return true
+	}
+	return false
+}
+
+// DefaultForgeKind returns the forge kind of well-known hosts: GitLab for
+// gitlab.com, Gitea for gitea.com and codeberg.org, and GitHub otherwise.
+func DefaultForgeKind(host string) string {
+	switch strings.ToLower(host) {
+	case "gitlab.com":
+		return ForgeGitLab
+	case "gitea.com", "codeberg.org":
+		return ForgeGitea
+	}
+	return ForgeGitHub
+}
+
+// forge abstracts what differs between forges when the gateway forwards
+// requests upstream: where git smart HTTP and the REST API are served, how
+// tokens are presented, and how a repository path splits into owner and
+// repo.
+type forge interface {
+	// kind returns the forge kind, such as ForgeGitHub.
+	kind() string
+	// gitURL returns the base URL of git smart HTTP paths.
+	gitURL() string
+	// apiURL returns the base URL of the REST API.
+	apiURL() string
+	// githubAPI reports whether the REST API follows GitHub's paths, so
+	// that the gateway's operations apply to it.
+	githubAPI() bool
+	// splitRepoPath splits a path such as owner/repo.git/info/refs into the
+	// owner, repo, and git operation.
+	splitRepoPath(p string) (owner, repo, operation string, err error)
+	// authorizeGit adds token to a git request.
+	authorizeGit(req *http.Request, token string)
+	// authorizeAPI adds token to a REST API request.
+	authorizeAPI(req *http.Request, token string)
+	// isAncestor asks the API whether base is head or one of its ancestors.
+	isAncestor(ctx context.Context, client *http.Client, token, owner, repo, base, head string) (bool, error)
+	// isPublic asks the API whether the repository is public.
+	isPublic(ctx context.Context, client *http.Client, token, owner, repo string) (bool, error)
+	// checkToken asks the API whether it accepts token.
+	checkToken(ctx context.Context, client *http.Client, token string) error
+}
+
+// newForge returns the forge of host as configured.
+func newForge(host string, config ForgeConfig) forge {
+	kind := config.Kind
+	if kind == "" {
+		kind = DefaultForgeKind(host)
+	}
+	baseURL := strings.TrimSuffix(config.URL, "/")
+	if baseURL == "" {
+		baseURL = "https://" + host
+	}
+
+	switch kind {
+	case ForgeGitLab:
+		return &gitlabForge{baseURL: baseURL}
+	case ForgeGitea:
+		return &giteaForge{baseURL: baseURL}
+	}
+	if config.URL == "" && strings.EqualFold(host, DefaultHost) {
+		// github.com serves its API from api.github.com.
+		return &githubForge{git: defaultGitHubBaseURL, api: defaultGitHubAPIBaseURL}
+	}
+	// GitHub Enterprise Server serves its API under /api/v3.
+	return &githubForge{git: baseURL, api: baseURL + "/api/v3"}
+}
+
+// graphQLURL returns the GraphQL endpoint for a GitHub REST API base URL:
+// /graphql on api.github.com, and /api/graphql on GitHub Enterprise Server.
+func graphQLURL(apiURL string) string {
+	return strings.TrimSuffix(apiURL, "/v3") + "/graphql"
+}
+
+// splitOwnerRepo splits owner/repo.git/{operation}, where owner is a single
+// path segment and the .git suffix is optional.
+func splitOwnerRepo(p string) (string, string, string, error) {
+	parts := strings.SplitN(p, "/", 3)
+	if len(parts) < 2 {
+		return "", "", "", fmt.Errorf("invalid path: expected /{host}/{owner}/{repo}.git/{operation}")
+	}
+	operation := ""
+	if len(parts) == 3 {
+		operation = parts[2]
+	}
+	return parts[0], strings.TrimSuffix(parts[1], ".git"), operation, nil
+}
+
+// githubForge is github.com or a GitHub Enterprise Server host.
+type githubForge struct {
+	git string
+	api string
+}
+
+func (f *githubForge) kind() string    { return ForgeGitHub }
+func (f *githubForge) gitURL() string  { return f.git }
+func (f *githubForge) apiURL() string  { return f.api }
+func (f *githubForge) githubAPI() bool { return true }
+
+func (f *githubForge) splitRepoPath(p string) (string, string, string, error) {
+	return splitOwnerRepo(p)
+}
+
+func (f *githubForge) authorizeGit(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Basic "+basicAuth("x-access-token", token))
+}
+
+func (f *githubForge) authorizeAPI(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+// isAncestor uses the compare API, whose status is "ahead" or "identical"
+// when head descends from base.
+func (f *githubForge) isAncestor(ctx context.Context, client *http.Client, token, owner, repo, base, head string) (bool, error) {
+	var comparison struct {
+		Status string `json:"status"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", f.api, owner, repo, base, head)
+	if err := getAPI(ctx, client, f, token, u, &comparison); err != nil {
+		return false, fmt.Errorf("compare %s...%s %w", shortOID(base), shortOID(head), err)
+	}
+	return comparison.Status == "ahead" || comparison.Status == "identical", nil
+}
+
+// isPublic reads the repository's visibility, which is "internal" for
+// repositories visible only to members of a GitHub Enterprise.
+func (f *githubForge) isPublic(ctx context.Context, client *http.Client, token, owner, repo string) (bool, error) {
+	var repository struct {
+		Private    bool   `json:"private"`
+		Visibility string `json:"visibility"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s", f.api, owner, repo)
+	if err := getAPI(ctx, client, f, token, u, &repository); err != nil {
+		return false, fmt.Errorf("repository %s/%s %w", owner, repo, err)
+	}
+	return !repository.Private && (repository.Visibility == "" || repository.Visibility == "public"), nil
+}
+
+// checkToken reads the token's rate limit, which any valid token can,
+// whatever its permissions.
+func (f *githubForge) checkToken(ctx context.Context, client *http.Client, token string) error {
+	if err := getAPI(ctx, client, f, token, f.api+"/rate_limit", &struct{}{}); err != nil {
+		return fmt.Errorf("rate limit %w", err)
+	}
+	return nil
+}
+
+// gitlabForge is gitlab.com or a self-managed GitLab host. Projects can be
+// in nested groups, so the owner is the full group path, such as
+// group/subgroup.
+type gitlabForge struct {
+	baseURL string
+}
+
+func (f *gitlabForge) kind() string    { return ForgeGitLab }
+func (f *gitlabForge) gitURL() string  { return f.baseURL }
+func (f *gitlabForge) apiURL() string  { return f.baseURL + "/api/v4" }
+func (f *gitlabForge) githubAPI() bool { return false }
+
+// splitRepoPath splits group/subgroup/repo.git/{operation}. Without the .git
+// suffix, the operation starts at the first info/ or git- segment.
+func (f *gitlabForge) splitRepoPath(p string) (string, string, string, error) {
+	repoPath, operation, found := strings.Cut(p, ".git/")
+	if !found {
+		repoPath = strings.TrimSuffix(p, ".git")
+		operation = ""
+		segments := strings.Split(repoPath, "/")
+		for i, segment := range segments {
+			if segment == "info" || strings.HasPrefix(segment, "git-") {
+				repoPath = strings.Join(segments[:i], "/")
+				operation = strings.Join(segments[i:], "/")
+				break
+			}
+		}
+	}
+
+	i := strings.LastIndex(repoPath, "/")
+	if i < 0 {
+		return "", "", "", fmt.Errorf("invalid path: expected /{host}/{group}/{repo}.git/{operation}")
+	}
+	return repoPath[:i], repoPath[i+1:], operation, nil
+}
+
+func (f *gitlabForge) authorizeGit(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Basic "+basicAuth("oauth2", token))
+}
+
+func (f *gitlabForge) authorizeAPI(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+// isAncestor uses the merge base API: base is an ancestor of head when it
+// is their merge base.
+func (f *gitlabForge) isAncestor(ctx context.Context, client *http.Client, token, owner, repo, base, head string) (bool, error) {
+	var mergeBase struct {
+		ID string `json:"id"`
+	}
+	query := url.Values{"refs[]": {base, head}}
+	u := fmt.Sprintf("%s/projects/%s/repository/merge_base?%s", f.apiURL(), url.PathEscape(owner+"/"+repo), query.Encode())
+	if err := getAPI(ctx, client, f, token, u, &mergeBase); err != nil {
+		return false, fmt.Errorf("merge base of %s and %s %w", shortOID(base), shortOID(head), err)
+	}
+	return mergeBase.ID == base, nil
+}
+
+// isPublic reads the project's visibility, which is "public", "internal",
+// or "private".
+func (f *gitlabForge) isPublic(ctx context.Context, client *http.Client, token, owner, repo string) (bool, error) {
+	var project struct {
+		Visibility string `json:"visibility"`
+	}
+	u := fmt.Sprintf("%s/projects/%s", f.apiURL(), url.PathEscape(owner+"/"+repo))
+	if err := getAPI(ctx, client, f, token, u, &project); err != nil {
+		return false, fmt.Errorf("project %s/%s %w", owner, repo, err)
+	}
+	return project.Visibility == "public", nil
+}
+
+// checkToken reads the token's user, a bot user for project and group
+// access tokens.
+func (f *gitlabForge) checkToken(ctx context.Context, client *http.Client, token string) error {
+	if err := getAPI(ctx, client, f, token, f.apiURL()+"/user", &struct{}{}); err != nil {
+		return fmt.Errorf("user %w", err)
+	}
+	return nil
+}
+
+// giteaForge is a Gitea or Forgejo host. Its REST API follows GitHub's
+// paths under /api/v1.
+type giteaForge struct {
+	baseURL string
+}
+
+func (f *giteaForge) kind() string    { return ForgeGitea }
+func (f *giteaForge) gitURL() string  { return f.baseURL }
+func (f *giteaForge) apiURL() string  { return f.baseURL + "/api/v1" }
+func (f *giteaForge) githubAPI() bool { return true }
+
+func (f *giteaForge) splitRepoPath(p string) (string, string, string, error) {
+	return splitOwnerRepo(p)
+}
+
+// authorizeGit sends the token as the user name, which Gitea accepts with
+// an empty or x-oauth-basic password.
+func (f *giteaForge) authorizeGit(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Basic "+basicAuth(token, "x-oauth-basic"))
+}
+
+func (f *giteaForge) authorizeAPI(req *http.Request, token string) {
+	req.Header.Set("Authorization", "token "+token)
+}
+
+// isAncestor compares head...base: no commits lead from their merge base to
+// base exactly when base is an ancestor of head.
+func (f *giteaForge) isAncestor(ctx context.Context, client *http.Client, token, owner, repo, base, head string) (bool, error) {
+	var comparison struct {
+		TotalCommits int `json:"total_commits"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", f.apiURL(), owner, repo, head, base)
+	if err := getAPI(ctx, client, f, token, u, &comparison); err != nil {
+		return false, fmt.Errorf("compare %s...%s %w", shortOID(head), shortOID(base), err)
+	}
+	return comparison.TotalCommits == 0, nil
+}
+
+// isPublic reads whether the repository is private, or internal to the
+// signed-in users of the instance.
+func (f *giteaForge) isPublic(ctx context.Context, client *http.Client, token, owner, repo string) (bool, error) {
+	var repository struct {
+		Private  bool `json:"private"`
+		Internal bool `json:"internal"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s", f.apiURL(), owner, repo)
+	if err := getAPI(ctx, client, f, token, u, &repository); err != nil {
+		return false, fmt.Errorf("repository %s/%s %w", owner, repo, err)
+	}
+	return !repository.Private && !repository.Internal, nil
+}
+
+// checkToken reads the token's user.
+func (f *giteaForge) checkToken(ctx context.Context, client *http.Client, token string) error {
+	if err := getAPI(ctx, client, f, token, f.apiURL()+"/user", &struct{}{}); err != nil {
+		return fmt.Errorf("user %w", err)
+	}
+	return nil
+}
+
+// getAPI sends an authorized GET request to a forge API and decodes the JSON
+// response into v.
+func getAPI(ctx context.Context, client *http.Client, f forge, token, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if token != "" {
+		f.authorizeAPI(req, token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to contact the API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
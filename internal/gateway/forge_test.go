@@ -0,0 +1,392 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewForge(t *testing.T) {
+	tests := []struct {
+		name        string
+		host        string
+		config      ForgeConfig
+		wantKind    string
+		wantGitURL  string
+		wantAPIURL  string
+		wantGraphQL string
+	}{
+		{
+			name:        "github.com",
+			host:        "github.com",
+			wantKind:    ForgeGitHub,
+			wantGitURL:  "https://github.com",
+			wantAPIURL:  "https://api.github.com",
+			wantGraphQL: "https://api.github.com/graphql",
+		},
+		{
+			name:        "GitHub Enterprise Server",
+			host:        "github.example.corp",
+			wantKind:    ForgeGitHub,
+			wantGitURL:  "https://github.example.corp",
+			wantAPIURL:  "https://github.example.corp/api/v3",
+			wantGraphQL: "https://github.example.corp/api/graphql",
+		},
+		{
+			name:       "gitlab.com",
+			host:       "gitlab.com",
+			wantKind:   ForgeGitLab,
+			wantGitURL: "https://gitlab.com",
+			wantAPIURL: "https://gitlab.com/api/v4",
+		},
+		{
+			name:       "codeberg.org",
+			host:       "codeberg.org",
+			wantKind:   ForgeGitea,
+			wantGitURL: "https://codeberg.org",
+			wantAPIURL: "https://codeberg.org/api/v1",
+		},
+		{
+			name:       "self-hosted Gitea with a base URL",
+			host:       "gitea",
+			config:     ForgeConfig{Kind: ForgeGitea, URL: "http://gitea:3000/"},
+			wantKind:   ForgeGitea,
+			wantGitURL: "http://gitea:3000",
+			wantAPIURL: "http://gitea:3000/api/v1",
+		},
+		{
+			name:       "self-managed GitLab",
+			host:       "gitlab.example.corp",
+			config:     ForgeConfig{Kind: ForgeGitLab},
+			wantKind:   ForgeGitLab,
+			wantGitURL: "https://gitlab.example.corp",
+			wantAPIURL: "https://gitlab.example.corp/api/v4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newForge(tt.host, tt.config)
+			assert.Equal(t, tt.wantKind, got.kind())
+			assert.Equal(t, tt.wantGitURL, got.gitURL())
+			assert.Equal(t, tt.wantAPIURL, got.apiURL())
+			if tt.wantGraphQL != "" {
+				assert.Equal(t, tt.wantGraphQL, graphQLURL(got.apiURL()))
+			}
+		})
+	}
+}
+
+func TestForge_Authorize(t *testing.T) {
+	tests := []struct {
+		name        string
+		forge       forge
+		wantGitAuth string
+		wantAPIAuth string
+	}{
+		{
+			name:        "GitHub",
+			forge:       &githubForge{},
+			wantGitAuth: "Basic " + basicAuth("x-access-token", "secret"),
+			wantAPIAuth: "Bearer secret",
+		},
+		{
+			name:        "GitLab",
+			forge:       &gitlabForge{},
+			wantGitAuth: "Basic " + basicAuth("oauth2", "secret"),
+			wantAPIAuth: "Bearer secret",
+		},
+		{
+			name:        "Gitea",
+			forge:       &giteaForge{},
+			wantGitAuth: "Basic " + basicAuth("secret", "x-oauth-basic"),
+			wantAPIAuth: "token secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gitReq := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.forge.authorizeGit(gitReq, "secret")
+			assert.Equal(t, tt.wantGitAuth, gitReq.Header.Get("Authorization"))
+
+			apiReq := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.forge.authorizeAPI(apiReq, "secret")
+			assert.Equal(t, tt.wantAPIAuth, apiReq.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestForge_IsAncestor(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/compare/{basehead}", func(w http.ResponseWriter, r *http.Request) {
+		// GitHub compare
+		switch r.PathValue("basehead") {
+		case testOID1 + "..." + testOID2:
+			w.Write([]byte(`{"status":"ahead"}`))
+		default:
+			w.Write([]byte(`{"status":"diverged"}`))
+		}
+	})
+	mux.HandleFunc("GET /api/v1/repos/owner/repo/compare/{basehead}", func(w http.ResponseWriter, r *http.Request) {
+		// Gitea compares head...base
+		switch r.PathValue("basehead") {
+		case testOID2 + "..." + testOID1:
+			w.Write([]byte(`{"total_commits":0}`))
+		default:
+			w.Write([]byte(`{"total_commits":2}`))
+		}
+	})
+	mux.HandleFunc("GET /api/v4/projects/{id}/repository/merge_base", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "group/subgroup/repo" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		refs := r.URL.Query()["refs[]"]
+		require.Len(t, refs, 2)
+		if refs[0] == testOID1 {
+			w.Write([]byte(`{"id":"` + testOID1 + `"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"3333333333333333333333333333333333333333"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		forge   forge
+		owner   string
+		base    string
+		head    string
+		want    bool
+		wantErr string
+	}{
+		{
+			name:  "GitHub fast-forward",
+			forge: &githubForge{api: server.URL},
+			owner: "owner",
+			base:  testOID1,
+			head:  testOID2,
+			want:  true,
+		},
+		{
+			name:  "GitHub diverged",
+			forge: &githubForge{api: server.URL},
+			owner: "owner",
+			base:  testOID2,
+			head:  testOID1,
+			want:  false,
+		},
+		{
+			name:  "Gitea fast-forward",
+			forge: &giteaForge{baseURL: server.URL},
+			owner: "owner",
+			base:  testOID1,
+			head:  testOID2,
+			want:  true,
+		},
+		{
+			name:  "Gitea diverged",
+			forge: &giteaForge{baseURL: server.URL},
+			owner: "owner",
+			base:  testOID2,
+			head:  testOID1,
+			want:  false,
+		},
+		{
+			name:  "GitLab fast-forward in a nested group",
+			forge: &gitlabForge{baseURL: server.URL},
+			owner: "group/subgroup",
+			base:  testOID1,
+			head:  testOID2,
+			want:  true,
+		},
+		{
+			name:  "GitLab diverged",
+			forge: &gitlabForge{baseURL: server.URL},
+			owner: "group/subgroup",
+			base:  testOID2,
+			head:  testOID1,
+			want:  false,
+		},
+		{
+			name:    "API error",
+			forge:   &gitlabForge{baseURL: server.URL},
+			owner:   "other",
+			base:    testOID1,
+			head:    testOID2,
+			wantErr: "returned 404 Not Found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.forge.isAncestor(context.Background(), http.DefaultClient, "secret", tt.owner, "repo", tt.base, tt.head)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestForge_IsPublic(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/{repo}", func(w http.ResponseWriter, r *http.Request) {
+		// GitHub
+		switch r.PathValue("repo") {
+		case "public":
+			w.Write([]byte(`{"private":false,"visibility":"public"}`))
+		case "internal":
+			w.Write([]byte(`{"private":true,"visibility":"internal"}`))
+		default:
+			w.Write([]byte(`{"private":true,"visibility":"private"}`))
+		}
+	})
+	mux.HandleFunc("GET /api/v1/repos/owner/{repo}", func(w http.ResponseWriter, r *http.Request) {
+		// Gitea
+		switch r.PathValue("repo") {
+		case "public":
+			w.Write([]byte(`{"private":false,"internal":false}`))
+		case "internal":
+			w.Write([]byte(`{"private":false,"internal":true}`))
+		default:
+			w.Write([]byte(`{"private":true,"internal":false}`))
+		}
+	})
+	mux.HandleFunc("GET /api/v4/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("id") {
+		case "group/subgroup/public":
+			w.Write([]byte(`{"visibility":"public"}`))
+		case "group/subgroup/internal":
+			w.Write([]byte(`{"visibility":"internal"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		forge   forge
+		owner   string
+		repo    string
+		want    bool
+		wantErr string
+	}{
+		{name: "GitHub public", forge: &githubForge{api: server.URL}, owner: "owner", repo: "public", want: true},
+		{name: "GitHub internal", forge: &githubForge{api: server.URL}, owner: "owner", repo: "internal"},
+		{name: "GitHub private", forge: &githubForge{api: server.URL}, owner: "owner", repo: "private"},
+		{name: "Gitea public", forge: &giteaForge{baseURL: server.URL}, owner: "owner", repo: "public", want: true},
+		{name: "Gitea internal", forge: &giteaForge{baseURL: server.URL}, owner: "owner", repo: "internal"},
+		{name: "Gitea private", forge: &giteaForge{baseURL: server.URL}, owner: "owner", repo: "private"},
+		{name: "GitLab public in a nested group", forge: &gitlabForge{baseURL: server.URL}, owner: "group/subgroup", repo: "public", want: true},
+		{name: "GitLab internal", forge: &gitlabForge{baseURL: server.URL}, owner: "group/subgroup", repo: "internal"},
+		{name: "API error", forge: &gitlabForge{baseURL: server.URL}, owner: "group", repo: "missing", wantErr: "project group/missing returned 404 Not Found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.forge.isPublic(context.Background(), http.DefaultClient, "secret", tt.owner, tt.repo)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestForge_CheckToken(t *testing.T) {
+	mux := http.NewServeMux()
+	authorized := func(path, authorization string) {
+		mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != authorization {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{}`))
+		})
+	}
+	authorized("/rate_limit", "Bearer secret")
+	authorized("/api/v4/user", "Bearer secret")
+	authorized("/api/v1/user", "token secret")
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		forge   forge
+		token   string
+		wantErr string
+	}{
+		{name: "GitHub", forge: &githubForge{api: server.URL}, token: "secret"},
+		{name: "GitHub rejects the token", forge: &githubForge{api: server.URL}, token: "revoked", wantErr: "rate limit returned 401 Unauthorized"},
+		{name: "GitLab", forge: &gitlabForge{baseURL: server.URL}, token: "secret"},
+		{name: "GitLab rejects the token", forge: &gitlabForge{baseURL: server.URL}, token: "revoked", wantErr: "user returned 401 Unauthorized"},
+		{name: "Gitea", forge: &giteaForge{baseURL: server.URL}, token: "secret"},
+		{name: "Gitea rejects the token", forge: &giteaForge{baseURL: server.URL}, token: "revoked", wantErr: "user returned 401 Unauthorized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.forge.checkToken(context.Background(), http.DefaultClient, tt.token)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAPIServer_NonGitHubForge(t *testing.T) {
+	config := ProxyConfig{
+		Host:         "gitlab.com",
+		AllowedOwner: "group",
+		AllowedRepo:  "repo",
+	}
+	server := NewAPIServer(config, NewGitHubAuthFromToken("secret"))
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		wantBody string
+	}{
+		{
+			name:     "REST API",
+			method:   http.MethodGet,
+			path:     "/api/github/repos/group/repo/pulls",
+			wantBody: "not implemented: the API is not supported for gitlab hosts",
+		},
+		{
+			name:     "GraphQL",
+			method:   http.MethodPost,
+			path:     "/api/graphql",
+			wantBody: "not implemented: GraphQL is not supported for gitlab hosts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			assert.Equal(t, http.StatusNotImplemented, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
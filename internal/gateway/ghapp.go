@@ -0,0 +1,368 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// githubAppJWTLifetime is how long an app JWT is valid. GitHub allows at
+	// most 10 minutes.
+	githubAppJWTLifetime = 9 * time.Minute
+
+	// githubAppTokenRefreshMargin is how long before expiry an installation
+	// token is replaced. Tokens are valid for an hour.
+	githubAppTokenRefreshMargin = 5 * time.Minute
+
+	// githubAppRequestTimeout bounds a single request to mint a token.
+	githubAppRequestTimeout = 30 * time.Second
+)
+
+// gitHubAppOperationPermissions lists the installation token permissions
+// each API operation needs. Read operations need read access, and write
+// operations write access.
+var gitHubAppOperationPermissions = map[string][]string{
+	"list-prs":                  {"pull_requests"},
+	"create-pr":                 {"pull_requests"},
+	"get-pr":                    {"pull_requests"},
+	"update-pr":                 {"pull_requests"},
+	"list-pr-comments":          {"pull_requests"},
+	"create-pr-comment":         {"pull_requests"},
+	"list-pr-reviews":           {"pull_requests"},
+	"create-pr-review":          {"pull_requests"},
+	"merge-pr":                  {"contents", "pull_requests"},
+	"list-issues":               {"issues"},
+	"create-issue":              {"issues"},
+	"get-issue":                 {"issues"},
+	"create-issue-comment":      {"issues", "pull_requests"},
+	"get-repo":                  {"metadata"},
+	"get-file-contents":         {"contents"},
+	"list-releases":             {"contents"},
+	"list-checks":               {"checks"},
+	"list-workflow-runs":        {"actions"},
+	"get-workflow-run":          {"actions"},
+	"list-workflow-run-jobs":    {"actions"},
+	"get-workflow-run-job-logs": {"actions"},
+}
+
+// GitHubAppPermissions returns the permission set for installation tokens
+// that covers what the gateway lets through: contents write for pushes to
+// the project, and the permissions of every operation the policy doesn't
+// deny.
+func (c ProxyConfig) GitHubAppPermissions() map[string]string {
+	permissions := map[string]string{"contents": "write", "metadata": "read"}
+	for _, op := range operations {
+		if c.operationDecision(op.Name) == OperationDeny {
+			continue
+		}
+		for _, name := range gitHubAppOperationPermissions[op.Name] {
+			if permissions[name] != "write" {
+				permissions[name] = op.Type
+			}
+		}
+	}
+	return permissions
+}
+
+// GitHubAppRepositories returns the names of the repositories in the
+// project owner's account that installation tokens need to cover: the
+// project, and the repositories the policy lets be read or written. It
+// returns nil, for every repository of the installation, when the policy
+// lets every repository be read or allows a glob of repository names.
+// Repositories of other accounts belong to other installations, which the
+// tokens cannot cover.
+func (c ProxyConfig) GitHubAppRepositories() []string {
+	policy := c.repoPolicy()
+	if policy.ReadsAll() {
+		return nil
+	}
+
+	repos := []string{c.AllowedRepo}
+	for _, patterns := range [][]string{policy.Read.Allow, policy.Write.Allow, policy.Write.NeedsApproval} {
+		for _, pattern := range patterns {
+			parts := strings.Split(pattern, "/")
+			switch len(parts) {
+			case 2:
+			case 3:
+				if matched, _ := path.Match(strings.ToLower(parts[0]), strings.ToLower(c.host())); !matched {
+					continue
+				}
+				parts = parts[1:]
+			default:
+				continue
+			}
+			if matched, _ := path.Match(strings.ToLower(parts[0]), strings.ToLower(c.AllowedOwner)); !matched {
+				continue
+			}
+			name, ok := unescapeGlob(parts[1])
+			if !ok {
+				return nil
+			}
+			if !slices.ContainsFunc(repos, func(repo string) bool { return strings.EqualFold(repo, name) }) {
+				repos = append(repos, name)
+			}
+		}
+	}
+	return repos
+}
+
+// unescapeGlob returns the name a path.Match pattern matches, or false if it
+// matches more than one name.
+func unescapeGlob(pattern string) (string, bool) {
+	var name strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*', '?', '[':
+			return "", false
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				name.WriteByte(pattern[i])
+			}
+		default:
+			name.WriteByte(c)
+		}
+	}
+	return name.String(), true
+}
+
+// GitHubAppConfig configures authentication as a GitHub App installation.
+type GitHubAppConfig struct {
+	// Host is the forge host the app is registered on. Defaults to
+	// DefaultHost.
+	Host  string
+	AppID int64
+	// InstallationID is the installation on the repository's account. When
+	// zero, it is looked up from Owner/Repo.
+	InstallationID int64
+	// PrivateKey is the app's PEM-encoded RSA private key.
+	PrivateKey []byte
+	// Owner and Repo are the repository the installation is looked up from.
+	Owner string
+	Repo  string
+	// Repositories are the names of the repositories in Owner's account
+	// that installation tokens are scoped to. When empty, tokens cover
+	// every repository of the installation. See
+	// ProxyConfig.GitHubAppRepositories.
+	Repositories []string
+	// Permissions is the permission set of installation tokens. Defaults to
+	// the permissions of every operation; see
+	// ProxyConfig.GitHubAppPermissions.
+	Permissions map[string]string
+}
+
+// githubApp mints installation tokens for a GitHub App and caches the
+// current one until shortly before it expires.
+type githubApp struct {
+	config     GitHubAppConfig
+	key        *rsa.PrivateKey
+	apiURL     string
+	httpClient *http.Client
+
+	mu             sync.Mutex
+	installationID int64
+	token          string
+	expiresAt      time.Time
+}
+
+// NewGitHubAuthFromApp creates auth that mints short-lived installation
+// tokens for a GitHub App, scoped to config's repositories and permissions,
+// and refreshes them before they expire. A first token is minted to check
+// the configuration.
+func NewGitHubAuthFromApp(config GitHubAppConfig) (*GitHubAuth, error) {
+	host := hostOrDefault(config.Host)
+	apiURL := newForge(host, ForgeConfig{Kind: ForgeGitHub}).apiURL()
+	return newGitHubAuthFromApp(config, apiURL, &http.Client{Timeout: githubAppRequestTimeout})
+}
+
+func newGitHubAuthFromApp(config GitHubAppConfig, apiURL string, httpClient *http.Client) (*GitHubAuth, error) {
+	if config.AppID == 0 {
+		return nil, fmt.Errorf("GitHub App ID is required")
+	}
+	if config.Owner == "" || config.Repo == "" {
+		return nil, fmt.Errorf("GitHub App repository is required")
+	}
+	if len(config.Permissions) == 0 {
+		config.Permissions = ProxyConfig{}.GitHubAppPermissions()
+	}
+
+	key, err := parseRSAPrivateKey(config.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &githubApp{
+		config:         config,
+		key:            key,
+		apiURL:         apiURL,
+		httpClient:     httpClient,
+		installationID: config.InstallationID,
+	}
+	if err := app.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return &GitHubAuth{host: config.Host, app: app}, nil
+}
+
+// parseRSAPrivateKey parses a PEM-encoded PKCS#1 or PKCS#8 RSA private key.
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode GitHub App private key: no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Token returns the current installation token, minting a new one when it
+// is about to expire. If minting fails, the current token is returned while
+// it is still valid, and "" afterwards.
+func (a *githubApp) Token() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if time.Until(a.expiresAt) > githubAppTokenRefreshMargin {
+		return a.token
+	}
+	if err := a.refreshLocked(context.Background()); err != nil && time.Now().After(a.expiresAt) {
+		return ""
+	}
+	return a.token
+}
+
+// refresh mints a new installation token.
+func (a *githubApp) refresh(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.refreshLocked(ctx)
+}
+
+func (a *githubApp) refreshLocked(ctx context.Context) error {
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if a.installationID == 0 {
+		var installation struct {
+			ID int64 `json:"id"`
+		}
+		path := fmt.Sprintf("/repos/%s/%s/installation", a.config.Owner, a.config.Repo)
+		if err := a.do(ctx, jwt, http.MethodGet, path, nil, &installation); err != nil {
+			return fmt.Errorf("failed to find GitHub App installation for %s/%s: %w", a.config.Owner, a.config.Repo, err)
+		}
+		a.installationID = installation.ID
+	}
+
+	request := struct {
+		Repositories []string          `json:"repositories,omitempty"`
+		Permissions  map[string]string `json:"permissions"`
+	}{
+		Repositories: a.config.Repositories,
+		Permissions:  a.config.Permissions,
+	}
+	var response struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", a.installationID)
+	if err := a.do(ctx, jwt, http.MethodPost, path, request, &response); err != nil {
+		return fmt.Errorf("failed to create GitHub App installation token: %w", err)
+	}
+	if response.Token == "" {
+		return fmt.Errorf("failed to create GitHub App installation token: response has no token")
+	}
+
+	a.token = response.Token
+	a.expiresAt = response.ExpiresAt
+	return nil
+}
+
+// do sends a GitHub API request authenticated with the app JWT and decodes
+// the JSON response into result.
+func (a *githubApp) do(ctx context.Context, jwt, method, path string, body, result any) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.apiURL+path, &reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to contact GitHub API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, apiErr.Message)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// jwt returns an RS256 JSON Web Token authenticating as the app.
+func (a *githubApp) jwt(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		// Backdate to allow for clock drift, as GitHub recommends.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(githubAppJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(a.config.AppID, 10),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT claims: %w", err)
+	}
+
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
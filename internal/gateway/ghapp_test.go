@@ -0,0 +1,323 @@
+package gateway
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHubApp is a fake GitHub API for the app installation endpoints.
+type fakeGitHubApp struct {
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	tokenLifetime  time.Duration
+	failTokens     bool
+	tokenRequests  int
+	lookups        int
+	lastPermission map[string]string
+	lastRepos      []string
+}
+
+func (f *fakeGitHubApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.verifyJWT(r.Header.Get("Authorization"))
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/my-owner/my-repo/installation":
+		f.lookups++
+		json.NewEncoder(w).Encode(map[string]any{"id": 42})
+	case r.Method == http.MethodPost && r.URL.Path == "/app/installations/42/access_tokens":
+		if f.failTokens {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"message": "boom"})
+			return
+		}
+		var body struct {
+			Repositories []string          `json:"repositories"`
+			Permissions  map[string]string `json:"permissions"`
+		}
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&body))
+		f.lastRepos = body.Repositories
+		f.lastPermission = body.Permissions
+		f.tokenRequests++
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"token":      fmt.Sprintf("ghs_token_%d", f.tokenRequests),
+			"expires_at": time.Now().Add(f.tokenLifetime).UTC().Format(time.RFC3339),
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+	}
+}
+
+// verifyJWT checks that the request is authenticated with a JWT signed by
+// the app key and issued by app 123.
+func (f *fakeGitHubApp) verifyJWT(authorization string) {
+	jwt, ok := strings.CutPrefix(authorization, "Bearer ")
+	require.True(f.t, ok, "missing bearer token")
+	parts := strings.Split(jwt, ".")
+	require.Len(f.t, parts, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(f.t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(f.t, rsa.VerifyPKCS1v15(&f.key.PublicKey, crypto.SHA256, digest[:], signature))
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(f.t, err)
+	var claims struct {
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+		Iss string `json:"iss"`
+	}
+	require.NoError(f.t, json.Unmarshal(claimsJSON, &claims))
+	assert.Equal(f.t, "123", claims.Iss)
+	assert.LessOrEqual(f.t, claims.Exp-claims.Iat, int64(10*time.Minute/time.Second))
+	assert.Greater(f.t, claims.Exp, time.Now().Unix())
+}
+
+func generateRSAKeyPEM(t *testing.T, pkcs8 bool) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	if pkcs8 {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestNewGitHubAuthFromApp(t *testing.T) {
+	key, keyPEM := generateRSAKeyPEM(t, false)
+
+	tests := []struct {
+		name            string
+		installationID  int64
+		repositories    []string
+		permissions     map[string]string
+		wantLookups     int
+		wantRepos       []string
+		wantPermissions map[string]string
+	}{
+		{
+			name:            "installation looked up from the repository",
+			wantLookups:     1,
+			wantPermissions: ProxyConfig{}.GitHubAppPermissions(),
+		},
+		{
+			name:            "explicit installation, repositories, and permissions",
+			installationID:  42,
+			repositories:    []string{"my-repo"},
+			permissions:     map[string]string{"contents": "read"},
+			wantRepos:       []string{"my-repo"},
+			wantPermissions: map[string]string{"contents": "read"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGitHubApp{t: t, key: key, tokenLifetime: time.Hour}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			auth, err := newGitHubAuthFromApp(GitHubAppConfig{
+				AppID:          123,
+				InstallationID: tt.installationID,
+				PrivateKey:     keyPEM,
+				Owner:          "my-owner",
+				Repo:           "my-repo",
+				Repositories:   tt.repositories,
+				Permissions:    tt.permissions,
+			}, server.URL, server.Client())
+			require.NoError(t, err)
+
+			assert.Equal(t, "ghs_token_1", auth.Token())
+			// The token is cached while it is valid.
+			assert.Equal(t, "ghs_token_1", auth.Token())
+			assert.Equal(t, 1, fake.tokenRequests)
+			assert.Equal(t, tt.wantLookups, fake.lookups)
+			assert.Equal(t, tt.wantRepos, fake.lastRepos)
+			assert.Equal(t, tt.wantPermissions, fake.lastPermission)
+		})
+	}
+}
+
+func TestGitHubApp_TokenRefresh(t *testing.T) {
+	key, keyPEM := generateRSAKeyPEM(t, true)
+	// Tokens expire within the refresh margin, so every call mints a new one.
+	fake := &fakeGitHubApp{t: t, key: key, tokenLifetime: 2 * time.Minute}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	auth, err := newGitHubAuthFromApp(GitHubAppConfig{
+		AppID:      123,
+		PrivateKey: keyPEM,
+		Owner:      "my-owner",
+		Repo:       "my-repo",
+	}, server.URL, server.Client())
+	require.NoError(t, err)
+
+	assert.Equal(t, "ghs_token_2", auth.Token())
+	assert.Equal(t, "ghs_token_3", auth.Token())
+	// The installation is looked up once.
+	assert.Equal(t, 1, fake.lookups)
+
+	// When minting fails, the current token is used until it expires.
+	fake.failTokens = true
+	assert.Equal(t, "ghs_token_3", auth.Token())
+
+	auth.app.expiresAt = time.Now().Add(-time.Second)
+	assert.Empty(t, auth.Token())
+}
+
+func TestNewGitHubAuthFromApp_Errors(t *testing.T) {
+	key, keyPEM := generateRSAKeyPEM(t, false)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+	ecPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecDER})
+
+	tests := []struct {
+		name       string
+		config     GitHubAppConfig
+		failTokens bool
+		wantErr    string
+	}{
+		{
+			name:    "missing app ID",
+			config:  GitHubAppConfig{PrivateKey: keyPEM, Owner: "my-owner", Repo: "my-repo"},
+			wantErr: "GitHub App ID is required",
+		},
+		{
+			name:    "missing repository",
+			config:  GitHubAppConfig{AppID: 123, PrivateKey: keyPEM},
+			wantErr: "GitHub App repository is required",
+		},
+		{
+			name:    "key is not PEM",
+			config:  GitHubAppConfig{AppID: 123, PrivateKey: []byte("not a key"), Owner: "my-owner", Repo: "my-repo"},
+			wantErr: "no PEM data found",
+		},
+		{
+			name:    "key is not RSA",
+			config:  GitHubAppConfig{AppID: 123, PrivateKey: ecPEM, Owner: "my-owner", Repo: "my-repo"},
+			wantErr: "GitHub App private key is not an RSA key",
+		},
+		{
+			name:    "app not installed on the repository",
+			config:  GitHubAppConfig{AppID: 123, PrivateKey: keyPEM, Owner: "other-owner", Repo: "other-repo"},
+			wantErr: "failed to find GitHub App installation for other-owner/other-repo: GitHub API returned status 404: Not Found",
+		},
+		{
+			name:       "token creation fails",
+			config:     GitHubAppConfig{AppID: 123, InstallationID: 42, PrivateKey: keyPEM, Owner: "my-owner", Repo: "my-repo"},
+			failTokens: true,
+			wantErr:    "failed to create GitHub App installation token: GitHub API returned status 500: boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGitHubApp{t: t, key: key, tokenLifetime: time.Hour, failTokens: tt.failTokens}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			_, err := newGitHubAuthFromApp(tt.config, server.URL, server.Client())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestProxyConfig_GitHubAppRepositories(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    *Policy
+		readRepos []string
+		want      []string
+	}{
+		{
+			name: "every repository is readable",
+			want: nil,
+		},
+		{
+			name:   "project scope",
+			policy: &Policy{Repos: RepoPolicy{Read: AccessList{Scope: ReadScopeProject}}},
+			want:   []string{"my-repo"},
+		},
+		{
+			name: "readable and writable repositories of the project owner",
+			policy: &Policy{Repos: RepoPolicy{
+				Read:  AccessList{Scope: ReadScopeProject, Allow: []string{"my-owner/docs", "github.com/my-owner/lib", "other-owner/tools", "github.example.com/my-owner/ghes"}},
+				Write: AccessList{Allow: []string{"my-owner/docs"}, NeedsApproval: []string{"MY-OWNER/site"}},
+			}},
+			readRepos: []string{"github.com/my-owner/sub.module"},
+			want:      []string{"my-repo", "docs", "lib", "sub.module", "site"},
+		},
+		{
+			name:   "glob of the project owner's repositories",
+			policy: &Policy{Repos: RepoPolicy{Read: AccessList{Allow: []string{"my-owner/tools-*"}}}},
+			want:   nil,
+		},
+		{
+			name:   "glob of other owners' repositories",
+			policy: &Policy{Repos: RepoPolicy{Read: AccessList{Allow: []string{"golang/*"}}}},
+			want:   []string{"my-repo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo", Policy: tt.policy, ReadRepos: tt.readRepos}
+			assert.Equal(t, tt.want, config.GitHubAppRepositories())
+		})
+	}
+}
+
+func TestProxyConfig_GitHubAppPermissions(t *testing.T) {
+	// Every operation needs a permission.
+	for _, op := range operations {
+		assert.NotEmpty(t, gitHubAppOperationPermissions[op.Name], op.Name)
+	}
+
+	assert.Equal(t, map[string]string{
+		"contents":      "write",
+		"metadata":      "read",
+		"pull_requests": "write",
+		"issues":        "write",
+		"checks":        "read",
+		"actions":       "read",
+	}, ProxyConfig{}.GitHubAppPermissions())
+
+	denied := ProxyConfig{Policy: &Policy{Operations: map[string]string{
+		"create-issue":         OperationDeny,
+		"create-issue-comment": OperationDeny,
+		"list-checks":          OperationDeny,
+	}}}
+	assert.Equal(t, map[string]string{
+		"contents":      "write",
+		"metadata":      "read",
+		"pull_requests": "write",
+		"issues":        "read",
+		"actions":       "read",
+	}, denied.GitHubAppPermissions())
+}
@@ -4,73 +4,120 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 // GitHubAuth handles GitHub authentication for the gateway.
-// When backed by a hosts file, Token() re-reads the file on each call so the
-// gateway picks up refreshed tokens without requiring a restart.
+// Token returns the token for the project host; TokenForHost returns tokens
+// for other hosts, read from the gh hosts file.
+// When backed by a hosts file, tokens are re-read from the file on each call
+// so the gateway picks up refreshed tokens without requiring a restart. When
+// backed by a GitHub App, Token() returns an installation token that is
+// refreshed before it expires.
 type GitHubAuth struct {
+	host        string // forge host Token authenticates to, defaults to DefaultHost
 	staticToken string
 	hostsPath   string
+	app         *githubApp
 }
 
-// NewGitHubAuth creates auth by trying methods in order:
+// NewGitHubAuth creates auth for host by trying methods in order:
 // 1. GITHUB_TOKEN env var
-// 2. Read PAT from ~/.config/gh/hosts.yml
+// 2. Read the host's token from ~/.config/gh/hosts.yml
 // 3. Error
-func NewGitHubAuth() (*GitHubAuth, error) {
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		return &GitHubAuth{staticToken: token}, nil
+// The hosts file is also used for the tokens of other hosts, if it exists.
+func NewGitHubAuth(host string) (*GitHubAuth, error) {
+	var hostsPath string
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		hostsPath = filepath.Join(homeDir, ".config", "gh", "hosts.yml")
 	}
 
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("no GITHUB_TOKEN set and failed to get home directory: %w", err)
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return &GitHubAuth{host: host, staticToken: token, hostsPath: hostsPath}, nil
 	}
 
-	hostsPath := filepath.Join(homeDir, ".config", "gh", "hosts.yml")
+	if hostsPath == "" {
+		return nil, fmt.Errorf("no GITHUB_TOKEN set and failed to get home directory")
+	}
 	// Validate that the file is readable and contains a token at startup.
-	if _, err := parseGHHostsFile(hostsPath); err != nil {
+	if _, err := parseGHHostsFile(hostsPath, hostOrDefault(host)); err != nil {
 		return nil, fmt.Errorf("no GITHUB_TOKEN set and failed to read gh hosts file: %w", err)
 	}
 
-	return &GitHubAuth{hostsPath: hostsPath}, nil
+	return &GitHubAuth{host: host, hostsPath: hostsPath}, nil
 }
 
-// NewGitHubAuthFromToken creates auth from an explicit token value.
+// NewGitHubAuthFromToken creates auth from an explicit token value for
+// DefaultHost.
 func NewGitHubAuthFromToken(token string) *GitHubAuth {
 	return &GitHubAuth{staticToken: token}
 }
 
-// Token returns the GitHub token. When backed by a hosts file, it re-reads the
-// file to pick up refreshed tokens.
+// Token returns the token for the project host. When backed by a hosts file,
+// it re-reads the file to pick up refreshed tokens; when backed by a GitHub
+// App, it mints a new installation token if the current one is about to
+// expire.
 func (a *GitHubAuth) Token() string {
+	if a.app != nil {
+		return a.app.Token()
+	}
 	if a.staticToken != "" {
 		return a.staticToken
 	}
-	token, err := parseGHHostsFile(a.hostsPath)
+	return a.hostsFileToken(hostOrDefault(a.host))
+}
+
+// TokenForHost returns the token for host, or "" if there is none.
+func (a *GitHubAuth) TokenForHost(host string) string {
+	if strings.EqualFold(host, hostOrDefault(a.host)) {
+		return a.Token()
+	}
+	return a.hostsFileToken(host)
+}
+
+// hostsFileToken returns host's token from the hosts file, or "" if there is
+// none.
+func (a *GitHubAuth) hostsFileToken(host string) string {
+	if a.hostsPath == "" {
+		return ""
+	}
+	token, err := parseGHHostsFile(a.hostsPath, host)
 	if err != nil {
 		return ""
 	}
 	return token
 }
 
+// hostOrDefault returns host, or DefaultHost if it is empty.
+func hostOrDefault(host string) string {
+	if host == "" {
+		return DefaultHost
+	}
+	return host
+}
+
 // ghHostsFile represents the structure of ~/.config/gh/hosts.yml.
 // Format:
 //
 //	github.com:
 //	    oauth_token: gho_xxxx
 //	    user: username
-type ghHostsFile map[string]struct {
+//	github.example.corp:
+//	    oauth_token: gho_yyyy
+//	    user: username
+type ghHostsFile map[string]ghHostEntry
+
+// ghHostEntry is a host's entry in hosts.yml.
+type ghHostEntry struct {
 	OAuthToken string `yaml:"oauth_token"`
 	User       string `yaml:"user"`
 }
 
 // parseGHHostsFile reads the gh CLI hosts.yml config file and returns the
-// oauth_token for github.com.
-func parseGHHostsFile(path string) (string, error) {
+// oauth_token for host.
+func parseGHHostsFile(path, host string) (string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return "", fmt.Errorf("failed to read hosts file %s: %w", path, err)
@@ -81,14 +128,20 @@ func parseGHHostsFile(path string) (string, error) {
 		return "", fmt.Errorf("failed to parse hosts file: %w", err)
 	}
 
-	gh, ok := hosts["github.com"]
-	if !ok {
-		return "", fmt.Errorf("no github.com entry found in hosts file")
+	var entry *ghHostEntry
+	for name, h := range hosts {
+		if strings.EqualFold(name, host) {
+			entry = &h
+			break
+		}
+	}
+	if entry == nil {
+		return "", fmt.Errorf("no %s entry found in hosts file", host)
 	}
 
-	if gh.OAuthToken == "" {
-		return "", fmt.Errorf("no oauth_token found for github.com in hosts file")
+	if entry.OAuthToken == "" {
+		return "", fmt.Errorf("no oauth_token found for %s in hosts file", host)
 	}
 
-	return gh.OAuthToken, nil
+	return entry.OAuthToken, nil
 }
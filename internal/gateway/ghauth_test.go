@@ -12,7 +12,7 @@ import (
 func TestNewGitHubAuth_EnvVar(t *testing.T) {
 	t.Setenv("GITHUB_TOKEN", "ghp_test_token_123")
 
-	auth, err := NewGitHubAuth()
+	auth, err := NewGitHubAuth("")
 
 	require.NoError(t, err)
 	assert.Equal(t, "ghp_test_token_123", auth.Token())
@@ -35,7 +35,7 @@ func TestNewGitHubAuth_GHHostsFile(t *testing.T) {
 	err = os.WriteFile(filepath.Join(ghDir, "hosts.yml"), []byte(hostsContent), 0o600)
 	require.NoError(t, err)
 
-	auth, err := NewGitHubAuth()
+	auth, err := NewGitHubAuth("")
 
 	require.NoError(t, err)
 	assert.Equal(t, "gho_from_hosts", auth.Token())
@@ -46,7 +46,7 @@ func TestNewGitHubAuth_NoAuthAvailable(t *testing.T) {
 	// Set HOME to a temp dir without gh config
 	t.Setenv("HOME", t.TempDir())
 
-	_, err := NewGitHubAuth()
+	_, err := NewGitHubAuth("")
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "no GITHUB_TOKEN set")
@@ -85,6 +85,14 @@ gitlab.com:
 `,
 			wantToken: "gho_primary",
 		},
+		{
+			name: "host matched case-insensitively",
+			content: `GitHub.com:
+    oauth_token: gho_mixed_case
+    user: testuser
+`,
+			wantToken: "gho_mixed_case",
+		},
 		{
 			name: "no github.com entry",
 			content: `gitlab.com:
@@ -118,7 +126,7 @@ gitlab.com:
 			err := os.WriteFile(hostsPath, []byte(tt.content), 0o600)
 			require.NoError(t, err)
 
-			token, err := parseGHHostsFile(hostsPath)
+			token, err := parseGHHostsFile(hostsPath, "github.com")
 
 			if tt.wantErr {
 				require.Error(t, err)
@@ -144,7 +152,7 @@ func TestGitHubAuth_TokenRefresh(t *testing.T) {
 	hostsPath := filepath.Join(ghDir, "hosts.yml")
 	require.NoError(t, os.WriteFile(hostsPath, []byte("github.com:\n    oauth_token: old_token\n    user: testuser\n"), 0o600))
 
-	auth, err := NewGitHubAuth()
+	auth, err := NewGitHubAuth("")
 	require.NoError(t, err)
 	assert.Equal(t, "old_token", auth.Token())
 
@@ -155,8 +163,44 @@ func TestGitHubAuth_TokenRefresh(t *testing.T) {
 }
 
 func TestParseGHHostsFile_FileNotFound(t *testing.T) {
-	_, err := parseGHHostsFile("/nonexistent/path/hosts.yml")
+	_, err := parseGHHostsFile("/nonexistent/path/hosts.yml", "github.com")
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to read hosts file")
 }
+
+func TestGitHubAuth_TokenForHost(t *testing.T) {
+	tmpHome := t.TempDir()
+	t.Setenv("HOME", tmpHome)
+	ghDir := filepath.Join(tmpHome, ".config", "gh")
+	require.NoError(t, os.MkdirAll(ghDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(ghDir, "hosts.yml"), []byte(`github.com:
+    oauth_token: gho_public
+github.example.corp:
+    oauth_token: gho_enterprise
+`), 0o600))
+
+	tests := []struct {
+		name        string
+		envToken    string
+		projectHost string
+		host        string
+		want        string
+	}{
+		{name: "project host from hosts file", projectHost: "github.example.corp", host: "github.example.corp", want: "gho_enterprise"},
+		{name: "other host from hosts file", projectHost: "github.example.corp", host: "github.com", want: "gho_public"},
+		{name: "env token is for the project host only", envToken: "ghp_env", projectHost: "github.example.corp", host: "GITHUB.EXAMPLE.CORP", want: "ghp_env"},
+		{name: "other host with env token", envToken: "ghp_env", projectHost: "github.example.corp", host: "github.com", want: "gho_public"},
+		{name: "host without a token", projectHost: "github.example.corp", host: "gitlab.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_TOKEN", tt.envToken)
+
+			auth, err := NewGitHubAuth(tt.projectHost)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, auth.TokenForHost(tt.host))
+		})
+	}
+}
@@ -0,0 +1,1201 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// maxGraphQLRequestSize bounds the GraphQL request body the gateway
+	// buffers for inspection.
+	maxGraphQLRequestSize = 1 << 20
+
+	// maxGraphQLDepth bounds the nesting of selection sets and values, so a
+	// malicious document can't exhaust the parser.
+	maxGraphQLDepth = 100
+
+	// maxGraphQLSelections bounds the selections of an operation after
+	// fragment spreads are expanded, so fragments spread many times can't
+	// exhaust the gateway.
+	maxGraphQLSelections = 10000
+)
+
+// graphQLMutation describes a GitHub GraphQL mutation the gateway forwards.
+type graphQLMutation struct {
+	// Name is the mutation field name.
+	Name string
+	// TargetField is the field of the mutation's input object holding the
+	// node ID of the repository, or of an object in the repository, that
+	// the mutation modifies.
+	TargetField string
+	// Operation is the REST operation whose policy decision also applies to
+	// the mutation. Empty if none does.
+	Operation string
+	// ProtectBase denies the mutation when the target pull request's base
+	// branch is protected.
+	ProtectBase bool
+}
+
+// graphQLMutations is the list of GraphQL mutations the gateway forwards.
+// They cover what gh uses for pull requests and issues.
+var graphQLMutations = []graphQLMutation{
+	{Name: "createPullRequest", TargetField: "repositoryId", Operation: "create-pr"},
+	{Name: "updatePullRequest", TargetField: "pullRequestId", Operation: "update-pr"},
+	{Name: "closePullRequest", TargetField: "pullRequestId", Operation: "update-pr"},
+	{Name: "reopenPullRequest", TargetField: "pullRequestId", Operation: "update-pr"},
+	{Name: "markPullRequestReadyForReview", TargetField: "pullRequestId", Operation: "update-pr"},
+	{Name: "convertPullRequestToDraft", TargetField: "pullRequestId", Operation: "update-pr"},
+	{Name: "requestReviews", TargetField: "pullRequestId", Operation: "update-pr"},
+	{Name: "addPullRequestReview", TargetField: "pullRequestId", Operation: "create-pr-review"},
+	{Name: "mergePullRequest", TargetField: "pullRequestId", Operation: "merge-pr", ProtectBase: true},
+	{Name: "enablePullRequestAutoMerge", TargetField: "pullRequestId", Operation: "merge-pr", ProtectBase: true},
+	{Name: "createIssue", TargetField: "repositoryId", Operation: "create-issue"},
+	{Name: "addComment", TargetField: "subjectId", Operation: "create-issue-comment"},
+	{Name: "addLabelsToLabelable", TargetField: "labelableId"},
+	{Name: "addAssigneesToAssignable", TargetField: "assignableId"},
+}
+
+// findGraphQLMutation returns the forwarded mutation with the given name, or nil.
+func findGraphQLMutation(name string) *graphQLMutation {
+	for i := range graphQLMutations {
+		if graphQLMutations[i].Name == name {
+			return &graphQLMutations[i]
+		}
+	}
+	return nil
+}
+
+// graphQLRequest is the JSON body of a GraphQL request.
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// graphQLError is a single error in a GraphQL error response.
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// graphQLErrorResponse is a GraphQL response carrying only errors.
+type graphQLErrorResponse struct {
+	Errors []graphQLError `json:"errors"`
+}
+
+// writeGraphQLError writes a GraphQL error response, which gh shows to the user.
+func writeGraphQLError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(graphQLErrorResponse{Errors: []graphQLError{{Message: message}}})
+}
+
+// handleGraphQL proxies a GraphQL request to the GitHub API. The document is
+// parsed to find the operation that will run. Queries for a repository need
+// it to be readable. Mutations must be declared in graphQLMutations, and the
+// node they modify is resolved to check that its repository is writable.
+func (s *APIServer) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	if s.forge.kind() != ForgeGitHub {
+		writeGraphQLError(w, http.StatusNotImplemented, fmt.Sprintf("not implemented: GraphQL is not supported for %s hosts", s.forge.kind()))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGraphQLError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGraphQLRequestSize+1))
+	if err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf("failed to read request body: %v", err))
+		return
+	}
+	if len(body) > maxGraphQLRequestSize {
+		writeGraphQLError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	var req graphQLRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse GraphQL request: %v", err))
+		return
+	}
+
+	op, fields, err := selectGraphQLOperation(req.Query, req.OperationName)
+	if err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf("invalid GraphQL document: %v", err))
+		return
+	}
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		names := make([]string, len(fields))
+		for i, field := range fields {
+			names[i] = field.Name
+		}
+		entry.Host = s.config.host()
+		entry.Operation = op + " " + strings.Join(names, ",")
+	})
+
+	switch op {
+	case "query":
+		if msg := s.checkGraphQLQuery(r.Context(), fields, req.Variables); msg != "" {
+			writeGraphQLError(w, http.StatusForbidden, msg)
+			return
+		}
+	case "mutation":
+		for _, field := range fields {
+			status, msg := s.checkGraphQLMutation(r.Context(), field, req.Variables)
+			if msg != "" {
+				writeGraphQLError(w, status, msg)
+				return
+			}
+		}
+	default:
+		writeGraphQLError(w, http.StatusForbidden, fmt.Sprintf("forbidden: %s operations are not supported by the gateway", op))
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	s.forwardToGitHubAPI(w, r, "/api", "/graphql")
+}
+
+// graphQLUnrestrictedFields are the root query fields that cannot reach a
+// repository, so they are forwarded when reads are restricted.
+var graphQLUnrestrictedFields = map[string]bool{
+	"rateLimit":  true,
+	"__typename": true,
+	"__schema":   true,
+	"__type":     true,
+}
+
+// graphQLCrossRepositoryFields are fields nested in a repository that list
+// other repositories, or issues, pull requests, and project items that can
+// be in other repositories. They are denied when reads are restricted.
+var graphQLCrossRepositoryFields = map[string]bool{
+	"repositories":                   true,
+	"repositoriesContributedTo":      true,
+	"starredRepositories":            true,
+	"watching":                       true,
+	"topRepositories":                true,
+	"pinnedItems":                    true,
+	"pinnableItems":                  true,
+	"itemShowcase":                   true,
+	"forks":                          true,
+	"search":                         true,
+	"contributionsCollection":        true,
+	"gists":                          true,
+	"items":                          true,
+	"cards":                          true,
+	"trackedIssues":                  true,
+	"trackedInIssues":                true,
+	"subIssues":                      true,
+	"closedByPullRequestsReferences": true,
+	"closingIssuesReferences":        true,
+}
+
+// graphQLLinkedFields are fields nested in a repository that return a user,
+// an organization, another repository, or an issue or pull request that can
+// be in another repository. When reads are restricted, they may only select
+// the fields in graphQLIdentityFields, such as author { login } or
+// headRepository { nameWithOwner }.
+var graphQLLinkedFields = map[string]bool{
+	"owner":               true,
+	"headRepositoryOwner": true,
+	"organization":        true,
+	"user":                true,
+	"author":              true,
+	"editor":              true,
+	"actor":               true,
+	"mergedBy":            true,
+	"assignees":           true,
+	"participants":        true,
+	"requestedReviewer":   true,
+	"mentionableUsers":    true,
+	"assignableUsers":     true,
+	"collaborators":       true,
+	"stargazers":          true,
+	"watchers":            true,
+	"users":               true,
+	"repository":          true,
+	"headRepository":      true,
+	"baseRepository":      true,
+	"parent":              true,
+	"source":              true,
+	"templateRepository":  true,
+	"commitRepository":    true,
+	"subject":             true,
+	"canonical":           true,
+	"duplicate":           true,
+}
+
+// graphQLIdentityFields are the fields that identify a user, organization,
+// team, repository, or issue without reading its contents, and the fields
+// of connections that list them.
+var graphQLIdentityFields = map[string]bool{
+	"__typename":      true,
+	"id":              true,
+	"databaseId":      true,
+	"login":           true,
+	"name":            true,
+	"slug":            true,
+	"email":           true,
+	"avatarUrl":       true,
+	"url":             true,
+	"nameWithOwner":   true,
+	"owner":           true,
+	"user":            true,
+	"organization":    true,
+	"nodes":           true,
+	"edges":           true,
+	"node":            true,
+	"cursor":          true,
+	"totalCount":      true,
+	"pageInfo":        true,
+	"hasNextPage":     true,
+	"hasPreviousPage": true,
+	"startCursor":     true,
+	"endCursor":       true,
+}
+
+// checkGraphQLQuery checks the fields of a query against the read policy.
+// It returns a message describing why the query is denied, or "".
+//
+// When the policy doesn't let every repository be read, only an allowlist of
+// root fields is forwarded: repository, whose owner and name are checked,
+// viewer with scalar fields only, and the fields in
+// graphQLUnrestrictedFields. Other root fields, such as node, search,
+// organization, or resource, can reach repositories by ID, search, or URL.
+// Fields nested in a repository must not leave it either: see
+// graphQLLeavesRepository.
+func (s *APIServer) checkGraphQLQuery(ctx context.Context, fields []graphQLSelection, variables map[string]any) string {
+	restricted := !s.config.repoPolicy().ReadsAll()
+	for _, field := range fields {
+		if field.Name != "repository" {
+			if restricted && !graphQLUnrestrictedFields[field.Name] && !(field.Name == "viewer" && graphQLScalarsOnly(field.Selections)) {
+				return fmt.Sprintf("forbidden: query field %s is not supported by the gateway when repository reads are restricted", field.Name)
+			}
+			continue
+		}
+		if restricted {
+			if name := graphQLLeavesRepository(field.Selections, false); name != "" {
+				return fmt.Sprintf("forbidden: field %s can reach other repositories and is not supported by the gateway when repository reads are restricted", name)
+			}
+		}
+		owner, _ := resolveGraphQLValue(field.Arguments["owner"], variables).(string)
+		name, _ := resolveGraphQLValue(field.Arguments["name"], variables).(string)
+		readable, err := s.canRead(ctx, owner, name)
+		if err != nil {
+			return redact(fmt.Sprintf("forbidden: failed to check repository visibility: %v", err), s.ghAuth.Token())
+		}
+		if !readable {
+			return "forbidden: access denied for this repository"
+		}
+	}
+	return ""
+}
+
+// graphQLLeavesRepository returns the name of the first field in selections
+// that can read another repository, or "" if there is none. Fields in
+// graphQLCrossRepositoryFields are denied, and fields in graphQLLinkedFields
+// may only select identity fields. identityOnly is set within a linked field.
+func graphQLLeavesRepository(selections []graphQLSelection, identityOnly bool) string {
+	for _, selection := range selections {
+		if selection.Spread || selection.Inline {
+			if name := graphQLLeavesRepository(selection.Selections, identityOnly); name != "" {
+				return name
+			}
+			continue
+		}
+		if graphQLCrossRepositoryFields[selection.Name] || (identityOnly && !graphQLIdentityFields[selection.Name]) {
+			return selection.Name
+		}
+		if name := graphQLLeavesRepository(selection.Selections, identityOnly || graphQLLinkedFields[selection.Name]); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// graphQLScalarsOnly reports whether a selection set selects only fields
+// without selection sets of their own, such as viewer { login }.
+func graphQLScalarsOnly(selections []graphQLSelection) bool {
+	for _, selection := range selections {
+		if selection.Spread || selection.Inline || len(selection.Selections) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkGraphQLMutation checks a root field of a mutation against the policy.
+// It returns the status and message to deny the mutation with, or "".
+func (s *APIServer) checkGraphQLMutation(ctx context.Context, field graphQLSelection, variables map[string]any) (int, string) {
+	mutation := findGraphQLMutation(field.Name)
+	if mutation == nil {
+		return http.StatusForbidden, fmt.Sprintf("forbidden: mutation %s not supported by the gateway", field.Name)
+	}
+
+	var approvals []string
+	if mutation.Operation != "" {
+		switch s.config.operationDecision(mutation.Operation) {
+		case OperationDeny:
+			return http.StatusForbidden, fmt.Sprintf("forbidden: operation %s is denied by policy", mutation.Operation)
+		case OperationNeedsApproval:
+			approvals = append(approvals, fmt.Sprintf("operation %s requires approval", mutation.Operation))
+		}
+	}
+
+	input, _ := resolveGraphQLValue(field.Arguments["input"], variables).(map[string]any)
+	targetID, _ := input[mutation.TargetField].(string)
+	if targetID == "" {
+		return http.StatusForbidden, fmt.Sprintf("forbidden: mutation %s has no %s", field.Name, mutation.TargetField)
+	}
+
+	target, err := s.resolveGraphQLNode(ctx, targetID)
+	if err != nil {
+		return http.StatusBadGateway, fmt.Sprintf("failed to resolve target of mutation %s: %v", field.Name, err)
+	}
+
+	owner, repo, _ := strings.Cut(target.nameWithOwner(), "/")
+	if !s.config.repoPolicy().CanWrite(s.config.host(), owner, repo) {
+		if !s.config.repoPolicy().NeedsWriteApproval(s.config.host(), owner, repo) {
+			return http.StatusForbidden, "forbidden: access denied for this repository"
+		}
+		approvals = append(approvals, fmt.Sprintf("writes to %s/%s require approval", owner, repo))
+	}
+
+	if mutation.ProtectBase {
+		baseRef := "refs/heads/" + target.BaseRefName
+		switch refs := s.config.refPolicy(); {
+		case refs.RequiresApproval(baseRef):
+			approvals = append(approvals, fmt.Sprintf("mutation %s into branch %s requires approval", field.Name, target.BaseRefName))
+		case refs.IsProtected(baseRef):
+			return http.StatusForbidden, fmt.Sprintf("forbidden: mutation %s into protected branch %s is denied by policy", field.Name, target.BaseRefName)
+		}
+	}
+
+	if len(approvals) > 0 {
+		approved, reason := s.approvals.approve(ctx, ApprovalRequest{
+			Method:    http.MethodPost,
+			Path:      "/graphql",
+			Host:      s.config.host(),
+			Owner:     owner,
+			Repo:      repo,
+			Operation: field.Name,
+			Reason:    strings.Join(approvals, "; "),
+		})
+		if !approved {
+			return http.StatusForbidden, "forbidden: " + reason
+		}
+	}
+
+	return 0, ""
+}
+
+// graphQLNodeQuery resolves a node ID to its repository and, for pull
+// requests, the base branch.
+const graphQLNodeQuery = `query($id: ID!) {
+  node(id: $id) {
+    __typename
+    ... on Repository { nameWithOwner }
+    ... on RepositoryNode { repository { nameWithOwner } }
+    ... on PullRequest { baseRefName }
+  }
+}`
+
+// graphQLNode is the result of graphQLNodeQuery.
+type graphQLNode struct {
+	TypeName      string `json:"__typename"`
+	NameWithOwner string `json:"nameWithOwner"`
+	Repository    *struct {
+		NameWithOwner string `json:"nameWithOwner"`
+	} `json:"repository"`
+	BaseRefName string `json:"baseRefName"`
+}
+
+// nameWithOwner returns the "owner/repo" name of the node's repository.
+func (n *graphQLNode) nameWithOwner() string {
+	if n.Repository != nil {
+		return n.Repository.NameWithOwner
+	}
+	return n.NameWithOwner
+}
+
+// resolveGraphQLNode looks up a node by ID in the GitHub GraphQL API.
+func (s *APIServer) resolveGraphQLNode(ctx context.Context, id string) (*graphQLNode, error) {
+	body, err := json.Marshal(graphQLRequest{
+		Query:     graphQLNodeQuery,
+		Variables: map[string]any{"id": id},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode node query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, graphQLURL(s.upstreamURL), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create node query request: %w", err)
+	}
+	s.forge.authorizeAPI(req, s.ghAuth.Token())
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query node: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("node query returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			Node *graphQLNode `json:"node"`
+		} `json:"data"`
+		Errors []graphQLError `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode node query response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("node query failed: %s", result.Errors[0].Message)
+	}
+	if result.Data.Node == nil || result.Data.Node.nameWithOwner() == "" {
+		return nil, fmt.Errorf("node %s does not belong to a repository", id)
+	}
+	return result.Data.Node, nil
+}
+
+// graphQLVariable is a reference to a variable in a parsed GraphQL value.
+type graphQLVariable string
+
+// resolveGraphQLValue replaces variable references in a parsed value with
+// their values. Objects become map[string]any and lists []any.
+func resolveGraphQLValue(value any, variables map[string]any) any {
+	switch v := value.(type) {
+	case graphQLVariable:
+		return variables[string(v)]
+	case map[string]any:
+		resolved := make(map[string]any, len(v))
+		for key, item := range v {
+			resolved[key] = resolveGraphQLValue(item, variables)
+		}
+		return resolved
+	case []any:
+		resolved := make([]any, len(v))
+		for i, item := range v {
+			resolved[i] = resolveGraphQLValue(item, variables)
+		}
+		return resolved
+	default:
+		return v
+	}
+}
+
+// graphQLSelection is a field, fragment spread, or inline fragment in a
+// selection set.
+type graphQLSelection struct {
+	// Name is the field name, or the fragment name of a spread.
+	Name string
+	// Spread is set for fragment spreads.
+	Spread bool
+	// Inline is set for inline fragments.
+	Inline bool
+	// Arguments holds the field's arguments. Values are strings, bools,
+	// nil, graphQLVariable, []any, or map[string]any; numbers and enums
+	// are kept as strings.
+	Arguments map[string]any
+	// Selections is the selection set of a field or inline fragment. For
+	// the fields returned by selectGraphQLOperation, it is the selection set
+	// of the named fragment for spreads.
+	Selections []graphQLSelection
+}
+
+// graphQLOperation is an operation definition in a GraphQL document.
+type graphQLOperation struct {
+	Type       string // "query", "mutation", or "subscription"
+	Name       string
+	Selections []graphQLSelection
+}
+
+// graphQLDocument is a parsed GraphQL executable document.
+type graphQLDocument struct {
+	operations []*graphQLOperation
+	fragments  map[string][]graphQLSelection
+	// selections counts the selections expanded by expandSpreads.
+	selections int
+}
+
+// selectGraphQLOperation parses query and returns the type and root fields
+// of the operation GitHub will execute: the one named operationName, or the
+// only one in the document. Fragments at the root are expanded, and the
+// selection sets of fragment spreads nested in the root fields are filled in.
+func selectGraphQLOperation(query, operationName string) (string, []graphQLSelection, error) {
+	doc, err := parseGraphQL(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var op *graphQLOperation
+	switch {
+	case operationName != "":
+		for _, candidate := range doc.operations {
+			if candidate.Name == operationName {
+				op = candidate
+				break
+			}
+		}
+		if op == nil {
+			return "", nil, fmt.Errorf("operation %q not found", operationName)
+		}
+	case len(doc.operations) == 1:
+		op = doc.operations[0]
+	default:
+		return "", nil, fmt.Errorf("operationName is required for a document with %d operations", len(doc.operations))
+	}
+
+	fields, err := doc.rootFields(op.Selections, map[string]bool{})
+	if err != nil {
+		return "", nil, err
+	}
+	return op.Type, fields, nil
+}
+
+// rootFields returns the fields of a selection set, expanding fragment
+// spreads and inline fragments. visited guards against fragment cycles.
+func (d *graphQLDocument) rootFields(selections []graphQLSelection, visited map[string]bool) ([]graphQLSelection, error) {
+	var fields []graphQLSelection
+	for _, selection := range selections {
+		var nested []graphQLSelection
+		switch {
+		case selection.Spread:
+			if visited[selection.Name] {
+				return nil, fmt.Errorf("fragment %q spreads itself", selection.Name)
+			}
+			fragment, ok := d.fragments[selection.Name]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %q", selection.Name)
+			}
+			visited[selection.Name] = true
+			expanded, err := d.rootFields(fragment, visited)
+			if err != nil {
+				return nil, err
+			}
+			delete(visited, selection.Name)
+			nested = expanded
+		case selection.Inline:
+			expanded, err := d.rootFields(selection.Selections, visited)
+			if err != nil {
+				return nil, err
+			}
+			nested = expanded
+		default:
+			expanded, err := d.expandSpreads(selection.Selections, visited)
+			if err != nil {
+				return nil, err
+			}
+			selection.Selections = expanded
+			nested = []graphQLSelection{selection}
+		}
+		fields = append(fields, nested...)
+	}
+	return fields, nil
+}
+
+// expandSpreads returns a copy of selections in which each fragment spread,
+// at any depth, has the selection set of its fragment.
+func (d *graphQLDocument) expandSpreads(selections []graphQLSelection, visited map[string]bool) ([]graphQLSelection, error) {
+	if len(selections) == 0 {
+		return selections, nil
+	}
+	expanded := make([]graphQLSelection, len(selections))
+	for i, selection := range selections {
+		d.selections++
+		if d.selections > maxGraphQLSelections {
+			return nil, fmt.Errorf("document has more than %d selections", maxGraphQLSelections)
+		}
+
+		nested := selection.Selections
+		if selection.Spread {
+			if visited[selection.Name] {
+				return nil, fmt.Errorf("fragment %q spreads itself", selection.Name)
+			}
+			fragment, ok := d.fragments[selection.Name]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %q", selection.Name)
+			}
+			visited[selection.Name] = true
+			nested = fragment
+		}
+		var err error
+		selection.Selections, err = d.expandSpreads(nested, visited)
+		if err != nil {
+			return nil, err
+		}
+		if selection.Spread {
+			delete(visited, selection.Name)
+		}
+		expanded[i] = selection
+	}
+	return expanded, nil
+}
+
+// graphQLTokenKind is the kind of a lexical token.
+type graphQLTokenKind int
+
+const (
+	graphQLEOF graphQLTokenKind = iota
+	graphQLPunctuator
+	graphQLName
+	graphQLNumber
+	graphQLString
+)
+
+// graphQLToken is a lexical token of a GraphQL document.
+type graphQLToken struct {
+	kind  graphQLTokenKind
+	value string
+}
+
+// graphQLParser is a recursive descent parser for GraphQL executable
+// documents. It keeps what the gateway needs to inspect a request: operation
+// types, root fields and their arguments, and fragments.
+type graphQLParser struct {
+	src   string
+	pos   int
+	tok   graphQLToken
+	depth int
+}
+
+// parseGraphQL parses a GraphQL executable document.
+func parseGraphQL(src string) (*graphQLDocument, error) {
+	p := &graphQLParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	doc := &graphQLDocument{fragments: map[string][]graphQLSelection{}}
+	for p.tok.kind != graphQLEOF {
+		if p.is(graphQLName, "fragment") {
+			name, selections, err := p.parseFragmentDefinition()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[name]; ok {
+				return nil, fmt.Errorf("duplicate fragment %q", name)
+			}
+			doc.fragments[name] = selections
+			continue
+		}
+
+		op, err := p.parseOperationDefinition()
+		if err != nil {
+			return nil, err
+		}
+		doc.operations = append(doc.operations, op)
+	}
+
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document has no operations")
+	}
+	return doc, nil
+}
+
+// parseOperationDefinition parses a query shorthand or an operation with a
+// type, optional name, variable definitions, and directives.
+func (p *graphQLParser) parseOperationDefinition() (*graphQLOperation, error) {
+	op := &graphQLOperation{Type: "query"}
+	if !p.is(graphQLPunctuator, "{") {
+		if p.tok.kind != graphQLName {
+			return nil, p.unexpected()
+		}
+		switch p.tok.value {
+		case "query", "mutation", "subscription":
+			op.Type = p.tok.value
+		default:
+			return nil, fmt.Errorf("unsupported definition %q", p.tok.value)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == graphQLName {
+			op.Name = p.tok.value
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if p.is(graphQLPunctuator, "(") {
+			if err := p.skipVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.skipDirectives(); err != nil {
+			return nil, err
+		}
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.Selections = selections
+	return op, nil
+}
+
+// parseFragmentDefinition parses "fragment Name on Type @directives { ... }".
+func (p *graphQLParser) parseFragmentDefinition() (string, []graphQLSelection, error) {
+	if err := p.next(); err != nil {
+		return "", nil, err
+	}
+	if p.tok.kind != graphQLName || p.tok.value == "on" {
+		return "", nil, p.unexpected()
+	}
+	name := p.tok.value
+	if err := p.next(); err != nil {
+		return "", nil, err
+	}
+	if err := p.skipTypeCondition(); err != nil {
+		return "", nil, err
+	}
+	if err := p.skipDirectives(); err != nil {
+		return "", nil, err
+	}
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return "", nil, err
+	}
+	return name, selections, nil
+}
+
+// parseSelectionSet parses "{ selection... }".
+func (p *graphQLParser) parseSelectionSet() ([]graphQLSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	p.depth++
+	if p.depth > maxGraphQLDepth {
+		return nil, fmt.Errorf("document is nested too deeply")
+	}
+	defer func() { p.depth-- }()
+
+	var selections []graphQLSelection
+	for !p.is(graphQLPunctuator, "}") {
+		selection, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("empty selection set")
+	}
+	return selections, p.next()
+}
+
+// parseSelection parses a field, fragment spread, or inline fragment.
+func (p *graphQLParser) parseSelection() (graphQLSelection, error) {
+	if p.is(graphQLPunctuator, "...") {
+		if err := p.next(); err != nil {
+			return graphQLSelection{}, err
+		}
+		if p.tok.kind == graphQLName && p.tok.value != "on" {
+			selection := graphQLSelection{Name: p.tok.value, Spread: true}
+			if err := p.next(); err != nil {
+				return graphQLSelection{}, err
+			}
+			return selection, p.skipDirectives()
+		}
+		if p.is(graphQLName, "on") {
+			if err := p.skipTypeCondition(); err != nil {
+				return graphQLSelection{}, err
+			}
+		}
+		if err := p.skipDirectives(); err != nil {
+			return graphQLSelection{}, err
+		}
+		selections, err := p.parseSelectionSet()
+		if err != nil {
+			return graphQLSelection{}, err
+		}
+		return graphQLSelection{Inline: true, Selections: selections}, nil
+	}
+
+	if p.tok.kind != graphQLName {
+		return graphQLSelection{}, p.unexpected()
+	}
+	selection := graphQLSelection{Name: p.tok.value}
+	if err := p.next(); err != nil {
+		return graphQLSelection{}, err
+	}
+	if p.is(graphQLPunctuator, ":") {
+		// The name was an alias; the field name follows.
+		if err := p.next(); err != nil {
+			return graphQLSelection{}, err
+		}
+		if p.tok.kind != graphQLName {
+			return graphQLSelection{}, p.unexpected()
+		}
+		selection.Name = p.tok.value
+		if err := p.next(); err != nil {
+			return graphQLSelection{}, err
+		}
+	}
+
+	if p.is(graphQLPunctuator, "(") {
+		arguments, err := p.parseArguments()
+		if err != nil {
+			return graphQLSelection{}, err
+		}
+		selection.Arguments = arguments
+	}
+	if err := p.skipDirectives(); err != nil {
+		return graphQLSelection{}, err
+	}
+	if p.is(graphQLPunctuator, "{") {
+		selections, err := p.parseSelectionSet()
+		if err != nil {
+			return graphQLSelection{}, err
+		}
+		selection.Selections = selections
+	}
+	return selection, nil
+}
+
+// parseArguments parses "(name: value ...)".
+func (p *graphQLParser) parseArguments() (map[string]any, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arguments := map[string]any{}
+	for !p.is(graphQLPunctuator, ")") {
+		if p.tok.kind != graphQLName {
+			return nil, p.unexpected()
+		}
+		name := p.tok.value
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arguments[name] = value
+	}
+	return arguments, p.next()
+}
+
+// parseValue parses a variable, literal, list, or object value.
+func (p *graphQLParser) parseValue() (any, error) {
+	p.depth++
+	if p.depth > maxGraphQLDepth {
+		return nil, fmt.Errorf("document is nested too deeply")
+	}
+	defer func() { p.depth-- }()
+
+	tok := p.tok
+	switch {
+	case tok.kind == graphQLPunctuator && tok.value == "$":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != graphQLName {
+			return nil, p.unexpected()
+		}
+		name := p.tok.value
+		return graphQLVariable(name), p.next()
+	case tok.kind == graphQLPunctuator && tok.value == "[":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !p.is(graphQLPunctuator, "]") {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, p.next()
+	case tok.kind == graphQLPunctuator && tok.value == "{":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		object := map[string]any{}
+		for !p.is(graphQLPunctuator, "}") {
+			if p.tok.kind != graphQLName {
+				return nil, p.unexpected()
+			}
+			name := p.tok.value
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			object[name] = value
+		}
+		return object, p.next()
+	case tok.kind == graphQLString, tok.kind == graphQLNumber:
+		return tok.value, p.next()
+	case tok.kind == graphQLName:
+		var value any
+		switch tok.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = tok.value
+		}
+		return value, p.next()
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+// skipVariableDefinitions skips "($name: Type = default @directives ...)".
+func (p *graphQLParser) skipVariableDefinitions() error {
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for !p.is(graphQLPunctuator, ")") {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		if p.tok.kind != graphQLName {
+			return p.unexpected()
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if p.is(graphQLPunctuator, "=") {
+			if err := p.next(); err != nil {
+				return err
+			}
+			if _, err := p.parseValue(); err != nil {
+				return err
+			}
+		}
+		if err := p.skipDirectives(); err != nil {
+			return err
+		}
+	}
+	return p.next()
+}
+
+// skipType skips a type reference such as "[ID!]!".
+func (p *graphQLParser) skipType() error {
+	if p.is(graphQLPunctuator, "[") {
+		p.depth++
+		if p.depth > maxGraphQLDepth {
+			return fmt.Errorf("document is nested too deeply")
+		}
+		defer func() { p.depth-- }()
+
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else {
+		if p.tok.kind != graphQLName {
+			return p.unexpected()
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	if p.is(graphQLPunctuator, "!") {
+		return p.next()
+	}
+	return nil
+}
+
+// skipTypeCondition skips "on Type".
+func (p *graphQLParser) skipTypeCondition() error {
+	if !p.is(graphQLName, "on") {
+		return p.unexpected()
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	if p.tok.kind != graphQLName {
+		return p.unexpected()
+	}
+	return p.next()
+}
+
+// skipDirectives skips "@name(arguments)..." directives.
+func (p *graphQLParser) skipDirectives() error {
+	for p.is(graphQLPunctuator, "@") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if p.tok.kind != graphQLName {
+			return p.unexpected()
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+		if p.is(graphQLPunctuator, "(") {
+			if _, err := p.parseArguments(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// is reports whether the current token has the given kind and value.
+func (p *graphQLParser) is(kind graphQLTokenKind, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+// expect consumes the punctuator value or returns an error.
+func (p *graphQLParser) expect(value string) error {
+	if !p.is(graphQLPunctuator, value) {
+		return p.unexpected()
+	}
+	return p.next()
+}
+
+// unexpected returns an error for the current token.
+func (p *graphQLParser) unexpected() error {
+	if p.tok.kind == graphQLEOF {
+		return fmt.Errorf("unexpected end of document")
+	}
+	return fmt.Errorf("unexpected %q at offset %d", p.tok.value, p.pos)
+}
+
+// next reads the next token, skipping whitespace, commas, and comments.
+func (p *graphQLParser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "\ufeff"):
+			p.pos += len("\ufeff")
+		default:
+			return p.readToken()
+		}
+	}
+	p.tok = graphQLToken{kind: graphQLEOF}
+	return nil
+}
+
+// readToken reads the token starting at the current position.
+func (p *graphQLParser) readToken() error {
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = graphQLToken{kind: graphQLPunctuator, value: "..."}
+	case strings.IndexByte("!$&():=@[]{|}", c) >= 0:
+		p.pos++
+		p.tok = graphQLToken{kind: graphQLPunctuator, value: string(c)}
+	case isGraphQLNameStart(c):
+		for p.pos < len(p.src) && (isGraphQLNameStart(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = graphQLToken{kind: graphQLName, value: p.src[start:p.pos]}
+	case c == '-' || isDigit(c):
+		p.pos++
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || strings.IndexByte(".eE+-", p.src[p.pos]) >= 0) {
+			p.pos++
+		}
+		p.tok = graphQLToken{kind: graphQLNumber, value: p.src[start:p.pos]}
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		return p.readBlockString()
+	case c == '"':
+		return p.readString()
+	default:
+		return fmt.Errorf("unexpected character %q at offset %d", c, p.pos)
+	}
+	return nil
+}
+
+// readString reads a quoted string, decoding escape sequences.
+func (p *graphQLParser) readString() error {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+		case '\n', '\r':
+			return fmt.Errorf("unterminated string at offset %d", start)
+		case '"':
+			p.pos++
+			// GraphQL string escapes are a subset of JSON's.
+			var value string
+			if err := json.Unmarshal([]byte(p.src[start:p.pos]), &value); err != nil {
+				return fmt.Errorf("invalid string at offset %d: %w", start, err)
+			}
+			p.tok = graphQLToken{kind: graphQLString, value: value}
+			return nil
+		default:
+			p.pos++
+		}
+	}
+	return fmt.Errorf("unterminated string at offset %d", start)
+}
+
+// readBlockString reads a """block string""". Indentation is kept as is,
+// since the gateway only compares string values that are single-line.
+func (p *graphQLParser) readBlockString() error {
+	start := p.pos
+	p.pos += 3
+	var value strings.Builder
+	for p.pos < len(p.src) {
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], `\"""`):
+			value.WriteString(`"""`)
+			p.pos += 4
+		case strings.HasPrefix(p.src[p.pos:], `"""`):
+			p.pos += 3
+			p.tok = graphQLToken{kind: graphQLString, value: value.String()}
+			return nil
+		default:
+			value.WriteByte(p.src[p.pos])
+			p.pos++
+		}
+	}
+	return fmt.Errorf("unterminated block string at offset %d", start)
+}
+
+func isGraphQLNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,621 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGraphQLUpstream returns a fake GitHub GraphQL API. Node queries are
+// answered from nodes; other requests are recorded in forwarded.
+func newGraphQLUpstream(t *testing.T, nodes map[string]graphQLNode, forwarded *[]graphQLRequest) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graphql", r.URL.Path)
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+
+		var req graphQLRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		w.Header().Set("Content-Type", "application/json")
+		if req.Query != graphQLNodeQuery {
+			*forwarded = append(*forwarded, req)
+			w.Write([]byte(`{"data":{}}`))
+			return
+		}
+
+		id, _ := req.Variables["id"].(string)
+		node, ok := nodes[id]
+		if !ok {
+			w.Write([]byte(`{"data":{"node":null},"errors":[{"message":"Could not resolve to a node"}]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"node": node}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAPIServer_GraphQL(t *testing.T) {
+	repoNode := func(nameWithOwner string) graphQLNode {
+		return graphQLNode{TypeName: "Repository", NameWithOwner: nameWithOwner}
+	}
+	prNode := func(nameWithOwner, base string) graphQLNode {
+		node := graphQLNode{TypeName: "PullRequest", BaseRefName: base}
+		node.Repository = &struct {
+			NameWithOwner string `json:"nameWithOwner"`
+		}{NameWithOwner: nameWithOwner}
+		return node
+	}
+	nodes := map[string]graphQLNode{
+		"R_project":    repoNode("my-owner/my-repo"),
+		"R_other":      repoNode("other-owner/other-repo"),
+		"PR_feature":   prNode("my-owner/my-repo", "feature"),
+		"PR_main":      prNode("my-owner/my-repo", "main"),
+		"PR_release":   prNode("my-owner/my-repo", "release/1.0"),
+		"PR_other":     prNode("other-owner/other-repo", "feature"),
+		"I_project":    {TypeName: "Issue", Repository: prNode("my-owner/my-repo", "").Repository},
+		"I_no_repo_id": {TypeName: "User"},
+	}
+
+	tests := []struct {
+		name          string
+		policy        *Policy
+		approval      string // decision of the host user, or "" for no approval queue
+		method        string
+		body          string
+		wantStatus    int
+		wantError     string
+		wantForwarded bool
+	}{
+		{
+			name:          "query is forwarded",
+			body:          `{"query":"query { viewer { login } }"}`,
+			wantStatus:    http.StatusOK,
+			wantForwarded: true,
+		},
+		{
+			name:          "query for a readable repository",
+			body:          `{"query":"query PullRequestForBranch($owner: String!, $repo: String!) { repository(owner: $owner, name: $repo) { pullRequests(first: 1) { nodes { number } } } }","variables":{"owner":"golang","repo":"go"}}`,
+			wantStatus:    http.StatusOK,
+			wantForwarded: true,
+		},
+		{
+			name: "query for a repository denied by the read policy",
+			policy: &Policy{
+				Repos: RepoPolicy{Read: AccessList{Deny: []string{"golang/*"}}},
+			},
+			body:       `{"query":"{ repository(owner: \"golang\", name: \"go\") { id } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: access denied for this repository",
+		},
+		{
+			name:          "create pull request in the project repository",
+			body:          `{"query":"mutation PullRequestCreate($input: CreatePullRequestInput!) { createPullRequest(input: $input) { pullRequest { url } } }","variables":{"input":{"repositoryId":"R_project","baseRefName":"main","headRefName":"feature","title":"t"}}}`,
+			wantStatus:    http.StatusOK,
+			wantForwarded: true,
+		},
+		{
+			name:       "create pull request in another repository",
+			body:       `{"query":"mutation { createPullRequest(input: {repositoryId: \"R_other\", baseRefName: \"main\", headRefName: \"feature\", title: \"t\"}) { pullRequest { url } } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: access denied for this repository",
+		},
+		{
+			name:          "comment on an issue in the project repository",
+			body:          `{"query":"mutation CommentCreate($input: AddCommentInput!) { addComment(input: $input) { commentEdge { node { url } } } }","variables":{"input":{"subjectId":"I_project","body":"hi"}}}`,
+			wantStatus:    http.StatusOK,
+			wantForwarded: true,
+		},
+		{
+			name:          "merge pull request into an unprotected branch",
+			body:          `{"query":"mutation PullRequestMerge($input: MergePullRequestInput!) { mergePullRequest(input: $input) { clientMutationId } }","variables":{"input":{"pullRequestId":"PR_feature","mergeMethod":"SQUASH"}}}`,
+			wantStatus:    http.StatusOK,
+			wantForwarded: true,
+		},
+		{
+			name:       "merge pull request into a default protected branch",
+			body:       `{"query":"mutation PullRequestMerge($input: MergePullRequestInput!) { mergePullRequest(input: $input) { clientMutationId } }","variables":{"input":{"pullRequestId":"PR_main","mergeMethod":"SQUASH"}}}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: mutation mergePullRequest into protected branch main is denied by policy",
+		},
+		{
+			name:       "enable auto-merge into a protected branch from the policy",
+			policy:     &Policy{Refs: RefPolicy{Protected: []string{"release/*"}}},
+			body:       `{"query":"mutation { enablePullRequestAutoMerge(input: {pullRequestId: \"PR_release\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: mutation enablePullRequestAutoMerge into protected branch release/1.0 is denied by policy",
+		},
+		{
+			name:       "merge pull request in another repository",
+			body:       `{"query":"mutation { mergePullRequest(input: {pullRequestId: \"PR_other\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: access denied for this repository",
+		},
+		{
+			name:       "mutation hidden behind an alias and a fragment",
+			body:       `{"query":"mutation { ...M } fragment M on Mutation { ok: mergePullRequest(input: {pullRequestId: \"PR_main\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: mutation mergePullRequest into protected branch main is denied by policy",
+		},
+		{
+			name:       "second root field of a mutation is checked",
+			body:       `{"query":"mutation { a: addComment(input: {subjectId: \"I_project\", body: \"x\"}) { clientMutationId } b: createIssue(input: {repositoryId: \"R_other\", title: \"x\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: access denied for this repository",
+		},
+		{
+			name:       "operation denied by policy applies to its mutation",
+			policy:     &Policy{Operations: map[string]string{"create-issue": OperationDeny}},
+			body:       `{"query":"mutation { createIssue(input: {repositoryId: \"R_project\", title: \"x\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: operation create-issue is denied by policy",
+		},
+		{
+			name:       "denied create-pr-review applies to addPullRequestReview",
+			policy:     &Policy{Operations: map[string]string{"create-pr-review": OperationDeny}},
+			body:       `{"query":"mutation { addPullRequestReview(input: {pullRequestId: \"PR_feature\", event: APPROVE}) { clientMutationId } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: operation create-pr-review is denied by policy",
+		},
+		{
+			name:          "denied create-pr-comment does not apply to addPullRequestReview",
+			policy:        &Policy{Operations: map[string]string{"create-pr-comment": OperationDeny}},
+			body:          `{"query":"mutation { addPullRequestReview(input: {pullRequestId: \"PR_feature\", event: COMMENT, body: \"x\"}) { clientMutationId } }"}`,
+			wantStatus:    http.StatusOK,
+			wantForwarded: true,
+		},
+		{
+			name:       "operation needing approval applies to its mutation",
+			policy:     &Policy{Operations: map[string]string{"merge-pr": OperationNeedsApproval}},
+			body:       `{"query":"mutation { mergePullRequest(input: {pullRequestId: \"PR_feature\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: operation merge-pr requires approval",
+		},
+		{
+			name:          "operation needing approval is forwarded when approved",
+			policy:        &Policy{Operations: map[string]string{"merge-pr": OperationNeedsApproval}},
+			approval:      ApprovalApprove,
+			body:          `{"query":"mutation { mergePullRequest(input: {pullRequestId: \"PR_feature\"}) { clientMutationId } }"}`,
+			wantStatus:    http.StatusOK,
+			wantForwarded: true,
+		},
+		{
+			name:       "merge into a branch needing approval denied by the host user",
+			policy:     &Policy{Refs: RefPolicy{Protected: []string{"release/*"}, NeedsApproval: []string{"release/*"}}},
+			approval:   ApprovalDeny,
+			body:       `{"query":"mutation { mergePullRequest(input: {pullRequestId: \"PR_release\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: mutation mergePullRequest into branch release/1.0 requires approval: denied by the host user",
+		},
+		{
+			name:          "mutation in a repository needing write approval",
+			policy:        &Policy{Repos: RepoPolicy{Write: AccessList{NeedsApproval: []string{"other-owner/*"}}}},
+			approval:      ApprovalApprove,
+			body:          `{"query":"mutation { createIssue(input: {repositoryId: \"R_other\", title: \"x\"}) { clientMutationId } }"}`,
+			wantStatus:    http.StatusOK,
+			wantForwarded: true,
+		},
+		{
+			name:       "unsupported mutation",
+			body:       `{"query":"mutation { deleteRef(input: {refId: \"REF_1\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: mutation deleteRef not supported by the gateway",
+		},
+		{
+			name:       "mutation without a target",
+			body:       `{"query":"mutation($input: MergePullRequestInput!) { mergePullRequest(input: $input) { clientMutationId } }","variables":{}}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: mutation mergePullRequest has no pullRequestId",
+		},
+		{
+			name:       "mutation target that does not resolve",
+			body:       `{"query":"mutation { mergePullRequest(input: {pullRequestId: \"PR_missing\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusBadGateway,
+			wantError:  "failed to resolve target of mutation mergePullRequest: node query failed: Could not resolve to a node",
+		},
+		{
+			name:       "mutation target outside any repository",
+			body:       `{"query":"mutation { addComment(input: {subjectId: \"I_no_repo_id\", body: \"x\"}) { clientMutationId } }"}`,
+			wantStatus: http.StatusBadGateway,
+			wantError:  "node I_no_repo_id does not belong to a repository",
+		},
+		{
+			name:          "operation selected by name",
+			body:          `{"query":"query Q { viewer { login } } mutation M { deleteRef(input: {refId: \"REF_1\"}) { clientMutationId } }","operationName":"Q"}`,
+			wantStatus:    http.StatusOK,
+			wantForwarded: true,
+		},
+		{
+			name:       "subscription",
+			body:       `{"query":"subscription { issueUpdated { id } }"}`,
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: subscription operations are not supported by the gateway",
+		},
+		{
+			name:       "invalid document",
+			body:       `{"query":"mutation { mergePullRequest("}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid GraphQL document: unexpected end of document",
+		},
+		{
+			name:       "invalid JSON",
+			body:       `not json`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "failed to parse GraphQL request",
+		},
+		{
+			name:       "GET is not allowed",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantError:  "method not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forwarded []graphQLRequest
+			upstream := newGraphQLUpstream(t, nodes, &forwarded)
+
+			config := ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo", Policy: tt.policy}
+			server := NewTestAPIServer(config, NewGitHubAuthFromToken("test-token"), upstream.URL)
+			if tt.approval != "" {
+				server.approvals = newTestApprovalQueue(t, tt.approval, 5*time.Second)
+			}
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/api/graphql", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantError != "" {
+				var resp graphQLErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				require.Len(t, resp.Errors, 1)
+				assert.Contains(t, resp.Errors[0].Message, tt.wantError)
+			}
+
+			if !tt.wantForwarded {
+				assert.Empty(t, forwarded)
+				return
+			}
+			require.Len(t, forwarded, 1)
+			var sent graphQLRequest
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &sent))
+			assert.Equal(t, sent, forwarded[0])
+		})
+	}
+}
+
+func TestAPIServer_GraphQL_ReadScope(t *testing.T) {
+	upstream := newReadScopeUpstream(t)
+	server := NewTestAPIServer(readScopeConfig, NewGitHubAuthFromToken("test-token"), upstream.URL)
+
+	tests := []struct {
+		name       string
+		repo       string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "public repository", repo: "other-owner/public-tools", wantStatus: http.StatusOK},
+		{name: "private repository", repo: "my-owner/private-tools", wantStatus: http.StatusForbidden, wantError: "forbidden: access denied for this repository"},
+		{
+			name:       "repository the token cannot see",
+			repo:       "other-owner/missing-repo",
+			wantStatus: http.StatusForbidden,
+			wantError:  "forbidden: failed to check repository visibility",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner, name, _ := strings.Cut(tt.repo, "/")
+			body := fmt.Sprintf(`{"query":"query { repository(owner: \"%s\", name: \"%s\") { issues(first: 1) { totalCount } } }"}`, owner, name)
+			req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(body))
+			w := httptest.NewRecorder()
+
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantError != "" {
+				var resp graphQLErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				require.Len(t, resp.Errors, 1)
+				assert.Contains(t, resp.Errors[0].Message, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestAPIServer_GraphQL_ReadScopeRootFields(t *testing.T) {
+	upstream := newReadScopeUpstream(t)
+	server := NewTestAPIServer(readScopeConfig, NewGitHubAuthFromToken("test-token"), upstream.URL)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantError string
+	}{
+		{name: "viewer login", query: `query { viewer { login name } }`},
+		{name: "rate limit", query: `query { rateLimit { remaining } }`},
+		{name: "typename", query: `query { __typename }`},
+		{name: "node", query: `query { node(id: \"R_private\") { ... on Repository { nameWithOwner } } }`, wantError: "query field node"},
+		{name: "nodes", query: `query { nodes(ids: [\"R_private\"]) { id } }`, wantError: "query field nodes"},
+		{name: "search", query: `query { search(query: \"private-tools\", type: REPOSITORY, first: 10) { nodes { ... on Repository { nameWithOwner } } } }`, wantError: "query field search"},
+		{name: "organization", query: `query { organization(login: \"my-owner\") { repository(name: \"private-tools\") { id } } }`, wantError: "query field organization"},
+		{name: "user", query: `query { user(login: \"my-owner\") { repository(name: \"private-tools\") { id } } }`, wantError: "query field user"},
+		{name: "repository owner", query: `query { repositoryOwner(login: \"my-owner\") { repository(name: \"private-tools\") { id } } }`, wantError: "query field repositoryOwner"},
+		{name: "viewer repositories", query: `query { viewer { login repositories(first: 10) { nodes { nameWithOwner } } } }`, wantError: "query field viewer"},
+		{name: "viewer fragment", query: `query { viewer { ... on User { login } } }`, wantError: "query field viewer"},
+		{name: "resource", query: `query { resource(url: \"https://github.com/my-owner/private-tools\") { url } }`, wantError: "query field resource"},
+		{name: "aliased root field", query: `query { login: viewer { login } repo: node(id: \"R_private\") { id } }`, wantError: "query field node"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"query":"%s"}`, tt.query)
+			req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(body))
+			w := httptest.NewRecorder()
+
+			server.ServeHTTP(w, req)
+
+			if tt.wantError == "" {
+				assert.Equal(t, http.StatusOK, w.Code)
+				return
+			}
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			var resp graphQLErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Len(t, resp.Errors, 1)
+			assert.Contains(t, resp.Errors[0].Message, tt.wantError)
+			assert.Contains(t, resp.Errors[0].Message, "repository reads are restricted")
+		})
+	}
+}
+
+func TestAPIServer_GraphQL_ReadScopeNestedFields(t *testing.T) {
+	upstream := newReadScopeUpstream(t)
+	server := NewTestAPIServer(readScopeConfig, NewGitHubAuthFromToken("test-token"), upstream.URL)
+
+	tests := []struct {
+		name      string
+		fields    string
+		fragments string
+		wantField string
+	}{
+		{name: "repository content", fields: `object(expression: \"HEAD:\") { id } issues(first: 1) { nodes { title body author { login } } }`},
+		{name: "pull request identities", fields: `pullRequest(number: 1) { headRepository { nameWithOwner } headRepositoryOwner { ... on User { login } } assignees(first: 10) { nodes { login } totalCount } }`},
+		{
+			name:      "owner repositories",
+			fields:    `owner { ... on Organization { repositories(first: 10) { nodes { name object(expression: \"HEAD:\") { id } } } } }`,
+			wantField: "repositories",
+		},
+		{name: "owner repository by name", fields: `owner { repository(name: \"private-tools\") { id } }`, wantField: "repository"},
+		{name: "parent contents", fields: `parent { object(expression: \"HEAD:\") { id } }`, wantField: "object"},
+		{name: "template repository", fields: `templateRepository { issues(first: 1) { nodes { body } } }`, wantField: "issues"},
+		{name: "forks", fields: `forks(first: 10) { nodes { nameWithOwner } }`, wantField: "forks"},
+		{name: "author repositories", fields: `issues(first: 1) { nodes { author { ... on User { repositories(first: 1) { nodes { name } } } } } }`, wantField: "repositories"},
+		{name: "organization", fields: `owner { ... on Organization { login } } pullRequest(number: 1) { author { ... on User { organization(login: \"my-owner\") { teams(first: 1) { totalCount } } } } }`, wantField: "teams"},
+		{name: "user", fields: `issues(first: 1) { nodes { author { ... on User { login } } } } owner { user { repositoriesContributedTo(first: 1) { totalCount } } }`, wantField: "repositoriesContributedTo"},
+		{name: "search connection", fields: `owner { ... on User { starredRepositories(first: 1) { nodes { name } } } }`, wantField: "starredRepositories"},
+		{name: "cross-referenced issue", fields: `issue(number: 1) { timelineItems(first: 10) { nodes { ... on CrossReferencedEvent { source { ... on Issue { body } } } } } }`, wantField: "body"},
+		{name: "fragment spread", fields: `owner { ...Repos }`, fragments: `fragment Repos on RepositoryOwner { repositories(first: 1) { nodes { name } } }`, wantField: "repositories"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"query":"query { repository(owner: \"my-owner\", name: \"my-repo\") { %s } } %s"}`, tt.fields, tt.fragments)
+			req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(body))
+			w := httptest.NewRecorder()
+
+			server.ServeHTTP(w, req)
+
+			if tt.wantField == "" {
+				assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+				return
+			}
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			var resp graphQLErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Len(t, resp.Errors, 1)
+			assert.Contains(t, resp.Errors[0].Message, "field "+tt.wantField+" can reach other repositories")
+		})
+	}
+}
+
+func TestAPIServer_GraphQL_RequestTooLarge(t *testing.T) {
+	server := NewTestAPIServer(ProxyConfig{}, NewGitHubAuthFromToken("test-token"), "http://127.0.0.1:0")
+
+	body := `{"query":"` + strings.Repeat("a", maxGraphQLRequestSize) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	server.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	data, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "request body too large")
+}
+
+func TestSelectGraphQLOperation(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		wantType      string
+		wantFields    []string
+		wantErr       string
+	}{
+		{
+			name:       "query shorthand",
+			query:      `{ viewer { login } }`,
+			wantType:   "query",
+			wantFields: []string{"viewer"},
+		},
+		{
+			name: "named mutation with variables, directives, and comments",
+			query: `# merge it
+mutation Merge($id: ID!, $method: PullRequestMergeMethod = SQUASH, $labels: [ID!]!) @deprecated {
+  merged: mergePullRequest(input: {pullRequestId: $id, mergeMethod: $method}) @include(if: true) {
+    pullRequest { number }
+  }
+}`,
+			wantType:   "mutation",
+			wantFields: []string{"mergePullRequest"},
+		},
+		{
+			name:       "fragments and inline fragments are expanded",
+			query:      `mutation { ... on Mutation { a: addComment(input: {}) { clientMutationId } } ...F } fragment F on Mutation { ...G } fragment G on Mutation { createIssue(input: {}) { clientMutationId } }`,
+			wantType:   "mutation",
+			wantFields: []string{"addComment", "createIssue"},
+		},
+		{
+			name:          "operation selected by name",
+			query:         `query A { viewer { login } } mutation B { createIssue(input: {}) { clientMutationId } }`,
+			operationName: "B",
+			wantType:      "mutation",
+			wantFields:    []string{"createIssue"},
+		},
+		{
+			name:       "strings with escapes and block strings",
+			query:      `mutation { addComment(input: {body: """a \""" b""", subjectId: "I_\"1\"A"}) { clientMutationId } }`,
+			wantType:   "mutation",
+			wantFields: []string{"addComment"},
+		},
+		{
+			name:    "multiple operations without a name",
+			query:   `query A { viewer { login } } query B { viewer { login } }`,
+			wantErr: "operationName is required for a document with 2 operations",
+		},
+		{
+			name:          "unknown operation name",
+			query:         `query A { viewer { login } }`,
+			operationName: "B",
+			wantErr:       `operation "B" not found`,
+		},
+		{
+			name:    "unknown fragment",
+			query:   `mutation { ...F }`,
+			wantErr: `unknown fragment "F"`,
+		},
+		{
+			name:    "fragment cycle",
+			query:   `mutation { ...F } fragment F on Mutation { ...G } fragment G on Mutation { ...F }`,
+			wantErr: `fragment "F" spreads itself`,
+		},
+		{
+			name:    "duplicate fragment",
+			query:   `{ ...F } fragment F on Query { a } fragment F on Query { b }`,
+			wantErr: `duplicate fragment "F"`,
+		},
+		{
+			name:    "only fragments",
+			query:   `fragment F on Query { a }`,
+			wantErr: "document has no operations",
+		},
+		{
+			name:    "empty document",
+			query:   ``,
+			wantErr: "document has no operations",
+		},
+		{
+			name:    "type system definition",
+			query:   `type Query { a: String }`,
+			wantErr: `unsupported definition "type"`,
+		},
+		{
+			name:    "empty selection set",
+			query:   `{ }`,
+			wantErr: "empty selection set",
+		},
+		{
+			name:    "unterminated string",
+			query:   `{ a(b: "c) }`,
+			wantErr: "unterminated string",
+		},
+		{
+			name:    "unexpected character",
+			query:   `{ a; }`,
+			wantErr: `unexpected character ';'`,
+		},
+		{
+			name:    "nested too deeply",
+			query:   strings.Repeat("{ a ", maxGraphQLDepth+1) + strings.Repeat("}", maxGraphQLDepth+1),
+			wantErr: "document is nested too deeply",
+		},
+		{
+			name:    "fragments expand to too many selections",
+			query:   `{ a { ...F0 } } ` + graphQLFragmentChain(20),
+			wantErr: "document has more than",
+		},
+		{
+			name:    "values nested too deeply",
+			query:   "{ a(b: " + strings.Repeat("[", maxGraphQLDepth+1) + strings.Repeat("]", maxGraphQLDepth+1) + ") }",
+			wantErr: "document is nested too deeply",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotType, fields, err := selectGraphQLOperation(tt.query, tt.operationName)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantType, gotType)
+			var names []string
+			for _, field := range fields {
+				names = append(names, field.Name)
+			}
+			assert.Equal(t, tt.wantFields, names)
+		})
+	}
+}
+
+func TestParseGraphQL_Arguments(t *testing.T) {
+	_, fields, err := selectGraphQLOperation(
+		`mutation($id: ID!) { addComment(input: {subjectId: $id, body: "a\nb", count: -1.5e3, draft: false, labels: [A, null], nested: {ok: true}}) { clientMutationId } }`,
+		"",
+	)
+	require.NoError(t, err)
+	require.Len(t, fields, 1)
+
+	input := resolveGraphQLValue(fields[0].Arguments["input"], map[string]any{"id": "I_1"})
+	assert.Equal(t, map[string]any{
+		"subjectId": "I_1",
+		"body":      "a\nb",
+		"count":     "-1.5e3",
+		"draft":     false,
+		"labels":    []any{"A", nil},
+		"nested":    map[string]any{"ok": true},
+	}, input)
+}
+
+// graphQLFragmentChain returns fragments F0 to Fn-1, each spreading the next
+// twice, so F0 expands to 2^n selections.
+func graphQLFragmentChain(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "fragment F%d on T { a: b { ...F%d } c: b { ...F%d } } ", i, i+1, i+1)
+	}
+	fmt.Fprintf(&b, "fragment F%d on T { d }", n)
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// hopByHopHeaders apply to a single connection, so a proxy does not forward
+// them (RFC 9110, section 7.6.1). Proxy-Connection is their non-standard
+// predecessor.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// sensitiveRequestHeaders carry credentials the client sent, or claims
+// about the client, which the gateway does not pass on to the forge: the
+// gateway authenticates with its own credentials, and forges such as GitLab
+// accept tokens in headers other than Authorization.
+var sensitiveRequestHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Private-Token",
+	"Job-Token",
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+}
+
+// sensitiveResponseHeaders describe the gateway's credentials, or set
+// state tied to them, which the gateway does not pass on to the client.
+var sensitiveResponseHeaders = []string{
+	"Set-Cookie",
+	"X-Oauth-Scopes",
+	"X-Oauth-Client-Id",
+	"Github-Authentication-Token-Expiration",
+}
+
+// copyRequestHeader copies the headers of a client request to an upstream
+// request, except hop-by-hop and sensitive ones.
+func copyRequestHeader(dst, src http.Header) {
+	copyHeader(dst, src, sensitiveRequestHeaders)
+}
+
+// copyResponseHeader copies the headers of an upstream response to the
+// client's response, except hop-by-hop and sensitive ones.
+func copyResponseHeader(dst, src http.Header) {
+	copyHeader(dst, src, sensitiveResponseHeaders)
+}
+
+// copyHeader copies src to dst, except the hop-by-hop headers, the headers
+// src's Connection header lists, and the sensitive headers.
+func copyHeader(dst, src http.Header, sensitive []string) {
+	skip := make(map[string]bool, len(hopByHopHeaders)+len(sensitive))
+	for _, name := range hopByHopHeaders {
+		skip[name] = true
+	}
+	for _, name := range sensitive {
+		skip[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, value := range src.Values("Connection") {
+		for name := range strings.SplitSeq(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				skip[http.CanonicalHeaderKey(name)] = true
+			}
+		}
+	}
+
+	for key, values := range src {
+		if skip[key] {
+			continue
+		}
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyRequestHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   http.Header
+	}{
+		{
+			name: "copies other headers",
+			header: http.Header{
+				"Accept":       {"application/json"},
+				"Git-Protocol": {"version=2"},
+				"X-Multi":      {"a", "b"},
+			},
+			want: http.Header{
+				"Accept":       {"application/json"},
+				"Git-Protocol": {"version=2"},
+				"X-Multi":      {"a", "b"},
+			},
+		},
+		{
+			name: "strips credentials",
+			header: http.Header{
+				"Authorization":       {"Bearer client-token"},
+				"Proxy-Authorization": {"Basic abc"},
+				"Cookie":              {"session=abc"},
+				"Private-Token":       {"glpat-abc"},
+				"Job-Token":           {"abc"},
+				"Accept":              {"*/*"},
+			},
+			want: http.Header{"Accept": {"*/*"}},
+		},
+		{
+			name: "strips hop-by-hop headers",
+			header: http.Header{
+				"Connection":        {"keep-alive, X-Hop"},
+				"Keep-Alive":        {"timeout=5"},
+				"Te":                {"trailers"},
+				"Transfer-Encoding": {"chunked"},
+				"Upgrade":           {"websocket"},
+				"X-Hop":             {"value"},
+				"Accept":            {"*/*"},
+			},
+			want: http.Header{"Accept": {"*/*"}},
+		},
+		{
+			name: "strips forwarding headers",
+			header: http.Header{
+				"Forwarded":       {"for=10.0.0.1"},
+				"X-Forwarded-For": {"10.0.0.1"},
+				"X-Real-Ip":       {"10.0.0.1"},
+				"Accept":          {"*/*"},
+			},
+			want: http.Header{"Accept": {"*/*"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(http.Header)
+			copyRequestHeader(got, tt.header)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCopyResponseHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   http.Header
+	}{
+		{
+			name: "copies other headers",
+			header: http.Header{
+				"Content-Type":          {"application/json"},
+				"Link":                  {`<https://api.github.com/repos?page=2>; rel="next"`},
+				"X-Ratelimit-Remaining": {"4999"},
+			},
+			want: http.Header{
+				"Content-Type":          {"application/json"},
+				"Link":                  {`<https://api.github.com/repos?page=2>; rel="next"`},
+				"X-Ratelimit-Remaining": {"4999"},
+			},
+		},
+		{
+			name: "strips headers about the credentials",
+			header: http.Header{
+				"Set-Cookie":                             {"_gh_sess=abc"},
+				"X-Oauth-Scopes":                         {"repo, workflow"},
+				"X-Oauth-Client-Id":                      {"abc"},
+				"Github-Authentication-Token-Expiration": {"2026-01-01 00:00:00 UTC"},
+				"Content-Type":                           {"application/json"},
+			},
+			want: http.Header{"Content-Type": {"application/json"}},
+		},
+		{
+			name: "strips hop-by-hop headers",
+			header: http.Header{
+				"Connection":         {"close"},
+				"Proxy-Authenticate": {"Basic"},
+				"Trailer":            {"X-Checksum"},
+				"Content-Type":       {"application/json"},
+			},
+			want: http.Header{"Content-Type": {"application/json"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(http.Header)
+			copyResponseHeader(got, tt.header)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readinessTTL is how long a successful readiness check is reused, so that
+// frequent probes do not spend the token's rate limit.
+const readinessTTL = 10 * time.Second
+
+// readinessTimeout bounds a readiness check.
+const readinessTimeout = 5 * time.Second
+
+// readiness checks that the gateway can serve requests: the project host's
+// forge is reachable and accepts the token.
+type readiness struct {
+	forge  forge
+	client *http.Client
+	token  func() string
+	now    func() time.Time
+
+	mu    sync.Mutex
+	ready time.Time // when the last successful check was made
+}
+
+func newReadiness(f forge, client *http.Client, token func() string) *readiness {
+	return &readiness{
+		forge:  f,
+		client: client,
+		token:  token,
+		now:    time.Now,
+	}
+}
+
+// check returns why the gateway is not ready, or nil if it is.
+func (c *readiness) check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.ready.IsZero() && c.now().Sub(c.ready) < readinessTTL {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	if token := c.token(); token != "" {
+		if err := c.forge.checkToken(ctx, c.client, token); err != nil {
+			return fmt.Errorf("token check failed: %w", err)
+		}
+	} else if err := c.reachable(ctx); err != nil {
+		return err
+	}
+	c.ready = c.now()
+	return nil
+}
+
+// reachable checks that the forge API answers at all, for gateways without
+// a token, which only serve public repositories.
+func (c *readiness) reachable(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.forge.apiURL(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to contact the API: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// withHealth serves the health endpoints in front of next: /healthz answers
+// while the gateway runs, /readyz once it can reach the forge with its
+// token, and /metrics serves the request metrics. Only /healthz and /readyz
+// are served without the client token.
+func (s *Server) withHealth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			fmt.Fprintln(w, "ok")
+		case "/readyz":
+			if err := s.readiness.check(r.Context()); err != nil {
+				http.Error(w, redact("not ready: "+err.Error(), s.readiness.token()), http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, "ok")
+		case "/metrics":
+			s.requireToken(s.metrics).ServeHTTP(w, r)
+		default:
+			s.requireToken(next).ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Health(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token valid-token" {
+			http.Error(w, `{"message":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"login":"bot"}`))
+	}))
+	defer upstream.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		token      string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "healthz", url: unreachable.URL, token: "valid-token", path: "/healthz", wantStatus: http.StatusOK, wantBody: "ok\n"},
+		{name: "ready with a valid token", url: upstream.URL, token: "valid-token", path: "/readyz", wantStatus: http.StatusOK, wantBody: "ok\n"},
+		{name: "not ready with a rejected token", url: upstream.URL, token: "revoked-token", path: "/readyz", wantStatus: http.StatusServiceUnavailable, wantBody: "not ready: token check failed: user returned 401 Unauthorized\n"},
+		{name: "ready without a token when the forge is reachable", url: upstream.URL, path: "/readyz", wantStatus: http.StatusOK, wantBody: "ok\n"},
+		{name: "not ready when the forge is unreachable", url: unreachable.URL, token: "valid-token", path: "/readyz", wantStatus: http.StatusServiceUnavailable, wantBody: "not ready: token check failed: user failed to contact the API"},
+		{name: "metrics", url: unreachable.URL, path: "/metrics", wantStatus: http.StatusOK, wantBody: "# HELP claude_forge_gateway_requests_total"},
+		{name: "other paths are passed on", url: unreachable.URL, path: "/api/schema", wantStatus: http.StatusTeapot, wantBody: "next\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServerWithAuth(ProxyConfig{
+				Host:         "gitea.example.com",
+				Forges:       map[string]ForgeConfig{"gitea.example.com": {Kind: ForgeGitea, URL: tt.url}},
+				AllowedOwner: "my-owner",
+				AllowedRepo:  "my-repo",
+			}, NewGitHubAuthFromToken(tt.token))
+			handler := server.withHealth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "next", http.StatusTeapot)
+			}))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestReadiness_Check(t *testing.T) {
+	var requests atomic.Int32
+	var fail atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"resources":{}}`))
+	}))
+	defer upstream.Close()
+
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	readiness := newReadiness(&githubForge{api: upstream.URL}, http.DefaultClient, func() string { return "test-token" })
+	readiness.now = func() time.Time { return clock }
+
+	require.NoError(t, readiness.check(context.Background()))
+	// A successful check is reused for a while.
+	fail.Store(true)
+	clock = clock.Add(readinessTTL - time.Second)
+	require.NoError(t, readiness.check(context.Background()))
+	assert.Equal(t, int32(1), requests.Load())
+
+	clock = clock.Add(time.Second)
+	err := readiness.check(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, "token check failed: rate limit returned 503 Service Unavailable", err.Error())
+	// A failed check is not reused.
+	fail.Store(false)
+	require.NoError(t, readiness.check(context.Background()))
+	assert.Equal(t, int32(3), requests.Load())
+}
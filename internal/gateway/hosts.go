@@ -0,0 +1,47 @@
+package gateway
+
+import "strings"
+
+// DefaultHost is the forge host used when ProxyConfig.Host is empty.
+const DefaultHost = "github.com"
+
+// host returns the forge host of the project repository.
+func (c ProxyConfig) host() string {
+	if c.Host == "" {
+		return DefaultHost
+	}
+	return c.Host
+}
+
+// isProjectHost reports whether host is the project's forge host.
+func (c ProxyConfig) isProjectHost(host string) bool {
+	return strings.EqualFold(host, c.host())
+}
+
+// hasHost reports whether the gateway proxies git requests to host.
+func (c ProxyConfig) hasHost(host string) bool {
+	if c.isProjectHost(host) {
+		return true
+	}
+	for _, h := range c.ExtraHosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// hosts returns the project host followed by ExtraHosts.
+func (c ProxyConfig) hosts() []string {
+	return append([]string{c.host()}, c.ExtraHosts...)
+}
+
+// forgeConfig returns the forge configuration of host.
+func (c ProxyConfig) forgeConfig(host string) ForgeConfig {
+	for h, config := range c.Forges {
+		if strings.EqualFold(h, host) {
+			return config
+		}
+	}
+	return ForgeConfig{}
+}
@@ -0,0 +1,16 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyConfig_HasHost(t *testing.T) {
+	config := ProxyConfig{Host: "github.example.corp", ExtraHosts: []string{"github.com"}}
+
+	assert.True(t, config.hasHost("github.example.corp"))
+	assert.True(t, config.hasHost("GitHub.com"))
+	assert.False(t, config.hasHost("gitlab.com"))
+	assert.True(t, ProxyConfig{}.hasHost("github.com"))
+}
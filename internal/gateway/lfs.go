@@ -0,0 +1,379 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LFS operations, relative to the repository, of the Git LFS batch and
+// locks APIs. Transfers are the gateway's own: the batch responses' object
+// actions point at them, so that object downloads and uploads go through the
+// gateway too.
+const (
+	lfsPrefix         = "info/lfs/"
+	lfsBatch          = lfsPrefix + "objects/batch"
+	lfsLocks          = lfsPrefix + "locks"
+	lfsTransferPrefix = lfsPrefix + "transfer/"
+)
+
+// lfsLocksOperation matches the operations of the locks API: listing and
+// creating locks, verifying them, and releasing one.
+var lfsLocksOperation = regexp.MustCompile(`^` + lfsLocks + `(/verify|/[^/]+/unlock)?$`)
+
+// maxLFSBatchSize bounds the batch requests and responses the gateway reads.
+const maxLFSBatchSize = 10 << 20
+
+// lfsActionTTL is how long an object action is kept when the forge does not
+// say when it expires, and the most it is kept otherwise.
+const lfsActionTTL = time.Hour
+
+// isLFSOperation reports whether operation is a Git LFS request.
+func isLFSOperation(operation string) bool {
+	return strings.HasPrefix(operation, lfsPrefix)
+}
+
+// lfsBatchResponse is the response of the batch API. Only the basic
+// transfer adapter is supported, whose object actions are plain HTTP
+// requests.
+type lfsBatchResponse struct {
+	Transfer string      `json:"transfer,omitempty"`
+	Objects  []lfsObject `json:"objects"`
+	HashAlgo string      `json:"hash_algo,omitempty"`
+}
+
+// lfsObject is an object of a batch response.
+type lfsObject struct {
+	OID           string                `json:"oid"`
+	Size          int64                 `json:"size"`
+	Authenticated bool                  `json:"authenticated,omitempty"`
+	Actions       map[string]*lfsAction `json:"actions,omitempty"`
+	Error         json.RawMessage       `json:"error,omitempty"`
+}
+
+// lfsAction is an object action: the request to make to download, upload,
+// or verify the object.
+type lfsAction struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresIn int64             `json:"expires_in,omitempty"`
+	ExpiresAt string            `json:"expires_at,omitempty"`
+}
+
+// lfsActionMethods are the methods of the basic transfer adapter's actions.
+var lfsActionMethods = map[string]string{
+	"download": http.MethodGet,
+	"upload":   http.MethodPut,
+	"verify":   http.MethodPost,
+}
+
+// lfsTransfer is an object action the gateway makes on behalf of the agent.
+type lfsTransfer struct {
+	host, owner, repo string
+	name              string // download, upload, or verify
+	action            lfsAction
+	expires           time.Time
+}
+
+// lfsTransfers remembers the object actions of batch responses, keyed by
+// random IDs, so that the agent never sees their hrefs and headers, which
+// can carry credentials.
+type lfsTransfers struct {
+	mu      sync.Mutex
+	entries map[string]*lfsTransfer
+	now     func() time.Time
+}
+
+func newLFSTransfers() *lfsTransfers {
+	return &lfsTransfers{
+		entries: make(map[string]*lfsTransfer),
+		now:     time.Now,
+	}
+}
+
+// add remembers t and returns its ID. Expired transfers are forgotten.
+func (s *lfsTransfers) add(t *lfsTransfer) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate transfer ID: %w", err)
+	}
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+	t.expires = now.Add(lfsActionTTL)
+	if t.action.ExpiresIn > 0 {
+		t.expires = minTime(t.expires, now.Add(time.Duration(t.action.ExpiresIn)*time.Second))
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, t.action.ExpiresAt); err == nil {
+		t.expires = minTime(t.expires, expiresAt)
+	}
+	s.entries[id] = t
+	return id, nil
+}
+
+// get returns the unexpired transfer with id, or nil.
+func (s *lfsTransfers) get(id string) *lfsTransfer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.entries[id]
+	if !ok || !s.now().Before(t.expires) {
+		return nil
+	}
+	return t
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// handleLFS serves a Git LFS request. Downloads and listing locks need read
+// access to the repository, and uploads and changing locks need write
+// access, as for git-upload-pack and git-receive-pack.
+func (p *Proxy) handleLFS(w http.ResponseWriter, r *http.Request, gr *gitRequest) {
+	switch {
+	case gr.Operation == lfsBatch && r.Method == http.MethodPost:
+		p.handleLFSBatch(w, r, gr)
+	case strings.HasPrefix(gr.Operation, lfsTransferPrefix):
+		p.handleLFSTransfer(w, r, gr)
+	case lfsLocksOperation.MatchString(gr.Operation):
+		if p.authorizeLFS(w, r, gr, r.Method != http.MethodGet) {
+			p.forwardToGitHub(w, r, gr)
+		}
+	default:
+		http.Error(w, "forbidden: LFS operation not supported by the gateway", http.StatusForbidden)
+	}
+}
+
+// authorizeLFS checks that the repository of gr can be read, or written if
+// write is set, and responds with an error if not. Repositories writable
+// with approval accept uploads, as the push that references the objects
+// still needs the approval.
+func (p *Proxy) authorizeLFS(w http.ResponseWriter, r *http.Request, gr *gitRequest, write bool) bool {
+	allowed, err := p.canAccessLFS(r.Context(), gr, write)
+	if err != nil {
+		http.Error(w, redact(fmt.Sprintf("forbidden: failed to check repository visibility: %v", err), p.token(gr)), http.StatusForbidden)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "forbidden: access denied for this repository", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (p *Proxy) canAccessLFS(ctx context.Context, gr *gitRequest, write bool) (bool, error) {
+	if write {
+		policy := p.config.repoPolicy()
+		return policy.CanWrite(gr.Host, gr.Owner, gr.Repo) || policy.NeedsWriteApproval(gr.Host, gr.Owner, gr.Repo), nil
+	}
+	return p.canRead(ctx, gr)
+}
+
+// handleLFSBatch forwards a batch request, and replaces the object actions
+// of the response with transfers through the gateway.
+func (p *Proxy) handleLFSBatch(w http.ResponseWriter, r *http.Request, gr *gitRequest) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLFSBatchSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	var batch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		http.Error(w, fmt.Sprintf("invalid LFS batch request: %v", err), http.StatusBadRequest)
+		return
+	}
+	var operation string
+	json.Unmarshal(batch["operation"], &operation)
+	if operation != "download" && operation != "upload" {
+		http.Error(w, fmt.Sprintf("invalid LFS batch request: unknown operation %q", operation), http.StatusBadRequest)
+		return
+	}
+	if !p.authorizeLFS(w, r, gr, operation == "upload") {
+		return
+	}
+
+	// Ask for the basic transfer adapter, whose actions can be rewritten.
+	batch["transfers"] = json.RawMessage(`["basic"]`)
+	body, err = json.Marshal(batch)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode LFS batch request: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	f := p.forge(gr.Host)
+	targetURL := fmt.Sprintf("%s/%s/%s.git/%s", f.gitURL(), gr.Owner, gr.Repo, gr.Operation)
+	upstreamReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create upstream request: %v", err), http.StatusInternalServerError)
+		return
+	}
+	copyRequestHeader(upstreamReq.Header, r.Header)
+	// The response is read, so it must not be compressed.
+	upstreamReq.Header.Del("Accept-Encoding")
+	token := p.token(gr)
+	if token != "" {
+		f.authorizeGit(upstreamReq, token)
+	}
+
+	resp, err := p.httpClient.Do(upstreamReq)
+	if err != nil {
+		http.Error(w, redact(fmt.Sprintf("failed to contact %s: %v", gr.Host, err), token), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.UpstreamStatus = resp.StatusCode
+	})
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxLFSBatchSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read LFS batch response: %v", err), http.StatusBadGateway)
+		return
+	}
+	if resp.StatusCode == http.StatusOK {
+		respBody, err = p.rewriteLFSBatch(r, gr, respBody)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to rewrite LFS batch response: %v", err), http.StatusBadGateway)
+			return
+		}
+	}
+
+	copyResponseHeader(w.Header(), resp.Header)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+}
+
+// rewriteLFSBatch replaces the hrefs of the object actions in a batch
+// response with transfers through the gateway, and drops their headers.
+func (p *Proxy) rewriteLFSBatch(r *http.Request, gr *gitRequest, body []byte) ([]byte, error) {
+	var batch lfsBatchResponse
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if batch.Transfer != "" && batch.Transfer != "basic" {
+		return nil, fmt.Errorf("unsupported transfer adapter %q", batch.Transfer)
+	}
+
+	for _, object := range batch.Objects {
+		for name, action := range object.Actions {
+			if _, ok := lfsActionMethods[name]; !ok || action == nil {
+				delete(object.Actions, name)
+				continue
+			}
+			id, err := p.lfs.add(&lfsTransfer{
+				host:   gr.Host,
+				owner:  gr.Owner,
+				repo:   gr.Repo,
+				name:   name,
+				action: *action,
+			})
+			if err != nil {
+				return nil, err
+			}
+			action.Href = lfsTransferURL(r, gr, id)
+			action.Header = nil
+		}
+	}
+	return json.Marshal(batch)
+}
+
+// lfsTransferURL returns the URL of a transfer as the agent reaches the
+// gateway: the request's URL with the batch operation replaced. The path is
+// the one the agent requested, without the /{host} prefix that
+// enterpriseHandler adds.
+func lfsTransferURL(r *http.Request, gr *gitRequest, id string) string {
+	requestPath := r.URL.Path
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		requestPath = u.Path
+	}
+	return requestBaseURL(r) + strings.TrimSuffix(requestPath, gr.Operation) + lfsTransferPrefix + id
+}
+
+// handleLFSTransfer makes an object action of an earlier batch response on
+// behalf of the agent, with the headers the forge asked for.
+func (p *Proxy) handleLFSTransfer(w http.ResponseWriter, r *http.Request, gr *gitRequest) {
+	t := p.lfs.get(strings.TrimPrefix(gr.Operation, lfsTransferPrefix))
+	if t == nil || !strings.EqualFold(t.host, gr.Host) || !strings.EqualFold(t.owner, gr.Owner) || !strings.EqualFold(t.repo, gr.Repo) {
+		http.Error(w, "not found: unknown or expired LFS transfer", http.StatusNotFound)
+		return
+	}
+	if r.Method != lfsActionMethods[t.name] {
+		http.Error(w, fmt.Sprintf("method not allowed: the LFS %s action is a %s request", t.name, lfsActionMethods[t.name]), http.StatusMethodNotAllowed)
+		return
+	}
+	// The policy may have changed since the batch request.
+	if !p.authorizeLFS(w, r, gr, t.name != "download") {
+		return
+	}
+
+	upstreamReq, err := http.NewRequestWithContext(r.Context(), r.Method, t.action.Href, r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create upstream request: %v", err), http.StatusInternalServerError)
+		return
+	}
+	upstreamReq.ContentLength = r.ContentLength
+	copyRequestHeader(upstreamReq.Header, r.Header)
+	for key, value := range t.action.Header {
+		upstreamReq.Header.Set(key, value)
+	}
+
+	// Actions on the forge itself may rely on the credentials of the batch
+	// request instead of their own headers.
+	f := p.forge(gr.Host)
+	token := p.token(gr)
+	if token != "" && upstreamReq.Header.Get("Authorization") == "" && sameHost(t.action.Href, f.gitURL()) {
+		f.authorizeGit(upstreamReq, token)
+	}
+
+	resp, err := p.httpClient.Do(upstreamReq)
+	if err != nil {
+		secrets := []string{token, t.action.Href}
+		for _, value := range t.action.Header {
+			secrets = append(secrets, value)
+		}
+		http.Error(w, redact(fmt.Sprintf("failed to contact the LFS %s action: %v", t.name, err), secrets...), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.UpstreamStatus = resp.StatusCode
+	})
+
+	copyResponseHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// sameHost reports whether the URLs a and b have the same host.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
@@ -0,0 +1,370 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLFSOID = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+// newTestLFSServer serves the batch API at /{owner}/{repo}.git, with object
+// actions at /objects/{oid}.
+func newTestLFSServer(t *testing.T, gotBatch *map[string]any, gotObject *http.Request) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/objects/") {
+			*gotObject = *r.Clone(r.Context())
+			w.Write([]byte("object content"))
+			return
+		}
+
+		require.NoError(t, json.NewDecoder(r.Body).Decode(gotBatch))
+		(*gotBatch)["authorization"] = r.Header.Get("Authorization")
+		operation := (*gotBatch)["operation"]
+		w.Header().Set("Content-Type", "application/vnd.git-lfs+json")
+		w.Header().Set("Set-Cookie", "_gh_sess=abc")
+		json.NewEncoder(w).Encode(map[string]any{
+			"transfer": "basic",
+			"objects": []map[string]any{{
+				"oid":  testLFSOID,
+				"size": 14,
+				"actions": map[string]any{
+					operation.(string): map[string]any{
+						"href":       server.URL + "/objects/" + testLFSOID + "?signature=upstream-secret",
+						"header":     map[string]string{"Authorization": "RemoteAuth upstream-secret"},
+						"expires_in": 3600,
+					},
+				},
+			}},
+		})
+	}))
+	return server
+}
+
+func TestProxy_LFSBatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantHref   string
+	}{
+		{
+			name:       "download from another repository",
+			path:       "/github.com/other-owner/other-repo.git/info/lfs/objects/batch",
+			body:       `{"operation":"download","transfers":["lfs-standalone-file","basic","ssh"],"objects":[{"oid":"` + testLFSOID + `","size":14}]}`,
+			wantStatus: http.StatusOK,
+			wantHref:   "http://gateway:8080/github.com/other-owner/other-repo.git/info/lfs/transfer/",
+		},
+		{
+			name:       "upload to the project repository",
+			path:       "/github.com/my-owner/my-repo.git/info/lfs/objects/batch",
+			body:       `{"operation":"upload","objects":[{"oid":"` + testLFSOID + `","size":14}]}`,
+			wantStatus: http.StatusOK,
+			wantHref:   "http://gateway:8080/github.com/my-owner/my-repo.git/info/lfs/transfer/",
+		},
+		{
+			name:       "upload to another repository",
+			path:       "/github.com/other-owner/other-repo.git/info/lfs/objects/batch",
+			body:       `{"operation":"upload","objects":[{"oid":"` + testLFSOID + `","size":14}]}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "unknown operation",
+			path:       "/github.com/my-owner/my-repo.git/info/lfs/objects/batch",
+			body:       `{"operation":"delete","objects":[]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid request",
+			path:       "/github.com/my-owner/my-repo.git/info/lfs/objects/batch",
+			body:       `not json`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBatch map[string]any
+			var gotObject http.Request
+			upstream := newTestLFSServer(t, &gotBatch, &gotObject)
+			defer upstream.Close()
+
+			proxy := newTestProxy(t, upstream.URL)
+
+			req := httptest.NewRequest(http.MethodPost, "http://gateway:8080"+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer client-token")
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Nil(t, gotBatch)
+				return
+			}
+			assert.Equal(t, []any{"basic"}, gotBatch["transfers"])
+			assert.Contains(t, gotBatch["authorization"], "Basic ")
+			assert.Empty(t, w.Header().Get("Set-Cookie"))
+			assert.NotContains(t, w.Body.String(), "upstream-secret")
+
+			var got lfsBatchResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			require.Len(t, got.Objects, 1)
+			for _, action := range got.Objects[0].Actions {
+				assert.True(t, strings.HasPrefix(action.Href, tt.wantHref), action.Href)
+				assert.Empty(t, action.Header)
+				assert.Equal(t, int64(3600), action.ExpiresIn)
+			}
+		})
+	}
+}
+
+func TestProxy_LFSTransfer(t *testing.T) {
+	tests := []struct {
+		name         string
+		operation    string
+		repo         string
+		method       string
+		transferRepo string
+		transferID   string
+		expire       bool
+		wantStatus   int
+	}{
+		{
+			name:       "download",
+			operation:  "download",
+			repo:       "other-owner/other-repo",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "upload",
+			operation:  "upload",
+			repo:       "my-owner/my-repo",
+			method:     http.MethodPut,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wrong method",
+			operation:  "download",
+			repo:       "other-owner/other-repo",
+			method:     http.MethodPut,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:         "another repository",
+			operation:    "download",
+			repo:         "other-owner/other-repo",
+			method:       http.MethodGet,
+			transferRepo: "my-owner/my-repo",
+			wantStatus:   http.StatusNotFound,
+		},
+		{
+			name:       "unknown transfer",
+			operation:  "download",
+			repo:       "other-owner/other-repo",
+			method:     http.MethodGet,
+			transferID: "unknown",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "expired transfer",
+			operation:  "download",
+			repo:       "other-owner/other-repo",
+			method:     http.MethodGet,
+			expire:     true,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBatch map[string]any
+			var gotObject http.Request
+			upstream := newTestLFSServer(t, &gotBatch, &gotObject)
+			defer upstream.Close()
+
+			proxy := newTestProxy(t, upstream.URL)
+			now := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+			proxy.lfs.now = func() time.Time { return now }
+
+			body := `{"operation":"` + tt.operation + `","objects":[{"oid":"` + testLFSOID + `","size":14}]}`
+			req := httptest.NewRequest(http.MethodPost, "http://gateway:8080/github.com/"+tt.repo+".git/info/lfs/objects/batch", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var batch lfsBatchResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+			href := batch.Objects[0].Actions[tt.operation].Href
+			if tt.transferRepo != "" {
+				href = strings.Replace(href, tt.repo, tt.transferRepo, 1)
+			}
+			if tt.transferID != "" {
+				href = href[:strings.LastIndex(href, "/")+1] + tt.transferID
+			}
+			if tt.expire {
+				now = now.Add(time.Hour)
+			}
+
+			req = httptest.NewRequest(tt.method, href, strings.NewReader("object content"))
+			req.Header.Set("Authorization", "Bearer client-token")
+			w = httptest.NewRecorder()
+			proxy.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Empty(t, gotObject.Method)
+				return
+			}
+			assert.Equal(t, tt.method, gotObject.Method)
+			assert.Equal(t, "signature=upstream-secret", gotObject.URL.RawQuery)
+			assert.Equal(t, "RemoteAuth upstream-secret", gotObject.Header.Get("Authorization"))
+			assert.Equal(t, "object content", w.Body.String())
+		})
+	}
+}
+
+func TestProxy_LFSTransfer_ForgeCredentials(t *testing.T) {
+	var gotAuth string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/objects/") {
+			gotAuth = r.Header.Get("Authorization")
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		json.NewEncoder(w).Encode(map[string]any{
+			"objects": []map[string]any{{
+				"oid":     testLFSOID,
+				"size":    14,
+				"actions": map[string]any{"download": map[string]any{"href": server.URL + "/objects/" + testLFSOID}},
+			}},
+		})
+	}))
+	defer server.Close()
+
+	proxy := newTestProxy(t, server.URL)
+
+	body := `{"operation":"download","objects":[{"oid":"` + testLFSOID + `","size":14}]}`
+	req := httptest.NewRequest(http.MethodPost, "http://gateway:8080/github.com/my-owner/my-repo.git/info/lfs/objects/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var batch lfsBatchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	req = httptest.NewRequest(http.MethodGet, batch.Objects[0].Actions["download"].Href, nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Basic "+basicAuth("x-access-token", "test-token"), gotAuth)
+}
+
+func TestProxy_LFSLocks(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{
+			name:       "list locks of another repository",
+			method:     http.MethodGet,
+			path:       "/github.com/other-owner/other-repo.git/info/lfs/locks",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "lock in another repository",
+			method:     http.MethodPost,
+			path:       "/github.com/other-owner/other-repo.git/info/lfs/locks",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "verify locks in another repository",
+			method:     http.MethodPost,
+			path:       "/github.com/other-owner/other-repo.git/info/lfs/locks/verify",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "lock in the project repository",
+			method:     http.MethodPost,
+			path:       "/github.com/my-owner/my-repo.git/info/lfs/locks",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unlock in the project repository",
+			method:     http.MethodPost,
+			path:       "/github.com/my-owner/my-repo.git/info/lfs/locks/123/unlock",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unknown LFS operation",
+			method:     http.MethodGet,
+			path:       "/github.com/my-owner/my-repo.git/info/lfs/objects/" + testLFSOID,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				w.Write([]byte(`{"locks":[]}`))
+			}))
+			defer upstream.Close()
+
+			proxy := newTestProxy(t, upstream.URL)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`))
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, strings.TrimPrefix(tt.path, "/github.com"), gotPath)
+			} else {
+				assert.Empty(t, gotPath)
+			}
+		})
+	}
+}
+
+func TestProxy_LFSBatch_EnterpriseEndpoint(t *testing.T) {
+	var gotBatch map[string]any
+	var gotObject http.Request
+	upstream := newTestLFSServer(t, &gotBatch, &gotObject)
+	defer upstream.Close()
+
+	handler := &enterpriseHandler{proxy: newTestProxy(t, upstream.URL)}
+
+	body := `{"operation":"download","objects":[{"oid":"` + testLFSOID + `","size":14}]}`
+	req := httptest.NewRequest(http.MethodPost, "https://gateway/my-owner/my-repo.git/info/lfs/objects/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var batch lfsBatchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	href := batch.Objects[0].Actions["download"].Href
+	assert.True(t, strings.HasPrefix(href, "https://gateway/my-owner/my-repo.git/info/lfs/transfer/"), href)
+
+	req = httptest.NewRequest(http.MethodGet, href, nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "object content", w.Body.String())
+}
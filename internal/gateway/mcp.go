@@ -0,0 +1,412 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// mcpProtocolVersion is the MCP revision the server implements.
+const mcpProtocolVersion = "2025-06-18"
+
+// mcpProtocolVersions lists the MCP revisions the server accepts from clients.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26"}
+
+// JSON-RPC error codes used by the MCP server.
+const (
+	jsonRPCParseError     = -32700
+	jsonRPCInvalidRequest = -32600
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInvalidParams  = -32602
+)
+
+// mcpRequest is a JSON-RPC request or notification. Notifications have no ID.
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// mcpResponse is a JSON-RPC response.
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+// mcpError is a JSON-RPC error.
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool describes a tool in a tools/list result.
+type mcpTool struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	InputSchema map[string]any     `json:"inputSchema"`
+	Annotations mcpToolAnnotations `json:"annotations"`
+}
+
+// mcpToolAnnotations are hints about a tool's behavior.
+type mcpToolAnnotations struct {
+	Title        string `json:"title,omitempty"`
+	ReadOnlyHint bool   `json:"readOnlyHint"`
+}
+
+// mcpContent is a content block of a tool result.
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpToolResult is the result of tools/call.
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError"`
+}
+
+// pathParamDescriptions describes the path parameters of the operations.
+var pathParamDescriptions = map[string]string{
+	"owner":  "Repository owner; defaults to the project's owner",
+	"repo":   "Repository name; defaults to the project's repository",
+	"number": "Pull request or issue number",
+	"ref":    "Commit SHA, branch, or tag",
+	"run_id": "Workflow run ID",
+	"job_id": "Workflow job ID",
+	"path":   "Path of the file or directory in the repository",
+}
+
+// integerPathParams are the path parameters that are numeric IDs.
+var integerPathParams = []string{"number", "run_id", "job_id"}
+
+// handleMCP serves the operations as MCP tools over the streamable HTTP
+// transport. Responses are plain JSON; the server never opens an SSE stream.
+// Tool calls go through the same policy checks as /api/github requests.
+func (s *APIServer) handleMCP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed: the MCP endpoint only accepts POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req mcpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeMCPResponse(w, http.StatusBadRequest, mcpResponse{
+			Error: &mcpError{Code: jsonRPCParseError, Message: fmt.Sprintf("failed to parse request: %v", err)},
+		})
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		writeMCPResponse(w, http.StatusBadRequest, mcpResponse{
+			ID:    req.ID,
+			Error: &mcpError{Code: jsonRPCInvalidRequest, Message: "invalid request: expected a JSON-RPC 2.0 request"},
+		})
+		return
+	}
+	// Notifications and responses from the client need no reply.
+	if len(req.ID) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	result, rpcErr := s.mcpCall(r, req)
+	writeMCPResponse(w, http.StatusOK, mcpResponse{ID: req.ID, Result: result, Error: rpcErr})
+}
+
+// writeMCPResponse writes a JSON-RPC response.
+func writeMCPResponse(w http.ResponseWriter, status int, resp mcpResponse) {
+	resp.JSONRPC = "2.0"
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// mcpCall runs a JSON-RPC method and returns its result or error.
+func (s *APIServer) mcpCall(r *http.Request, req mcpRequest) (any, *mcpError) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := mcpProtocolVersion
+		if slices.Contains(mcpProtocolVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "claude-forge-gateway", "version": mcpServerVersion()},
+			"instructions": fmt.Sprintf("Tools for the %s API of %s/%s and the other repositories the gateway policy allows. "+
+				"owner and repo default to the project.", s.config.host(), s.config.AllowedOwner, s.config.AllowedRepo),
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": s.mcpTools()}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &mcpError{Code: jsonRPCInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+		}
+		op := findOperation(params.Name)
+		if op == nil || !s.mcpToolListed(op) {
+			return nil, &mcpError{Code: jsonRPCInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+		}
+		return s.callTool(r, op, params.Arguments), nil
+	}
+	return nil, &mcpError{Code: jsonRPCMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+}
+
+// mcpServerVersion returns the module version the gateway was built from.
+func mcpServerVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// mcpToolListed reports whether op is offered as a tool. Operations the
+// policy denies are left out, and forges without a GitHub-compatible API
+// have no tools.
+func (s *APIServer) mcpToolListed(op *Operation) bool {
+	return s.forge.githubAPI() && s.config.operationDecision(op.Name) != OperationDeny
+}
+
+// mcpTools returns the tools for the operations the policy does not deny.
+func (s *APIServer) mcpTools() []mcpTool {
+	tools := []mcpTool{}
+	for i := range operations {
+		op := &operations[i]
+		if !s.mcpToolListed(op) {
+			continue
+		}
+		description := fmt.Sprintf("%s (%s %s).", op.Description, op.Method, op.Path)
+		if s.config.operationDecision(op.Name) == OperationNeedsApproval {
+			description += " The gateway policy requires approval for this operation."
+		}
+		tools = append(tools, mcpTool{
+			Name:        op.Name,
+			Description: description,
+			InputSchema: toolInputSchema(op),
+			Annotations: mcpToolAnnotations{Title: op.Description, ReadOnlyHint: op.Type == "read"},
+		})
+	}
+	return tools
+}
+
+// pathParams returns the names of the parameters in an operation's path.
+func pathParams(op *Operation) []string {
+	var names []string
+	for _, part := range strings.Split(op.Path, "/") {
+		if name, ok := strings.CutPrefix(part, "{"); ok {
+			names = append(names, strings.TrimSuffix(strings.TrimSuffix(name, "}"), "..."))
+		}
+	}
+	return names
+}
+
+// toolInputSchema returns the JSON schema of an operation's arguments: its
+// path parameters followed by its query and body parameters.
+func toolInputSchema(op *Operation) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	for _, name := range pathParams(op) {
+		schemaType := "string"
+		if slices.Contains(integerPathParams, name) {
+			schemaType = "integer"
+		}
+		properties[name] = map[string]any{"type": schemaType, "description": pathParamDescriptions[name]}
+		if name != "owner" && name != "repo" {
+			required = append(required, name)
+		}
+	}
+	for _, param := range op.Params {
+		property := map[string]any{"type": param.Type}
+		if param.Type == "array" {
+			property["items"] = map[string]any{"type": "string"}
+		}
+		if param.Description != "" {
+			property["description"] = param.Description
+		}
+		if len(param.Enum) > 0 {
+			property["enum"] = param.Enum
+		}
+		properties[param.Name] = property
+		if param.Required {
+			required = append(required, param.Name)
+		}
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// callTool runs an operation with the tool arguments through the GitHub API
+// proxy, so that the policy applies, and returns the response as the result.
+func (s *APIServer) callTool(r *http.Request, op *Operation, rawArgs json.RawMessage) *mcpToolResult {
+	req, err := s.toolRequest(r.Context(), op, rawArgs)
+	if err != nil {
+		return toolError(redact(err.Error(), s.ghAuth.Token()))
+	}
+	req.Host = r.Host
+
+	resp := &toolResponseWriter{header: http.Header{}}
+	s.handleGitHubProxy(resp, req, "/api/github")
+
+	status := resp.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := strings.TrimSpace(resp.body.String())
+	if status >= http.StatusBadRequest {
+		annotateAudit(r.Context(), func(entry *AuditEntry) {
+			if entry.UpstreamStatus != 0 {
+				return
+			}
+			entry.Decision = AuditError
+			if status == http.StatusForbidden {
+				entry.Decision = AuditDeny
+			}
+			entry.Reason = body
+		})
+		return toolError(fmt.Sprintf("%s failed with status %d: %s", op.Name, status, body))
+	}
+	return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: body}}}
+}
+
+// toolError returns a tool result reporting message as an error.
+func toolError(message string) *mcpToolResult {
+	return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: message}}, IsError: true}
+}
+
+// toolRequest builds the /api/github request for an operation from the tool
+// arguments.
+func (s *APIServer) toolRequest(ctx context.Context, op *Operation, rawArgs json.RawMessage) (*http.Request, error) {
+	args := map[string]any{}
+	if len(rawArgs) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(rawArgs))
+		decoder.UseNumber()
+		if err := decoder.Decode(&args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+
+	known := map[string]bool{}
+	path := op.Path
+	for _, name := range pathParams(op) {
+		known[name] = true
+		value := argString(args[name])
+		if value == "" {
+			switch name {
+			case "owner":
+				value = s.config.AllowedOwner
+			case "repo":
+				value = s.config.AllowedRepo
+			default:
+				return nil, fmt.Errorf("missing required argument %q", name)
+			}
+		}
+		if name == "path" {
+			segments, ok := cleanAPIPath(strings.Trim(value, "/"))
+			if !ok {
+				return nil, fmt.Errorf("invalid argument %q: must not contain empty, . or .. segments", name)
+			}
+			path = strings.Replace(path, "/{path...}", segments, 1)
+			continue
+		}
+		if value == "." || value == ".." {
+			return nil, fmt.Errorf("invalid argument %q: must not be . or ..", name)
+		}
+		path = strings.Replace(path, "{"+name+"}", url.PathEscape(value), 1)
+	}
+
+	query := url.Values{}
+	body := map[string]any{}
+	for _, param := range op.Params {
+		known[param.Name] = true
+		value, ok := args[param.Name]
+		if !ok || value == nil {
+			if param.Required {
+				return nil, fmt.Errorf("missing required argument %q", param.Name)
+			}
+			continue
+		}
+		if param.In == "query" {
+			query.Set(param.Name, argString(value))
+			continue
+		}
+		body[param.Name] = value
+	}
+	for name := range args {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown argument %q for %s", name, op.Name)
+		}
+	}
+
+	target := "/api/github" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	if op.Method == http.MethodGet {
+		return http.NewRequestWithContext(ctx, op.Method, target, nil)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request body: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, op.Method, target, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// argString formats a scalar tool argument for a path or query.
+func argString(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// toolResponseWriter buffers the response of a tool call.
+type toolResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *toolResponseWriter) Header() http.Header { return w.header }
+
+func (w *toolResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *toolResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
@@ -0,0 +1,376 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postMCP sends a JSON-RPC request to the server's MCP endpoint.
+func postMCP(t *testing.T, handler http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// decodeMCPResult decodes the result of a successful JSON-RPC response into v.
+func decodeMCPResult(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *mcpError       `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Nil(t, resp.Error)
+	require.NoError(t, json.Unmarshal(resp.Result, v))
+}
+
+func TestMCP_Initialize(t *testing.T) {
+	server := NewAPIServer(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}, NewGitHubAuthFromToken("test-token"))
+
+	tests := []struct {
+		name          string
+		clientVersion string
+		wantVersion   string
+	}{
+		{name: "supported version", clientVersion: "2025-03-26", wantVersion: "2025-03-26"},
+		{name: "unsupported version", clientVersion: "2024-11-05", wantVersion: mcpProtocolVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postMCP(t, server, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"`+tt.clientVersion+`","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+
+			var result struct {
+				ProtocolVersion string         `json:"protocolVersion"`
+				Capabilities    map[string]any `json:"capabilities"`
+				ServerInfo      struct {
+					Name string `json:"name"`
+				} `json:"serverInfo"`
+			}
+			decodeMCPResult(t, w, &result)
+			assert.Equal(t, tt.wantVersion, result.ProtocolVersion)
+			assert.Contains(t, result.Capabilities, "tools")
+			assert.Equal(t, "claude-forge-gateway", result.ServerInfo.Name)
+		})
+	}
+}
+
+func TestMCP_Protocol(t *testing.T) {
+	server := NewAPIServer(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}, NewGitHubAuthFromToken("test-token"))
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantCode   int
+	}{
+		{
+			name:       "notification is accepted",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "ping",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":"2.0","id":"a","method":"ping"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unknown method",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":"2.0","id":2,"method":"resources/list"}`,
+			wantStatus: http.StatusOK,
+			wantCode:   jsonRPCMethodNotFound,
+		},
+		{
+			name:       "unknown tool",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"delete-repo"}}`,
+			wantStatus: http.StatusOK,
+			wantCode:   jsonRPCInvalidParams,
+		},
+		{
+			name:       "malformed JSON",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   jsonRPCParseError,
+		},
+		{
+			name:       "not JSON-RPC 2.0",
+			method:     http.MethodPost,
+			body:       `{"id":4,"method":"ping"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   jsonRPCInvalidRequest,
+		},
+		{
+			name:       "GET has no event stream",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/mcp", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusAccepted || tt.wantStatus == http.StatusMethodNotAllowed {
+				return
+			}
+			var resp struct {
+				JSONRPC string    `json:"jsonrpc"`
+				Error   *mcpError `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "2.0", resp.JSONRPC)
+			if tt.wantCode == 0 {
+				assert.Nil(t, resp.Error)
+				return
+			}
+			require.NotNil(t, resp.Error)
+			assert.Equal(t, tt.wantCode, resp.Error.Code)
+		})
+	}
+}
+
+func TestMCP_ToolsList(t *testing.T) {
+	config := ProxyConfig{
+		AllowedOwner: "my-owner",
+		AllowedRepo:  "my-repo",
+		Policy: &Policy{
+			Operations: map[string]string{
+				"create-issue": OperationDeny,
+				"merge-pr":     OperationNeedsApproval,
+			},
+		},
+	}
+	server := NewAPIServer(config, NewGitHubAuthFromToken("test-token"))
+
+	var result struct {
+		Tools []mcpTool `json:"tools"`
+	}
+	decodeMCPResult(t, postMCP(t, server, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`), &result)
+
+	tools := map[string]mcpTool{}
+	for _, tool := range result.Tools {
+		tools[tool.Name] = tool
+	}
+	assert.Len(t, tools, len(operations)-1)
+	assert.NotContains(t, tools, "create-issue")
+	assert.Contains(t, tools["merge-pr"].Description, "requires approval")
+
+	getPR := tools["get-pr"]
+	assert.True(t, getPR.Annotations.ReadOnlyHint)
+	assert.Equal(t, []any{"number"}, getPR.InputSchema["required"])
+	assert.Equal(t, map[string]any{"type": "integer", "description": "Pull request or issue number"}, getPR.InputSchema["properties"].(map[string]any)["number"])
+
+	createPR := tools["create-pr"]
+	assert.False(t, createPR.Annotations.ReadOnlyHint)
+	assert.Equal(t, []any{"title", "head", "base"}, createPR.InputSchema["required"])
+	assert.Equal(t, false, createPR.InputSchema["additionalProperties"])
+
+	createIssueComment := tools["create-issue-comment"]
+	assert.ElementsMatch(t, []any{"number", "body"}, createIssueComment.InputSchema["required"])
+
+	listPRs := tools["list-prs"].InputSchema["properties"].(map[string]any)
+	assert.Equal(t, []any{"open", "closed", "all"}, listPRs["state"].(map[string]any)["enum"])
+	assert.Contains(t, listPRs, "per_page")
+}
+
+func TestMCP_ToolsList_NonGitHubForge(t *testing.T) {
+	server := NewAPIServer(ProxyConfig{Host: "gitlab.com", AllowedOwner: "group", AllowedRepo: "repo"}, NewGitHubAuthFromToken("test-token"))
+
+	var result struct {
+		Tools []mcpTool `json:"tools"`
+	}
+	decodeMCPResult(t, postMCP(t, server, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`), &result)
+	assert.Empty(t, result.Tools)
+}
+
+func TestMCP_ToolsCall(t *testing.T) {
+	type upstreamRequest struct {
+		method string
+		uri    string
+		body   string
+	}
+	var got []upstreamRequest
+	ghAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, upstreamRequest{method: r.Method, uri: r.URL.RequestURI(), body: string(body)})
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ghAPI.Close()
+
+	config := ProxyConfig{
+		AllowedOwner: "my-owner",
+		AllowedRepo:  "my-repo",
+		Policy: &Policy{
+			Operations: map[string]string{"merge-pr": OperationNeedsApproval},
+		},
+	}
+	server := NewTestAPIServer(config, NewGitHubAuthFromToken("test-token"), ghAPI.URL)
+
+	tests := []struct {
+		name         string
+		tool         string
+		arguments    string
+		wantUpstream *upstreamRequest
+		wantIsError  bool
+		wantText     string
+	}{
+		{
+			name:         "read with project defaults and query parameters",
+			tool:         "list-prs",
+			arguments:    `{"state":"open","per_page":5}`,
+			wantUpstream: &upstreamRequest{method: http.MethodGet, uri: "/repos/my-owner/my-repo/pulls?per_page=5&state=open"},
+			wantText:     `{"ok":true}`,
+		},
+		{
+			name:         "read another repository",
+			tool:         "get-pr",
+			arguments:    `{"owner":"golang","repo":"go","number":12}`,
+			wantUpstream: &upstreamRequest{method: http.MethodGet, uri: "/repos/golang/go/pulls/12"},
+			wantText:     `{"ok":true}`,
+		},
+		{
+			name:         "file contents with a nested path",
+			tool:         "get-file-contents",
+			arguments:    `{"path":"docs/getting started.md","ref":"main"}`,
+			wantUpstream: &upstreamRequest{method: http.MethodGet, uri: "/repos/my-owner/my-repo/contents/docs/getting%20started.md?ref=main"},
+			wantText:     `{"ok":true}`,
+		},
+		{
+			name:         "write sends a JSON body",
+			tool:         "create-issue",
+			arguments:    `{"title":"Bug","labels":["bug"]}`,
+			wantUpstream: &upstreamRequest{method: http.MethodPost, uri: "/repos/my-owner/my-repo/issues", body: `{"labels":["bug"],"title":"Bug"}`},
+			wantText:     `{"ok":true}`,
+		},
+		{
+			name:        "write to another repository is denied",
+			tool:        "create-issue",
+			arguments:   `{"owner":"golang","repo":"go","title":"Bug"}`,
+			wantIsError: true,
+			wantText:    "create-issue failed with status 403: forbidden: access denied for this repository",
+		},
+		{
+			name:        "operation that needs approval is rejected",
+			tool:        "merge-pr",
+			arguments:   `{"number":1}`,
+			wantIsError: true,
+			wantText:    "forbidden: operation merge-pr requires approval",
+		},
+		{
+			name:        "missing required argument",
+			tool:        "create-pr",
+			arguments:   `{"title":"Change"}`,
+			wantIsError: true,
+			wantText:    `missing required argument "head"`,
+		},
+		{
+			name:        "missing path parameter",
+			tool:        "get-issue",
+			arguments:   `{}`,
+			wantIsError: true,
+			wantText:    `missing required argument "number"`,
+		},
+		{
+			name:        "unknown argument",
+			tool:        "get-repo",
+			arguments:   `{"visibility":"private"}`,
+			wantIsError: true,
+			wantText:    `unknown argument "visibility" for get-repo`,
+		},
+		{
+			name:        "dot segments in the file path",
+			tool:        "get-file-contents",
+			arguments:   `{"path":"../../../golang/go/contents/x"}`,
+			wantIsError: true,
+			wantText:    `invalid argument "path": must not contain empty, . or .. segments`,
+		},
+		{
+			name:        "dot segment as the repository",
+			tool:        "get-repo",
+			arguments:   `{"owner":"my-owner","repo":".."}`,
+			wantIsError: true,
+			wantText:    `invalid argument "repo": must not be . or ..`,
+		},
+		{
+			name:         "upstream error",
+			tool:         "get-file-contents",
+			arguments:    `{"path":"missing"}`,
+			wantUpstream: &upstreamRequest{method: http.MethodGet, uri: "/repos/my-owner/my-repo/contents/missing"},
+			wantIsError:  true,
+			wantText:     `get-file-contents failed with status 404: {"message":"Not Found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			var body bytes.Buffer
+			require.NoError(t, json.NewEncoder(&body).Encode(map[string]any{
+				"jsonrpc": "2.0",
+				"id":      1,
+				"method":  "tools/call",
+				"params":  map[string]any{"name": tt.tool, "arguments": json.RawMessage(tt.arguments)},
+			}))
+
+			var result mcpToolResult
+			decodeMCPResult(t, postMCP(t, server, body.String()), &result)
+
+			if tt.wantUpstream == nil {
+				assert.Empty(t, got)
+			} else {
+				assert.Equal(t, []upstreamRequest{*tt.wantUpstream}, got)
+			}
+			assert.Equal(t, tt.wantIsError, result.IsError)
+			require.Len(t, result.Content, 1)
+			assert.Equal(t, "text", result.Content[0].Type)
+			assert.Contains(t, result.Content[0].Text, tt.wantText)
+		})
+	}
+}
+
+func TestMCP_ToolsCall_Audit(t *testing.T) {
+	var logBuf bytes.Buffer
+	config := ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}
+	server := NewTestAPIServer(config, NewGitHubAuthFromToken("test-token"), "http://127.0.0.1:0")
+	server.audit = NewAuditLog(&logBuf, "abc12345")
+
+	w := postMCP(t, server, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"create-issue","arguments":{"owner":"golang","repo":"go","title":"Bug"}}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var entry AuditEntry
+	require.NoError(t, json.Unmarshal(logBuf.Bytes(), &entry))
+	assert.Equal(t, "/mcp", entry.Path)
+	assert.Equal(t, "create-issue", entry.Operation)
+	assert.Equal(t, "golang", entry.Owner)
+	assert.Equal(t, "go", entry.Repo)
+	assert.Equal(t, AuditDeny, entry.Decision)
+	assert.Equal(t, "forbidden: access denied for this repository", entry.Reason)
+}
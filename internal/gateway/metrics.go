@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsNamespace prefixes the names of the gateway's metrics.
+const metricsNamespace = "claude_forge_gateway"
+
+// durationBuckets are the upper bounds, in seconds, of the request duration
+// histogram's buckets. Requests that wait for approval or a rate limit take
+// minutes.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// requestKey identifies a request counter.
+type requestKey struct {
+	server   string
+	decision string
+	code     int
+}
+
+// histogram is a request duration histogram of one server.
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Metrics counts the requests the gateway handles, and serves them in the
+// Prometheus text format. It is fed from the audit entries of requests, so
+// it covers the same requests as the audit log. A nil *Metrics records
+// nothing.
+type Metrics struct {
+	mu             sync.Mutex
+	requests       map[requestKey]uint64
+	durations      map[string]*histogram
+	upstreamErrors map[string]uint64
+}
+
+// NewMetrics creates an empty set of metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:       make(map[requestKey]uint64),
+		durations:      make(map[string]*histogram),
+		upstreamErrors: make(map[string]uint64),
+	}
+}
+
+// observe records a request that took duration.
+func (m *Metrics) observe(entry *AuditEntry, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{server: entry.Server, decision: entry.Decision, code: entry.Status}]++
+
+	h, ok := m.durations[entry.Server]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets)+1)}
+		m.durations[entry.Server] = h
+	}
+	seconds := duration.Seconds()
+	i, _ := slices.BinarySearch(durationBuckets, seconds)
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+
+	// The upstream could not be reached, or failed.
+	if (entry.UpstreamStatus == 0 && entry.Status == http.StatusBadGateway) || entry.UpstreamStatus >= http.StatusInternalServerError {
+		m.upstreamErrors[entry.Server]++
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := metricsNamespace + "_requests_total"
+	fmt.Fprintf(w, "# HELP %s Requests handled by the gateway, by server, decision, and status code.\n", name)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	keys := slices.SortedFunc(maps.Keys(m.requests), func(a, b requestKey) int {
+		return cmp.Or(strings.Compare(a.server, b.server), strings.Compare(a.decision, b.decision), cmp.Compare(a.code, b.code))
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{server=%q,decision=%q,code=\"%d\"} %d\n", name, key.server, key.decision, key.code, m.requests[key])
+	}
+
+	name = metricsNamespace + "_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time taken to handle requests, by server.\n", name)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, server := range slices.Sorted(maps.Keys(m.durations)) {
+		h := m.durations[server]
+		var cumulative uint64
+		for i, bound := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{server=%q,le=%q} %d\n", name, server, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{server=%q,le=\"+Inf\"} %d\n", name, server, h.count)
+		fmt.Fprintf(w, "%s_sum{server=%q} %s\n", name, server, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{server=%q} %d\n", name, server, h.count)
+	}
+
+	name = metricsNamespace + "_upstream_errors_total"
+	fmt.Fprintf(w, "# HELP %s Requests whose upstream could not be reached or answered with a server error, by server.\n", name)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, server := range slices.Sorted(maps.Keys(m.upstreamErrors)) {
+		fmt.Fprintf(w, "%s{server=%q} %d\n", name, server, m.upstreamErrors[server])
+	}
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.observe(&AuditEntry{Server: "git", Decision: AuditAllow, Status: http.StatusOK, UpstreamStatus: http.StatusOK}, 3*time.Millisecond)
+	metrics.observe(&AuditEntry{Server: "git", Decision: AuditAllow, Status: http.StatusOK, UpstreamStatus: http.StatusOK}, 2*time.Second)
+	metrics.observe(&AuditEntry{Server: "api", Decision: AuditDeny, Status: http.StatusForbidden}, 10*time.Millisecond)
+	metrics.observe(&AuditEntry{Server: "api", Decision: AuditError, Status: http.StatusBadGateway}, 20*time.Millisecond)
+	metrics.observe(&AuditEntry{Server: "api", Decision: AuditAllow, Status: http.StatusServiceUnavailable, UpstreamStatus: http.StatusServiceUnavailable}, 40*time.Millisecond)
+	(*Metrics)(nil).observe(&AuditEntry{Server: "api"}, time.Second)
+
+	var buf bytes.Buffer
+	metrics.write(&buf)
+
+	assert.Equal(t, `# HELP claude_forge_gateway_requests_total Requests handled by the gateway, by server, decision, and status code.
+# TYPE claude_forge_gateway_requests_total counter
+claude_forge_gateway_requests_total{server="api",decision="allow",code="503"} 1
+claude_forge_gateway_requests_total{server="api",decision="deny",code="403"} 1
+claude_forge_gateway_requests_total{server="api",decision="error",code="502"} 1
+claude_forge_gateway_requests_total{server="git",decision="allow",code="200"} 2
+# HELP claude_forge_gateway_request_duration_seconds Time taken to handle requests, by server.
+# TYPE claude_forge_gateway_request_duration_seconds histogram
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="0.005"} 0
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="0.01"} 1
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="0.025"} 2
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="0.05"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="0.1"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="0.25"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="0.5"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="1"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="2.5"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="5"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="10"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="30"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="60"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="300"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="api",le="+Inf"} 3
+claude_forge_gateway_request_duration_seconds_sum{server="api"} 0.07
+claude_forge_gateway_request_duration_seconds_count{server="api"} 3
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="0.005"} 1
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="0.01"} 1
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="0.025"} 1
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="0.05"} 1
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="0.1"} 1
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="0.25"} 1
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="0.5"} 1
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="1"} 1
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="2.5"} 2
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="5"} 2
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="10"} 2
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="30"} 2
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="60"} 2
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="300"} 2
+claude_forge_gateway_request_duration_seconds_bucket{server="git",le="+Inf"} 2
+claude_forge_gateway_request_duration_seconds_sum{server="git"} 2.003
+claude_forge_gateway_request_duration_seconds_count{server="git"} 2
+# HELP claude_forge_gateway_upstream_errors_total Requests whose upstream could not be reached or answered with a server error, by server.
+# TYPE claude_forge_gateway_upstream_errors_total counter
+claude_forge_gateway_upstream_errors_total{server="api"} 2
+`, buf.String())
+}
+
+func TestServer_Metrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		auditLog bool
+	}{
+		{name: "without an audit log"},
+		{name: "with an audit log", auditLog: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServerWithAuth(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}, NewGitHubAuthFromToken("test-token"))
+			var logBuf bytes.Buffer
+			if tt.auditLog {
+				server.EnableAuditLog(NewAuditLog(&logBuf, "abc12345"))
+			}
+
+			server.proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/github.com/other-owner/other-repo.git/git-receive-pack", nil))
+			server.apiServer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/schema", nil))
+
+			w := httptest.NewRecorder()
+			server.withHealth(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Body.String(), `claude_forge_gateway_requests_total{server="git",decision="deny",code="403"} 1`)
+			assert.Contains(t, w.Body.String(), `claude_forge_gateway_requests_total{server="api",decision="allow",code="200"} 1`)
+			assert.Equal(t, tt.auditLog, strings.Count(logBuf.String(), "\n") == 2)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// mirrorStampFile is the file in a mirror whose modification time records
+// when the mirror was last fetched from the upstream.
+const mirrorStampFile = "claude-forge-fetched"
+
+// mirrors reports whether the repository on host is mirrored in the cache.
+func (c *Cache) mirrors(host, owner, repo string) bool {
+	return c != nil && matchRepo(c.mirrorPatterns, host, owner, repo)
+}
+
+// mirrorPath returns the path of the bare mirror of the repository.
+func (c *Cache) mirrorPath(host, owner, repo string) string {
+	return filepath.Join(c.dir, "git", strings.ToLower(host), strings.ToLower(owner), strings.ToLower(repo)+".git")
+}
+
+// updateMirror creates the mirror of the repository, or fetches it from
+// the upstream if it was last fetched more than the refresh interval ago.
+// Gateways sharing the cache take a lock on the mirror while doing so.
+func (c *Cache) updateMirror(ctx context.Context, f forge, token, host, owner, repo string) (string, error) {
+	dir := c.mirrorPath(host, owner, repo)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+
+	lock, err := os.OpenFile(dir+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to open mirror lock: %w", err)
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return "", fmt.Errorf("failed to lock mirror: %w", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	stamp := filepath.Join(dir, mirrorStampFile)
+	if info, err := os.Stat(stamp); err == nil && c.now().Sub(info.ModTime()) < c.refreshInterval {
+		return dir, nil
+	}
+
+	// A mirror fetches every ref, so that fetches of refs such as pull
+	// request heads are served too.
+	args := []string{"--git-dir", dir, "fetch", "--quiet", "--prune", "origin"}
+	_, err = os.Stat(dir)
+	create := errors.Is(err, os.ErrNotExist)
+	if create {
+		args = []string{"clone", "--quiet", "--mirror", fmt.Sprintf("%s/%s/%s.git", f.gitURL(), owner, repo), dir}
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if token != "" {
+		// Pass the credentials in the environment rather than on the
+		// command line, where other processes could read them.
+		authReq := &http.Request{Header: http.Header{}}
+		f.authorizeGit(authReq, token)
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: "+authReq.Header.Get("Authorization"),
+		)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if create {
+			os.RemoveAll(dir)
+		}
+		return "", fmt.Errorf("failed to fetch mirror: %w: %s", err, bytes.TrimSpace(output))
+	}
+
+	now := c.now()
+	if err := os.WriteFile(stamp, nil, 0o644); err != nil {
+		return "", fmt.Errorf("failed to record mirror fetch: %w", err)
+	}
+	if err := os.Chtimes(stamp, now, now); err != nil {
+		return "", fmt.Errorf("failed to record mirror fetch: %w", err)
+	}
+	return dir, nil
+}
+
+// invalidateMirror makes the next fetch of the repository update its
+// mirror first, such as after a push to it.
+func (c *Cache) invalidateMirror(host, owner, repo string) {
+	if !c.mirrors(host, owner, repo) {
+		return
+	}
+	os.Remove(filepath.Join(c.mirrorPath(host, owner, repo), mirrorStampFile))
+}
+
+// serveFromMirror serves a git-upload-pack request from the repository's
+// mirror with git upload-pack --stateless-rpc, and reports whether it did.
+// The ref advertisement updates the mirror first; if that fails, the
+// request is left to the upstream. Later requests of the fetch are served
+// from the mirror as advertised.
+func (p *Proxy) serveFromMirror(w http.ResponseWriter, r *http.Request, gr *gitRequest) bool {
+	advertise := gr.Operation == "info/refs"
+
+	var dir string
+	if advertise {
+		var err error
+		dir, err = p.cache.updateMirror(r.Context(), p.forge(gr.Host), p.token(gr), gr.Host, gr.Owner, gr.Repo)
+		if err != nil {
+			return false
+		}
+	} else {
+		dir = p.cache.mirrorPath(gr.Host, gr.Owner, gr.Repo)
+		if _, err := os.Stat(dir); err != nil {
+			return false
+		}
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid gzip body: %v", err), http.StatusBadRequest)
+			return true
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	args := []string{"upload-pack", "--stateless-rpc"}
+	if advertise {
+		args = append(args, "--advertise-refs")
+	}
+	cmd := exec.CommandContext(r.Context(), "git", append(args, dir)...)
+	cmd.Env = os.Environ()
+	if protocol := r.Header.Get("Git-Protocol"); protocol != "" {
+		cmd.Env = append(cmd.Env, "GIT_PROTOCOL="+protocol)
+	}
+	if !advertise {
+		cmd.Stdin = body
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to run git upload-pack: %v", err), http.StatusInternalServerError)
+		return true
+	}
+	if err := cmd.Start(); err != nil {
+		http.Error(w, fmt.Sprintf("failed to run git upload-pack: %v", err), http.StatusInternalServerError)
+		return true
+	}
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.Cache = "mirror"
+	})
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if advertise {
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		// Protocol v2 responses start with the capability advertisement,
+		// older ones with the service announcement.
+		if !strings.Contains(r.Header.Get("Git-Protocol"), "version=2") {
+			writePktLine(w, []byte("# service=git-upload-pack\n"))
+			io.WriteString(w, "0000")
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+	}
+	io.Copy(w, stdout)
+	// The response has started, so a failure can only end it early.
+	cmd.Wait()
+	return true
+}
@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy_Mirror(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+	}{
+		{name: "protocol v0", protocol: "0"},
+		{name: "protocol v2", protocol: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newGitTestUpstream(t)
+			upstreamURL := upstream.URL + "/my-owner/my-repo.git"
+			seed := t.TempDir()
+			runGit(t, seed, "init", "--initial-branch=main")
+			runGit(t, seed, "commit", "--allow-empty", "-m", "initial")
+			runGit(t, seed, "push", "--quiet", upstreamURL, "main")
+
+			cache, err := NewCache(t.TempDir(), []string{"my-owner/*"})
+			require.NoError(t, err)
+			cache.refreshInterval = time.Hour
+			proxy := NewTestProxy(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"},
+				NewGitHubAuthFromToken("test-token"), upstream.URL)
+			proxy.cache = cache
+			var logBuf bytes.Buffer
+			proxy.audit = NewAuditLog(&logBuf, "abc12345")
+			proxyServer := httptest.NewServer(proxy)
+			defer proxyServer.Close()
+			gatewayURL := proxyServer.URL + "/github.com/my-owner/my-repo.git"
+
+			git := func(dir string, args ...string) string {
+				return runGit(t, dir, append([]string{"-c", "protocol.version=" + tt.protocol}, args...)...)
+			}
+
+			// A clone creates the mirror and is served from it.
+			first := t.TempDir()
+			git(first, "clone", "--quiet", gatewayURL, ".")
+			assert.DirExists(t, filepath.Join(cache.dir, "git", "github.com", "my-owner", "my-repo.git"))
+			for _, line := range strings.Split(strings.TrimSpace(logBuf.String()), "\n") {
+				assert.Contains(t, line, `"cache":"mirror"`)
+			}
+
+			// A push through the gateway goes upstream and invalidates the mirror.
+			git(first, "commit", "--allow-empty", "-m", "through the gateway")
+			git(first, "push", "--quiet", "origin", "HEAD:refs/heads/feature")
+			second := t.TempDir()
+			git(second, "clone", "--quiet", gatewayURL, ".")
+			assert.Equal(t, git(first, "rev-parse", "HEAD"), git(second, "rev-parse", "origin/feature"))
+
+			// Pushes elsewhere show up once the mirror is refreshed.
+			initial := git(seed, "rev-parse", "HEAD")
+			git(seed, "commit", "--allow-empty", "-m", "elsewhere")
+			git(seed, "push", "--quiet", upstreamURL, "main")
+			git(second, "fetch", "--quiet", "origin")
+			assert.Equal(t, initial, git(second, "rev-parse", "origin/main"))
+
+			cache.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+			git(second, "fetch", "--quiet", "origin")
+			assert.Equal(t, git(seed, "rev-parse", "HEAD"), git(second, "rev-parse", "origin/main"))
+		})
+	}
+}
+
+func TestProxy_MirrorFallsBackToUpstream(t *testing.T) {
+	upstream := newGitTestUpstream(t)
+	cache, err := NewCache(t.TempDir(), []string{"my-owner/*"})
+	require.NoError(t, err)
+	proxy := NewTestProxy(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"},
+		NewGitHubAuthFromToken("test-token"), upstream.URL)
+	proxy.cache = cache
+
+	// The upstream has no such repository, so the mirror cannot be created
+	// and the upstream's response is passed on.
+	req := httptest.NewRequest("GET", "/github.com/my-owner/missing.git/info/refs?service=git-upload-pack", nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+
+	assert.Equal(t, 404, w.Code)
+	assert.NoDirExists(t, cache.mirrorPath("github.com", "my-owner", "missing"))
+}
@@ -0,0 +1,335 @@
+package gateway
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is the gateway policy file. It is loaded from YAML:
+//
+//	repos:
+//	  write:
+//	    allow: [michael-freling/claude-code-tools, michael-freling/claude-code-tools-docs]
+//	    needs_approval: ["michael-freling/*"]
+//	  read:
+//	    scope: project
+//	    allow: ["michael-freling/*", "golang/*"]
+//	    deny: ["michael-freling/secrets-*"]
+//	refs:
+//	  protected: [main]
+//	  needs_approval: ["release/*"]
+//	  allow_deletions: false
+//	  allow_force_push: false
+//	operations:
+//	  merge-pr: needs-approval
+//	  create-issue: deny
+//	egress:
+//	  allow: [pkg.go.dev, "*.docker.io"]
+type Policy struct {
+	Repos RepoPolicy `yaml:"repos"`
+	Refs  RefPolicy  `yaml:"refs"`
+	// Operations sets the decision for API operations by name. Operations
+	// that are not listed are allowed.
+	Operations map[string]string `yaml:"operations"`
+	// Egress lists further destinations the egress proxy allows, in
+	// addition to DefaultEgressAllow.
+	Egress EgressPolicy `yaml:"egress"`
+}
+
+// Decisions for API operations in the policy's operations section.
+const (
+	OperationAllow         = "allow"
+	OperationDeny          = "deny"
+	OperationNeedsApproval = "needs-approval"
+)
+
+// Read scopes in the policy's repos.read.scope.
+const (
+	// ReadScopeAll makes every repository readable when repos.read.allow
+	// is empty.
+	ReadScopeAll = "all"
+	// ReadScopeProject makes only the project, writable repositories, the
+	// repositories in repos.read.allow, and public repositories readable.
+	ReadScopeProject = "project"
+)
+
+// RepoPolicy controls which repositories can be read from and written to.
+// Patterns are "owner/repo" or "host/owner/repo" globs in path.Match syntax,
+// matched case-insensitively. Patterns without a host match repositories on
+// every host. Deny patterns take precedence over allow patterns.
+type RepoPolicy struct {
+	// Read lists the repositories that can be cloned, fetched, and queried.
+	// When Read.Allow is empty and Read.Scope is not ReadScopeProject,
+	// every repository can be read.
+	Read AccessList `yaml:"read"`
+	// Write lists the repositories that can be pushed to and modified.
+	// Writable repositories are always readable.
+	Write AccessList `yaml:"write"`
+}
+
+// AccessList is a pair of allow and deny glob lists.
+type AccessList struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+	// NeedsApproval lists repositories that are not allowed, but can be
+	// written to when the host user approves each request. Only valid in
+	// the write list.
+	NeedsApproval []string `yaml:"needs_approval"`
+	// Scope is ReadScopeAll (the default) or ReadScopeProject. Only valid
+	// in the read list.
+	Scope string `yaml:"scope"`
+}
+
+// defaultProtectedRefs are protected when the policy doesn't list any.
+var defaultProtectedRefs = []string{"refs/heads/main", "refs/heads/master"}
+
+// RefPolicy controls which ref updates a push may contain. It applies to
+// every writable repository.
+type RefPolicy struct {
+	// Protected lists ref globs that cannot be created, updated, or deleted.
+	// Names without a refs/ prefix are branches. Defaults to main and master.
+	Protected []string `yaml:"protected"`
+	// NeedsApproval lists ref globs that can be pushed to only when the host
+	// user approves the push. It takes precedence over Protected.
+	NeedsApproval []string `yaml:"needs_approval"`
+	// AllowDeletions permits deleting unprotected refs.
+	AllowDeletions bool `yaml:"allow_deletions"`
+	// AllowForcePush permits non-fast-forward updates of unprotected refs.
+	AllowForcePush bool `yaml:"allow_force_push"`
+}
+
+// IsProtected reports whether ref, a full ref name, is protected.
+func (p RefPolicy) IsProtected(ref string) bool {
+	protected := p.Protected
+	if len(protected) == 0 {
+		protected = defaultProtectedRefs
+	}
+	return matchRef(protected, ref)
+}
+
+// RequiresApproval reports whether pushes to ref, a full ref name, need the
+// host user's approval.
+func (p RefPolicy) RequiresApproval(ref string) bool {
+	return matchRef(p.NeedsApproval, ref)
+}
+
+// matchRef reports whether ref matches any of the ref globs. Patterns
+// without a refs/ prefix are branches.
+func matchRef(patterns []string, ref string) bool {
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "refs/") {
+			pattern = "refs/heads/" + pattern
+		}
+		if matched, _ := path.Match(pattern, ref); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadPolicy reads a gateway policy from the YAML file at path.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policy := &Policy{}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// Validate checks that every repository pattern is a valid "owner/repo" or
+// "host/owner/repo" glob, every ref pattern is a valid glob, every operation
+// decision names a declared operation, and every egress pattern is a domain.
+func (p *Policy) Validate() error {
+	if len(p.Repos.Read.NeedsApproval) > 0 {
+		return fmt.Errorf("repos.read.needs_approval is not supported: approvals apply to writes only")
+	}
+	if p.Repos.Write.Scope != "" {
+		return fmt.Errorf("repos.write.scope is not supported: scopes apply to reads only")
+	}
+	switch p.Repos.Read.Scope {
+	case "", ReadScopeAll, ReadScopeProject:
+	default:
+		return fmt.Errorf("repos.read.scope must be %q or %q, got %q", ReadScopeAll, ReadScopeProject, p.Repos.Read.Scope)
+	}
+
+	lists := []struct {
+		name string
+		list []string
+	}{
+		{name: "repos.read.allow", list: p.Repos.Read.Allow},
+		{name: "repos.read.deny", list: p.Repos.Read.Deny},
+		{name: "repos.write.allow", list: p.Repos.Write.Allow},
+		{name: "repos.write.deny", list: p.Repos.Write.Deny},
+		{name: "repos.write.needs_approval", list: p.Repos.Write.NeedsApproval},
+	}
+
+	for _, l := range lists {
+		for _, pattern := range l.list {
+			if strings.Count(pattern, "/") == 0 {
+				return fmt.Errorf("invalid pattern %q in %s: expected owner/repo or host/owner/repo", pattern, l.name)
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q in %s: %w", pattern, l.name, err)
+			}
+		}
+	}
+
+	for _, pattern := range p.Refs.Protected {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q in refs.protected: %w", pattern, err)
+		}
+	}
+	for _, pattern := range p.Refs.NeedsApproval {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q in refs.needs_approval: %w", pattern, err)
+		}
+	}
+
+	for _, pattern := range p.Egress.Allow {
+		if err := ValidateEgressPattern(pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q in egress.allow: %w", pattern, err)
+		}
+	}
+
+	for name, decision := range p.Operations {
+		if findOperation(name) == nil {
+			return fmt.Errorf("unknown operation %q in operations", name)
+		}
+		switch decision {
+		case OperationAllow, OperationDeny, OperationNeedsApproval:
+		default:
+			return fmt.Errorf("operation %q must be %q, %q, or %q, got %q", name, OperationAllow, OperationDeny, OperationNeedsApproval, decision)
+		}
+	}
+
+	return nil
+}
+
+// CanRead reports whether the repository on host can be read. With
+// ReadScopeProject, public repositories are readable too, which the policy
+// cannot tell; see ReadsPublic.
+func (p RepoPolicy) CanRead(host, owner, repo string) bool {
+	if p.CanWrite(host, owner, repo) {
+		return true
+	}
+	if matchRepo(p.Read.Deny, host, owner, repo) {
+		return false
+	}
+	if len(p.Read.Allow) == 0 && p.Read.Scope != ReadScopeProject {
+		return true
+	}
+	return matchRepo(p.Read.Allow, host, owner, repo)
+}
+
+// ReadsAll reports whether every repository can be read, so that reads don't
+// need to be attributed to a repository to be allowed.
+func (p RepoPolicy) ReadsAll() bool {
+	return len(p.Read.Allow) == 0 && len(p.Read.Deny) == 0 && p.Read.Scope != ReadScopeProject
+}
+
+// ReadsPublic reports whether the repository on host can be read if the
+// forge reports it as public.
+func (p RepoPolicy) ReadsPublic(host, owner, repo string) bool {
+	return p.Read.Scope == ReadScopeProject && !matchRepo(p.Read.Deny, host, owner, repo)
+}
+
+// CanWrite reports whether the repository on host can be written to.
+func (p RepoPolicy) CanWrite(host, owner, repo string) bool {
+	if matchRepo(p.Write.Deny, host, owner, repo) {
+		return false
+	}
+	return matchRepo(p.Write.Allow, host, owner, repo)
+}
+
+// NeedsWriteApproval reports whether the repository on host is not writable,
+// but can be written to with the host user's approval.
+func (p RepoPolicy) NeedsWriteApproval(host, owner, repo string) bool {
+	if p.CanWrite(host, owner, repo) || matchRepo(p.Write.Deny, host, owner, repo) {
+		return false
+	}
+	return matchRepo(p.Write.NeedsApproval, host, owner, repo)
+}
+
+// matchRepo reports whether owner/repo on host matches any of the patterns.
+// A pattern matches either owner/repo or host/owner/repo; since * does not
+// match /, the number of segments decides which. The owner of a GitLab
+// project in a nested group spans several segments, such as group/subgroup.
+func matchRepo(patterns []string, host, owner, repo string) bool {
+	name := strings.ToLower(owner + "/" + repo)
+	qualified := strings.ToLower(host) + "/" + name
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, qualified); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// repoPolicy returns the repository policy enforced by the gateway: the
+// policy file's, with the project repository on the project host added to
+// the writable list, and ReadRepos to a restricted readable list.
+func (c ProxyConfig) repoPolicy() RepoPolicy {
+	var policy RepoPolicy
+	if c.Policy != nil {
+		policy = c.Policy.Repos
+	}
+
+	if len(c.ReadRepos) > 0 && (len(policy.Read.Allow) > 0 || policy.Read.Scope == ReadScopeProject) {
+		allow := make([]string, 0, len(policy.Read.Allow)+len(c.ReadRepos))
+		allow = append(allow, policy.Read.Allow...)
+		for _, name := range c.ReadRepos {
+			allow = append(allow, escapeGlob(name))
+		}
+		policy.Read.Allow = allow
+	}
+
+	if c.AllowedOwner != "" && c.AllowedRepo != "" {
+		allow := make([]string, 0, len(policy.Write.Allow)+1)
+		allow = append(allow, policy.Write.Allow...)
+		// Escape glob metacharacters so the project name is matched literally.
+		policy.Write.Allow = append(allow, escapeGlob(c.host())+"/"+escapeGlob(c.AllowedOwner)+"/"+escapeGlob(c.AllowedRepo))
+	}
+
+	return policy
+}
+
+// escapeGlob escapes path.Match metacharacters in s.
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(s)
+}
+
+// refPolicy returns the ref policy enforced on pushes.
+func (c ProxyConfig) refPolicy() RefPolicy {
+	if c.Policy == nil {
+		return RefPolicy{}
+	}
+	return c.Policy.Refs
+}
+
+// operationDecision returns the policy decision for the named API operation.
+func (c ProxyConfig) operationDecision(name string) string {
+	if c.Policy != nil {
+		if decision, ok := c.Policy.Operations[name]; ok {
+			return decision
+		}
+	}
+	return OperationAllow
+}
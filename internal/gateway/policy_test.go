@@ -0,0 +1,377 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Policy
+		wantErr string
+	}{
+		{
+			name: "read and write lists",
+			content: `
+repos:
+  write:
+    allow: [my-owner/my-repo, my-owner/my-docs]
+  read:
+    allow: ["my-owner/*"]
+    deny: ["my-owner/secret-*"]
+`,
+			want: &Policy{
+				Repos: RepoPolicy{
+					Write: AccessList{Allow: []string{"my-owner/my-repo", "my-owner/my-docs"}},
+					Read:  AccessList{Allow: []string{"my-owner/*"}, Deny: []string{"my-owner/secret-*"}},
+				},
+			},
+		},
+		{
+			name:    "host-qualified patterns",
+			content: "repos:\n  read:\n    allow: [\"github.example.corp/team/*\", \"golang/*\"]\n",
+			want: &Policy{
+				Repos: RepoPolicy{
+					Read: AccessList{Allow: []string{"github.example.corp/team/*", "golang/*"}},
+				},
+			},
+		},
+		{
+			name:    "pattern without owner",
+			content: "repos:\n  write:\n    allow: [my-repo]\n",
+			wantErr: `invalid pattern "my-repo" in repos.write.allow: expected owner/repo or host/owner/repo`,
+		},
+		{
+			name:    "GitLab nested group patterns",
+			content: "repos:\n  read:\n    allow: [gitlab.com/group/subgroup/*]\n",
+			want: &Policy{
+				Repos: RepoPolicy{
+					Read: AccessList{Allow: []string{"gitlab.com/group/subgroup/*"}},
+				},
+			},
+		},
+		{
+			name:    "malformed glob",
+			content: "repos:\n  read:\n    deny: [\"my-owner/[\"]\n",
+			wantErr: `invalid pattern "my-owner/[" in repos.read.deny`,
+		},
+		{
+			name:    "unknown operation",
+			content: "operations:\n  delete-repo: deny\n",
+			wantErr: `unknown operation "delete-repo" in operations`,
+		},
+		{
+			name:    "invalid operation decision",
+			content: "operations:\n  merge-pr: maybe\n",
+			wantErr: `operation "merge-pr" must be "allow", "deny", or "needs-approval", got "maybe"`,
+		},
+		{
+			name:    "egress allow list",
+			content: "egress:\n  allow: [pkg.go.dev, \"*.docker.io\"]\n",
+			want: &Policy{
+				Egress: EgressPolicy{Allow: []string{"pkg.go.dev", "*.docker.io"}},
+			},
+		},
+		{
+			name:    "invalid egress pattern",
+			content: "egress:\n  allow: [\"https://pkg.go.dev\"]\n",
+			wantErr: `invalid pattern "https://pkg.go.dev" in egress.allow`,
+		},
+		{
+			name:    "needs approval lists",
+			content: "repos:\n  write:\n    needs_approval: [\"my-owner/*\"]\nrefs:\n  needs_approval: [\"release/*\"]\n",
+			want: &Policy{
+				Repos: RepoPolicy{Write: AccessList{NeedsApproval: []string{"my-owner/*"}}},
+				Refs:  RefPolicy{NeedsApproval: []string{"release/*"}},
+			},
+		},
+		{
+			name:    "project read scope",
+			content: "repos:\n  read:\n    scope: project\n    allow: [\"golang/*\"]\n",
+			want: &Policy{
+				Repos: RepoPolicy{Read: AccessList{Scope: ReadScopeProject, Allow: []string{"golang/*"}}},
+			},
+		},
+		{
+			name:    "invalid read scope",
+			content: "repos:\n  read:\n    scope: org\n",
+			wantErr: `repos.read.scope must be "all" or "project", got "org"`,
+		},
+		{
+			name:    "scope for writes",
+			content: "repos:\n  write:\n    scope: project\n",
+			wantErr: "repos.write.scope is not supported: scopes apply to reads only",
+		},
+		{
+			name:    "needs approval for reads",
+			content: "repos:\n  read:\n    needs_approval: [\"my-owner/*\"]\n",
+			wantErr: "repos.read.needs_approval is not supported: approvals apply to writes only",
+		},
+		{
+			name:    "invalid repo pattern needing approval",
+			content: "repos:\n  write:\n    needs_approval: [my-repo]\n",
+			wantErr: `invalid pattern "my-repo" in repos.write.needs_approval`,
+		},
+		{
+			name:    "invalid ref pattern needing approval",
+			content: "refs:\n  needs_approval: [\"release/[\"]\n",
+			wantErr: `invalid pattern "release/[" in refs.needs_approval`,
+		},
+		{
+			name:    "invalid YAML",
+			content: "repos: [",
+			wantErr: "failed to parse policy file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "gateway-policy.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+
+			got, err := LoadPolicy(path)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadPolicy_FileNotExist(t *testing.T) {
+	_, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.yaml"))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read policy file")
+}
+
+func TestProxyConfig_RepoPolicy(t *testing.T) {
+	config := ProxyConfig{
+		AllowedOwner: "my-owner",
+		AllowedRepo:  "my-repo",
+		Policy: &Policy{
+			Repos: RepoPolicy{
+				Write: AccessList{
+					Allow:         []string{"my-owner/docs-*"},
+					Deny:          []string{"my-owner/docs-archive"},
+					NeedsApproval: []string{"my-owner/*"},
+				},
+				Read: AccessList{
+					Allow: []string{"my-owner/*", "golang/*", "github.example.corp/team/*", "gitlab.com/group/subgroup/*"},
+					Deny:  []string{"my-owner/secret-*"},
+				},
+			},
+		},
+	}
+	policy := config.repoPolicy()
+
+	tests := []struct {
+		name         string
+		host         string
+		owner        string
+		repo         string
+		wantRead     bool
+		wantWrite    bool
+		wantApproval bool
+	}{
+		{name: "project repo", owner: "my-owner", repo: "my-repo", wantRead: true, wantWrite: true},
+		{name: "project repo is case-insensitive", host: "GitHub.com", owner: "My-Owner", repo: "My-Repo", wantRead: true, wantWrite: true},
+		{name: "project repo on another host is not writable", host: "github.example.corp", owner: "my-owner", repo: "my-repo", wantRead: true, wantApproval: true},
+		{name: "writable glob", owner: "my-owner", repo: "docs-site", wantRead: true, wantWrite: true},
+		{name: "write deny wins over allow", owner: "my-owner", repo: "docs-archive", wantRead: true},
+		{name: "readable org", owner: "my-owner", repo: "tools", wantRead: true, wantApproval: true},
+		{name: "read deny", owner: "my-owner", repo: "secret-keys", wantApproval: true},
+		{name: "second readable org", owner: "golang", repo: "go", wantRead: true},
+		{name: "org outside read allow list", owner: "other-org", repo: "private"},
+		{name: "host-qualified pattern", host: "github.example.corp", owner: "team", repo: "lib", wantRead: true},
+		{name: "host-qualified pattern on another host", owner: "team", repo: "lib"},
+		{name: "nested group", host: "gitlab.com", owner: "group/subgroup", repo: "lib", wantRead: true},
+		{name: "parent of nested group", host: "gitlab.com", owner: "group", repo: "lib"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := tt.host
+			if host == "" {
+				host = "github.com"
+			}
+			assert.Equal(t, tt.wantRead, policy.CanRead(host, tt.owner, tt.repo))
+			assert.Equal(t, tt.wantWrite, policy.CanWrite(host, tt.owner, tt.repo))
+			assert.Equal(t, tt.wantApproval, policy.NeedsWriteApproval(host, tt.owner, tt.repo))
+		})
+	}
+}
+
+func TestProxyConfig_RepoPolicy_Defaults(t *testing.T) {
+	policy := ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my[repo]"}.repoPolicy()
+
+	assert.True(t, policy.CanRead("github.com", "any-owner", "any-repo"))
+	assert.False(t, policy.CanWrite("github.com", "any-owner", "any-repo"))
+	// The project name is matched literally, not as a glob.
+	assert.True(t, policy.CanWrite("github.com", "my-owner", "my[repo]"))
+	assert.False(t, policy.CanWrite("github.com", "my-owner", "myr"))
+}
+
+func TestProxyConfig_RepoPolicy_ReadScope(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         ProxyConfig
+		owner          string
+		repo           string
+		wantRead       bool
+		wantReadPublic bool
+	}{
+		{
+			name:     "read repos are ignored when every repository is readable",
+			config:   ProxyConfig{ReadRepos: []string{"github.com/my-owner/lib"}},
+			owner:    "other-owner",
+			repo:     "tools",
+			wantRead: true,
+		},
+		{
+			name: "read repos extend a restricted allow list",
+			config: ProxyConfig{
+				ReadRepos: []string{"github.com/my-owner/lib"},
+				Policy:    &Policy{Repos: RepoPolicy{Read: AccessList{Allow: []string{"golang/*"}}}},
+			},
+			owner:    "my-owner",
+			repo:     "lib",
+			wantRead: true,
+		},
+		{
+			name:   "read repos are matched literally",
+			config: ProxyConfig{ReadRepos: []string{"github.com/my-owner/l*"}, Policy: &Policy{Repos: RepoPolicy{Read: AccessList{Scope: ReadScopeProject}}}},
+			owner:  "my-owner",
+			repo:   "lib",
+			// Not in the policy, but may be public.
+			wantReadPublic: true,
+		},
+		{
+			name:     "project scope reads the project",
+			config:   ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo", Policy: &Policy{Repos: RepoPolicy{Read: AccessList{Scope: ReadScopeProject}}}},
+			owner:    "my-owner",
+			repo:     "my-repo",
+			wantRead: true,
+			// Readable anyway.
+			wantReadPublic: true,
+		},
+		{
+			name: "project scope does not read public denied repos",
+			config: ProxyConfig{Policy: &Policy{Repos: RepoPolicy{Read: AccessList{
+				Scope: ReadScopeProject,
+				Deny:  []string{"other-owner/*"},
+			}}}},
+			owner: "other-owner",
+			repo:  "tools",
+		},
+		{
+			name:   "all scope does not check visibility",
+			config: ProxyConfig{Policy: &Policy{Repos: RepoPolicy{Read: AccessList{Allow: []string{"golang/*"}}}}},
+			owner:  "other-owner",
+			repo:   "tools",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.config.repoPolicy()
+			assert.Equal(t, tt.wantRead, policy.CanRead("github.com", tt.owner, tt.repo))
+			assert.Equal(t, tt.wantReadPublic, policy.ReadsPublic("github.com", tt.owner, tt.repo))
+		})
+	}
+}
+
+func TestPolicy_AppliedToProxyAndAPIServer(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	config := ProxyConfig{
+		AllowedOwner: "my-owner",
+		AllowedRepo:  "my-repo",
+		Policy: &Policy{
+			Repos: RepoPolicy{
+				Write: AccessList{Allow: []string{"my-owner/my-docs"}},
+				Read:  AccessList{Deny: []string{"other-org/*"}},
+			},
+		},
+	}
+	proxy := NewTestProxy(config, NewGitHubAuthFromToken("test-token"), upstream.URL)
+	apiServer := NewTestAPIServer(config, NewGitHubAuthFromToken("test-token"), upstream.URL)
+
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{
+			name:       "push to second writable repo",
+			handler:    proxy,
+			method:     http.MethodPost,
+			path:       "/github.com/my-owner/my-docs.git/git-receive-pack",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "clone from denied org",
+			handler:    proxy,
+			method:     http.MethodGet,
+			path:       "/github.com/other-org/private.git/info/refs?service=git-upload-pack",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "fetch pack from denied org",
+			handler:    proxy,
+			method:     http.MethodPost,
+			path:       "/github.com/other-org/private.git/git-upload-pack",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "create PR in second writable repo",
+			handler:    apiServer,
+			method:     http.MethodPost,
+			path:       "/api/github/repos/my-owner/my-docs/pulls",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "read issues from denied org",
+			handler:    apiServer,
+			method:     http.MethodGet,
+			path:       "/api/github/repos/other-org/private/issues",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "route outside the operations list",
+			handler:    apiServer,
+			method:     http.MethodGet,
+			path:       "/api/github/user",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			tt.handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
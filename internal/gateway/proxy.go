@@ -1,160 +1,304 @@
 package gateway
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
+	"os/exec"
+	"path"
 	"strings"
 )
 
 // ProxyConfig holds configuration for the gateway proxy.
+// AllowedOwner/AllowedRepo on Host is the project repository, which is always
+// writable. Policy, when set, grants access to further repositories and
+// restricts which repositories can be read.
 type ProxyConfig struct {
+	// Host is the forge host of the project repository, such as github.com
+	// or a GitHub Enterprise Server host. API requests go to this host.
+	// Defaults to DefaultHost.
+	Host         string
 	AllowedOwner string
 	AllowedRepo  string
+	// ExtraHosts are further forge hosts that git requests can be proxied
+	// to, such as github.com for dependencies of a GitHub Enterprise
+	// Server project.
+	ExtraHosts []string
+	// Forges selects the forge of hosts, keyed by host. Hosts not listed
+	// use DefaultForgeKind at https://{host}.
+	Forges map[string]ForgeConfig
+	// ReadRepos are further repositories, as host/owner/repo, readable
+	// when the policy restricts reads, such as the project's submodules.
+	ReadRepos []string
+	Policy    *Policy
+	// MaxPushSize bounds the size of a push, in bytes, that the gateway
+	// buffers while inspecting it. Defaults to DefaultMaxPushSize.
+	MaxPushSize int64
 }
 
 // defaultGitHubBaseURL is the default upstream base URL for git operations.
 const defaultGitHubBaseURL = "https://github.com"
 
-// Proxy is an HTTP reverse proxy that forwards git operations to github.com.
-// The agent's gitconfig rewrites github.com URLs to go through this proxy:
+// Proxy is an HTTP reverse proxy that forwards git operations to the
+// configured forge hosts. Requests arrive as
+// /{host}/{owner}/{repo}.git/{operation}, either on the proxy port, which
+// the agent's gitconfig uses for hosts other than the project's:
 //
-//	[url "http://gateway:8080/github.com/"]
+//	[url "https://gateway:8080/github.com/"]
 //	    insteadOf = https://github.com/
 //
-// This means requests arrive as plain HTTP: /github.com/{owner}/{repo}.git/{operation}
+// or through the HTTPS endpoint, which the agent's gitconfig uses for the
+// project host and which adds the /{host} prefix (see enterpriseHandler):
+//
+//	[url "https://gateway/"]
+//	    insteadOf = https://github.example.corp/
 type Proxy struct {
-	config      ProxyConfig
-	ghAuth      *GitHubAuth
-	upstreamURL string // base URL for upstream git server, defaults to https://github.com
-	httpClient  *http.Client
+	config     ProxyConfig
+	ghAuth     *GitHubAuth
+	forges     map[string]forge // forges of the project host and ExtraHosts, keyed by lower-case host
+	httpClient *http.Client
+	audit      *AuditLog
+	approvals  *ApprovalQueue
+	visibility *visibilityCache
+	cache      *Cache
+	lfs        *lfsTransfers
+	// sshCommand returns the command that runs a git service on the
+	// upstream for git over SSH.
+	sshCommand func(ctx context.Context, gr *gitRequest, service, gitProtocol string) *exec.Cmd
 }
 
 // NewProxy creates a new git proxy with the given config and auth.
 func NewProxy(config ProxyConfig, ghAuth *GitHubAuth) *Proxy {
+	forges := make(map[string]forge, len(config.ExtraHosts)+1)
+	for _, host := range config.hosts() {
+		forges[strings.ToLower(host)] = newForge(host, config.forgeConfig(host))
+	}
+
 	return &Proxy{
-		config:      config,
-		ghAuth:      ghAuth,
-		upstreamURL: defaultGitHubBaseURL,
-		httpClient:  http.DefaultClient,
+		config:     config,
+		ghAuth:     ghAuth,
+		forges:     forges,
+		httpClient: http.DefaultClient,
+		visibility: newVisibilityCache(),
+		lfs:        newLFSTransfers(),
+		sshCommand: upstreamSSHCommand,
+	}
+}
+
+// forge returns the forge of host. Hosts that are not configured are
+// treated as GitHub hosts, which is only used to parse their paths.
+func (p *Proxy) forge(host string) forge {
+	if f, ok := p.forges[strings.ToLower(host)]; ok {
+		return f
+	}
+	return newForge(host, ForgeConfig{Kind: ForgeGitHub})
+}
+
+// token returns the token for the request's forge host.
+func (p *Proxy) token(gr *gitRequest) string {
+	if p.config.isProjectHost(gr.Host) {
+		return p.ghAuth.Token()
 	}
+	return p.ghAuth.TokenForHost(gr.Host)
 }
 
 // gitRequest represents a parsed git HTTP request.
 type gitRequest struct {
+	Host      string
 	Owner     string
 	Repo      string
 	Operation string
 	Service   string // query param service value for info/refs
 }
 
-// ServeHTTP handles requests matching /github.com/{owner}/{repo}.git/{operation}.
+// lfsService is the audited service of Git LFS requests.
+const lfsService = "git-lfs"
+
+// ServeHTTP handles requests matching /{host}/{owner}/{repo}.git/{operation}.
 // It enforces access control:
-//   - Read operations (git-upload-pack) are allowed for any repo
-//   - Write operations (git-receive-pack) are allowed only for the configured project
+//   - The host must be the project host or one of ExtraHosts
+//   - Read operations (git-upload-pack) are allowed for repos the policy lets you read,
+//     and for public repos when the policy's read scope is the project
+//   - Write operations (git-receive-pack) are allowed for the project and repos the policy lets you write,
+//     and each pushed ref update must satisfy the ref policy
+//   - Git LFS downloads and uploads follow the same read and write rules (see handleLFS)
 //   - All other requests are denied
+//
+// Every request is recorded in the audit log, if one is set.
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	gr, err := parseGitRequest(r)
+	p.audit.serve(w, r, "git", p.handle)
+}
+
+// handle serves a git request.
+func (p *Proxy) handle(w http.ResponseWriter, r *http.Request) {
+	gr, err := p.parseGitRequest(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	if !p.isAllowed(gr, r.Method) {
-		http.Error(w, "forbidden: write access denied for this repository", http.StatusForbidden)
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.Host = gr.Host
+		entry.Owner = gr.Owner
+		entry.Repo = gr.Repo
+		entry.Service = gr.service()
+	})
+
+	if !p.config.hasHost(gr.Host) {
+		http.Error(w, fmt.Sprintf("forbidden: host %s is not configured in the gateway", gr.Host), http.StatusForbidden)
 		return
 	}
 
-	p.forwardToGitHub(w, r, gr)
-}
+	if isLFSOperation(gr.Operation) {
+		p.handleLFS(w, r, gr)
+		return
+	}
 
-// parseGitRequest extracts owner, repo, and operation from the request path.
-// Expected path format: /github.com/{owner}/{repo}.git/{operation...}
-func parseGitRequest(r *http.Request) (*gitRequest, error) {
-	path := strings.TrimPrefix(r.URL.Path, "/github.com/")
-	if path == r.URL.Path {
-		return nil, fmt.Errorf("path must start with /github.com/")
+	allowed, err := p.isAllowed(r.Context(), gr, r.Method)
+	if err != nil {
+		http.Error(w, redact(fmt.Sprintf("forbidden: failed to check repository visibility: %v", err), p.token(gr)), http.StatusForbidden)
+		return
+	}
+	if !allowed {
+		http.Error(w, "forbidden: access denied for this repository", http.StatusForbidden)
+		return
 	}
 
-	parts := strings.SplitN(path, "/", 3)
-	if len(parts) < 2 {
-		return nil, fmt.Errorf("invalid path: expected /github.com/{owner}/{repo}.git/{operation}")
+	if gr.Operation == "git-receive-pack" && r.Method == http.MethodPost {
+		p.handleReceivePack(w, r, gr)
+		return
 	}
 
-	owner := parts[0]
-	repoRaw := parts[1]
+	if gr.service() == "git-upload-pack" && p.cache.mirrors(gr.Host, gr.Owner, gr.Repo) && p.serveFromMirror(w, r, gr) {
+		return
+	}
 
-	// The repo part may or may not end with ".git"; strip the suffix.
-	repo := strings.TrimSuffix(repoRaw, ".git")
+	p.forwardToGitHub(w, r, gr)
+}
 
-	// The third part (if present) is the git operation path.
-	operation := ""
-	if len(parts) == 3 {
-		operation = parts[2]
+// service returns the git service the request is for.
+func (gr *gitRequest) service() string {
+	if gr.Service != "" {
+		return gr.Service
 	}
-
-	if owner == "" || repo == "" {
-		return nil, fmt.Errorf("invalid path: owner and repo must not be empty")
+	if isLFSOperation(gr.Operation) {
+		return lfsService
 	}
+	return path.Base(gr.Operation)
+}
 
-	gr := &gitRequest{
-		Owner:     owner,
-		Repo:      repo,
-		Operation: operation,
+// parseGitRequest extracts host, owner, repo, and operation from the request path.
+func (p *Proxy) parseGitRequest(r *http.Request) (*gitRequest, error) {
+	gr, err := p.parseGitPath(r.URL.Path)
+	if err != nil {
+		return nil, err
 	}
 
 	// Extract service query param for info/refs
-	if strings.HasSuffix(operation, "info/refs") {
+	if gr.Operation == "info/refs" {
 		gr.Service = r.URL.Query().Get("service")
 	}
 
 	return gr, nil
 }
 
-// isAllowed checks whether the request is permitted based on the operation type.
-func (p *Proxy) isAllowed(gr *gitRequest, method string) bool {
+// parseGitPath extracts host, owner, repo, and operation from a path of the
+// format /{host}/{owner}/{repo}.git/{operation...}, where the host's forge
+// decides how the repository path splits into owner and repo. Paths with
+// empty, . or .. segments are rejected: the policy checks the owner and
+// repo parsed here, so the upstream must not resolve the path to another
+// repository.
+func (p *Proxy) parseGitPath(urlPath string) (*gitRequest, error) {
+	host, repoPath, found := strings.Cut(strings.TrimPrefix(urlPath, "/"), "/")
+	if !found {
+		return nil, fmt.Errorf("invalid path: expected /{host}/{owner}/{repo}.git/{operation}")
+	}
+
+	owner, repo, operation, err := p.forge(host).splitRepoPath(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if host == "" || owner == "" || repo == "" {
+		return nil, fmt.Errorf("invalid path: host, owner, and repo must not be empty")
+	}
+	segments := strings.Split(host+"/"+owner+"/"+repo, "/")
+	if operation != "" {
+		segments = append(segments, strings.Split(operation, "/")...)
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("invalid path: segments must not be empty, . or ..")
+		}
+	}
+
+	return &gitRequest{
+		Host:      host,
+		Owner:     owner,
+		Repo:      repo,
+		Operation: operation,
+	}, nil
+}
+
+// isAllowed checks whether the request is permitted based on the operation,
+// which must be one of the smart HTTP operations. It returns an error if
+// the visibility of the repository is needed but cannot be checked.
+func (p *Proxy) isAllowed(ctx context.Context, gr *gitRequest, method string) (bool, error) {
 	op := gr.Operation
+	policy := p.config.repoPolicy()
 
 	// info/refs endpoint
-	if strings.HasSuffix(op, "info/refs") {
+	if op == "info/refs" {
 		switch gr.Service {
 		case "git-upload-pack":
-			// Read: allowed for any repo
-			return true
+			// Read: allowed for readable repos
+			return p.canRead(ctx, gr)
 		case "git-receive-pack":
-			// Write: only allowed for the configured project
-			return p.isProjectRepo(gr)
+			// Write: only allowed for writable repos, or ones writable
+			// with approval, which is asked for when the push arrives
+			return policy.CanWrite(gr.Host, gr.Owner, gr.Repo) || policy.NeedsWriteApproval(gr.Host, gr.Owner, gr.Repo), nil
 		default:
 			// Unknown service
-			return false
+			return false, nil
 		}
 	}
 
-	// git-upload-pack POST: read operation, allowed for any repo
-	if strings.HasSuffix(op, "git-upload-pack") && method == http.MethodPost {
-		return true
+	// git-upload-pack POST: read operation, allowed for readable repos
+	if op == "git-upload-pack" && method == http.MethodPost {
+		return p.canRead(ctx, gr)
 	}
 
-	// git-receive-pack POST: write operation, only allowed for project repo
-	if strings.HasSuffix(op, "git-receive-pack") && method == http.MethodPost {
-		return p.isProjectRepo(gr)
+	// git-receive-pack POST: write operation, only allowed for writable repos
+	// or ones writable with approval
+	if op == "git-receive-pack" && method == http.MethodPost {
+		return policy.CanWrite(gr.Host, gr.Owner, gr.Repo) || policy.NeedsWriteApproval(gr.Host, gr.Owner, gr.Repo), nil
 	}
 
 	// Everything else is denied
-	return false
+	return false, nil
 }
 
-// isProjectRepo checks if the request targets the allowed project repository.
-func (p *Proxy) isProjectRepo(gr *gitRequest) bool {
-	return strings.EqualFold(gr.Owner, p.config.AllowedOwner) &&
-		strings.EqualFold(gr.Repo, p.config.AllowedRepo)
+// canRead reports whether the repository of gr can be read: the policy
+// allows it, or the policy allows public repositories and the forge reports
+// it as public.
+func (p *Proxy) canRead(ctx context.Context, gr *gitRequest) (bool, error) {
+	policy := p.config.repoPolicy()
+	if policy.CanRead(gr.Host, gr.Owner, gr.Repo) {
+		return true, nil
+	}
+	if !policy.ReadsPublic(gr.Host, gr.Owner, gr.Repo) {
+		return false, nil
+	}
+	return p.visibility.isPublic(ctx, p.httpClient, p.forge(gr.Host), p.token(gr), gr.Host, gr.Owner, gr.Repo)
 }
 
-// forwardToGitHub forwards the request to the actual GitHub server.
+// forwardToGitHub forwards the request to the request's forge host.
 func (p *Proxy) forwardToGitHub(w http.ResponseWriter, r *http.Request, gr *gitRequest) {
-	// Build the upstream GitHub URL
-	targetURL := fmt.Sprintf("%s/%s/%s.git/%s", p.upstreamURL, gr.Owner, gr.Repo, gr.Operation)
+	f := p.forge(gr.Host)
+
+	// Build the upstream URL
+	targetURL := fmt.Sprintf("%s/%s/%s.git/%s", f.gitURL(), gr.Owner, gr.Repo, gr.Operation)
 	if r.URL.RawQuery != "" {
 		targetURL += "?" + r.URL.RawQuery
 	}
@@ -165,31 +309,31 @@ func (p *Proxy) forwardToGitHub(w http.ResponseWriter, r *http.Request, gr *gitR
 		http.Error(w, fmt.Sprintf("failed to create upstream request: %v", err), http.StatusInternalServerError)
 		return
 	}
+	upstreamReq.ContentLength = r.ContentLength
 
-	// Copy relevant headers
-	for key, values := range r.Header {
-		for _, value := range values {
-			upstreamReq.Header.Add(key, value)
-		}
-	}
+	// Copy the headers, except the client's credentials
+	copyRequestHeader(upstreamReq.Header, r.Header)
 
-	// Add GitHub authentication
-	upstreamReq.Header.Set("Authorization", "Basic "+basicAuth("x-access-token", p.ghAuth.Token()))
+	// Add authentication for the host. Without a token, only public
+	// repositories can be fetched.
+	token := p.token(gr)
+	if token != "" {
+		f.authorizeGit(upstreamReq, token)
+	}
 
 	// Execute the upstream request
 	resp, err := p.httpClient.Do(upstreamReq)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to contact GitHub: %v", err), http.StatusBadGateway)
+		http.Error(w, redact(fmt.Sprintf("failed to contact %s: %v", gr.Host, err), token), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.UpstreamStatus = resp.StatusCode
+	})
 
-	// Copy the response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
+	// Copy the response headers, except those about the credentials
+	copyResponseHeader(w.Header(), resp.Header)
 	w.WriteHeader(resp.StatusCode)
 
 	// Copy the response body
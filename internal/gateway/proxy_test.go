@@ -4,6 +4,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -59,6 +61,88 @@ func TestProxy_ServeHTTP_ReadFromAnyRepo(t *testing.T) {
 	}
 }
 
+// newReadScopeUpstream serves git requests and reports the repositories
+// named public-* as public. Repositories named missing-* are not found.
+func newReadScopeUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/{owner}/{repo}", func(w http.ResponseWriter, r *http.Request) {
+		repo := r.PathValue("repo")
+		switch {
+		case strings.HasPrefix(repo, "missing-"):
+			http.NotFound(w, r)
+		case strings.HasPrefix(repo, "public-"):
+			w.Write([]byte(`{"private":false,"visibility":"public"}`))
+		default:
+			w.Write([]byte(`{"private":true,"visibility":"private"}`))
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readScopeConfig restricts reads to the project, its lib submodule, the
+// golang organization, and public repositories other than public-secret.
+var readScopeConfig = ProxyConfig{
+	AllowedOwner: "my-owner",
+	AllowedRepo:  "my-repo",
+	ReadRepos:    []string{"github.com/my-owner/lib"},
+	Policy: &Policy{
+		Repos: RepoPolicy{
+			Read: AccessList{
+				Scope: ReadScopeProject,
+				Allow: []string{"golang/*"},
+				Deny:  []string{"other-owner/public-secret"},
+			},
+		},
+	},
+}
+
+func TestProxy_ServeHTTP_ReadScope(t *testing.T) {
+	upstream := newReadScopeUpstream(t)
+	proxy := NewTestProxy(readScopeConfig, NewGitHubAuthFromToken("test-token"), upstream.URL)
+
+	tests := []struct {
+		name       string
+		repo       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "project repo", repo: "my-owner/my-repo", wantStatus: http.StatusOK},
+		{name: "submodule", repo: "my-owner/lib", wantStatus: http.StatusOK},
+		{name: "declared dependency", repo: "golang/go", wantStatus: http.StatusOK},
+		{name: "public repo", repo: "other-owner/public-tools", wantStatus: http.StatusOK},
+		{name: "private repo", repo: "my-owner/private-tools", wantStatus: http.StatusForbidden, wantBody: "access denied for this repository"},
+		{name: "denied public repo", repo: "other-owner/public-secret", wantStatus: http.StatusForbidden, wantBody: "access denied for this repository"},
+		{
+			name:       "repo the token cannot see",
+			repo:       "other-owner/missing-repo",
+			wantStatus: http.StatusForbidden,
+			wantBody:   "failed to check repository visibility: repository other-owner/missing-repo returned 404 Not Found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, req := range []*http.Request{
+				httptest.NewRequest(http.MethodGet, "/github.com/"+tt.repo+".git/info/refs?service=git-upload-pack", nil),
+				httptest.NewRequest(http.MethodPost, "/github.com/"+tt.repo+".git/git-upload-pack", nil),
+			} {
+				w := httptest.NewRecorder()
+
+				proxy.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.wantStatus, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
 func TestProxy_ServeHTTP_PushToProjectRepoAllowed(t *testing.T) {
 	ghServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -188,14 +272,14 @@ func TestProxy_ServeHTTP_InvalidPath(t *testing.T) {
 		name string
 		path string
 	}{
-		{
-			name: "no github.com prefix",
-			path: "/example.com/owner/repo.git/info/refs",
-		},
 		{
 			name: "missing repo",
 			path: "/github.com/owner",
 		},
+		{
+			name: "missing host",
+			path: "/owner/repo.git",
+		},
 	}
 
 	for _, tt := range tests {
@@ -311,7 +395,7 @@ func TestProxy_ServeHTTP_UpstreamError(t *testing.T) {
 		ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"},
 		NewGitHubAuthFromToken("test-token"),
 	)
-	proxy.upstreamURL = "http://127.0.0.1:1" // port that should refuse connections
+	proxy.forges["github.com"] = &githubForge{git: "http://127.0.0.1:1"} // port that should refuse connections
 
 	req := httptest.NewRequest(http.MethodGet, "/github.com/my-owner/my-repo.git/info/refs?service=git-upload-pack", nil)
 	w := httptest.NewRecorder()
@@ -319,7 +403,7 @@ func TestProxy_ServeHTTP_UpstreamError(t *testing.T) {
 	proxy.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusBadGateway, w.Code)
-	assert.Contains(t, w.Body.String(), "failed to contact GitHub")
+	assert.Contains(t, w.Body.String(), "failed to contact github.com")
 }
 
 func TestProxy_ServeHTTP_UpstreamPath(t *testing.T) {
@@ -346,6 +430,7 @@ func TestParseGitRequest(t *testing.T) {
 		name      string
 		path      string
 		query     string
+		wantHost  string
 		wantOwner string
 		wantRepo  string
 		wantOp    string
@@ -356,6 +441,7 @@ func TestParseGitRequest(t *testing.T) {
 			name:      "info/refs with service",
 			path:      "/github.com/owner/repo.git/info/refs",
 			query:     "service=git-upload-pack",
+			wantHost:  "github.com",
 			wantOwner: "owner",
 			wantRepo:  "repo",
 			wantOp:    "info/refs",
@@ -364,6 +450,7 @@ func TestParseGitRequest(t *testing.T) {
 		{
 			name:      "git-upload-pack",
 			path:      "/github.com/owner/repo.git/git-upload-pack",
+			wantHost:  "github.com",
 			wantOwner: "owner",
 			wantRepo:  "repo",
 			wantOp:    "git-upload-pack",
@@ -371,13 +458,40 @@ func TestParseGitRequest(t *testing.T) {
 		{
 			name:      "git-receive-pack",
 			path:      "/github.com/owner/repo.git/git-receive-pack",
+			wantHost:  "github.com",
+			wantOwner: "owner",
+			wantRepo:  "repo",
+			wantOp:    "git-receive-pack",
+		},
+		{
+			name:      "enterprise host",
+			path:      "/github.example.corp/owner/repo.git/git-upload-pack",
+			wantHost:  "github.example.corp",
 			wantOwner: "owner",
 			wantRepo:  "repo",
+			wantOp:    "git-upload-pack",
+		},
+		{
+			name:      "GitLab nested group",
+			path:      "/gitlab.com/group/subgroup/repo.git/info/refs",
+			query:     "service=git-upload-pack",
+			wantHost:  "gitlab.com",
+			wantOwner: "group/subgroup",
+			wantRepo:  "repo",
+			wantOp:    "info/refs",
+			wantSvc:   "git-upload-pack",
+		},
+		{
+			name:      "GitLab nested group without .git suffix",
+			path:      "/gitlab.com/group/subgroup/repo/git-receive-pack",
+			wantHost:  "gitlab.com",
+			wantOwner: "group/subgroup",
+			wantRepo:  "repo",
 			wantOp:    "git-receive-pack",
 		},
 		{
-			name:    "invalid prefix",
-			path:    "/example.com/owner/repo.git/info/refs",
+			name:    "missing host",
+			path:    "/owner/repo.git",
 			wantErr: true,
 		},
 		{
@@ -395,7 +509,8 @@ func TestParseGitRequest(t *testing.T) {
 			}
 			r := httptest.NewRequest(http.MethodGet, url, nil)
 
-			gr, err := parseGitRequest(r)
+			proxy := NewProxy(ProxyConfig{ExtraHosts: []string{"gitlab.com"}}, NewGitHubAuthFromToken(""))
+			gr, err := proxy.parseGitRequest(r)
 
 			if tt.wantErr {
 				require.Error(t, err)
@@ -403,6 +518,7 @@ func TestParseGitRequest(t *testing.T) {
 			}
 
 			require.NoError(t, err)
+			assert.Equal(t, tt.wantHost, gr.Host)
 			assert.Equal(t, tt.wantOwner, gr.Owner)
 			assert.Equal(t, tt.wantRepo, gr.Repo)
 			assert.Equal(t, tt.wantOp, gr.Operation)
@@ -436,6 +552,37 @@ func TestProxy_ServeHTTP_ForwardsRequestHeaders(t *testing.T) {
 	assert.Contains(t, values, "value2")
 }
 
+func TestProxy_ServeHTTP_StripsSensitiveHeaders(t *testing.T) {
+	var capturedHeaders http.Header
+	ghServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedHeaders = r.Header
+		w.Header().Set("Set-Cookie", "_gh_sess=abc")
+		w.Header().Set("X-OAuth-Scopes", "repo")
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ghServer.Close()
+
+	proxy := newTestProxy(t, ghServer.URL)
+
+	req := httptest.NewRequest(http.MethodGet, "/github.com/owner/repo.git/info/refs?service=git-upload-pack", nil)
+	req.Header.Set("Authorization", "Bearer client-token")
+	req.Header.Set("Cookie", "session=abc")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	w := httptest.NewRecorder()
+
+	proxy.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, capturedHeaders.Get("Authorization"), "client-token")
+	assert.Contains(t, capturedHeaders.Get("Authorization"), "Basic ")
+	assert.Empty(t, capturedHeaders.Get("Cookie"))
+	assert.Empty(t, capturedHeaders.Get("X-Forwarded-For"))
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+	assert.Empty(t, w.Header().Get("X-OAuth-Scopes"))
+	assert.Equal(t, "application/x-git-upload-pack-advertisement", w.Header().Get("Content-Type"))
+}
+
 func TestProxy_ServeHTTP_EmptyOwnerRepoPath(t *testing.T) {
 	proxy := NewProxy(
 		ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"},
@@ -451,6 +598,64 @@ func TestProxy_ServeHTTP_EmptyOwnerRepoPath(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+func TestProxy_ServeHTTP_PathTraversalDenied(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{
+			name:   "fetch of another repository",
+			method: http.MethodPost,
+			path:   "/github.com/my-owner/my-repo.git/../../my-owner/private-tools.git/git-upload-pack",
+		},
+		{
+			name:   "ref advertisement of another repository",
+			method: http.MethodGet,
+			path:   "/github.com/my-owner/my-repo.git/../../other-owner/other-repo.git/info/refs?service=git-upload-pack",
+		},
+		{
+			name:   "push to another repository",
+			method: http.MethodPost,
+			path:   "/github.com/my-owner/my-repo.git/../../other-owner/other-repo.git/git-receive-pack",
+		},
+		{
+			name:   "dot segment in owner",
+			method: http.MethodPost,
+			path:   "/github.com/./my-repo.git/git-upload-pack",
+		},
+		{
+			name:   "empty segment in operation",
+			method: http.MethodPost,
+			path:   "/github.com/my-owner/my-repo.git//git-receive-pack",
+		},
+		{
+			name:   "LFS locks of another repository",
+			method: http.MethodGet,
+			path:   "/github.com/my-owner/my-repo.git/info/lfs/locks/../../../../other-owner/other-repo.git/info/lfs/locks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamCalled bool
+			ghServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamCalled = true
+			}))
+			defer ghServer.Close()
+			proxy := newTestProxy(t, ghServer.URL)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			proxy.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.False(t, upstreamCalled)
+		})
+	}
+}
+
 // newTestProxy creates a Proxy with its upstream URL pointed at the test server.
 func newTestProxy(t *testing.T, testServerURL string) *Proxy {
 	t.Helper()
@@ -459,7 +664,107 @@ func newTestProxy(t *testing.T, testServerURL string) *Proxy {
 		ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"},
 		NewGitHubAuthFromToken("test-token"),
 	)
-	proxy.upstreamURL = testServerURL
+	proxy.forges["github.com"] = &githubForge{git: testServerURL, api: testServerURL}
 
 	return proxy
 }
+
+func TestProxy_ServeHTTP_Hosts(t *testing.T) {
+	newUpstreamServer := func(name string, gotAuth *string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*gotAuth = r.Header.Get("Authorization")
+			w.Write([]byte(name))
+		}))
+	}
+	var enterpriseAuth, publicAuth string
+	enterprise := newUpstreamServer("enterprise", &enterpriseAuth)
+	defer enterprise.Close()
+	public := newUpstreamServer("public", &publicAuth)
+	defer public.Close()
+
+	tmpHome := t.TempDir()
+	t.Setenv("HOME", tmpHome)
+	t.Setenv("GITHUB_TOKEN", "ghp_enterprise")
+	ghDir := filepath.Join(tmpHome, ".config", "gh")
+	require.NoError(t, os.MkdirAll(ghDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(ghDir, "hosts.yml"), []byte("github.com:\n    oauth_token: gho_public\n"), 0o600))
+	ghAuth, err := NewGitHubAuth("github.example.corp")
+	require.NoError(t, err)
+
+	proxy := NewProxy(ProxyConfig{
+		Host:         "github.example.corp",
+		AllowedOwner: "my-owner",
+		AllowedRepo:  "my-repo",
+		ExtraHosts:   []string{"github.com"},
+		Forges: map[string]ForgeConfig{
+			"github.example.corp": {URL: enterprise.URL},
+			"github.com":          {URL: public.URL},
+		},
+	}, ghAuth)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+		gotAuth    *string
+		wantAuth   string
+	}{
+		{
+			name:       "fetch from the project host",
+			method:     http.MethodGet,
+			path:       "/github.example.corp/my-owner/my-repo.git/info/refs?service=git-upload-pack",
+			wantStatus: http.StatusOK,
+			wantBody:   "enterprise",
+			gotAuth:    &enterpriseAuth,
+			wantAuth:   "Basic " + basicAuth("x-access-token", "ghp_enterprise"),
+		},
+		{
+			name:       "fetch from an extra host uses its own token",
+			method:     http.MethodGet,
+			path:       "/github.com/golang/go.git/info/refs?service=git-upload-pack",
+			wantStatus: http.StatusOK,
+			wantBody:   "public",
+			gotAuth:    &publicAuth,
+			wantAuth:   "Basic " + basicAuth("x-access-token", "gho_public"),
+		},
+		{
+			name:       "push to the project repo on the project host",
+			method:     http.MethodGet,
+			path:       "/github.example.corp/my-owner/my-repo.git/info/refs?service=git-receive-pack",
+			wantStatus: http.StatusOK,
+			wantBody:   "enterprise",
+			gotAuth:    &enterpriseAuth,
+			wantAuth:   "Basic " + basicAuth("x-access-token", "ghp_enterprise"),
+		},
+		{
+			name:       "push to the same name on an extra host",
+			method:     http.MethodGet,
+			path:       "/github.com/my-owner/my-repo.git/info/refs?service=git-receive-pack",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "host that is not configured",
+			method:     http.MethodGet,
+			path:       "/gitlab.com/my-owner/my-repo.git/info/refs?service=git-upload-pack",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enterpriseAuth, publicAuth = "", ""
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			proxy.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.gotAuth != nil {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+				assert.Equal(t, tt.wantAuth, *tt.gotAuth)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Defaults of the rate limiter. The token bucket keeps the gateways of
+// parallel sessions below GitHub's secondary rate limit of 900 REST points
+// per minute.
+const (
+	DefaultRateLimitRate    = 10.0
+	DefaultRateLimitBurst   = 100
+	DefaultMaxRateLimitWait = time.Minute
+)
+
+// maxRateLimitRetries bounds how often a request rejected by a rate limit is
+// retried.
+const maxRateLimitRetries = 3
+
+// defaultSecondaryRetryAfter is how long to back off after a secondary rate
+// limit response that does not say how long to wait.
+const defaultSecondaryRetryAfter = time.Minute
+
+// rateLimitStateTTL is how long the state of a token is listed after it
+// was last used, such as a GitHub App token that has expired.
+const rateLimitStateTTL = 24 * time.Hour
+
+// RateLimitResource is the primary rate limit of a resource, such as
+// "core" or "graphql", as last reported by the forge.
+type RateLimitResource struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Used      int       `json:"used"`
+	Reset     time.Time `json:"reset"`
+}
+
+// RateLimitStatus is the rate limit state of a token on a host, shared by
+// the gateways that use the token.
+type RateLimitStatus struct {
+	Host string `json:"host"`
+	// Token identifies the token without revealing it.
+	Token     string                       `json:"token"`
+	Resources map[string]RateLimitResource `json:"resources,omitempty"`
+	// RetryAfter is when requests can be sent again after a secondary rate
+	// limit response.
+	RetryAfter time.Time `json:"retry_after,omitzero"`
+	// Tokens is the number of requests the token bucket lets through
+	// without waiting.
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+// RateLimiter tracks the rate limits the forge reports for each token, and
+// spaces out API requests with a token bucket per token. With a directory,
+// the state is kept in a file per token there, so that the gateways of
+// parallel sessions sharing the directory share their limits. A nil
+// *RateLimiter neither tracks nor limits anything.
+type RateLimiter struct {
+	dir     string
+	rate    float64 // requests per second
+	burst   float64
+	maxWait time.Duration
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+
+	mu     sync.Mutex
+	states map[string]*RateLimitStatus // without dir
+}
+
+// NewRateLimiter creates a rate limiter that lets rate requests per second
+// through for each token, in bursts of up to burst requests. Requests that
+// would wait longer than maxWait are rejected instead. The state is shared
+// through dir, or kept in memory if dir is empty.
+func NewRateLimiter(dir string, rate float64, burst int, maxWait time.Duration) (*RateLimiter, error) {
+	if rate <= 0 || burst < 1 {
+		return nil, fmt.Errorf("invalid rate limit: rate and burst must be positive")
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create rate limit directory: %w", err)
+		}
+	}
+	return &RateLimiter{
+		dir:     dir,
+		rate:    rate,
+		burst:   float64(burst),
+		maxWait: maxWait,
+		now:     time.Now,
+		sleep:   sleepContext,
+		states:  make(map[string]*RateLimitStatus),
+	}, nil
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// tokenFingerprint identifies token on host without revealing it.
+func tokenFingerprint(host, token string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(host) + "\n" + token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// rateLimitResource returns the rate limit resource GitHub counts a request
+// for ghPath against.
+func rateLimitResource(ghPath string) string {
+	switch {
+	case ghPath == "/graphql":
+		return "graphql"
+	case strings.HasPrefix(ghPath, "/search/"):
+		return "search"
+	default:
+		return "core"
+	}
+}
+
+// update applies fn to the state of token on host, holding a lock on it
+// that gateways sharing the directory respect.
+func (l *RateLimiter) update(host, token string, fn func(st *RateLimitStatus)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := tokenFingerprint(host, token)
+	if l.dir == "" {
+		st, ok := l.states[key]
+		if !ok {
+			st = &RateLimitStatus{Host: host, Token: key, Tokens: l.burst}
+			l.states[key] = st
+		}
+		fn(st)
+		st.Updated = l.now()
+		return nil
+	}
+
+	lock, err := os.OpenFile(filepath.Join(l.dir, key+".lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open rate limit lock: %w", err)
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock rate limit state: %w", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	path := filepath.Join(l.dir, key+".json")
+	st := &RateLimitStatus{Host: host, Token: key, Tokens: l.burst}
+	if data, err := os.ReadFile(path); err == nil {
+		// A corrupt state starts over.
+		json.Unmarshal(data, st)
+	}
+	fn(st)
+	st.Updated = l.now()
+	if err := writeFileAtomic(path, st); err != nil {
+		return fmt.Errorf("failed to write rate limit state: %w", err)
+	}
+	return nil
+}
+
+// rateLimitError is returned when a request would wait for a rate limit
+// longer than allowed.
+type rateLimitError struct {
+	until time.Time
+	wait  time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded: retry after %s", e.until.UTC().Format(time.RFC3339))
+}
+
+// wait blocks until a request for resource can be sent with token on host:
+// the forge's primary and secondary rate limits allow it, and the token
+// bucket has a token for it. It returns a *rateLimitError instead if that
+// takes longer than the maximum wait.
+func (l *RateLimiter) wait(ctx context.Context, host, token, resource string) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		var delay time.Duration
+		var reserved bool
+		err := l.update(host, token, func(st *RateLimitStatus) {
+			now := l.now()
+			if !st.Updated.IsZero() {
+				st.Tokens = min(l.burst, st.Tokens+now.Sub(st.Updated).Seconds()*l.rate)
+			}
+			if st.RetryAfter.After(now) {
+				delay = st.RetryAfter.Sub(now)
+				return
+			}
+			if res, ok := st.Resources[resource]; ok && res.Remaining == 0 && res.Reset.After(now) {
+				delay = res.Reset.Sub(now)
+				return
+			}
+			if st.Tokens < 1 {
+				delay = time.Duration((1 - st.Tokens) / l.rate * float64(time.Second))
+			}
+			if delay <= l.maxWait {
+				st.Tokens--
+				reserved = true
+			}
+		})
+		if err != nil {
+			// Rate limiting is best effort; the forge enforces its limits anyway.
+			return nil
+		}
+		if delay > l.maxWait {
+			return &rateLimitError{until: l.now().Add(delay), wait: delay}
+		}
+		if delay > 0 {
+			if err := l.sleep(ctx, delay); err != nil {
+				return err
+			}
+		}
+		if reserved {
+			return nil
+		}
+	}
+}
+
+// record updates the state of token on host with the rate limit headers of
+// resp, a response to a request for resource. It reports whether resp is a
+// rate limit response, and how long to wait before retrying it.
+func (l *RateLimiter) record(host, token, resource string, resp *http.Response) (time.Duration, bool) {
+	if l == nil {
+		return 0, false
+	}
+
+	header := resp.Header
+	if name := header.Get("X-RateLimit-Resource"); name != "" {
+		resource = name
+	}
+	limited := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && (header.Get("Retry-After") != "" || header.Get("X-RateLimit-Remaining") == "0"))
+
+	var retryAfter time.Duration
+	l.update(host, token, func(st *RateLimitStatus) {
+		now := l.now()
+		if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+			res := st.Resources[resource]
+			res.Remaining = remaining
+			res.Limit, _ = strconv.Atoi(header.Get("X-RateLimit-Limit"))
+			res.Used, _ = strconv.Atoi(header.Get("X-RateLimit-Used"))
+			if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+				res.Reset = time.Unix(reset, 0).UTC()
+			}
+			if st.Resources == nil {
+				st.Resources = make(map[string]RateLimitResource)
+			}
+			st.Resources[resource] = res
+		}
+		if !limited {
+			return
+		}
+
+		switch seconds, err := strconv.Atoi(header.Get("Retry-After")); {
+		case err == nil:
+			retryAfter = time.Duration(seconds) * time.Second
+		case header.Get("X-RateLimit-Remaining") == "0":
+			// The primary rate limit is exhausted until it resets.
+			retryAfter = max(st.Resources[resource].Reset.Sub(now), 0)
+			return
+		default:
+			retryAfter = defaultSecondaryRetryAfter
+		}
+		st.RetryAfter = now.Add(retryAfter)
+	})
+	return retryAfter, limited
+}
+
+// status returns the state of token on host.
+func (l *RateLimiter) status(host, token string) RateLimitStatus {
+	if l == nil {
+		return RateLimitStatus{Host: host, Token: tokenFingerprint(host, token)}
+	}
+	var status RateLimitStatus
+	l.update(host, token, func(st *RateLimitStatus) {
+		now := l.now()
+		if !st.Updated.IsZero() {
+			st.Tokens = min(l.burst, st.Tokens+now.Sub(st.Updated).Seconds()*l.rate)
+		}
+		status = *st
+	})
+	return status
+}
+
+// ReadRateLimits returns the rate limit states in dir, the directory shared
+// by rate limiters, that were used within the last day, ordered by host and
+// last use. A missing directory has no states.
+func ReadRateLimits(dir string) ([]RateLimitStatus, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate limit directory: %w", err)
+	}
+
+	var states []RateLimitStatus
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var st RateLimitStatus
+		if err := json.Unmarshal(data, &st); err != nil {
+			continue
+		}
+		if time.Since(st.Updated) > rateLimitStateTTL {
+			continue
+		}
+		states = append(states, st)
+	}
+
+	slices.SortFunc(states, func(a, b RateLimitStatus) int {
+		if c := strings.Compare(a.Host, b.Host); c != 0 {
+			return c
+		}
+		return b.Updated.Compare(a.Updated)
+	})
+	return states, nil
+}
@@ -0,0 +1,372 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClock is a fake clock that sleeping advances.
+type testClock struct {
+	now    time.Time
+	slept  []time.Duration
+	cancel bool // whether sleeping fails as if the request was cancelled
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) Sleep(ctx context.Context, d time.Duration) error {
+	if c.cancel {
+		return context.Canceled
+	}
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// newTestRateLimiter creates a rate limiter with a fake clock that lets
+// 10 requests per second through in bursts of burst.
+func newTestRateLimiter(t *testing.T, dir string, burst int) (*RateLimiter, *testClock) {
+	t.Helper()
+	limiter, err := NewRateLimiter(dir, 10, burst, time.Minute)
+	require.NoError(t, err)
+	clock := &testClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	limiter.now = clock.Now
+	limiter.sleep = clock.Sleep
+	return limiter, clock
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	_, err := NewRateLimiter("", 0, 10, time.Minute)
+	assert.EqualError(t, err, "invalid rate limit: rate and burst must be positive")
+
+	_, err = NewRateLimiter("", 10, 0, time.Minute)
+	assert.EqualError(t, err, "invalid rate limit: rate and burst must be positive")
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	tests := []struct {
+		name      string
+		requests  int
+		setup     func(st *RateLimitStatus, now time.Time)
+		wantSlept []time.Duration
+		wantErr   string
+	}{
+		{
+			name:     "requests within the burst do not wait",
+			requests: 3,
+		},
+		{
+			name:      "requests beyond the burst wait for the bucket to refill",
+			requests:  5,
+			wantSlept: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond},
+		},
+		{
+			name:     "secondary rate limit waits until retry after",
+			requests: 1,
+			setup: func(st *RateLimitStatus, now time.Time) {
+				st.RetryAfter = now.Add(30 * time.Second)
+			},
+			wantSlept: []time.Duration{30 * time.Second},
+		},
+		{
+			name:     "exhausted primary rate limit waits until reset",
+			requests: 1,
+			setup: func(st *RateLimitStatus, now time.Time) {
+				st.Resources = map[string]RateLimitResource{"core": {Limit: 5000, Remaining: 0, Reset: now.Add(20 * time.Second)}}
+			},
+			wantSlept: []time.Duration{20 * time.Second},
+		},
+		{
+			name:     "exhausted primary rate limit of another resource does not wait",
+			requests: 1,
+			setup: func(st *RateLimitStatus, now time.Time) {
+				st.Resources = map[string]RateLimitResource{"graphql": {Limit: 5000, Remaining: 0, Reset: now.Add(20 * time.Second)}}
+			},
+		},
+		{
+			name:     "wait beyond the maximum is rejected",
+			requests: 1,
+			setup: func(st *RateLimitStatus, now time.Time) {
+				st.Resources = map[string]RateLimitResource{"core": {Limit: 5000, Remaining: 0, Reset: now.Add(time.Hour)}}
+			},
+			wantErr: "rate limit exceeded: retry after 2026-01-02T04:04:05Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, clock := newTestRateLimiter(t, "", 3)
+			if tt.setup != nil {
+				require.NoError(t, limiter.update("github.com", "test-token", func(st *RateLimitStatus) {
+					tt.setup(st, clock.now)
+				}))
+			}
+
+			var err error
+			for range tt.requests {
+				if err = limiter.wait(context.Background(), "github.com", "test-token", "core"); err != nil {
+					break
+				}
+			}
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSlept, clock.slept)
+		})
+	}
+}
+
+func TestRateLimiter_WaitCancelled(t *testing.T) {
+	limiter, clock := newTestRateLimiter(t, "", 1)
+	clock.cancel = true
+
+	require.NoError(t, limiter.wait(context.Background(), "github.com", "test-token", "core"))
+	assert.ErrorIs(t, limiter.wait(context.Background(), "github.com", "test-token", "core"), context.Canceled)
+}
+
+func TestRateLimiter_Record(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	reset := fmt.Sprint(now.Add(10 * time.Minute).Unix())
+
+	tests := []struct {
+		name           string
+		status         int
+		header         map[string]string
+		wantLimited    bool
+		wantRetryAfter time.Duration
+		wantResources  map[string]RateLimitResource
+		wantRetryUntil time.Time
+	}{
+		{
+			name:   "limits are recorded",
+			status: http.StatusOK,
+			header: map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "4990", "X-RateLimit-Used": "10", "X-RateLimit-Reset": reset},
+			wantResources: map[string]RateLimitResource{
+				"core": {Limit: 5000, Remaining: 4990, Used: 10, Reset: now.Add(10 * time.Minute)},
+			},
+		},
+		{
+			name:   "resource header takes precedence",
+			status: http.StatusOK,
+			header: map[string]string{"X-RateLimit-Resource": "search", "X-RateLimit-Limit": "30", "X-RateLimit-Remaining": "29", "X-RateLimit-Used": "1", "X-RateLimit-Reset": reset},
+			wantResources: map[string]RateLimitResource{
+				"search": {Limit: 30, Remaining: 29, Used: 1, Reset: now.Add(10 * time.Minute)},
+			},
+		},
+		{
+			name:   "permission error is not a rate limit",
+			status: http.StatusForbidden,
+		},
+		{
+			name:           "secondary rate limit with retry after",
+			status:         http.StatusTooManyRequests,
+			header:         map[string]string{"Retry-After": "30"},
+			wantLimited:    true,
+			wantRetryAfter: 30 * time.Second,
+			wantRetryUntil: now.Add(30 * time.Second),
+		},
+		{
+			name:           "secondary rate limit without retry after",
+			status:         http.StatusTooManyRequests,
+			wantLimited:    true,
+			wantRetryAfter: time.Minute,
+			wantRetryUntil: now.Add(time.Minute),
+		},
+		{
+			name:           "exhausted primary rate limit",
+			status:         http.StatusForbidden,
+			header:         map[string]string{"X-RateLimit-Limit": "5000", "X-RateLimit-Remaining": "0", "X-RateLimit-Used": "5000", "X-RateLimit-Reset": reset},
+			wantLimited:    true,
+			wantRetryAfter: 10 * time.Minute,
+			wantResources: map[string]RateLimitResource{
+				"core": {Limit: 5000, Remaining: 0, Used: 5000, Reset: now.Add(10 * time.Minute)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, _ := newTestRateLimiter(t, "", 3)
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for key, value := range tt.header {
+				resp.Header.Set(key, value)
+			}
+
+			retryAfter, limited := limiter.record("github.com", "test-token", "core", resp)
+
+			assert.Equal(t, tt.wantLimited, limited)
+			assert.Equal(t, tt.wantRetryAfter, retryAfter)
+			status := limiter.status("github.com", "test-token")
+			assert.Equal(t, tt.wantResources, status.Resources)
+			assert.Equal(t, tt.wantRetryUntil, status.RetryAfter)
+		})
+	}
+}
+
+func TestRateLimiter_SharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	first, clock := newTestRateLimiter(t, dir, 2)
+	second, _ := newTestRateLimiter(t, dir, 2)
+	second.now = clock.Now
+	second.sleep = clock.Sleep
+
+	// The limiters share one bucket for the token, so the third request
+	// waits whichever limiter sends it.
+	require.NoError(t, first.wait(context.Background(), "github.com", "test-token", "core"))
+	require.NoError(t, second.wait(context.Background(), "github.com", "test-token", "core"))
+	assert.Empty(t, clock.slept)
+	require.NoError(t, first.wait(context.Background(), "github.com", "test-token", "core"))
+	assert.Equal(t, []time.Duration{100 * time.Millisecond}, clock.slept)
+
+	// Another token has its own bucket.
+	require.NoError(t, second.wait(context.Background(), "github.com", "other-token", "core"))
+	assert.Len(t, clock.slept, 1)
+
+	second.record("github.com", "test-token", "core", &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"5"}}})
+	assert.Equal(t, clock.now.Add(5*time.Second), first.status("github.com", "test-token").RetryAfter)
+}
+
+func TestReadRateLimits(t *testing.T) {
+	dir := t.TempDir()
+	limiter, err := NewRateLimiter(dir, 10, 10, time.Minute)
+	require.NoError(t, err)
+	limiter.record("github.example.corp", "enterprise-token", "core", &http.Response{StatusCode: http.StatusOK, Header: http.Header{"X-Ratelimit-Remaining": {"4000"}}})
+	limiter.record("github.com", "test-token", "core", &http.Response{StatusCode: http.StatusOK, Header: http.Header{"X-Ratelimit-Remaining": {"100"}}})
+	old, err := NewRateLimiter(dir, 10, 10, time.Minute)
+	require.NoError(t, err)
+	old.now = func() time.Time { return time.Now().Add(-48 * time.Hour) }
+	old.record("github.com", "expired-token", "core", &http.Response{StatusCode: http.StatusOK, Header: http.Header{}})
+
+	states, err := ReadRateLimits(dir)
+	require.NoError(t, err)
+	require.Len(t, states, 2)
+	assert.Equal(t, "github.com", states[0].Host)
+	assert.Equal(t, tokenFingerprint("github.com", "test-token"), states[0].Token)
+	assert.Equal(t, 100, states[0].Resources["core"].Remaining)
+	assert.Equal(t, "github.example.corp", states[1].Host)
+
+	states, err = ReadRateLimits(t.TempDir() + "/missing")
+	require.NoError(t, err)
+	assert.Empty(t, states)
+}
+
+func TestAPIServer_RateLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     []string // Retry-After of rate limit responses before a success, "" for success
+		wantStatus    int
+		wantRequests  int32
+		wantSlept     []time.Duration
+		wantNextError bool // whether the next request is rejected by the gateway
+	}{
+		{
+			name:         "success is relayed",
+			responses:    []string{""},
+			wantStatus:   http.StatusOK,
+			wantRequests: 1,
+		},
+		{
+			name:         "secondary rate limit is retried after waiting",
+			responses:    []string{"2", ""},
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+			wantSlept:    []time.Duration{2 * time.Second},
+		},
+		{
+			name:         "retries are bounded",
+			responses:    []string{"1", "1", "1", "1", "1"},
+			wantStatus:   http.StatusTooManyRequests,
+			wantRequests: maxRateLimitRetries + 1,
+			wantSlept:    []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name:          "long retry after is relayed and holds later requests",
+			responses:     []string{"3600", ""},
+			wantStatus:    http.StatusTooManyRequests,
+			wantRequests:  1,
+			wantNextError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1)) - 1
+				w.Header().Set("X-RateLimit-Limit", "5000")
+				w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(4999-n))
+				if n < len(tt.responses) && tt.responses[n] != "" {
+					w.Header().Set("Retry-After", tt.responses[n])
+					http.Error(w, "secondary rate limit", http.StatusTooManyRequests)
+					return
+				}
+				w.Write([]byte(`[]`))
+			}))
+			defer upstream.Close()
+
+			server := NewTestAPIServer(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}, NewGitHubAuthFromToken("test-token"), upstream.URL)
+			limiter, clock := newTestRateLimiter(t, "", 10)
+			server.rateLimit = limiter
+
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/github/repos/my-owner/my-repo/issues", nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantRequests, requests.Load())
+			assert.Equal(t, tt.wantSlept, clock.slept)
+
+			if tt.wantNextError {
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/github/repos/my-owner/my-repo/pulls", nil))
+				assert.Equal(t, http.StatusTooManyRequests, w.Code)
+				assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+				assert.Contains(t, w.Body.String(), "rate limit exceeded: retry after 2026-01-02T04:04:05Z")
+				assert.Equal(t, tt.wantRequests, requests.Load())
+			}
+		})
+	}
+}
+
+func TestAPIServer_RateLimitStatus(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Resource", "core")
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		w.Header().Set("X-RateLimit-Used", "679")
+		w.Header().Set("X-RateLimit-Reset", "1767326645")
+		w.Write([]byte(`[]`))
+	}))
+	defer upstream.Close()
+
+	server := NewTestAPIServer(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"}, NewGitHubAuthFromToken("test-token"), upstream.URL)
+	limiter, _ := newTestRateLimiter(t, "", 10)
+	server.rateLimit = limiter
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/github/repos/my-owner/my-repo/issues", nil))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/ratelimit", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var status RateLimitStatus
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	assert.Equal(t, "github.com", status.Host)
+	assert.Equal(t, tokenFingerprint("github.com", "test-token"), status.Token)
+	assert.Equal(t, map[string]RateLimitResource{
+		"core": {Limit: 5000, Remaining: 4321, Used: 679, Reset: time.Unix(1767326645, 0).UTC()},
+	}, status.Resources)
+	assert.Equal(t, 9.0, status.Tokens)
+}
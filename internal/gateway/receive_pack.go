@@ -0,0 +1,788 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxFastForwardLookups bounds the upstream compare requests made to verify a
+// single ref update is a fast-forward.
+const maxFastForwardLookups = 10
+
+// maxPackCommitSize bounds the size of a commit, and of a delta applied to
+// one, that the gateway inflates to read the commit's parents. Commits are
+// usually far smaller; the bound keeps a crafted pack from making the
+// gateway allocate more than this per object.
+const maxPackCommitSize = 16 << 20
+
+// DefaultMaxPushSize is the largest push the gateway accepts by default.
+// It matches GitHub's limit for a single push.
+const DefaultMaxPushSize = 2 << 30
+
+// maxPushSize returns the largest push the gateway accepts.
+func (c ProxyConfig) maxPushSize() int64 {
+	if c.MaxPushSize > 0 {
+		return c.MaxPushSize
+	}
+	return DefaultMaxPushSize
+}
+
+// pushLimitReader reads a push over SSH, and fails with an
+// *http.MaxBytesError once more than limit bytes are read, as
+// http.MaxBytesReader does for pushes over HTTP.
+type pushLimitReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (l *pushLimitReader) Read(p []byte) (int, error) {
+	if l.read > l.limit {
+		return 0, &http.MaxBytesError{Limit: l.limit}
+	}
+	if remaining := l.limit - l.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n - int(l.read-l.limit), &http.MaxBytesError{Limit: l.limit}
+	}
+	return n, err
+}
+
+// isPushTooLarge reports whether err is from reading past the push size limit.
+func isPushTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// pushTooLargeReasons rejects every update of req because the push exceeds
+// limit bytes.
+func pushTooLargeReasons(req *receivePackRequest, limit int64) map[string]string {
+	reasons := make(map[string]string, len(req.Updates))
+	for _, u := range req.Updates {
+		reasons[u.Ref] = fmt.Sprintf("push exceeds the gateway's limit of %d bytes", limit)
+	}
+	return reasons
+}
+
+// refUpdate is a ref update command sent at the start of a receive-pack request:
+//
+//	<old-oid> SP <new-oid> SP <ref>
+type refUpdate struct {
+	OldOID string
+	NewOID string
+	Ref    string
+}
+
+// isCreate reports whether the update creates the ref.
+func (u refUpdate) isCreate() bool {
+	return isZeroOID(u.OldOID)
+}
+
+// isDelete reports whether the update deletes the ref.
+func (u refUpdate) isDelete() bool {
+	return isZeroOID(u.NewOID)
+}
+
+// receivePackRequest is the command section of a receive-pack request.
+type receivePackRequest struct {
+	Updates      []refUpdate
+	Capabilities []string
+}
+
+// hasCapability reports whether the client requested the capability.
+func (r *receivePackRequest) hasCapability(name string) bool {
+	for _, c := range r.Capabilities {
+		if c == name || strings.HasPrefix(c, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// handleReceivePack enforces the ref policy on a push before forwarding it.
+// The request body is spooled to a temporary file while its commands and
+// pack are inspected, then forwarded unchanged if every update is allowed.
+// Pushes larger than the configured limit are rejected.
+func (p *Proxy) handleReceivePack(w http.ResponseWriter, r *http.Request, gr *gitRequest) {
+	limit := p.config.maxPushSize()
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	spool, err := os.CreateTemp("", "gateway-receive-pack-*")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to buffer push: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	body := io.TeeReader(r.Body, spool)
+	var reader io.Reader = body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid gzip body: %v", err), http.StatusBadRequest)
+			return
+		}
+		reader = gz
+	}
+	br := bufio.NewReader(reader)
+
+	req, err := readReceivePackRequest(br)
+	if err != nil {
+		if isPushTooLarge(err) {
+			http.Error(w, fmt.Sprintf("push exceeds the gateway's limit of %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("invalid receive-pack request: %v", err), http.StatusBadRequest)
+		return
+	}
+	var refs []AuditRefUpdate
+	for _, u := range req.Updates {
+		refs = append(refs, AuditRefUpdate{Ref: u.Ref, OldOID: u.OldOID, NewOID: u.NewOID})
+	}
+	annotateAudit(r.Context(), func(entry *AuditEntry) {
+		entry.Refs = refs
+	})
+
+	reasons, err := p.checkRefUpdates(r.Context(), gr, req, func(hexLen int) (map[string][]string, error) {
+		return readPackCommits(br, hexLen)
+	})
+	if err == nil {
+		// Read the rest of the body, so the spool is complete for
+		// forwarding and the client finishes sending before it reads a
+		// rejection.
+		_, err = io.Copy(io.Discard, body)
+	}
+	if isPushTooLarge(err) {
+		reasons, err = pushTooLargeReasons(req, limit), nil
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to inspect push: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(reasons) > 0 {
+		annotateAudit(r.Context(), func(entry *AuditEntry) {
+			entry.Decision = AuditDeny
+			entry.Reason = strings.Join(rejectionMessages(req, reasons), "; ")
+		})
+		writeReceivePackRejection(w, req, reasons)
+		return
+	}
+
+	if approvals := p.pushApprovals(gr, req); len(approvals) > 0 {
+		approved, reason := p.approvals.approve(r.Context(), ApprovalRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Host:   gr.Host,
+			Owner:  gr.Owner,
+			Repo:   gr.Repo,
+			Refs:   refs,
+			Reason: strings.Join(approvals, "; "),
+		})
+		if !approved {
+			for _, u := range req.Updates {
+				reasons[u.Ref] = reason
+			}
+			annotateAudit(r.Context(), func(entry *AuditEntry) {
+				entry.Decision = AuditDeny
+				entry.Reason = reason
+			})
+			writeReceivePackRejection(w, req, reasons)
+			return
+		}
+	}
+
+	size, err := spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to buffer push: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, fmt.Sprintf("failed to buffer push: %v", err), http.StatusInternalServerError)
+		return
+	}
+	r.Body = spool
+	r.ContentLength = size
+
+	p.forwardToGitHub(w, r, gr)
+	p.cache.invalidateMirror(gr.Host, gr.Owner, gr.Repo)
+}
+
+// pushApprovals returns why the push needs the host user's approval: the
+// repository is only writable with approval, or it updates refs that need
+// approval. It returns nil if the push needs no approval.
+func (p *Proxy) pushApprovals(gr *gitRequest, req *receivePackRequest) []string {
+	var approvals []string
+	if !p.config.repoPolicy().CanWrite(gr.Host, gr.Owner, gr.Repo) {
+		approvals = append(approvals, fmt.Sprintf("writes to %s/%s require approval", gr.Owner, gr.Repo))
+	}
+	policy := p.config.refPolicy()
+	for _, u := range req.Updates {
+		if policy.RequiresApproval(u.Ref) {
+			approvals = append(approvals, fmt.Sprintf("pushes to %s require approval", u.Ref))
+		}
+	}
+	return approvals
+}
+
+// checkRefUpdates returns the reason each rejected ref update is not
+// allowed, keyed by ref. readCommits returns the parents of the pushed
+// commits, and is only called when a fast-forward check needs them.
+func (p *Proxy) checkRefUpdates(ctx context.Context, gr *gitRequest, req *receivePackRequest, readCommits func(hexLen int) (map[string][]string, error)) (map[string]string, error) {
+	policy := p.config.refPolicy()
+	reasons := make(map[string]string)
+
+	var needsFastForward []refUpdate
+	for _, u := range req.Updates {
+		switch {
+		case policy.IsProtected(u.Ref) && !policy.RequiresApproval(u.Ref):
+			reasons[u.Ref] = "protected ref cannot be pushed to through the gateway"
+		case u.isDelete():
+			if !policy.AllowDeletions {
+				reasons[u.Ref] = "deleting refs is not allowed through the gateway"
+			}
+		case u.isCreate() || policy.AllowForcePush:
+		case !strings.HasPrefix(u.Ref, "refs/heads/"):
+			reasons[u.Ref] = "updating an existing non-branch ref is not allowed through the gateway"
+		default:
+			needsFastForward = append(needsFastForward, u)
+		}
+	}
+
+	if len(reasons) > 0 || len(needsFastForward) == 0 {
+		return reasons, nil
+	}
+
+	commits, err := readCommits(len(needsFastForward[0].NewOID))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range needsFastForward {
+		ok, err := p.isFastForward(ctx, gr, commits, u.OldOID, u.NewOID)
+		if err != nil {
+			reasons[u.Ref] = fmt.Sprintf("cannot verify fast-forward: %v", err)
+			continue
+		}
+		if !ok {
+			reasons[u.Ref] = "non-fast-forward updates are not allowed through the gateway"
+		}
+	}
+
+	return reasons, nil
+}
+
+// isFastForward reports whether newOID descends from oldOID. It walks the
+// parents of the pushed commits; where the walk leaves the pack, it asks the
+// upstream API whether the existing commit descends from oldOID.
+func (p *Proxy) isFastForward(ctx context.Context, gr *gitRequest, commits map[string][]string, oldOID, newOID string) (bool, error) {
+	visited := map[string]bool{newOID: true}
+	queue := []string{newOID}
+	var boundary []string
+
+	for len(queue) > 0 {
+		oid := queue[0]
+		queue = queue[1:]
+
+		if oid == oldOID {
+			return true, nil
+		}
+
+		parents, ok := commits[oid]
+		if !ok {
+			boundary = append(boundary, oid)
+			continue
+		}
+		for _, parent := range parents {
+			if !visited[parent] {
+				visited[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	if len(boundary) > maxFastForwardLookups {
+		return false, fmt.Errorf("push is based on %d existing commits", len(boundary))
+	}
+
+	for _, oid := range boundary {
+		ok, err := p.descendsFrom(ctx, gr, oldOID, oid)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// descendsFrom asks the forge API whether head is base or descends from it.
+func (p *Proxy) descendsFrom(ctx context.Context, gr *gitRequest, base, head string) (bool, error) {
+	return p.forge(gr.Host).isAncestor(ctx, p.httpClient, p.token(gr), gr.Owner, gr.Repo, base, head)
+}
+
+// readReceivePackRequest reads the ref update commands up to the flush packet.
+// Shallow lines are skipped; signed pushes are rejected since the commands
+// are inside the certificate.
+func readReceivePackRequest(r io.Reader) (*receivePackRequest, error) {
+	req := &receivePackRequest{}
+
+	for {
+		line, err := readPktLine(r)
+		if err == io.EOF && len(req.Updates) == 0 {
+			// An empty body updates nothing.
+			return req, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			return req, nil
+		}
+
+		text := strings.TrimSuffix(string(line), "\n")
+		if len(req.Updates) == 0 {
+			if strings.HasPrefix(text, "shallow ") {
+				continue
+			}
+			if strings.HasPrefix(text, "push-cert") {
+				return nil, fmt.Errorf("signed pushes are not supported")
+			}
+
+			command, capabilities, found := strings.Cut(text, "\x00")
+			if found {
+				req.Capabilities = strings.Fields(capabilities)
+			}
+			text = command
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 || !isOID(fields[0]) || !isOID(fields[1]) {
+			return nil, fmt.Errorf("malformed ref update command %q", text)
+		}
+		req.Updates = append(req.Updates, refUpdate{OldOID: fields[0], NewOID: fields[1], Ref: fields[2]})
+	}
+}
+
+// readPktLine reads a single pkt-line. It returns a nil payload for a flush packet.
+func readPktLine(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseUint(string(header[:]), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkt-line length %q", header[:])
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	if length < 4 {
+		return nil, fmt.Errorf("invalid pkt-line length %d", length)
+	}
+
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("truncated pkt-line: %w", err)
+	}
+	return payload, nil
+}
+
+// writePktLine writes payload as a pkt-line.
+func writePktLine(w io.Writer, payload []byte) {
+	fmt.Fprintf(w, "%04x", len(payload)+4)
+	w.Write(payload)
+}
+
+// rejectionMessages describes each rejected ref update, in push order.
+func rejectionMessages(req *receivePackRequest, reasons map[string]string) []string {
+	var messages []string
+	for _, u := range req.Updates {
+		if reason, ok := reasons[u.Ref]; ok {
+			messages = append(messages, fmt.Sprintf("%s: %s", u.Ref, reason))
+		}
+	}
+	return messages
+}
+
+// writeReceivePackRejection responds with a report-status rejecting every
+// update, so the client displays the reason next to each rejected ref.
+// Updates that were allowed are rejected too, since the push is not forwarded.
+func writeReceivePackRejection(w http.ResponseWriter, req *receivePackRequest, reasons map[string]string) {
+	if !req.hasCapability("report-status") && !req.hasCapability("report-status-v2") {
+		http.Error(w, "forbidden: "+strings.Join(rejectionMessages(req, reasons), "; "), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	writeReceivePackReport(w, req, reasons)
+}
+
+// writeReceivePackReport writes the report-status of a push rejecting every
+// update, for a client that requested report-status.
+func writeReceivePackReport(w io.Writer, req *receivePackRequest, reasons map[string]string) {
+	var report bytes.Buffer
+	writePktLine(&report, []byte("unpack ok\n"))
+	for _, u := range req.Updates {
+		reason, ok := reasons[u.Ref]
+		if !ok {
+			reason = "another ref in this push was rejected by the gateway"
+		}
+		writePktLine(&report, []byte(fmt.Sprintf("ng %s %s\n", u.Ref, reason)))
+	}
+	report.WriteString("0000")
+
+	if !req.hasCapability("side-band-64k") && !req.hasCapability("side-band") {
+		w.Write(report.Bytes())
+		return
+	}
+
+	// Multiplex the report on band 1 and a human-readable summary on band 2,
+	// which the client prints prefixed with "remote:".
+	maxPayload := 999 - 5
+	if req.hasCapability("side-band-64k") {
+		maxPayload = 65519 - 5
+	}
+	writePktLine(w, []byte("\x02gateway: push rejected by policy\n"))
+	data := report.Bytes()
+	for len(data) > 0 {
+		n := min(len(data), maxPayload)
+		writePktLine(w, append([]byte{1}, data[:n]...))
+		data = data[n:]
+	}
+	w.Write([]byte("0000"))
+}
+
+// Pack object types.
+const (
+	packObjCommit   = 1
+	packObjOfsDelta = 6
+	packObjRefDelta = 7
+)
+
+// packObject is an object read from a pack. Content is only kept for commits.
+type packObject struct {
+	typ     int
+	content []byte
+}
+
+// readPackCommits reads a pack and returns the parents of every commit in it,
+// keyed by object ID. hexLen is the length of a hex object ID, which selects
+// SHA-1 or SHA-256. Deltified commits are resolved against bases in the pack.
+func readPackCommits(r *bufio.Reader, hexLen int) (map[string][]string, error) {
+	commits := make(map[string][]string)
+
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			// No pack: the push only references existing objects.
+			return commits, nil
+		}
+		return nil, fmt.Errorf("failed to read pack header: %w", err)
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, fmt.Errorf("invalid pack signature")
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported pack version %d", version)
+	}
+	count := binary.BigEndian.Uint32(header[8:12])
+
+	newHash := sha1.New
+	if hexLen == sha256.Size*2 {
+		newHash = sha256.New
+	}
+
+	cr := &countingReader{r: r, n: 12}
+	byOffset := make(map[int64]*packObject)
+	byOID := make(map[string]*packObject)
+
+	for i := uint32(0); i < count; i++ {
+		offset := cr.n
+		typ, size, err := readPackObjectHeader(cr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pack object header: %w", err)
+		}
+
+		var base *packObject
+		switch typ {
+		case packObjOfsDelta:
+			distance, err := readOffsetDelta(cr)
+			if err != nil {
+				return nil, err
+			}
+			base = byOffset[offset-distance]
+		case packObjRefDelta:
+			oid := make([]byte, hexLen/2)
+			if _, err := io.ReadFull(cr, oid); err != nil {
+				return nil, fmt.Errorf("failed to read delta base: %w", err)
+			}
+			// The base may be an existing object outside the pack.
+			base = byOID[hex.EncodeToString(oid)]
+		}
+
+		object := &packObject{typ: typ}
+		isDelta := typ == packObjOfsDelta || typ == packObjRefDelta
+		keep := typ == packObjCommit || (isDelta && base != nil && base.typ == packObjCommit)
+
+		if keep && size > maxPackCommitSize {
+			return nil, fmt.Errorf("pack object of %d bytes exceeds the gateway's limit of %d bytes for commits", size, maxPackCommitSize)
+		}
+		data, err := inflate(cr, keep, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inflate pack object: %w", err)
+		}
+
+		if isDelta {
+			object.typ = 0
+			if base != nil {
+				object.typ = base.typ
+			}
+			if keep {
+				if data, err = applyDelta(base.content, data); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if object.typ == packObjCommit && keep {
+			object.content = data
+			oid := hashObject(newHash(), "commit", data)
+			byOID[oid] = object
+			commits[oid] = commitParents(data)
+		}
+		byOffset[offset] = object
+	}
+
+	return commits, nil
+}
+
+// countingReader tracks the pack offset. It implements io.ByteReader so the
+// zlib reader doesn't read past the end of each object.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// readPackObjectHeader reads an object's type and inflated size.
+func readPackObjectHeader(r io.ByteReader) (int, uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	typ := int(b>>4) & 0x7
+	size := uint64(b & 0x0f)
+	shift := 4
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= uint64(b&0x7f) << shift
+		shift += 7
+	}
+	return typ, size, nil
+}
+
+// readOffsetDelta reads the distance back to an OFS_DELTA object's base.
+func readOffsetDelta(r io.ByteReader) (int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read delta offset: %w", err)
+	}
+	offset := int64(b & 0x7f)
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, fmt.Errorf("failed to read delta offset: %w", err)
+		}
+		offset = ((offset + 1) << 7) | int64(b&0x7f)
+	}
+	return offset, nil
+}
+
+// inflate reads one zlib stream, returning its content if keep is set and
+// discarding it otherwise. Kept content must be size bytes, the size in the
+// object's header, which the caller bounds.
+func inflate(r io.Reader, keep bool, size uint64) ([]byte, error) {
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	if !keep {
+		_, err := io.Copy(io.Discard, z)
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(z, int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != size {
+		return nil, fmt.Errorf("inflated object size does not match its header size %d", size)
+	}
+	return data, nil
+}
+
+// applyDelta reconstructs an object from its base and a git delta.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid delta")
+	r := bytes.NewReader(delta)
+
+	readSize := func() (uint64, error) {
+		var size uint64
+		var shift uint
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, errInvalid
+			}
+			size |= uint64(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+
+	baseSize, err := readSize()
+	if err != nil || baseSize != uint64(len(base)) {
+		return nil, errInvalid
+	}
+	resultSize, err := readSize()
+	if err != nil {
+		return nil, errInvalid
+	}
+	if resultSize > maxPackCommitSize {
+		return nil, fmt.Errorf("delta result of %d bytes exceeds the gateway's limit of %d bytes for commits", resultSize, maxPackCommitSize)
+	}
+
+	result := make([]byte, 0, resultSize)
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		if op&0x80 == 0 {
+			// Insert the next op bytes.
+			if op == 0 || int(op) > r.Len() {
+				return nil, errInvalid
+			}
+			data := make([]byte, op)
+			r.Read(data)
+			result = append(result, data...)
+			continue
+		}
+
+		// Copy from the base; the low bits select which offset and size bytes follow.
+		var offset, size uint64
+		for i := uint(0); i < 4; i++ {
+			if op&(1<<i) != 0 {
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, errInvalid
+				}
+				offset |= uint64(b) << (8 * i)
+			}
+		}
+		for i := uint(0); i < 3; i++ {
+			if op&(1<<(4+i)) != 0 {
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, errInvalid
+				}
+				size |= uint64(b) << (8 * i)
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > uint64(len(base)) {
+			return nil, errInvalid
+		}
+		result = append(result, base[offset:offset+size]...)
+	}
+
+	if uint64(len(result)) != resultSize {
+		return nil, errInvalid
+	}
+	return result, nil
+}
+
+// hashObject returns the object ID of a loose object with the given type and content.
+func hashObject(h hash.Hash, typ string, content []byte) string {
+	fmt.Fprintf(h, "%s %d\x00", typ, len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// commitParents returns the parent object IDs listed in a commit's header.
+func commitParents(content []byte) []string {
+	var parents []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			// End of the header
+			break
+		}
+		if parent, ok := strings.CutPrefix(line, "parent "); ok {
+			parents = append(parents, parent)
+		}
+	}
+	return parents
+}
+
+// isOID reports whether s is a hex SHA-1 or SHA-256 object ID.
+func isOID(s string) bool {
+	if len(s) != sha1.Size*2 && len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// isZeroOID reports whether oid is the all-zero object ID used for missing refs.
+func isZeroOID(oid string) bool {
+	return strings.Trim(oid, "0") == ""
+}
+
+// shortOID abbreviates an object ID for messages.
+func shortOID(oid string) string {
+	if len(oid) > 12 {
+		return oid[:12]
+	}
+	return oid
+}
@@ -0,0 +1,501 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testOID1 = "1111111111111111111111111111111111111111"
+	testOID2 = "2222222222222222222222222222222222222222"
+	zeroOID  = "0000000000000000000000000000000000000000"
+)
+
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+func TestReadReceivePackRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    *receivePackRequest
+		wantErr string
+	}{
+		{
+			name: "commands with capabilities",
+			body: pktLine(testOID1+" "+testOID2+" refs/heads/feature\x00report-status side-band-64k agent=git/2.39\n") +
+				pktLine(zeroOID+" "+testOID2+" refs/heads/new\n") +
+				"0000PACK",
+			want: &receivePackRequest{
+				Updates: []refUpdate{
+					{OldOID: testOID1, NewOID: testOID2, Ref: "refs/heads/feature"},
+					{OldOID: zeroOID, NewOID: testOID2, Ref: "refs/heads/new"},
+				},
+				Capabilities: []string{"report-status", "side-band-64k", "agent=git/2.39"},
+			},
+		},
+		{
+			name: "shallow lines are skipped",
+			body: pktLine("shallow "+testOID1+"\n") + pktLine(testOID1+" "+zeroOID+" refs/heads/old\x00report-status") + "0000",
+			want: &receivePackRequest{
+				Updates:      []refUpdate{{OldOID: testOID1, NewOID: zeroOID, Ref: "refs/heads/old"}},
+				Capabilities: []string{"report-status"},
+			},
+		},
+		{
+			name: "empty body",
+			body: "",
+			want: &receivePackRequest{},
+		},
+		{
+			name:    "signed push",
+			body:    pktLine("push-cert\x00report-status\n") + "0000",
+			wantErr: "signed pushes are not supported",
+		},
+		{
+			name:    "malformed command",
+			body:    pktLine("not a command\n") + "0000",
+			wantErr: "malformed ref update command",
+		},
+		{
+			name:    "invalid length",
+			body:    "zzzz",
+			wantErr: "invalid pkt-line length",
+		},
+		{
+			name:    "truncated command list",
+			body:    pktLine(testOID1 + " " + testOID2 + " refs/heads/feature\n"),
+			wantErr: "EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReceivePackRequest(strings.NewReader(tt.body))
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("tree abc\nparent def\n\nmessage")
+
+	// Result size 31: copy 20 bytes at offset 0, insert "new", copy 8 bytes at offset 20.
+	delta := []byte{byte(len(base)), 31, 0x90, 20, 3, 'n', 'e', 'w', 0x91, 20, 8}
+
+	got, err := applyDelta(base, delta)
+
+	require.NoError(t, err)
+	assert.Equal(t, "tree abc\nparent def\nnew\nmessage", string(got))
+
+	_, err = applyDelta([]byte("short"), delta)
+	assert.Error(t, err)
+
+	// A result size of 1 TiB is rejected before anything is allocated.
+	huge := []byte{byte(len(base)), 0x80, 0x80, 0x80, 0x80, 0x80, 0x20, 0x90, 20}
+	_, err = applyDelta(base, huge)
+	assert.ErrorContains(t, err, "exceeds the gateway's limit")
+}
+
+func TestCommitParents(t *testing.T) {
+	content := []byte("tree " + testOID1 + "\nparent " + testOID1 + "\nparent " + testOID2 + "\nauthor a\n\nparent in message\n")
+
+	assert.Equal(t, []string{testOID1, testOID2}, commitParents(content))
+}
+
+func TestRefPolicy_IsProtected(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RefPolicy
+		ref    string
+		want   bool
+	}{
+		{name: "default protects main", ref: "refs/heads/main", want: true},
+		{name: "default protects master", ref: "refs/heads/master", want: true},
+		{name: "default allows feature branches", ref: "refs/heads/feature", want: false},
+		{name: "short branch glob", policy: RefPolicy{Protected: []string{"release/*"}}, ref: "refs/heads/release/v1", want: true},
+		{name: "explicit list replaces defaults", policy: RefPolicy{Protected: []string{"develop"}}, ref: "refs/heads/main", want: false},
+		{name: "full ref pattern", policy: RefPolicy{Protected: []string{"refs/tags/*"}}, ref: "refs/tags/v1.0.0", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.IsProtected(tt.ref))
+		})
+	}
+}
+
+func TestWriteReceivePackRejection(t *testing.T) {
+	req := &receivePackRequest{
+		Updates: []refUpdate{
+			{OldOID: testOID1, NewOID: testOID2, Ref: "refs/heads/main"},
+			{OldOID: testOID1, NewOID: testOID2, Ref: "refs/heads/feature"},
+		},
+		Capabilities: []string{"report-status"},
+	}
+	reasons := map[string]string{"refs/heads/main": "protected"}
+
+	t.Run("report-status", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		writeReceivePackRejection(w, req, reasons)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-git-receive-pack-result", w.Header().Get("Content-Type"))
+		assert.Equal(t, pktLine("unpack ok\n")+
+			pktLine("ng refs/heads/main protected\n")+
+			pktLine("ng refs/heads/feature another ref in this push was rejected by the gateway\n")+
+			"0000", w.Body.String())
+	})
+
+	t.Run("side-band-64k", func(t *testing.T) {
+		sideBandReq := *req
+		sideBandReq.Capabilities = []string{"report-status", "side-band-64k"}
+		w := httptest.NewRecorder()
+		writeReceivePackRejection(w, &sideBandReq, reasons)
+
+		r := bufio.NewReader(w.Body)
+		progress, err := readPktLine(r)
+		require.NoError(t, err)
+		assert.Equal(t, "\x02gateway: push rejected by policy\n", string(progress))
+
+		report, err := readPktLine(r)
+		require.NoError(t, err)
+		assert.Equal(t, byte(1), report[0])
+		assert.Contains(t, string(report[1:]), "ng refs/heads/main protected\n")
+
+		flush, err := readPktLine(r)
+		require.NoError(t, err)
+		assert.Nil(t, flush)
+	})
+
+	t.Run("without report-status", func(t *testing.T) {
+		plainReq := *req
+		plainReq.Capabilities = nil
+		w := httptest.NewRecorder()
+		writeReceivePackRejection(w, &plainReq, reasons)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "refs/heads/main: protected")
+	})
+}
+
+// gitTestUpstream is a git smart HTTP server backed by git http-backend,
+// which also answers the GitHub compare API from the bare repository.
+type gitTestUpstream struct {
+	*httptest.Server
+	root string
+}
+
+func newGitTestUpstream(t *testing.T) *gitTestUpstream {
+	t.Helper()
+
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+	bare := filepath.Join(root, "my-owner", "my-repo.git")
+	runGit(t, root, "init", "--bare", "--initial-branch=main", bare)
+	runGit(t, bare, "config", "http.receivepack", "true")
+
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/{owner}/{repo}/compare/{basehead}", func(w http.ResponseWriter, r *http.Request) {
+		base, head, _ := strings.Cut(r.PathValue("basehead"), "...")
+		repoDir := filepath.Join(root, r.PathValue("owner"), r.PathValue("repo")+".git")
+		status := "diverged"
+		if exec.Command("git", "-C", repoDir, "merge-base", "--is-ancestor", base, head).Run() == nil {
+			status = "ahead"
+		}
+		fmt.Fprintf(w, `{"status": %q}`, status)
+	})
+	mux.Handle("/", backend)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return &gitTestUpstream{Server: server, root: root}
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test User", "GIT_AUTHOR_EMAIL=test@test.com",
+		"GIT_COMMITTER_NAME=Test User", "GIT_COMMITTER_EMAIL=test@test.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %v failed: %s", args, string(output))
+	return strings.TrimSpace(string(output))
+}
+
+// tryGit runs git and returns its combined output and error.
+func tryGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestProxy_ReceivePack_RefPolicy(t *testing.T) {
+	upstream := newGitTestUpstream(t)
+
+	// Seed main and feature directly in the upstream.
+	seed := t.TempDir()
+	runGit(t, seed, "init", "--initial-branch=main")
+	runGit(t, seed, "commit", "--allow-empty", "-m", "initial")
+	runGit(t, seed, "push", upstream.URL+"/my-owner/my-repo.git", "main", "main:feature", "main:stale")
+
+	tests := []struct {
+		name        string
+		policy      *Policy
+		maxPushSize int64
+		approval    string // decision of the host user, or "" for no approval queue
+		setup       func(t *testing.T, dir string)
+		pushArgs    []string
+		wantErr     bool
+		wantOutput  []string
+	}{
+		{
+			name:     "new branch is allowed",
+			setup:    func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "new") },
+			pushArgs: []string{"HEAD:refs/heads/topic"},
+		},
+		{
+			name:     "fast-forward is allowed",
+			setup:    func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "next") },
+			pushArgs: []string{"HEAD:feature"},
+		},
+		{
+			name: "fast-forward to an existing commit is allowed",
+			setup: func(t *testing.T, dir string) {
+				// The commit reaches the upstream first, so the push sends no pack
+				// and the gateway asks the compare API instead.
+				runGit(t, dir, "commit", "--allow-empty", "-m", "shared")
+				runGit(t, dir, "push", "--quiet", upstream.URL+"/my-owner/my-repo.git", "HEAD:refs/heads/shared")
+			},
+			pushArgs: []string{"HEAD:feature"},
+		},
+		{
+			name:       "protected branch is rejected",
+			setup:      func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "direct") },
+			pushArgs:   []string{"HEAD:main"},
+			wantErr:    true,
+			wantOutput: []string{"[remote rejected] HEAD -> main (protected ref cannot be pushed to through the gateway)"},
+		},
+		{
+			name: "force push is rejected",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "commit", "--amend", "--allow-empty", "-m", "rewritten")
+			},
+			pushArgs:   []string{"--force", "HEAD:feature"},
+			wantErr:    true,
+			wantOutput: []string{"(non-fast-forward updates are not allowed through the gateway)"},
+		},
+		{
+			name:   "force push is allowed by policy",
+			policy: &Policy{Refs: RefPolicy{AllowForcePush: true}},
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "commit", "--amend", "--allow-empty", "-m", "rewritten")
+			},
+			pushArgs: []string{"--force", "HEAD:stale"},
+		},
+		{
+			name:       "deletion is rejected",
+			pushArgs:   []string{"--delete", "stale"},
+			wantErr:    true,
+			wantOutput: []string{"[remote rejected] stale (deleting refs is not allowed through the gateway)"},
+		},
+		{
+			name:       "every update is rejected with a rejected one",
+			setup:      func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "both") },
+			pushArgs:   []string{"HEAD:main", "HEAD:refs/heads/other"},
+			wantErr:    true,
+			wantOutput: []string{"HEAD -> other (another ref in this push was rejected by the gateway)"},
+		},
+		{
+			name:     "branch needing approval is pushed when approved",
+			policy:   &Policy{Refs: RefPolicy{NeedsApproval: []string{"release/*"}}},
+			approval: ApprovalApprove,
+			setup:    func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "release") },
+			pushArgs: []string{"HEAD:refs/heads/release/v1"},
+		},
+		{
+			name:       "branch needing approval is rejected when denied",
+			policy:     &Policy{Refs: RefPolicy{NeedsApproval: []string{"release/*"}}},
+			approval:   ApprovalDeny,
+			setup:      func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "release") },
+			pushArgs:   []string{"HEAD:refs/heads/release/v2"},
+			wantErr:    true,
+			wantOutput: []string{"(pushes to refs/heads/release/v2 require approval: denied by the host user)"},
+		},
+		{
+			name:       "branch needing approval is rejected without an approval queue",
+			policy:     &Policy{Refs: RefPolicy{NeedsApproval: []string{"release/*"}}},
+			setup:      func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "release") },
+			pushArgs:   []string{"HEAD:refs/heads/release/v3"},
+			wantErr:    true,
+			wantOutput: []string{"(pushes to refs/heads/release/v3 require approval)"},
+		},
+		{
+			name:     "protected branch needing approval is pushed when approved",
+			policy:   &Policy{Refs: RefPolicy{NeedsApproval: []string{"main"}}},
+			approval: ApprovalApprove,
+			setup:    func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "approved") },
+			pushArgs: []string{"HEAD:main"},
+		},
+		{
+			name:        "oversized push is rejected",
+			maxPushSize: 4096,
+			setup: func(t *testing.T, dir string) {
+				// Random content, so the pack does not compress below the limit.
+				large := make([]byte, 64<<10)
+				_, err := rand.Read(large)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "large.bin"), large, 0o644))
+				runGit(t, dir, "add", "large.bin")
+				runGit(t, dir, "commit", "-m", "large")
+			},
+			pushArgs:   []string{"HEAD:refs/heads/large"},
+			wantErr:    true,
+			wantOutput: []string{"(push exceeds the gateway's limit of 4096 bytes)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := NewTestProxy(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo", Policy: tt.policy, MaxPushSize: tt.maxPushSize},
+				NewGitHubAuthFromToken("test-token"), upstream.URL)
+			if tt.approval != "" {
+				proxy.approvals = newTestApprovalQueue(t, tt.approval, 5*time.Second)
+			}
+			proxyServer := httptest.NewServer(proxy)
+			defer proxyServer.Close()
+
+			dir := t.TempDir()
+			runGit(t, dir, "clone", "--quiet", upstream.URL+"/my-owner/my-repo.git", ".")
+			runGit(t, dir, "checkout", "--quiet", "feature")
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+
+			output, err := tryGit(dir, append([]string{"push", proxyServer.URL + "/github.com/my-owner/my-repo.git"}, tt.pushArgs...)...)
+
+			if tt.wantErr {
+				require.Error(t, err, output)
+			} else {
+				require.NoError(t, err, output)
+			}
+			for _, want := range tt.wantOutput {
+				assert.Contains(t, output, want)
+			}
+		})
+	}
+}
+
+func TestReadPackCommits(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--initial-branch=main")
+	runGit(t, dir, "commit", "--allow-empty", "-m", "first")
+	first := runGit(t, dir, "rev-parse", "HEAD")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), bytes.Repeat([]byte("content\n"), 100), 0o644))
+	runGit(t, dir, "add", "file.txt")
+	runGit(t, dir, "commit", "-m", "second")
+	second := runGit(t, dir, "rev-parse", "HEAD")
+
+	cmd := exec.Command("git", "pack-objects", "--stdout", "--revs")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader("HEAD\n")
+	pack, err := cmd.Output()
+	require.NoError(t, err)
+
+	commits, err := readPackCommits(bufio.NewReader(bytes.NewReader(pack)), len(second))
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		first:  nil,
+		second: {first},
+	}, commits)
+}
+
+func TestReadPackCommits_Limits(t *testing.T) {
+	// packWithObject returns a pack holding a single object of typ whose
+	// header declares size, with content compressed as its data.
+	packWithObject := func(typ int, size uint64, content []byte) []byte {
+		var pack bytes.Buffer
+		pack.WriteString("PACK")
+		binary.Write(&pack, binary.BigEndian, uint32(2))
+		binary.Write(&pack, binary.BigEndian, uint32(1))
+		b := byte(typ<<4) | byte(size&0x0f)
+		for size >>= 4; size > 0; size >>= 7 {
+			pack.WriteByte(b | 0x80)
+			b = byte(size & 0x7f)
+		}
+		pack.WriteByte(b)
+		z := zlib.NewWriter(&pack)
+		z.Write(content)
+		z.Close()
+		return pack.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		pack    []byte
+		wantErr string
+	}{
+		{
+			name:    "commit larger than the limit",
+			pack:    packWithObject(packObjCommit, 1<<40, []byte("tree")),
+			wantErr: "exceeds the gateway's limit",
+		},
+		{
+			name:    "commit inflating past its header size",
+			pack:    packWithObject(packObjCommit, 4, make([]byte, 1<<20)),
+			wantErr: "does not match its header size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readPackCommits(bufio.NewReader(bytes.NewReader(tt.pack)), 40)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -2,42 +2,150 @@ package gateway
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
-// Server is the main gateway server that runs both the proxy and API server.
+// Server is the main gateway server that runs both the proxy and API server,
+// and optionally a GitHub Enterprise Server compatible HTTPS endpoint.
 type Server struct {
 	proxy     *Proxy
 	apiServer *APIServer
+
+	tlsAddr     string
+	tlsCert     *tls.Certificate
+	clientToken string
+
+	egress     *EgressProxy
+	egressAddr string
+	audit      *AuditLog
+
+	ssh     *SSHServer
+	sshAddr string
+
+	metrics   *Metrics
+	readiness *readiness
 }
 
 // NewServer creates a new gateway server with the given config.
-// It resolves GitHub authentication automatically.
+// It resolves authentication for the project host automatically.
 func NewServer(config ProxyConfig) (*Server, error) {
-	ghAuth, err := NewGitHubAuth()
+	ghAuth, err := NewGitHubAuth(config.Host)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize GitHub auth: %w", err)
 	}
 
-	return &Server{
-		proxy:     NewProxy(config, ghAuth),
-		apiServer: NewAPIServer(config, ghAuth),
-	}, nil
+	return NewServerWithAuth(config, ghAuth), nil
 }
 
 // NewServerWithAuth creates a new gateway server with explicit auth.
 func NewServerWithAuth(config ProxyConfig, ghAuth *GitHubAuth) *Server {
-	return &Server{
+	s := &Server{
 		proxy:     NewProxy(config, ghAuth),
 		apiServer: NewAPIServer(config, ghAuth),
+		metrics:   NewMetrics(),
+	}
+	s.readiness = newReadiness(s.apiServer.forge, s.apiServer.httpClient, ghAuth.Token)
+	// Without an audit log, requests still feed the metrics.
+	metricsOnly := &AuditLog{now: time.Now, metrics: s.metrics}
+	s.proxy.audit = metricsOnly
+	s.apiServer.audit = metricsOnly
+	return s
+}
+
+// EnableTLS makes Run serve the proxy and API server over HTTPS, using the
+// PEM-encoded certificate and key. Unless addr is empty, Run also serves the
+// GitHub Enterprise Server URL layout over HTTPS on addr. This lets the real
+// gh CLI use the gateway as its GH_HOST.
+func (s *Server) EnableTLS(addr string, certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	s.tlsAddr = addr
+	s.tlsCert = &cert
+	return nil
+}
+
+// EnableClientAuth makes the proxy, API server, and GitHub Enterprise Server
+// endpoint serve only requests that present token, such as
+// "Authorization: Bearer <token>", so that only the session's agent can use
+// the gateway's credentials. The health endpoints stay open.
+func (s *Server) EnableClientAuth(token string) {
+	s.clientToken = token
+}
+
+// EnableAuditLog records every request served by the proxy and API server
+// in log.
+func (s *Server) EnableAuditLog(log *AuditLog) {
+	log.metrics = s.metrics
+	s.audit = log
+	s.proxy.audit = log
+	s.apiServer.audit = log
+	if s.egress != nil {
+		s.egress.audit = log
 	}
 }
 
+// EnableApprovals makes the proxy and API server park requests that need
+// approval in queue until the host user decides on them, instead of denying
+// them.
+func (s *Server) EnableApprovals(queue *ApprovalQueue) {
+	s.proxy.approvals = queue
+	s.apiServer.approvals = queue
+}
+
+// EnableCache makes the proxy serve fetches of mirrored repositories from
+// cache, and the API server revalidate cached API responses.
+func (s *Server) EnableCache(cache *Cache) {
+	s.proxy.cache = cache
+	s.apiServer.cache = cache
+}
+
+// EnableRateLimit makes the API server track and limit its requests with
+// limiter instead of its own, such as one sharing its state with the
+// gateways of other sessions.
+func (s *Server) EnableRateLimit(limiter *RateLimiter) {
+	s.apiServer.rateLimit = limiter
+}
+
+// EnableEgress makes Run also serve an HTTP forward proxy on addr that
+// allows only the destinations matching allow. See EgressPolicy for the
+// pattern syntax.
+func (s *Server) EnableEgress(addr string, allow []string) {
+	s.egress = NewEgressProxy(allow)
+	s.egress.audit = s.audit
+	s.egressAddr = addr
+}
+
+// EnableSSH makes Run also serve git over SSH on addr, with the
+// PEM-encoded Ed25519 host key, to clients authenticating with
+// authorizedKey. See SSHServer.
+func (s *Server) EnableSSH(addr string, hostKeyPEM []byte, authorizedKey string) error {
+	server, err := NewSSHServer(s.proxy, hostKeyPEM, authorizedKey)
+	if err != nil {
+		return err
+	}
+	// The upstream is reached with ssh, which needs the user's passwd entry.
+	if home, err := os.UserHomeDir(); err == nil {
+		if err := ensurePasswdEntry("/etc/passwd", home); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: git over SSH may fail: %v\n", err)
+		}
+	}
+	s.ssh = server
+	s.sshAddr = addr
+	return nil
+}
+
 // Run starts both servers. Proxy listens on proxyAddr and the API server
 // listens on apiAddr. It blocks until an OS interrupt signal is received,
 // then shuts down both servers gracefully.
@@ -48,36 +156,98 @@ func (s *Server) Run(proxyAddr, apiAddr string) error {
 }
 
 // RunWithContext starts both servers and blocks until the context is cancelled
-// or a server error occurs, then shuts down gracefully.
+// or a server error occurs, then shuts down gracefully. Both servers also
+// serve /healthz, /readyz, and /metrics.
 func (s *Server) RunWithContext(ctx context.Context, proxyAddr, apiAddr string) error {
 	proxyServer := &http.Server{
 		Addr:    proxyAddr,
-		Handler: s.proxy,
+		Handler: s.withHealth(s.proxy),
 	}
 	apiHTTPServer := &http.Server{
 		Addr:    apiAddr,
-		Handler: s.apiServer,
+		Handler: s.withHealth(s.apiServer),
+	}
+
+	var tlsServer *http.Server
+	if s.tlsCert != nil {
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{*s.tlsCert}}
+		proxyServer.TLSConfig = tlsConfig
+		apiHTTPServer.TLSConfig = tlsConfig
+		if s.tlsAddr != "" {
+			tlsServer = &http.Server{
+				Addr:      s.tlsAddr,
+				Handler:   s.requireToken(&enterpriseHandler{proxy: s.proxy, apiServer: s.apiServer}),
+				TLSConfig: tlsConfig,
+			}
+		}
 	}
 
-	errCh := make(chan error, 2)
+	var egressServer *http.Server
+	if s.egress != nil {
+		egressServer = &http.Server{
+			Addr:    s.egressAddr,
+			Handler: s.requireProxyToken(s.egress),
+		}
+	}
+
+	var sshListener net.Listener
+	if s.ssh != nil {
+		var err error
+		sshListener, err = net.Listen("tcp", s.sshAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for SSH: %w", err)
+		}
+	}
+
+	errCh := make(chan error, 5)
 
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		if err := proxyServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listenAndServe(proxyServer); err != nil && err != http.ErrServerClosed {
 			errCh <- fmt.Errorf("proxy server error: %w", err)
 		}
 	}()
 
 	go func() {
 		defer wg.Done()
-		if err := apiHTTPServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listenAndServe(apiHTTPServer); err != nil && err != http.ErrServerClosed {
 			errCh <- fmt.Errorf("API server error: %w", err)
 		}
 	}()
 
+	if tlsServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tlsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("TLS server error: %w", err)
+			}
+		}()
+	}
+
+	if egressServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := egressServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("egress proxy error: %w", err)
+			}
+		}()
+	}
+
+	if sshListener != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.ssh.Serve(sshListener); err != nil && err != errSSHServerClosed {
+				errCh <- fmt.Errorf("SSH server error: %w", err)
+			}
+		}()
+	}
+
 	select {
 	case <-ctx.Done():
 		fmt.Fprintf(os.Stderr, "shutting down\n")
@@ -89,7 +259,51 @@ func (s *Server) RunWithContext(ctx context.Context, proxyAddr, apiAddr string)
 	shutdownCtx := context.Background()
 	proxyServer.Shutdown(shutdownCtx)
 	apiHTTPServer.Shutdown(shutdownCtx)
+	if tlsServer != nil {
+		tlsServer.Shutdown(shutdownCtx)
+	}
+	if egressServer != nil {
+		egressServer.Shutdown(shutdownCtx)
+	}
+	if s.ssh != nil {
+		s.ssh.Close()
+	}
 
 	wg.Wait()
 	return nil
 }
+
+// listenAndServe serves HTTPS if server has a TLS configuration, and plain
+// HTTP otherwise.
+func listenAndServe(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// enterpriseHandler serves the GitHub Enterprise Server URL layout, so that
+// gh and git can use the gateway as their GitHub host. Requests under /api/
+// (/api/v3/... and /api/graphql) go to the API server, and everything else
+// is a git request for /{owner}/{repo}.git/{operation} on the project host.
+type enterpriseHandler struct {
+	proxy     *Proxy
+	apiServer *APIServer
+}
+
+// ServeHTTP routes the request to the API server or the git proxy.
+func (h *enterpriseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		h.apiServer.ServeHTTP(w, r)
+		return
+	}
+
+	// Rewrite the path to the proxy's /{host}/{owner}/{repo}.git layout.
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = "/" + h.proxy.config.host() + r.URL.Path
+	r2.URL.RawPath = ""
+	h.proxy.ServeHTTP(w, r2)
+}
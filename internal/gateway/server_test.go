@@ -2,7 +2,13 @@ package gateway
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -123,3 +129,208 @@ func TestServer_RunWithContext_BadAddress(t *testing.T) {
 	err := srv.RunWithContext(t.Context(), "127.0.0.1:0", "invalid-address-::::")
 	require.Error(t, err)
 }
+
+// generateTestCertificate creates a session CA and a gateway certificate
+// for hosts signed by it, returning the CA certificate and the gateway's
+// certificate and key.
+func generateTestCertificate(t *testing.T, hosts ...string) ([]byte, []byte, []byte) {
+	t.Helper()
+	caCertPEM, caKeyPEM, err := GenerateCA()
+	require.NoError(t, err)
+	certPEM, keyPEM, err := GenerateCertificate(caCertPEM, caKeyPEM, hosts...)
+	require.NoError(t, err)
+	return caCertPEM, certPEM, keyPEM
+}
+
+func TestServer_EnableTLS(t *testing.T) {
+	_, certPEM, keyPEM := generateTestCertificate(t, "gateway")
+	var err error
+
+	srv := NewServerWithAuth(ProxyConfig{AllowedOwner: "test-owner", AllowedRepo: "test-repo"}, NewGitHubAuthFromToken("test-token"))
+
+	err = srv.EnableTLS("127.0.0.1:0", []byte("not a cert"), keyPEM)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load TLS certificate")
+
+	require.NoError(t, srv.EnableTLS("127.0.0.1:0", certPEM, keyPEM))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.RunWithContext(ctx, "127.0.0.1:0", "127.0.0.1:0")
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunWithContext did not return after context cancellation")
+	}
+}
+
+func TestServer_EnableSSH(t *testing.T) {
+	hostKey, _, err := GenerateSSHKey()
+	require.NoError(t, err)
+	_, clientPublicKey, err := GenerateSSHKey()
+	require.NoError(t, err)
+
+	srv := NewServerWithAuth(ProxyConfig{AllowedOwner: "test-owner", AllowedRepo: "test-repo"}, NewGitHubAuthFromToken("test-token"))
+
+	err = srv.EnableSSH("127.0.0.1:0", []byte("not a key"), clientPublicKey)
+	require.ErrorContains(t, err, "failed to load SSH host key")
+	err = srv.EnableSSH("127.0.0.1:0", hostKey, "ssh-rsa AAAAB3NzaC1yc2E=")
+	require.ErrorContains(t, err, "failed to load SSH authorized key")
+
+	require.NoError(t, srv.EnableSSH("127.0.0.1:0", hostKey, clientPublicKey))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.RunWithContext(ctx, "127.0.0.1:0", "127.0.0.1:0")
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunWithContext did not return after context cancellation")
+	}
+}
+
+func TestEnterpriseHandler(t *testing.T) {
+	var gotPaths []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPaths = append(gotPaths, r.URL.Path)
+		if r.URL.Path == "/repos/test-owner/test-repo/pulls" {
+			w.Header().Set("Link", `<`+"http://"+r.Host+`/repos/test-owner/test-repo/pulls?page=2>; rel="next"`)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	config := ProxyConfig{AllowedOwner: "test-owner", AllowedRepo: "test-repo"}
+	ghAuth := NewGitHubAuthFromToken("test-token")
+	handler := &enterpriseHandler{
+		proxy:     NewTestProxy(config, ghAuth, upstream.URL),
+		apiServer: NewTestAPIServer(config, ghAuth, upstream.URL),
+	}
+
+	caCertPEM, certPEM, keyPEM := generateTestCertificate(t, "127.0.0.1")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	defer server.Close()
+
+	// Trust only the session CA, as the agent does.
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caCertPEM))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		wantStatus   int
+		wantUpstream string
+		wantLink     string
+	}{
+		{
+			name:         "REST API request",
+			method:       http.MethodGet,
+			path:         "/api/v3/repos/test-owner/test-repo/pulls",
+			wantStatus:   http.StatusOK,
+			wantUpstream: "/repos/test-owner/test-repo/pulls",
+			wantLink:     `<` + server.URL + `/api/v3/repos/test-owner/test-repo/pulls?page=2>; rel="next"`,
+		},
+		{
+			name:       "REST API request outside the operations list",
+			method:     http.MethodDelete,
+			path:       "/api/v3/repos/test-owner/test-repo",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:         "GraphQL request",
+			method:       http.MethodPost,
+			path:         "/api/graphql",
+			body:         `{"query":"{ viewer { login } }"}`,
+			wantStatus:   http.StatusOK,
+			wantUpstream: "/graphql",
+		},
+		{
+			name:         "git request",
+			method:       http.MethodGet,
+			path:         "/test-owner/test-repo.git/info/refs?service=git-upload-pack",
+			wantStatus:   http.StatusOK,
+			wantUpstream: "/test-owner/test-repo.git/info/refs",
+		},
+		{
+			name:       "git push to another repository",
+			method:     http.MethodGet,
+			path:       "/other-owner/other-repo.git/info/refs?service=git-receive-pack",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPaths = nil
+
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantUpstream == "" {
+				assert.Empty(t, gotPaths)
+			} else {
+				assert.Equal(t, []string{tt.wantUpstream}, gotPaths)
+			}
+			assert.Equal(t, tt.wantLink, resp.Header.Get("Link"))
+		})
+	}
+}
+
+func TestGenerateCertificate(t *testing.T) {
+	caCertPEM, certPEM, keyPEM := generateTestCertificate(t, "gateway", "127.0.0.1")
+
+	_, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	assert.False(t, cert.IsCA)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caCertPEM))
+	for _, host := range []string{"gateway", "127.0.0.1"} {
+		_, err := cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+		assert.NoError(t, err, host)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: "github.com", Roots: roots})
+	assert.Error(t, err)
+
+	// Another session's CA does not vouch for the certificate.
+	otherCAPEM, _, _ := generateTestCertificate(t, "gateway")
+	otherRoots := x509.NewCertPool()
+	require.True(t, otherRoots.AppendCertsFromPEM(otherCAPEM))
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: "gateway", Roots: otherRoots})
+	assert.Error(t, err)
+
+	_, _, err = GenerateCertificate([]byte("not a cert"), nil, "gateway")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load CA")
+}
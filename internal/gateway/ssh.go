@@ -0,0 +1,236 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// errSSHServerClosed is returned by SSHServer.Serve after Close.
+var errSSHServerClosed = errors.New("gateway: SSH server closed")
+
+const (
+	// sshHandshakeTimeout bounds the key exchange and authentication of a
+	// connection.
+	sshHandshakeTimeout = 30 * time.Second
+	// sshMaxAuthAttempts bounds the keys a client can try.
+	sshMaxAuthAttempts = 6
+)
+
+// SSHServer serves git over SSH to the agent, so that remotes such as
+// git@github.com:owner/repo.git work through the gateway. It accepts a
+// single client key, and runs only git-upload-pack and git-receive-pack,
+// which the proxy relays to the forge under the same policy as git over
+// HTTP (see Proxy.serveSSH).
+type SSHServer struct {
+	config  *ssh.ServerConfig
+	handler func(ctx context.Context, session *sshSession) uint32
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewSSHServer creates an SSH server for proxy, identified by the
+// PEM-encoded host key in the OpenSSH format, which accepts clients
+// authenticating with authorizedKey, a key in the authorized_keys format.
+// GenerateSSHKey generates both.
+func NewSSHServer(proxy *Proxy, hostKeyPEM []byte, authorizedKey string) (*SSHServer, error) {
+	hostKey, err := ssh.ParsePrivateKey(hostKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH host key: %w", err)
+	}
+	clientKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH authorized key: %w", err)
+	}
+
+	config := &ssh.ServerConfig{
+		MaxAuthTries:  sshMaxAuthAttempts,
+		ServerVersion: "SSH-2.0-claude-forge-gateway",
+		// The user name is ignored.
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, fmt.Errorf("unknown public key")
+			}
+			return &ssh.Permissions{}, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	return &SSHServer{
+		config:    config,
+		handler:   proxy.serveSSH,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve accepts connections on l until Close is called, then returns
+// errSSHServerClosed.
+func (s *SSHServer) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return errSSHServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return errSSHServerClosed
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return errSSHServerClosed
+		}
+		go func() {
+			defer s.untrack(conn)
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Close stops the listeners and closes every connection, which ends their
+// git commands.
+func (s *SSHServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+func (s *SSHServer) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *SSHServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// serveConn serves a connection until the client disconnects, then ends
+// the commands still running.
+func (s *SSHServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(sshHandshakeTimeout))
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+	conn.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(reqs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveChannel(ctx, newChannel)
+		}()
+	}
+	cancel()
+	wg.Wait()
+}
+
+// serveChannel serves a session channel, which runs one command.
+// Environment variables are accepted before the command; shells,
+// terminals, and subsystems are refused. The command is cancelled when the
+// client closes the channel.
+func (s *SSHServer) serveChannel(ctx context.Context, newChannel ssh.NewChannel) {
+	ch, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	env := make(map[string]string)
+	var done chan struct{}
+	for req := range reqs {
+		switch req.Type {
+		case "env":
+			var msg struct{ Name, Value string }
+			ok := done == nil && ssh.Unmarshal(req.Payload, &msg) == nil
+			if ok {
+				env[msg.Name] = msg.Value
+			}
+			req.Reply(ok, nil)
+		case "exec":
+			var msg struct{ Command string }
+			ok := done == nil && ssh.Unmarshal(req.Payload, &msg) == nil
+			req.Reply(ok, nil)
+			if ok {
+				done = make(chan struct{})
+				go func() {
+					defer close(done)
+					status := s.handler(ctx, &sshSession{
+						command: msg.Command,
+						env:     env,
+						stdin:   ch,
+						stdout:  ch,
+						stderr:  ch.Stderr(),
+					})
+					ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+					ch.CloseWrite()
+					ch.Close()
+				}()
+			}
+		default:
+			req.Reply(false, nil)
+		}
+	}
+
+	// The client closed the channel, or the connection.
+	cancel()
+	if done != nil {
+		<-done
+	}
+}
+
+// sshSession is a command the client runs on a session channel.
+type sshSession struct {
+	command string
+	env     map[string]string
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
@@ -0,0 +1,369 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSSHServer serves proxy over SSH on a local port, with the upstream
+// commands run on the bare repositories of upstream, and points git's ssh
+// at it. It returns the gateway's URL, which repository paths are appended to.
+func newTestSSHServer(t *testing.T, proxy *Proxy, upstream *gitTestUpstream) string {
+	t.Helper()
+	if _, err := exec.LookPath("ssh"); err != nil {
+		t.Skip("ssh is not installed")
+	}
+
+	proxy.sshCommand = func(ctx context.Context, gr *gitRequest, service, gitProtocol string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "git", strings.TrimPrefix(service, "git-"), filepath.Join(upstream.root, gr.Owner, gr.Repo+".git"))
+		cmd.Env = append(os.Environ(), "GIT_PROTOCOL="+gitProtocol)
+		return cmd
+	}
+
+	hostKey, hostPublicKey, err := GenerateSSHKey()
+	require.NoError(t, err)
+	clientKey, clientPublicKey, err := GenerateSSHKey()
+	require.NoError(t, err)
+	server, err := NewSSHServer(proxy, hostKey, clientPublicKey)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	port := l.Addr().(*net.TCPAddr).Port
+
+	dir := t.TempDir()
+	identity := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(identity, clientKey, 0o600))
+	knownHosts := filepath.Join(dir, "known_hosts")
+	require.NoError(t, os.WriteFile(knownHosts, []byte(fmt.Sprintf("[127.0.0.1]:%d %s\n", port, hostPublicKey)), 0o600))
+	t.Setenv("GIT_SSH_COMMAND", fmt.Sprintf("ssh -F /dev/null -i %s -o IdentitiesOnly=yes -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes -o BatchMode=yes", identity, knownHosts))
+
+	return fmt.Sprintf("ssh://git@127.0.0.1:%d", port)
+}
+
+func TestSSHServer_Fetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+	}{
+		{name: "protocol v0", protocol: "0"},
+		{name: "protocol v2", protocol: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newGitTestUpstream(t)
+			seed := t.TempDir()
+			runGit(t, seed, "init", "--initial-branch=main")
+			runGit(t, seed, "commit", "--allow-empty", "-m", "initial")
+			runGit(t, seed, "push", "--quiet", upstream.URL+"/my-owner/my-repo.git", "main")
+
+			proxy := NewTestProxy(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"},
+				NewGitHubAuthFromToken("test-token"), upstream.URL)
+			logBuf := &syncBuffer{}
+			proxy.audit = NewAuditLog(logBuf, "abc12345")
+			gatewayURL := newTestSSHServer(t, proxy, upstream)
+
+			dir := t.TempDir()
+			runGit(t, dir, "-c", "protocol.version="+tt.protocol, "clone", "--quiet", gatewayURL+"/github.com/my-owner/my-repo.git", ".")
+			assert.Equal(t, runGit(t, seed, "rev-parse", "HEAD"), runGit(t, dir, "rev-parse", "HEAD"))
+
+			entry := readAuditEntry(t, logBuf)
+			assert.Equal(t, "ssh", entry.Server)
+			assert.Equal(t, "git-upload-pack", entry.Method)
+			assert.Equal(t, "/github.com/my-owner/my-repo.git", entry.Path)
+			assert.Equal(t, "my-owner", entry.Owner)
+			assert.Equal(t, "my-repo", entry.Repo)
+			assert.Equal(t, AuditAllow, entry.Decision)
+			assert.Equal(t, 200, entry.Status)
+			assert.Positive(t, entry.BytesOut)
+		})
+	}
+}
+
+func TestSSHServer_Denied(t *testing.T) {
+	upstream := newGitTestUpstream(t)
+	runGit(t, upstream.root, "init", "--bare", "--initial-branch=main", filepath.Join(upstream.root, "other-owner", "other-repo.git"))
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantOutput string
+	}{
+		{
+			name:       "fetch from another repository",
+			args:       []string{"ls-remote", "/github.com/other-owner/other-repo.git"},
+			wantOutput: "gateway: forbidden: access denied for this repository",
+		},
+		{
+			name:       "push to another repository",
+			args:       []string{"push", "/github.com/other-owner/other-repo.git", "HEAD:main"},
+			wantOutput: "gateway: forbidden: access denied for this repository",
+		},
+		{
+			name:       "host not configured",
+			args:       []string{"ls-remote", "/gitlab.com/my-owner/my-repo.git"},
+			wantOutput: "gateway: forbidden: host gitlab.com is not configured in the gateway",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := NewTestProxy(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo", Policy: &Policy{Repos: RepoPolicy{Read: AccessList{Allow: []string{"my-owner/*"}}}}},
+				NewGitHubAuthFromToken("test-token"), upstream.URL)
+			logBuf := &syncBuffer{}
+			proxy.audit = NewAuditLog(logBuf, "abc12345")
+			gatewayURL := newTestSSHServer(t, proxy, upstream)
+			dir := t.TempDir()
+			runGit(t, dir, "init", "--initial-branch=main")
+			runGit(t, dir, "commit", "--allow-empty", "-m", "initial")
+
+			args := append([]string{tt.args[0], gatewayURL + tt.args[1]}, tt.args[2:]...)
+			output, err := tryGit(dir, args...)
+			require.Error(t, err, output)
+			assert.Contains(t, output, tt.wantOutput)
+
+			entry := readAuditEntry(t, logBuf)
+			assert.Equal(t, AuditDeny, entry.Decision)
+			assert.Equal(t, 403, entry.Status)
+		})
+	}
+}
+
+func TestSSHServer_Push(t *testing.T) {
+	upstream := newGitTestUpstream(t)
+	seed := t.TempDir()
+	runGit(t, seed, "init", "--initial-branch=main")
+	runGit(t, seed, "commit", "--allow-empty", "-m", "initial")
+	runGit(t, seed, "push", upstream.URL+"/my-owner/my-repo.git", "main", "main:feature")
+	bare := filepath.Join(upstream.root, "my-owner", "my-repo.git")
+
+	proxy := NewTestProxy(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"},
+		NewGitHubAuthFromToken("test-token"), upstream.URL)
+	gatewayURL := newTestSSHServer(t, proxy, upstream)
+
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, dir string)
+		pushArgs   []string
+		wantRef    string // ref that must point at HEAD after the push
+		wantErr    bool
+		wantOutput string
+	}{
+		{
+			name:     "new branch is allowed",
+			setup:    func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "new") },
+			pushArgs: []string{"HEAD:refs/heads/topic"},
+			wantRef:  "refs/heads/topic",
+		},
+		{
+			name:     "fast-forward is allowed",
+			setup:    func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "next") },
+			pushArgs: []string{"HEAD:feature"},
+			wantRef:  "refs/heads/feature",
+		},
+		{
+			name: "push larger than the channel window is allowed",
+			setup: func(t *testing.T, dir string) {
+				// The SSH channel window is 2 MiB.
+				data := make([]byte, 6<<20)
+				rand.Read(data)
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "large"), data, 0o644))
+				runGit(t, dir, "add", "large")
+				runGit(t, dir, "commit", "-m", "large")
+			},
+			pushArgs: []string{"HEAD:refs/heads/large"},
+			wantRef:  "refs/heads/large",
+		},
+		{
+			name:       "protected branch is rejected",
+			setup:      func(t *testing.T, dir string) { runGit(t, dir, "commit", "--allow-empty", "-m", "direct") },
+			pushArgs:   []string{"HEAD:main"},
+			wantErr:    true,
+			wantOutput: "[remote rejected] HEAD -> main (protected ref cannot be pushed to through the gateway)",
+		},
+		{
+			name:       "deletion is rejected",
+			pushArgs:   []string{"--delete", "feature"},
+			wantErr:    true,
+			wantOutput: "[remote rejected] feature (deleting refs is not allowed through the gateway)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			runGit(t, dir, "clone", "--quiet", gatewayURL+"/github.com/my-owner/my-repo.git", ".")
+			runGit(t, dir, "checkout", "--quiet", "feature")
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+			before := runGit(t, bare, "for-each-ref")
+
+			output, err := tryGit(dir, append([]string{"push", "origin"}, tt.pushArgs...)...)
+
+			if tt.wantErr {
+				require.Error(t, err, output)
+				assert.Contains(t, output, tt.wantOutput)
+				assert.Equal(t, before, runGit(t, bare, "for-each-ref"))
+				return
+			}
+			require.NoError(t, err, output)
+			assert.Equal(t, runGit(t, dir, "rev-parse", "HEAD"), runGit(t, bare, "rev-parse", tt.wantRef))
+		})
+	}
+}
+
+func TestSSHServer_RejectsOtherKeys(t *testing.T) {
+	upstream := newGitTestUpstream(t)
+	proxy := NewTestProxy(ProxyConfig{AllowedOwner: "my-owner", AllowedRepo: "my-repo"},
+		NewGitHubAuthFromToken("test-token"), upstream.URL)
+	gatewayURL := newTestSSHServer(t, proxy, upstream)
+
+	otherKey, _, err := GenerateSSHKey()
+	require.NoError(t, err)
+	identity := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(identity, otherKey, 0o600))
+	t.Setenv("GIT_SSH_COMMAND", regexp.MustCompile(`-i \S+`).ReplaceAllString(os.Getenv("GIT_SSH_COMMAND"), "-i "+identity))
+
+	output, err := tryGit(t.TempDir(), "ls-remote", gatewayURL+"/github.com/my-owner/my-repo.git")
+	require.Error(t, err, output)
+	assert.Contains(t, output, "Permission denied (publickey)")
+}
+
+func TestNewSSHServer_InvalidKeys(t *testing.T) {
+	hostKey, publicKey, err := GenerateSSHKey()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		hostKey       []byte
+		authorizedKey string
+		wantErr       string
+	}{
+		{name: "keys", hostKey: hostKey, authorizedKey: publicKey},
+		{name: "key with comment", hostKey: hostKey, authorizedKey: publicKey + " agent@forge"},
+		{name: "invalid host key", hostKey: []byte("not a key"), authorizedKey: publicKey, wantErr: "failed to load SSH host key"},
+		{name: "missing authorized key", hostKey: hostKey, authorizedKey: "ssh-ed25519", wantErr: "failed to load SSH authorized key"},
+		{name: "invalid base64", hostKey: hostKey, authorizedKey: "ssh-ed25519 !!!", wantErr: "failed to load SSH authorized key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSSHServer(&Proxy{}, tt.hostKey, tt.authorizedKey)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestParseSSHCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		wantService string
+		wantPath    string
+		wantErr     string
+	}{
+		{
+			name:        "upload-pack",
+			command:     "git-upload-pack '/github.com/owner/repo.git'",
+			wantService: "git-upload-pack",
+			wantPath:    "/github.com/owner/repo.git",
+		},
+		{
+			name:        "receive-pack without leading slash",
+			command:     "git-receive-pack 'github.com/owner/repo'",
+			wantService: "git-receive-pack",
+			wantPath:    "/github.com/owner/repo",
+		},
+		{
+			name:    "other command",
+			command: "sh -c id",
+			wantErr: `unsupported command "sh -c id"`,
+		},
+		{
+			name:    "shell characters",
+			command: "git-upload-pack '/github.com/owner/repo.git'; id",
+			wantErr: "invalid repository path",
+		},
+		{
+			name:    "missing path",
+			command: "git-upload-pack",
+			wantErr: "invalid repository path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repoPath, err := parseSSHCommand(tt.command)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantService, service)
+			assert.Equal(t, tt.wantPath, repoPath)
+		})
+	}
+}
+
+func TestUpstreamSSHCommand(t *testing.T) {
+	gr := &gitRequest{Host: "github.example.corp:8443", Owner: "owner", Repo: "repo"}
+
+	cmd := upstreamSSHCommand(context.Background(), gr, "git-upload-pack", "version=2")
+
+	assert.Equal(t, []string{
+		"ssh", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes", "-o", "SendEnv=GIT_PROTOCOL",
+		"--", "git@github.example.corp", "git-upload-pack 'owner/repo.git'",
+	}, cmd.Args)
+	assert.Contains(t, cmd.Env, "GIT_PROTOCOL=version=2")
+}
+
+func TestEnsurePasswdEntry(t *testing.T) {
+	tests := []struct {
+		name   string
+		passwd string
+		want   string
+	}{
+		{
+			name:   "existing entry",
+			passwd: fmt.Sprintf("root:x:0:0:root:/root:/bin/sh\nme:x:%d:%d::/home/me:/bin/sh\n", os.Getuid(), os.Getgid()),
+			want:   fmt.Sprintf("root:x:0:0:root:/root:/bin/sh\nme:x:%d:%d::/home/me:/bin/sh\n", os.Getuid(), os.Getgid()),
+		},
+		{
+			name:   "missing entry",
+			passwd: "nobody:x:65534:65534:nobody:/:/sbin/nologin",
+			want:   fmt.Sprintf("nobody:x:65534:65534:nobody:/:/sbin/nologin\nforge:x:%d:%d:claude-forge:/home/user:/sbin/nologin\n", os.Getuid(), os.Getgid()),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "passwd")
+			require.NoError(t, os.WriteFile(path, []byte(tt.passwd), 0o644))
+
+			require.NoError(t, ensurePasswdEntry(path, "/home/user"))
+
+			got, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// sshGitServices are the git commands the SSH server runs.
+var sshGitServices = []string{"git-upload-pack", "git-receive-pack"}
+
+// sshPathSegment matches a segment of an owner or repository name that can
+// be passed to the upstream in a quoted command.
+var sshPathSegment = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// gitProtocolValue matches the GIT_PROTOCOL values passed to the upstream,
+// such as "version=2".
+var gitProtocolValue = regexp.MustCompile(`^[A-Za-z0-9=:._-]+$`)
+
+// upstreamSSHCommand returns the command that runs service for the
+// repository of gr on its forge host over SSH. It authenticates with the
+// host user's SSH keys, mounted at ~/.ssh, and only connects to hosts in
+// their known_hosts.
+func upstreamSSHCommand(ctx context.Context, gr *gitRequest, service, gitProtocol string) *exec.Cmd {
+	host := gr.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	args := []string{"-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes"}
+	env := os.Environ()
+	if gitProtocol != "" {
+		args = append(args, "-o", "SendEnv=GIT_PROTOCOL")
+		env = append(env, "GIT_PROTOCOL="+gitProtocol)
+	}
+	args = append(args, "--", "git@"+host, fmt.Sprintf("%s '%s/%s.git'", service, gr.Owner, gr.Repo))
+
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	cmd.Env = env
+	return cmd
+}
+
+// sshGitSession is a git command the agent runs over SSH.
+type sshGitSession struct {
+	stdin  *sshCounter
+	stdout *sshCounter
+	stderr io.Writer
+	env    map[string]string
+}
+
+// fail reports msg to the client on stderr, which git prints as the reason
+// the command failed, and records it as the reason in the audit log.
+func (s *sshGitSession) fail(ctx context.Context, status int, msg string) (int, uint32) {
+	fmt.Fprintf(s.stderr, "gateway: %s\n", msg)
+	annotateAudit(ctx, func(entry *AuditEntry) {
+		entry.Reason = msg
+	})
+	return status, 1
+}
+
+// start starts cmd with the session's stdout and stderr, and returns its
+// stdin. Copying the session's stdin is left to the caller, since the
+// client keeps it open while it waits for the command's output.
+func (s *sshGitSession) start(cmd *exec.Cmd) (io.WriteCloser, error) {
+	cmd.Stdout = s.stdout
+	cmd.Stderr = s.stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return stdin, nil
+}
+
+// wait waits for the upstream command cmd, and returns its outcome.
+func (s *sshGitSession) wait(ctx context.Context, cmd *exec.Cmd, host string) (int, uint32) {
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return http.StatusOK, 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0:
+		// The upstream reported the error on stderr, which the client got.
+		annotateAudit(ctx, func(entry *AuditEntry) {
+			entry.Reason = fmt.Sprintf("upstream %s exited with status %d", host, exitErr.ExitCode())
+		})
+		return http.StatusBadGateway, uint32(exitErr.ExitCode())
+	default:
+		return s.fail(ctx, http.StatusBadGateway, fmt.Sprintf("failed to run upstream %s: %v", host, err))
+	}
+}
+
+// serveSSH runs a git command the agent sent over SSH, such as
+//
+//	git-upload-pack '/github.com/owner/repo.git'
+//
+// for the remote ssh://git@gateway:2222/github.com/owner/repo.git, and
+// returns its exit status. The repository path has the proxy's
+// /{host}/{owner}/{repo}.git layout, and the same policy applies as to git
+// over HTTP. Allowed commands are relayed to the forge over SSH (see
+// upstreamSSHCommand), and fetches of mirrored repositories are served
+// from their mirror.
+//
+// Every command is recorded in the audit log, if one is set, as a request
+// of the "ssh" server whose method is the git service.
+func (p *Proxy) serveSSH(ctx context.Context, session *sshSession) uint32 {
+	service, repoPath, parseErr := parseSSHCommand(session.command)
+	entry := &AuditEntry{Server: "ssh", Method: service, Path: repoPath}
+	if parseErr != nil {
+		entry.Method = "exec"
+	}
+
+	s := &sshGitSession{
+		stdin:  &sshCounter{r: session.stdin},
+		stdout: &sshCounter{w: session.stdout},
+		stderr: session.stderr,
+		env:    session.env,
+	}
+	var exitStatus uint32
+	p.audit.record(ctx, entry, func(ctx context.Context) int {
+		var status int
+		if parseErr != nil {
+			status, exitStatus = s.fail(ctx, http.StatusBadRequest, parseErr.Error())
+		} else {
+			status, exitStatus = p.handleSSH(ctx, s, service, repoPath)
+		}
+		annotateAudit(ctx, func(entry *AuditEntry) {
+			entry.BytesIn = s.stdin.n.Load()
+			entry.BytesOut = s.stdout.n.Load()
+		})
+		return status
+	})
+	return exitStatus
+}
+
+// handleSSH checks the policy for a git command, then runs it.
+func (p *Proxy) handleSSH(ctx context.Context, s *sshGitSession, service, repoPath string) (int, uint32) {
+	gr, err := p.parseGitPath(strings.TrimSuffix(repoPath, ".git") + ".git/" + service)
+	if err != nil {
+		return s.fail(ctx, http.StatusBadRequest, err.Error())
+	}
+	annotateAudit(ctx, func(entry *AuditEntry) {
+		entry.Host = gr.Host
+		entry.Owner = gr.Owner
+		entry.Repo = gr.Repo
+		entry.Service = service
+	})
+
+	if !p.config.hasHost(gr.Host) {
+		return s.fail(ctx, http.StatusForbidden, fmt.Sprintf("forbidden: host %s is not configured in the gateway", gr.Host))
+	}
+	for _, segment := range strings.Split(gr.Owner+"/"+gr.Repo, "/") {
+		if !sshPathSegment.MatchString(segment) || segment == "." || segment == ".." {
+			return s.fail(ctx, http.StatusBadRequest, fmt.Sprintf("invalid repository path %q", repoPath))
+		}
+	}
+
+	allowed, err := p.isAllowed(ctx, gr, http.MethodPost)
+	if err != nil {
+		return s.fail(ctx, http.StatusForbidden, redact(fmt.Sprintf("forbidden: failed to check repository visibility: %v", err), p.token(gr)))
+	}
+	if !allowed {
+		return s.fail(ctx, http.StatusForbidden, "forbidden: access denied for this repository")
+	}
+
+	// Only pass on protocol versions, which the client asks for in
+	// GIT_PROTOCOL.
+	gitProtocol := s.env["GIT_PROTOCOL"]
+	if !gitProtocolValue.MatchString(gitProtocol) {
+		gitProtocol = ""
+	}
+
+	if service == "git-receive-pack" {
+		return p.handleSSHReceivePack(ctx, s, gr, p.sshCommand(ctx, gr, service, gitProtocol))
+	}
+
+	var cmd *exec.Cmd
+	if p.cache.mirrors(gr.Host, gr.Owner, gr.Repo) {
+		if dir, err := p.cache.updateMirror(ctx, p.forge(gr.Host), p.token(gr), gr.Host, gr.Owner, gr.Repo); err == nil {
+			cmd = exec.CommandContext(ctx, "git", "upload-pack", dir)
+			cmd.Env = append(os.Environ(), "GIT_PROTOCOL="+gitProtocol)
+			annotateAudit(ctx, func(entry *AuditEntry) {
+				entry.Cache = "mirror"
+			})
+		}
+	}
+	if cmd == nil {
+		cmd = p.sshCommand(ctx, gr, service, gitProtocol)
+	}
+
+	upstream, err := s.start(cmd)
+	if err != nil {
+		return s.fail(ctx, http.StatusBadGateway, fmt.Sprintf("failed to contact %s: %v", gr.Host, err))
+	}
+	go func() {
+		io.Copy(upstream, s.stdin)
+		upstream.Close()
+	}()
+	return s.wait(ctx, cmd, gr.Host)
+}
+
+// handleSSHReceivePack enforces the ref policy on a push over SSH before
+// relaying it. The upstream advertises its refs to the client first; the
+// client's commands and pack are then spooled to a temporary file while
+// they are inspected, and relayed unchanged if every update is allowed.
+// Otherwise the upstream gets no commands, and the client a report
+// rejecting them.
+func (p *Proxy) handleSSHReceivePack(ctx context.Context, s *sshGitSession, gr *gitRequest, cmd *exec.Cmd) (int, uint32) {
+	spool, err := os.CreateTemp("", "gateway-receive-pack-*")
+	if err != nil {
+		return s.fail(ctx, http.StatusInternalServerError, fmt.Sprintf("failed to buffer push: %v", err))
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	upstream, err := s.start(cmd)
+	if err != nil {
+		return s.fail(ctx, http.StatusBadGateway, fmt.Sprintf("failed to contact %s: %v", gr.Host, err))
+	}
+	// abort ends the upstream without updating anything.
+	abort := func() {
+		io.WriteString(upstream, "0000")
+		upstream.Close()
+		cmd.Wait()
+	}
+
+	limit := p.config.maxPushSize()
+	req, commits, err := readSSHPush(bufio.NewReader(io.TeeReader(&pushLimitReader{r: s.stdin, limit: limit}, spool)))
+	if err != nil {
+		abort()
+		if isPushTooLarge(err) {
+			return s.fail(ctx, http.StatusRequestEntityTooLarge, fmt.Sprintf("push exceeds the gateway's limit of %d bytes", limit))
+		}
+		return s.fail(ctx, http.StatusBadRequest, fmt.Sprintf("invalid receive-pack request: %v", err))
+	}
+	var refs []AuditRefUpdate
+	for _, u := range req.Updates {
+		refs = append(refs, AuditRefUpdate{Ref: u.Ref, OldOID: u.OldOID, NewOID: u.NewOID})
+	}
+	annotateAudit(ctx, func(entry *AuditEntry) {
+		entry.Refs = refs
+	})
+
+	reasons, err := p.checkRefUpdates(ctx, gr, req, func(int) (map[string][]string, error) {
+		return commits, nil
+	})
+	if err != nil {
+		abort()
+		return s.fail(ctx, http.StatusBadRequest, fmt.Sprintf("failed to inspect push: %v", err))
+	}
+
+	if len(reasons) == 0 {
+		if approvals := p.pushApprovals(gr, req); len(approvals) > 0 {
+			approved, reason := p.approvals.approve(ctx, ApprovalRequest{
+				Method: "git-receive-pack",
+				Path:   "/" + gr.Host + "/" + gr.Owner + "/" + gr.Repo + ".git",
+				Host:   gr.Host,
+				Owner:  gr.Owner,
+				Repo:   gr.Repo,
+				Refs:   refs,
+				Reason: strings.Join(approvals, "; "),
+			})
+			if !approved {
+				for _, u := range req.Updates {
+					reasons[u.Ref] = reason
+				}
+			}
+		}
+	}
+
+	if len(reasons) > 0 {
+		abort()
+		messages := rejectionMessages(req, reasons)
+		annotateAudit(ctx, func(entry *AuditEntry) {
+			entry.Decision = AuditDeny
+		})
+		if !req.hasCapability("report-status") && !req.hasCapability("report-status-v2") {
+			return s.fail(ctx, http.StatusForbidden, "forbidden: "+strings.Join(messages, "; "))
+		}
+		annotateAudit(ctx, func(entry *AuditEntry) {
+			entry.Reason = strings.Join(messages, "; ")
+		})
+		writeReceivePackReport(s.stdout, req, reasons)
+		return http.StatusOK, 0
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		abort()
+		return s.fail(ctx, http.StatusInternalServerError, fmt.Sprintf("failed to buffer push: %v", err))
+	}
+	go func() {
+		io.Copy(upstream, io.MultiReader(spool, s.stdin))
+		upstream.Close()
+	}()
+	status, exitStatus := s.wait(ctx, cmd, gr.Host)
+	p.cache.invalidateMirror(gr.Host, gr.Owner, gr.Repo)
+	return status, exitStatus
+}
+
+// readSSHPush reads a push up to the end of its pack, and returns its
+// commands and the parents of the pushed commits. Over SSH, the client
+// keeps sending until it reads the report, so the end of the push is found
+// by reading the pack.
+func readSSHPush(r *bufio.Reader) (*receivePackRequest, map[string][]string, error) {
+	req, err := readReceivePackRequest(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.hasCapability("push-options") {
+		for {
+			line, err := readPktLine(r)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read push options: %w", err)
+			}
+			if line == nil {
+				break
+			}
+		}
+	}
+
+	// Pushes that only delete refs have no pack.
+	hexLen := 0
+	for _, u := range req.Updates {
+		if !u.isDelete() {
+			hexLen = len(u.NewOID)
+			break
+		}
+	}
+	if hexLen == 0 {
+		return req, map[string][]string{}, nil
+	}
+
+	commits, err := readPackCommits(r, hexLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(r, make([]byte, hexLen/2)); err != nil {
+		return nil, nil, fmt.Errorf("failed to read pack checksum: %w", err)
+	}
+	return req, commits, nil
+}
+
+// parseSSHCommand parses the command git runs over SSH, such as
+// git-upload-pack '/github.com/owner/repo.git', into the git service and
+// the repository path.
+func parseSSHCommand(command string) (service, repoPath string, err error) {
+	service, arg, _ := strings.Cut(command, " ")
+	if !slices.Contains(sshGitServices, service) {
+		return "", "", fmt.Errorf("unsupported command %q: only %s are allowed", command, strings.Join(sshGitServices, " and "))
+	}
+
+	// git quotes the path in single quotes.
+	arg = strings.TrimSpace(arg)
+	if len(arg) >= 2 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+		arg = arg[1 : len(arg)-1]
+	}
+	if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\`$;&|<>(){}[]*?!~") {
+		return "", "", fmt.Errorf("invalid repository path %q: expected /{host}/{owner}/{repo}.git", arg)
+	}
+	return service, "/" + strings.TrimPrefix(arg, "/"), nil
+}
+
+// ensurePasswdEntry adds an entry for the current user to the passwd file
+// if it has none, with home as their home directory. ssh refuses to run for
+// a user without one, and reads the keys and known hosts in their home
+// directory. The gateway container runs as the host user, who has no entry
+// in the image.
+func ensurePasswdEntry(passwd, home string) error {
+	uid := strconv.Itoa(os.Getuid())
+	data, err := os.ReadFile(passwd)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", passwd, err)
+	}
+	for line := range strings.Lines(string(data)) {
+		if fields := strings.Split(line, ":"); len(fields) > 2 && fields[2] == uid {
+			return nil
+		}
+	}
+
+	f, err := os.OpenFile(passwd, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to add user %s to %s: %w", uid, passwd, err)
+	}
+	defer f.Close()
+	entry := fmt.Sprintf("forge:x:%s:%d:claude-forge:%s:/sbin/nologin\n", uid, os.Getgid(), home)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		entry = "\n" + entry
+	}
+	if _, err := f.WriteString(entry); err != nil {
+		return fmt.Errorf("failed to add user %s to %s: %w", uid, passwd, err)
+	}
+	return nil
+}
+
+// sshCounter counts the bytes read from r or written to w. The goroutines
+// relaying a session's stdin may still be running when it is read.
+type sshCounter struct {
+	r io.Reader
+	w io.Writer
+	n atomic.Int64
+}
+
+func (c *sshCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c *sshCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
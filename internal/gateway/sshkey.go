@@ -0,0 +1,31 @@
+package gateway
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// GenerateSSHKey generates an Ed25519 key for the gateway's SSH server: its
+// host key, or the key the agent authenticates with. It returns the private
+// key in the OpenSSH format, which ssh reads as an identity file, and the
+// public key in the authorized_keys format.
+func GenerateSSHKey() (privateKey []byte, publicKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "claude-forge")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode private key: %w", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+	return pem.EncodeToMemory(block), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))), nil
+}
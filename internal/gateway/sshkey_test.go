@@ -0,0 +1,35 @@
+package gateway
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateSSHKey(t *testing.T) {
+	privateKey, publicKey, err := GenerateSSHKey()
+	require.NoError(t, err)
+
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	require.NoError(t, err)
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	require.NoError(t, err)
+	assert.Equal(t, ssh.KeyAlgoED25519, pub.Type())
+	assert.Equal(t, pub.Marshal(), signer.PublicKey().Marshal())
+
+	// ssh reads the private key as an identity file.
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path, privateKey, 0o600))
+	output, err := exec.Command("ssh-keygen", "-y", "-f", path).CombinedOutput()
+	require.NoError(t, err, string(output))
+	assert.Equal(t, publicKey, strings.Join(strings.Fields(string(output))[:2], " "))
+}
@@ -1,14 +1,21 @@
 package gateway
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+)
 
 // NewTestProxy creates a Proxy with a custom upstream URL for testing.
+// The upstream serves both git and GitHub API requests.
 func NewTestProxy(config ProxyConfig, ghAuth *GitHubAuth, upstreamURL string) *Proxy {
 	return &Proxy{
-		config:      config,
-		ghAuth:      ghAuth,
-		upstreamURL: upstreamURL,
-		httpClient:  http.DefaultClient,
+		config:     config,
+		ghAuth:     ghAuth,
+		forges:     map[string]forge{strings.ToLower(config.host()): &githubForge{git: upstreamURL, api: upstreamURL}},
+		httpClient: http.DefaultClient,
+		visibility: newVisibilityCache(),
+		lfs:        newLFSTransfers(),
+		sshCommand: upstreamSSHCommand,
 	}
 }
 
@@ -17,7 +24,9 @@ func NewTestAPIServer(config ProxyConfig, ghAuth *GitHubAuth, upstreamURL string
 	return &APIServer{
 		config:      config,
 		ghAuth:      ghAuth,
+		forge:       &githubForge{git: upstreamURL, api: upstreamURL},
 		upstreamURL: upstreamURL,
 		httpClient:  http.DefaultClient,
+		visibility:  newVisibilityCache(),
 	}
 }
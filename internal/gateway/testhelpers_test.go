@@ -19,7 +19,7 @@ func TestNewTestProxy(t *testing.T) {
 	require.NotNil(t, proxy)
 	assert.Equal(t, "test-owner", proxy.config.AllowedOwner)
 	assert.Equal(t, "test-repo", proxy.config.AllowedRepo)
-	assert.Equal(t, "http://example.com", proxy.upstreamURL)
+	assert.Equal(t, "http://example.com", proxy.forge("github.com").gitURL())
 	assert.NotNil(t, proxy.httpClient)
 	assert.NotNil(t, proxy.ghAuth)
 }
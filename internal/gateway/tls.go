@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// certificateValidity is how long a generated CA or gateway certificate is
+// valid. Certificates are generated per session, so this only needs to
+// outlast one.
+const certificateValidity = 90 * 24 * time.Hour
+
+// GenerateCA creates a CA for one session, which signs the gateway's
+// certificate. Clients trust the gateway by adding the CA certificate to
+// their trust store. It returns the PEM-encoded certificate and private key.
+func GenerateCA() ([]byte, []byte, error) {
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "claude-forge session CA"},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	return createCertificate(template, nil, nil)
+}
+
+// GenerateCertificate creates a certificate for the gateway's HTTPS
+// listeners, valid for the given host names or IP addresses and signed by
+// the PEM-encoded CA certificate and key from GenerateCA. It returns the
+// PEM-encoded certificate and private key.
+func GenerateCertificate(caCertPEM, caKeyPEM []byte, hosts ...string) ([]byte, []byte, error) {
+	ca, err := tls.X509KeyPair(caCertPEM, caKeyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load CA: %w", err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "claude-forge gateway"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	return createCertificate(template, caCert, ca.PrivateKey)
+}
+
+// createCertificate creates a certificate from template with a new key,
+// signed by parent and its key, or self-signed if parent is nil.
+func createCertificate(template, parent *x509.Certificate, parentKey any) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	now := time.Now()
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-time.Hour)
+	template.NotAfter = now.Add(certificateValidity)
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
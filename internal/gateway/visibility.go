@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// visibilityTTL is how long the visibility of a repository is remembered.
+const visibilityTTL = 10 * time.Minute
+
+// visibilityCache remembers which repositories the forge API reported as
+// public, so that every fetch of a public dependency doesn't cost an API
+// request. Failed lookups are not remembered.
+type visibilityCache struct {
+	mu      sync.Mutex
+	entries map[string]visibilityEntry
+	now     func() time.Time
+}
+
+// visibilityEntry is a remembered visibility.
+type visibilityEntry struct {
+	public  bool
+	expires time.Time
+}
+
+func newVisibilityCache() *visibilityCache {
+	return &visibilityCache{
+		entries: make(map[string]visibilityEntry),
+		now:     time.Now,
+	}
+}
+
+// isPublic reports whether owner/repo on host is public, asking the forge f
+// unless the answer is remembered.
+func (c *visibilityCache) isPublic(ctx context.Context, client *http.Client, f forge, token, host, owner, repo string) (bool, error) {
+	key := strings.ToLower(host + "/" + owner + "/" + repo)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.public, nil
+	}
+
+	public, err := f.isPublic(ctx, client, token, owner, repo)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = visibilityEntry{public: public, expires: c.now().Add(visibilityTTL)}
+	c.mu.Unlock()
+	return public, nil
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisibilityCache(t *testing.T) {
+	requests := 0
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"private":false}`))
+	}))
+	defer server.Close()
+
+	now := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	cache := newVisibilityCache()
+	cache.now = func() time.Time { return now }
+	f := &githubForge{api: server.URL}
+	isPublic := func(repo string) (bool, error) {
+		return cache.isPublic(context.Background(), http.DefaultClient, f, "secret", "github.com", "owner", repo)
+	}
+
+	public, err := isPublic("lib")
+	require.NoError(t, err)
+	assert.True(t, public)
+
+	// The answer is remembered, case-insensitively.
+	public, err = isPublic("Lib")
+	require.NoError(t, err)
+	assert.True(t, public)
+	assert.Equal(t, 1, requests)
+
+	// Failed lookups are not remembered.
+	fail = true
+	_, err = isPublic("other")
+	require.Error(t, err)
+	_, err = isPublic("other")
+	require.Error(t, err)
+	assert.Equal(t, 3, requests)
+
+	// Remembered answers expire.
+	now = now.Add(visibilityTTL)
+	_, err = isPublic("lib")
+	require.Error(t, err)
+	assert.Equal(t, 4, requests)
+}
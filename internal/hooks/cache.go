@@ -0,0 +1,196 @@
+package hooks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michael-freling/claude-code-tools/internal/command"
+)
+
+// DefaultLookupCacheTTL is how long branch and pull request lookups are cached
+// by a long-lived evaluator.
+const DefaultLookupCacheTTL = time.Minute
+
+// LookupCache caches the git and gh lookups rules make, so a long-lived
+// evaluator doesn't fork git and gh for every tool call.
+//
+// A cached current branch is only reused while the repository's HEAD file is
+// unchanged, so switching branches is noticed immediately.
+type LookupCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	now      func() time.Time
+	branches map[string]branchCacheEntry
+	prBases  map[string]prBaseCacheEntry
+}
+
+type branchCacheEntry struct {
+	branch      string
+	headModTime time.Time
+	expiresAt   time.Time
+}
+
+type prBaseCacheEntry struct {
+	baseBranch string
+	expiresAt  time.Time
+}
+
+// NewLookupCache creates a cache whose entries expire after ttl.
+func NewLookupCache(ttl time.Duration) *LookupCache {
+	if ttl <= 0 {
+		ttl = DefaultLookupCacheTTL
+	}
+
+	return &LookupCache{
+		ttl:      ttl,
+		now:      time.Now,
+		branches: make(map[string]branchCacheEntry),
+		prBases:  make(map[string]prBaseCacheEntry),
+	}
+}
+
+// GitRunner returns a GitRunner that answers lookups from the cache and runs
+// them in dir when the rule doesn't pass a directory.
+func (c *LookupCache) GitRunner(gitRunner command.GitRunner, dir string) command.GitRunner {
+	return &cachingGitRunner{GitRunner: gitRunner, cache: c, dir: dir}
+}
+
+// GhRunner returns a GhRunner that answers lookups from the cache and runs
+// them in dir when the rule doesn't pass a directory.
+func (c *LookupCache) GhRunner(ghRunner command.GhRunner, dir string) command.GhRunner {
+	return &cachingGhRunner{GhRunner: ghRunner, cache: c, dir: dir}
+}
+
+// cachingGitRunner is the GitRunner handed to rules by a LookupCache.
+// Only the lookups used by rules are cached; other methods pass through.
+type cachingGitRunner struct {
+	command.GitRunner
+	cache *LookupCache
+	dir   string
+}
+
+// GetCurrentBranch returns the cached branch of dir while HEAD is unchanged.
+func (r *cachingGitRunner) GetCurrentBranch(ctx context.Context, dir string) (string, error) {
+	if dir == "" {
+		dir = r.dir
+	}
+
+	headPath, ok := findGitHead(dir)
+	if !ok {
+		return r.GitRunner.GetCurrentBranch(ctx, dir)
+	}
+	info, err := os.Stat(headPath)
+	if err != nil {
+		return r.GitRunner.GetCurrentBranch(ctx, dir)
+	}
+
+	c := r.cache
+	c.mu.Lock()
+	entry, ok := c.branches[headPath]
+	c.mu.Unlock()
+	if ok && entry.headModTime.Equal(info.ModTime()) && c.now().Before(entry.expiresAt) {
+		return entry.branch, nil
+	}
+
+	branch, err := r.GitRunner.GetCurrentBranch(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.branches[headPath] = branchCacheEntry{
+		branch:      branch,
+		headModTime: info.ModTime(),
+		expiresAt:   c.now().Add(c.ttl),
+	}
+	c.mu.Unlock()
+
+	return branch, nil
+}
+
+// cachingGhRunner is the GhRunner handed to rules by a LookupCache.
+// Only the lookups used by rules are cached; other methods pass through.
+type cachingGhRunner struct {
+	command.GhRunner
+	cache *LookupCache
+	dir   string
+}
+
+// GetPRBaseBranch returns the cached base branch of the pull request.
+func (r *cachingGhRunner) GetPRBaseBranch(ctx context.Context, dir string, prNumber string) (string, error) {
+	if dir == "" {
+		dir = r.dir
+	}
+
+	// Pull request numbers are only unique per repository, so the key
+	// includes the repository root.
+	key := dir
+	if headPath, ok := findGitHead(dir); ok {
+		key = headPath
+	}
+	key += "#" + prNumber
+
+	c := r.cache
+	c.mu.Lock()
+	entry, ok := c.prBases[key]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expiresAt) {
+		return entry.baseBranch, nil
+	}
+
+	baseBranch, err := r.GhRunner.GetPRBaseBranch(ctx, dir, prNumber)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.prBases[key] = prBaseCacheEntry{
+		baseBranch: baseBranch,
+		expiresAt:  c.now().Add(c.ttl),
+	}
+	c.mu.Unlock()
+
+	return baseBranch, nil
+}
+
+// findGitHead returns the HEAD file of the repository or worktree containing
+// dir, without running git. It follows .git files written for worktrees.
+func findGitHead(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		info, err := os.Stat(gitPath)
+		if err == nil {
+			if info.IsDir() {
+				return filepath.Join(gitPath, "HEAD"), true
+			}
+
+			data, err := os.ReadFile(gitPath)
+			if err != nil {
+				return "", false
+			}
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+			if !ok {
+				return "", false
+			}
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			return filepath.Join(gitDir, "HEAD"), true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
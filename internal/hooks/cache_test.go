@@ -0,0 +1,139 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/michael-freling/claude-code-tools/internal/command"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// newTestRepo creates a directory with a .git/HEAD file and returns the
+// directory and the HEAD path.
+func newTestRepo(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	headPath := filepath.Join(dir, ".git", "HEAD")
+	require.NoError(t, os.MkdirAll(filepath.Dir(headPath), 0o755))
+	require.NoError(t, os.WriteFile(headPath, []byte("ref: refs/heads/main\n"), 0o644))
+	return dir, headPath
+}
+
+func TestLookupCache_GetCurrentBranch(t *testing.T) {
+	dir, headPath := newTestRepo(t)
+	ctrl := gomock.NewController(t)
+	mockGit := command.NewMockGitRunner(ctrl)
+
+	now := time.Now()
+	cache := NewLookupCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	gitRunner := cache.GitRunner(mockGit, dir)
+
+	// The first lookup runs git in the bound directory; the second is cached.
+	mockGit.EXPECT().GetCurrentBranch(gomock.Any(), dir).Return("main", nil)
+	for i := 0; i < 2; i++ {
+		branch, err := gitRunner.GetCurrentBranch(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, "main", branch)
+	}
+
+	// Switching branches changes HEAD, which invalidates the entry.
+	later := now.Add(time.Second)
+	require.NoError(t, os.WriteFile(headPath, []byte("ref: refs/heads/feature\n"), 0o644))
+	require.NoError(t, os.Chtimes(headPath, later, later))
+	mockGit.EXPECT().GetCurrentBranch(gomock.Any(), dir).Return("feature", nil)
+	branch, err := gitRunner.GetCurrentBranch(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, "feature", branch)
+
+	// Entries expire after the TTL.
+	now = now.Add(2 * time.Minute)
+	mockGit.EXPECT().GetCurrentBranch(gomock.Any(), dir).Return("feature", nil)
+	_, err = gitRunner.GetCurrentBranch(context.Background(), "")
+	require.NoError(t, err)
+}
+
+func TestLookupCache_GetCurrentBranch_ErrorNotCached(t *testing.T) {
+	dir, _ := newTestRepo(t)
+	ctrl := gomock.NewController(t)
+	mockGit := command.NewMockGitRunner(ctrl)
+	gitRunner := NewLookupCache(time.Minute).GitRunner(mockGit, dir)
+
+	gomock.InOrder(
+		mockGit.EXPECT().GetCurrentBranch(gomock.Any(), dir).Return("", errors.New("not a repository")),
+		mockGit.EXPECT().GetCurrentBranch(gomock.Any(), dir).Return("main", nil),
+	)
+
+	_, err := gitRunner.GetCurrentBranch(context.Background(), "")
+	require.Error(t, err)
+
+	branch, err := gitRunner.GetCurrentBranch(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, "main", branch)
+}
+
+func TestLookupCache_GetCurrentBranch_OutsideRepository(t *testing.T) {
+	dir := t.TempDir()
+	ctrl := gomock.NewController(t)
+	mockGit := command.NewMockGitRunner(ctrl)
+	gitRunner := NewLookupCache(time.Minute).GitRunner(mockGit, dir)
+
+	mockGit.EXPECT().GetCurrentBranch(gomock.Any(), dir).Return("main", nil).Times(2)
+	for i := 0; i < 2; i++ {
+		_, err := gitRunner.GetCurrentBranch(context.Background(), "")
+		require.NoError(t, err)
+	}
+}
+
+func TestLookupCache_GetPRBaseBranch(t *testing.T) {
+	dir, _ := newTestRepo(t)
+	otherDir, _ := newTestRepo(t)
+	ctrl := gomock.NewController(t)
+	mockGh := command.NewMockGhRunner(ctrl)
+	cache := NewLookupCache(time.Minute)
+
+	mockGh.EXPECT().GetPRBaseBranch(gomock.Any(), dir, "42").Return("main", nil)
+	mockGh.EXPECT().GetPRBaseBranch(gomock.Any(), otherDir, "42").Return("develop", nil)
+
+	for i := 0; i < 2; i++ {
+		base, err := cache.GhRunner(mockGh, dir).GetPRBaseBranch(context.Background(), "", "42")
+		require.NoError(t, err)
+		assert.Equal(t, "main", base)
+
+		base, err = cache.GhRunner(mockGh, otherDir).GetPRBaseBranch(context.Background(), "", "42")
+		require.NoError(t, err)
+		assert.Equal(t, "develop", base)
+	}
+}
+
+func TestFindGitHead(t *testing.T) {
+	t.Run("repository subdirectory", func(t *testing.T) {
+		dir, headPath := newTestRepo(t)
+		subDir := filepath.Join(dir, "internal", "hooks")
+		require.NoError(t, os.MkdirAll(subDir, 0o755))
+
+		got, ok := findGitHead(subDir)
+		require.True(t, ok)
+		assert.Equal(t, headPath, got)
+	})
+
+	t.Run("worktree with .git file", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: /repo/.git/worktrees/feature\n"), 0o644))
+
+		got, ok := findGitHead(dir)
+		require.True(t, ok)
+		assert.Equal(t, "/repo/.git/worktrees/feature/HEAD", got)
+	})
+
+	t.Run("outside repository", func(t *testing.T) {
+		_, ok := findGitHead(t.TempDir())
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,176 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	// daemonEvaluatePath is the endpoint the daemon evaluates pre-tool-use input on.
+	daemonEvaluatePath = "/pre-tool-use"
+
+	// daemonClientTimeout bounds a single evaluation request, so a hung daemon
+	// doesn't stall the tool call; the client falls back on timeout.
+	daemonClientTimeout = 30 * time.Second
+)
+
+// ErrDaemonUnavailable is returned by EvaluateWithDaemon when no daemon is
+// listening on the socket. Callers should evaluate in-process instead.
+var ErrDaemonUnavailable = errors.New("hook daemon is not running")
+
+// EvaluateFunc evaluates pre-tool-use input.
+type EvaluateFunc func(ctx context.Context, input *ToolInput) (*RuleResult, error)
+
+// daemonResponse is the JSON body returned by the daemon.
+type daemonResponse struct {
+	Allowed  bool   `json:"allowed"`
+	RuleName string `json:"rule_name,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Daemon is a long-lived hook evaluator listening on a unix socket.
+type Daemon struct {
+	evaluate EvaluateFunc
+}
+
+// NewDaemon creates a daemon that evaluates requests with evaluate.
+func NewDaemon(evaluate EvaluateFunc) *Daemon {
+	return &Daemon{
+		evaluate: evaluate,
+	}
+}
+
+// ServeHTTP evaluates the pre-tool-use input in the request body.
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != daemonEvaluatePath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	input, err := ParseToolInput(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(daemonResponse{Error: fmt.Sprintf("failed to parse tool input: %v", err)})
+		return
+	}
+
+	result, err := d.evaluate(r.Context(), input)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(daemonResponse{Error: err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(daemonResponse{
+		Allowed:  result.Allowed,
+		RuleName: result.RuleName,
+		Message:  result.Message,
+	})
+}
+
+// Serve listens on the unix socket at socketPath and blocks until the
+// context is cancelled, then shuts down gracefully and removes the socket.
+// A stale socket left by a daemon that exited uncleanly is replaced; it
+// returns an error if another daemon is already listening.
+func (d *Daemon) Serve(ctx context.Context, socketPath string) error {
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return fmt.Errorf("another daemon is already listening on %s", socketPath)
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	if err := os.Chmod(socketPath, 0o600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+
+	server := &http.Server{Handler: d}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			errCh <- fmt.Errorf("daemon server error: %w", err)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-errCh:
+		return err
+	}
+
+	// Graceful shutdown
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), daemonClientTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// EvaluateWithDaemon sends pre-tool-use input to the daemon listening on
+// socketPath and returns its result. It returns ErrDaemonUnavailable when
+// the socket is absent or nothing is listening on it.
+func EvaluateWithDaemon(ctx context.Context, socketPath string, input *ToolInput) (*RuleResult, error) {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tool input: %w", err)
+	}
+
+	client := &http.Client{
+		Timeout: daemonClientTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://claude-hooks"+daemonEvaluatePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, fmt.Errorf("%w: %v", ErrDaemonUnavailable, err)
+		}
+		return nil, fmt.Errorf("failed to reach hook daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var response daemonResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode daemon response: %w", err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("hook daemon failed: %s", response.Error)
+	}
+
+	if !response.Allowed {
+		return NewBlockedResult(response.RuleName, response.Message), nil
+	}
+	return NewAllowedResult(), nil
+}
@@ -0,0 +1,172 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestDaemon serves evaluate on a socket in a temporary directory until
+// the test ends, and returns the socket path.
+func startTestDaemon(t *testing.T, evaluate EvaluateFunc) string {
+	t.Helper()
+
+	// Unix socket paths are limited to ~100 bytes, so avoid t.TempDir's long names.
+	dir, err := os.MkdirTemp("", "hooks")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "serve.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewDaemon(evaluate).Serve(ctx, socketPath)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socketPath)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return socketPath
+}
+
+func TestEvaluateWithDaemon(t *testing.T) {
+	var got *ToolInput
+	socketPath := startTestDaemon(t, func(_ context.Context, input *ToolInput) (*RuleResult, error) {
+		got = input
+		if command, _ := input.GetStringArg("command"); strings.Contains(command, "--no-verify") {
+			return NewBlockedResult("no-verify", "blocked"), nil
+		}
+		return NewAllowedResult(), nil
+	})
+
+	input := &ToolInput{
+		ToolName:       "Bash",
+		ToolInput:      []byte(`{"command": "git commit --no-verify"}`),
+		PermissionMode: PermissionModePlan,
+		Cwd:            "/work",
+	}
+	result, err := EvaluateWithDaemon(context.Background(), socketPath, input)
+
+	require.NoError(t, err)
+	assert.Equal(t, NewBlockedResult("no-verify", "blocked"), result)
+	assert.Equal(t, "Bash", got.ToolName)
+	assert.Equal(t, PermissionModePlan, got.PermissionMode)
+	assert.Equal(t, "/work", got.Cwd)
+
+	input.ToolInput = []byte(`{"command": "ls"}`)
+	result, err = EvaluateWithDaemon(context.Background(), socketPath, input)
+
+	require.NoError(t, err)
+	assert.Equal(t, NewAllowedResult(), result)
+}
+
+func TestEvaluateWithDaemon_EvaluationError(t *testing.T) {
+	socketPath := startTestDaemon(t, func(context.Context, *ToolInput) (*RuleResult, error) {
+		return nil, errors.New("invalid policy")
+	})
+
+	_, err := EvaluateWithDaemon(context.Background(), socketPath, &ToolInput{ToolName: "Bash"})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid policy")
+	assert.False(t, errors.Is(err, ErrDaemonUnavailable))
+}
+
+func TestEvaluateWithDaemon_Unavailable(t *testing.T) {
+	t.Run("socket does not exist", func(t *testing.T) {
+		_, err := EvaluateWithDaemon(context.Background(), filepath.Join(t.TempDir(), "missing.sock"), &ToolInput{ToolName: "Bash"})
+
+		assert.ErrorIs(t, err, ErrDaemonUnavailable)
+	})
+
+	t.Run("stale socket", func(t *testing.T) {
+		socketPath := startTestDaemon(t, nil)
+		// A regular file left where the socket was refuses connections.
+		require.NoError(t, os.Remove(socketPath))
+		require.NoError(t, os.WriteFile(socketPath, nil, 0o600))
+
+		_, err := EvaluateWithDaemon(context.Background(), socketPath, &ToolInput{ToolName: "Bash"})
+
+		assert.ErrorIs(t, err, ErrDaemonUnavailable)
+	})
+}
+
+func TestDaemon_Serve_AlreadyRunning(t *testing.T) {
+	socketPath := startTestDaemon(t, nil)
+
+	err := NewDaemon(nil).Serve(context.Background(), socketPath)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "another daemon is already listening")
+}
+
+func TestDaemon_ServeHTTP(t *testing.T) {
+	daemon := NewDaemon(func(context.Context, *ToolInput) (*RuleResult, error) {
+		return NewAllowedResult(), nil
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "evaluates input",
+			method:     http.MethodPost,
+			path:       daemonEvaluatePath,
+			body:       `{"tool_name": "Bash", "tool_input": {"command": "ls"}}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"allowed":true}`,
+		},
+		{
+			name:       "invalid input",
+			method:     http.MethodPost,
+			path:       daemonEvaluatePath,
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "tool_name is required",
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			path:       daemonEvaluatePath,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "unknown path",
+			method:     http.MethodPost,
+			path:       "/unknown",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+
+			daemon.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
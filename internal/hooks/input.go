@@ -7,10 +7,14 @@ import (
 )
 
 // ToolInput represents the input to a tool from Claude Code.
+// ToolResponse is only set for post-tool-use events.
 type ToolInput struct {
-	ToolName  string          `json:"tool_name"`
-	ToolInput json.RawMessage `json:"tool_input"`
-	parsed    map[string]interface{}
+	ToolName       string          `json:"tool_name"`
+	ToolInput      json.RawMessage `json:"tool_input"`
+	ToolResponse   json.RawMessage `json:"tool_response,omitempty"`
+	PermissionMode string          `json:"permission_mode"`
+	Cwd            string          `json:"cwd,omitempty"`
+	parsed         map[string]interface{}
 }
 
 // ParseToolInput reads and parses tool input JSON from a reader.
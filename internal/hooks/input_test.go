@@ -39,6 +39,15 @@ func TestParseToolInput(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:  "valid input with permission_mode",
+			input: `{"tool_name": "Bash", "tool_input": {"command": "ls"}, "permission_mode": "bypassPermissions"}`,
+			want: &ToolInput{
+				ToolName:       "Bash",
+				PermissionMode: "bypassPermissions",
+			},
+			wantErr: false,
+		},
 		{
 			name:    "missing tool_name",
 			input:   `{"tool_input": {"command": "ls"}}`,
@@ -73,6 +82,7 @@ func TestParseToolInput(t *testing.T) {
 
 			require.NoError(t, err)
 			assert.Equal(t, tt.want.ToolName, got.ToolName)
+			assert.Equal(t, tt.want.PermissionMode, got.PermissionMode)
 		})
 	}
 }
@@ -0,0 +1,220 @@
+package hooks
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Claude Code permission modes reported in the hook input's permission_mode field.
+const (
+	PermissionModeDefault     = "default"
+	PermissionModeAcceptEdits = "acceptEdits"
+	PermissionModePlan        = "plan"
+	PermissionModeBypass      = "bypassPermissions"
+)
+
+// Policy selects which rules apply to a tool call based on the permission mode
+// Claude Code is running in. It is loaded from a YAML file:
+//
+//	default_profile: strict
+//	profiles:
+//	  strict:
+//	    rules: [no-verify, git-push, gh-branch-protection, gh-ruleset, gh-pr-merge, secret-leak]
+//	  relaxed:
+//	    rules: [git-push]
+//	modes:
+//	  bypassPermissions: strict
+//	  default: relaxed
+//	  plan: relaxed
+//
+// When no profile resolves for a mode, every rule and stop check is applied.
+type Policy struct {
+	DefaultProfile string             `yaml:"default_profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+	Modes          map[string]string  `yaml:"modes"`
+	Secrets        SecretsConfig      `yaml:"secrets"`
+	Stop           StopConfig         `yaml:"stop"`
+}
+
+// Profile is a named set of rules and stop checks.
+type Profile struct {
+	Rules      []string `yaml:"rules"`
+	StopChecks []string `yaml:"stop_checks"`
+}
+
+// DefaultPolicy returns a Policy that applies every rule in every permission mode.
+func DefaultPolicy() *Policy {
+	return &Policy{}
+}
+
+// LoadPolicy reads a policy from the YAML file at path.
+// Returns the default policy if the file doesn't exist.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultPolicy(), nil
+		}
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policy := DefaultPolicy()
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// validate checks that every profile reference points to a defined profile
+// and that the secrets and stop configurations are valid.
+func (p *Policy) validate() error {
+	if p.DefaultProfile != "" {
+		if _, ok := p.Profiles[p.DefaultProfile]; !ok {
+			return fmt.Errorf("default_profile %q is not defined in profiles", p.DefaultProfile)
+		}
+	}
+
+	for mode, name := range p.Modes {
+		if _, ok := p.Profiles[name]; !ok {
+			return fmt.Errorf("profile %q for mode %q is not defined in profiles", name, mode)
+		}
+	}
+
+	if _, err := p.Secrets.Detectors(); err != nil {
+		return err
+	}
+
+	if err := p.Stop.validate(); err != nil {
+		return err
+	}
+
+	checks := make(map[string]bool, len(p.Stop.Checks))
+	for _, check := range p.Stop.Checks {
+		checks[check.Name] = true
+	}
+	for name, profile := range p.Profiles {
+		for _, checkName := range profile.StopChecks {
+			if !checks[checkName] {
+				return fmt.Errorf("profile %q references unknown stop check %q", name, checkName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ProfileFor returns the name of the profile that applies to the permission mode.
+// Returns an empty string when every rule applies.
+func (p *Policy) ProfileFor(permissionMode string) string {
+	if name, ok := p.Modes[permissionMode]; ok {
+		return name
+	}
+	return p.DefaultProfile
+}
+
+// Validate checks that every rule referenced by a profile exists in rules.
+// rules should contain the rules of every hook event, since a profile may
+// list rules for more than one event.
+//
+// It returns a warning for each rule of the default profile that another
+// profile leaves out, since a mode mapped to that profile silently loses
+// the rule.
+func (p *Policy) Validate(rules []Rule) ([]string, error) {
+	known := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		known[rule.Name()] = true
+	}
+
+	for name, profile := range p.Profiles {
+		for _, ruleName := range profile.Rules {
+			if !known[ruleName] {
+				return nil, fmt.Errorf("profile %q references unknown rule %q", name, ruleName)
+			}
+		}
+	}
+
+	defaultProfile, ok := p.Profiles[p.DefaultProfile]
+	if !ok {
+		return nil, nil
+	}
+
+	var warnings []string
+	for _, name := range slices.Sorted(maps.Keys(p.Profiles)) {
+		if name == p.DefaultProfile {
+			continue
+		}
+		for _, ruleName := range defaultProfile.Rules {
+			if !slices.Contains(p.Profiles[name].Rules, ruleName) {
+				warnings = append(warnings, fmt.Sprintf("profile %q drops rule %q that default profile %q applies", name, ruleName, p.DefaultProfile))
+			}
+		}
+	}
+
+	return warnings, nil
+}
+
+// Select returns the subset of rules enabled for the permission mode,
+// preserving the order of rules. Rule names in the profile that are not in
+// rules are ignored; use Validate to detect unknown names.
+func (p *Policy) Select(permissionMode string, rules []Rule) ([]Rule, error) {
+	name := p.ProfileFor(permissionMode)
+	if name == "" {
+		return rules, nil
+	}
+
+	profile, ok := p.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q is not defined", name)
+	}
+
+	enabled := make(map[string]bool, len(profile.Rules))
+	for _, ruleName := range profile.Rules {
+		enabled[ruleName] = true
+	}
+
+	selected := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		if enabled[rule.Name()] {
+			selected = append(selected, rule)
+		}
+	}
+
+	return selected, nil
+}
+
+// SelectStopChecks returns the stop checks enabled for the permission mode,
+// preserving the configured order.
+func (p *Policy) SelectStopChecks(permissionMode string) ([]StopCheck, error) {
+	name := p.ProfileFor(permissionMode)
+	if name == "" {
+		return p.Stop.Checks, nil
+	}
+
+	profile, ok := p.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q is not defined", name)
+	}
+
+	enabled := make(map[string]bool, len(profile.StopChecks))
+	for _, checkName := range profile.StopChecks {
+		enabled[checkName] = true
+	}
+
+	selected := make([]StopCheck, 0, len(profile.StopChecks))
+	for _, check := range p.Stop.Checks {
+		if enabled[check.Name] {
+			selected = append(selected, check)
+		}
+	}
+
+	return selected, nil
+}
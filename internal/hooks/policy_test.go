@@ -0,0 +1,287 @@
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Policy
+		wantErr string
+	}{
+		{
+			name: "profiles per mode",
+			content: `
+default_profile: strict
+profiles:
+  strict:
+    rules: [no-verify, git-push]
+  relaxed:
+    rules: [git-push]
+modes:
+  plan: relaxed
+`,
+			want: &Policy{
+				DefaultProfile: "strict",
+				Profiles: map[string]Profile{
+					"strict":  {Rules: []string{"no-verify", "git-push"}},
+					"relaxed": {Rules: []string{"git-push"}},
+				},
+				Modes: map[string]string{"plan": "relaxed"},
+			},
+		},
+		{
+			name:    "empty file returns default policy",
+			content: "",
+			want:    DefaultPolicy(),
+		},
+		{
+			name: "undefined default profile",
+			content: `
+default_profile: missing
+`,
+			wantErr: `default_profile "missing" is not defined in profiles`,
+		},
+		{
+			name: "undefined mode profile",
+			content: `
+profiles:
+  strict:
+    rules: [git-push]
+modes:
+  bypassPermissions: missing
+`,
+			wantErr: `profile "missing" for mode "bypassPermissions" is not defined in profiles`,
+		},
+		{
+			name: "invalid secrets action",
+			content: `
+secrets:
+  action: ignore
+`,
+			wantErr: `secrets action must be "block" or "redact", got "ignore"`,
+		},
+		{
+			name: "stop checks",
+			content: `
+profiles:
+  strict:
+    stop_checks: [test]
+stop:
+  timeout: 5m
+  checks:
+    - name: test
+      command: [go, test, ./...]
+`,
+			want: &Policy{
+				Profiles: map[string]Profile{"strict": {StopChecks: []string{"test"}}},
+				Stop: StopConfig{
+					Timeout: 5 * time.Minute,
+					Checks:  []StopCheck{{Name: "test", Command: []string{"go", "test", "./..."}}},
+				},
+			},
+		},
+		{
+			name: "unknown stop check in profile",
+			content: `
+profiles:
+  strict:
+    stop_checks: [lint]
+`,
+			wantErr: `profile "strict" references unknown stop check "lint"`,
+		},
+		{
+			name:    "invalid YAML",
+			content: "profiles: [",
+			wantErr: "failed to parse policy file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+
+			got, err := LoadPolicy(path)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadPolicy_FileNotExist(t *testing.T) {
+	got, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.yaml"))
+
+	require.NoError(t, err)
+	assert.Equal(t, DefaultPolicy(), got)
+}
+
+func TestPolicy_Select(t *testing.T) {
+	rules := []Rule{
+		&mockRule{name: "no-verify"},
+		&mockRule{name: "git-push"},
+		&mockRule{name: "gh-pr-merge"},
+	}
+
+	policy := &Policy{
+		DefaultProfile: "strict",
+		Profiles: map[string]Profile{
+			"strict":  {Rules: []string{"gh-pr-merge", "no-verify", "git-push"}},
+			"relaxed": {Rules: []string{"git-push"}},
+			"off":     {Rules: []string{}},
+		},
+		Modes: map[string]string{
+			PermissionModeDefault: "relaxed",
+			PermissionModePlan:    "off",
+		},
+	}
+
+	tests := []struct {
+		name           string
+		policy         *Policy
+		permissionMode string
+		want           []string
+		wantErr        string
+	}{
+		{
+			name:           "bypass mode falls back to default profile",
+			policy:         policy,
+			permissionMode: PermissionModeBypass,
+			want:           []string{"no-verify", "git-push", "gh-pr-merge"},
+		},
+		{
+			name:           "default mode uses relaxed profile",
+			policy:         policy,
+			permissionMode: PermissionModeDefault,
+			want:           []string{"git-push"},
+		},
+		{
+			name:           "plan mode disables all rules",
+			policy:         policy,
+			permissionMode: PermissionModePlan,
+			want:           []string{},
+		},
+		{
+			name:           "missing permission mode falls back to default profile",
+			policy:         policy,
+			permissionMode: "",
+			want:           []string{"no-verify", "git-push", "gh-pr-merge"},
+		},
+		{
+			name:           "default policy applies every rule",
+			policy:         DefaultPolicy(),
+			permissionMode: PermissionModePlan,
+			want:           []string{"no-verify", "git-push", "gh-pr-merge"},
+		},
+		{
+			name: "rules of other hook events are ignored",
+			policy: &Policy{
+				DefaultProfile: "mixed",
+				Profiles:       map[string]Profile{"mixed": {Rules: []string{"secret-leak", "git-push"}}},
+			},
+			permissionMode: PermissionModeBypass,
+			want:           []string{"git-push"},
+		},
+		{
+			name: "undefined profile",
+			policy: &Policy{
+				Modes: map[string]string{PermissionModeBypass: "missing"},
+			},
+			permissionMode: PermissionModeBypass,
+			wantErr:        `profile "missing" is not defined`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Select(tt.permissionMode, rules)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			names := make([]string, 0, len(got))
+			for _, rule := range got {
+				names = append(names, rule.Name())
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	rules := []Rule{
+		&mockRule{name: "git-push"},
+		&mockRule{name: "secret-leak"},
+	}
+
+	tests := []struct {
+		name         string
+		policy       *Policy
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name:   "default policy",
+			policy: DefaultPolicy(),
+		},
+		{
+			name: "profile drops a rule of the default profile",
+			policy: &Policy{
+				DefaultProfile: "strict",
+				Profiles: map[string]Profile{
+					"strict":  {Rules: []string{"git-push", "secret-leak"}},
+					"relaxed": {Rules: []string{"git-push"}},
+					"full":    {Rules: []string{"secret-leak", "git-push"}},
+				},
+			},
+			wantWarnings: []string{`profile "relaxed" drops rule "secret-leak" that default profile "strict" applies`},
+		},
+		{
+			name: "known rules",
+			policy: &Policy{
+				Profiles: map[string]Profile{"strict": {Rules: []string{"git-push", "secret-leak"}}},
+			},
+		},
+		{
+			name: "unknown rule name",
+			policy: &Policy{
+				Profiles: map[string]Profile{"typo": {Rules: []string{"git-pushh"}}},
+			},
+			wantErr: `profile "typo" references unknown rule "git-pushh"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := tt.policy.Validate(rules)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWarnings, warnings)
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/michael-freling/claude-code-tools/internal/command"
+)
+
+// Decision is the outcome of replaying a tool call through the rule engine.
+type Decision string
+
+const (
+	// DecisionAllowed means no rule would have blocked the tool call.
+	DecisionAllowed Decision = "allowed"
+	// DecisionBlocked means a rule would have blocked the tool call.
+	DecisionBlocked Decision = "blocked"
+	// DecisionNeedsReview means the outcome depends on state that is not
+	// recorded in the transcript, or a rule failed to evaluate.
+	DecisionNeedsReview Decision = "needs-review"
+)
+
+// RulesFactory builds the rules to replay, given the runners they should use
+// for runtime lookups.
+type RulesFactory func(gitRunner command.GitRunner, ghRunner command.GhRunner) []Rule
+
+// ReportEntry is the replay result for a single tool call.
+type ReportEntry struct {
+	Call     TranscriptToolCall
+	Decision Decision
+	RuleName string
+	Message  string
+}
+
+// Report is the result of replaying a transcript through the rule engine.
+type Report struct {
+	Source  string
+	Entries []ReportEntry
+}
+
+// Replay evaluates every tool call against the rules selected by the policy
+// for the call's permission mode.
+//
+// Rules that need the repository or pull request state at the time of the
+// original call (for example, the current branch for an implicit git push)
+// cannot be evaluated faithfully after the fact. Those lookups fail during
+// replay and the call is reported as needing review instead of allowed.
+func Replay(source string, calls []TranscriptToolCall, policy *Policy, newRules RulesFactory) (*Report, error) {
+	lookups := &replayLookups{}
+	rules := newRules(&replayGitRunner{lookups: lookups}, &replayGhRunner{lookups: lookups})
+
+	report := &Report{Source: source}
+	for _, call := range calls {
+		selected, err := policy.Select(call.Input.PermissionMode, rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to select rules: %w", err)
+		}
+
+		lookups.reset()
+		result, err := NewRuleEngine(selected...).Evaluate(call.Input)
+
+		entry := ReportEntry{Call: call}
+		switch {
+		case err != nil:
+			entry.Decision = DecisionNeedsReview
+			entry.Message = err.Error()
+		case !result.Allowed:
+			entry.Decision = DecisionBlocked
+			entry.RuleName = result.RuleName
+			entry.Message = result.Message
+		case len(lookups.names) > 0:
+			entry.Decision = DecisionNeedsReview
+			entry.Message = "depends on runtime state: " + strings.Join(lookups.names, ", ")
+		default:
+			entry.Decision = DecisionAllowed
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+
+	return report, nil
+}
+
+// Count returns the number of entries with the given decision.
+func (r *Report) Count(decision Decision) int {
+	count := 0
+	for _, e := range r.Entries {
+		if e.Decision == decision {
+			count++
+		}
+	}
+	return count
+}
+
+// WriteMarkdown writes the report as a Markdown document.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Hook compliance report\n\n")
+	fmt.Fprintf(&b, "Transcript: `%s`\n\n", r.Source)
+	fmt.Fprintf(&b, "| Decision | Count |\n|---|---|\n")
+	for _, d := range []Decision{DecisionBlocked, DecisionNeedsReview, DecisionAllowed} {
+		fmt.Fprintf(&b, "| %s | %d |\n", d, r.Count(d))
+	}
+
+	fmt.Fprintf(&b, "\n## Tool calls\n\n")
+	if len(r.Entries) == 0 {
+		fmt.Fprintf(&b, "No tool calls found.\n")
+	} else {
+		fmt.Fprintf(&b, "| Line | Time | Tool | Input | Decision | Rule | Message |\n|---|---|---|---|---|---|---|\n")
+		for _, e := range r.Entries {
+			fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s | %s |\n",
+				e.Call.Line,
+				escapeMarkdownCell(e.Call.Timestamp),
+				escapeMarkdownCell(e.Call.Input.ToolName),
+				escapeMarkdownCell(summarizeToolInput(e.Call.Input)),
+				e.Decision,
+				escapeMarkdownCell(e.RuleName),
+				escapeMarkdownCell(e.Message),
+			)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var reportHTMLTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"summarize": summarizeToolInput,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Hook compliance report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.input { font-family: monospace; white-space: pre-wrap; }
+tr.blocked { background: #fdd; }
+tr.needs-review { background: #ffd; }
+</style>
+</head>
+<body>
+<h1>Hook compliance report</h1>
+<p>Transcript: <code>{{.Report.Source}}</code></p>
+<table>
+<tr><th>Decision</th><th>Count</th></tr>
+{{range .Counts}}<tr><td>{{.Decision}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<h2>Tool calls</h2>
+{{if .Report.Entries}}<table>
+<tr><th>Line</th><th>Time</th><th>Tool</th><th>Input</th><th>Decision</th><th>Rule</th><th>Message</th></tr>
+{{range .Report.Entries}}<tr class="{{.Decision}}"><td>{{.Call.Line}}</td><td>{{.Call.Timestamp}}</td><td>{{.Call.Input.ToolName}}</td><td class="input">{{summarize .Call.Input}}</td><td>{{.Decision}}</td><td>{{.RuleName}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+{{else}}<p>No tool calls found.</p>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes the report as a standalone HTML document.
+func (r *Report) WriteHTML(w io.Writer) error {
+	type decisionCount struct {
+		Decision Decision
+		Count    int
+	}
+
+	data := struct {
+		Report *Report
+		Counts []decisionCount
+	}{Report: r}
+	for _, d := range []Decision{DecisionBlocked, DecisionNeedsReview, DecisionAllowed} {
+		data.Counts = append(data.Counts, decisionCount{Decision: d, Count: r.Count(d)})
+	}
+
+	return reportHTMLTemplate.Execute(w, data)
+}
+
+// summarizeToolInput returns the most relevant argument of a tool call for display.
+func summarizeToolInput(input *ToolInput) string {
+	for _, name := range []string{"command", "file_path", "path", "url", "pattern"} {
+		if value, ok := input.GetStringArg(name); ok {
+			return value
+		}
+	}
+	return string(input.ToolInput)
+}
+
+// escapeMarkdownCell makes a value safe to place in a Markdown table cell.
+func escapeMarkdownCell(value string) string {
+	value = strings.ReplaceAll(value, "|", `\|`)
+	value = strings.ReplaceAll(value, "\r\n", "<br>")
+	value = strings.ReplaceAll(value, "\n", "<br>")
+	return value
+}
+
+// replayLookups records runtime lookups requested by rules during replay.
+type replayLookups struct {
+	names []string
+}
+
+func (l *replayLookups) reset() {
+	l.names = nil
+}
+
+func (l *replayLookups) record(name string) error {
+	l.names = append(l.names, name)
+	return fmt.Errorf("%s is not available when replaying a transcript", name)
+}
+
+// replayGitRunner is the GitRunner handed to rules during replay.
+// Only the lookups used by rules are implemented; they always fail.
+type replayGitRunner struct {
+	command.GitRunner
+	lookups *replayLookups
+}
+
+// GetCurrentBranch records the lookup and fails, since the branch at the time
+// of the original call is unknown.
+func (r *replayGitRunner) GetCurrentBranch(_ context.Context, _ string) (string, error) {
+	return "", r.lookups.record("current branch")
+}
+
+// replayGhRunner is the GhRunner handed to rules during replay.
+// Only the lookups used by rules are implemented; they always fail.
+type replayGhRunner struct {
+	command.GhRunner
+	lookups *replayLookups
+}
+
+// GetPRBaseBranch records the lookup and fails, since the base branch at the
+// time of the original call is unknown.
+func (r *replayGhRunner) GetPRBaseBranch(_ context.Context, _ string, prNumber string) (string, error) {
+	return "", r.lookups.record("base branch of PR #" + prNumber)
+}
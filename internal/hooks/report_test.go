@@ -0,0 +1,184 @@
+package hooks
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/michael-freling/claude-code-tools/internal/command"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replayRules(gitRunner command.GitRunner, ghRunner command.GhRunner) []Rule {
+	return []Rule{
+		NewNoVerifyRule(),
+		NewGitPushRule(gitRunner),
+		NewPRMergeRule(ghRunner),
+	}
+}
+
+func newTranscriptCall(line int, toolName, toolInput, permissionMode string) TranscriptToolCall {
+	input, err := ParseToolInput(strings.NewReader(fmt.Sprintf(`{"tool_name": %q, "tool_input": %s}`, toolName, toolInput)))
+	if err != nil {
+		panic(err)
+	}
+	input.PermissionMode = permissionMode
+	return TranscriptToolCall{ID: fmt.Sprintf("toolu_%d", line), Line: line, Input: input}
+}
+
+func TestReplay(t *testing.T) {
+	calls := []TranscriptToolCall{
+		newTranscriptCall(1, "Bash", `{"command": "git status"}`, ""),
+		newTranscriptCall(2, "Bash", `{"command": "git commit --no-verify -m wip"}`, ""),
+		newTranscriptCall(3, "Bash", `{"command": "git push"}`, ""),
+		newTranscriptCall(4, "Bash", `{"command": "gh pr merge 42"}`, ""),
+		newTranscriptCall(5, "Bash", `{"command": "git push origin main"}`, ""),
+		newTranscriptCall(6, "Read", `{"file_path": "/work/main.go"}`, ""),
+		newTranscriptCall(7, "Bash", `{"command": "git commit --no-verify -m wip"}`, PermissionModePlan),
+	}
+	policy := &Policy{
+		Profiles: map[string]Profile{"relaxed": {Rules: []string{"git-push"}}},
+		Modes:    map[string]string{PermissionModePlan: "relaxed"},
+	}
+
+	report, err := Replay("session.jsonl", calls, policy, replayRules)
+	require.NoError(t, err)
+
+	want := []struct {
+		decision Decision
+		ruleName string
+		message  string
+	}{
+		{decision: DecisionAllowed},
+		{decision: DecisionBlocked, ruleName: "no-verify", message: "Command contains --no-verify flag which bypasses git hooks"},
+		{decision: DecisionNeedsReview, message: "depends on runtime state: current branch"},
+		{decision: DecisionNeedsReview, message: "depends on runtime state: base branch of PR #42"},
+		{decision: DecisionBlocked, ruleName: "git-push", message: "Direct push to main/master branch is not allowed"},
+		{decision: DecisionAllowed},
+		{decision: DecisionAllowed},
+	}
+	require.Len(t, report.Entries, len(want))
+	for i, w := range want {
+		assert.Equal(t, w.decision, report.Entries[i].Decision, "entry %d", i)
+		assert.Equal(t, w.ruleName, report.Entries[i].RuleName, "entry %d", i)
+		assert.Equal(t, w.message, report.Entries[i].Message, "entry %d", i)
+	}
+
+	assert.Equal(t, 2, report.Count(DecisionBlocked))
+	assert.Equal(t, 2, report.Count(DecisionNeedsReview))
+	assert.Equal(t, 3, report.Count(DecisionAllowed))
+}
+
+func TestReplay_RuleError(t *testing.T) {
+	calls := []TranscriptToolCall{
+		newTranscriptCall(1, "Bash", `{"command": "ls"}`, ""),
+	}
+	failing := func(command.GitRunner, command.GhRunner) []Rule {
+		return []Rule{&mockRule{name: "broken", err: fmt.Errorf("boom")}}
+	}
+
+	report, err := Replay("session.jsonl", calls, DefaultPolicy(), failing)
+
+	require.NoError(t, err)
+	require.Len(t, report.Entries, 1)
+	assert.Equal(t, DecisionNeedsReview, report.Entries[0].Decision)
+	assert.Contains(t, report.Entries[0].Message, "boom")
+}
+
+func TestReplay_InvalidPolicy(t *testing.T) {
+	calls := []TranscriptToolCall{
+		newTranscriptCall(1, "Bash", `{"command": "ls"}`, ""),
+	}
+	policy := &Policy{
+		Modes: map[string]string{"": "missing"},
+	}
+
+	_, err := Replay("session.jsonl", calls, policy, replayRules)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to select rules")
+}
+
+func TestReport_WriteMarkdown(t *testing.T) {
+	report := &Report{
+		Source: "session.jsonl",
+		Entries: []ReportEntry{
+			{
+				Call:     newTranscriptCall(2, "Bash", `{"command": "echo a | tee b\nls"}`, ""),
+				Decision: DecisionBlocked,
+				RuleName: "no-verify",
+				Message:  "blocked",
+			},
+			{
+				Call:     newTranscriptCall(3, "Read", `{"file_path": "/work/main.go"}`, ""),
+				Decision: DecisionAllowed,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteMarkdown(&buf))
+
+	got := buf.String()
+	assert.Contains(t, got, "Transcript: `session.jsonl`")
+	assert.Contains(t, got, "| blocked | 1 |")
+	assert.Contains(t, got, "| needs-review | 0 |")
+	assert.Contains(t, got, "| allowed | 1 |")
+	assert.Contains(t, got, `| 2 |  | Bash | echo a \| tee b<br>ls | blocked | no-verify | blocked |`)
+	assert.Contains(t, got, "| 3 |  | Read | /work/main.go | allowed |  |  |")
+}
+
+func TestReport_WriteMarkdown_NoEntries(t *testing.T) {
+	report := &Report{Source: "empty.jsonl"}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteMarkdown(&buf))
+
+	assert.Contains(t, buf.String(), "No tool calls found.")
+}
+
+func TestReport_WriteHTML(t *testing.T) {
+	report := &Report{
+		Source: "session.jsonl",
+		Entries: []ReportEntry{
+			{
+				Call:     newTranscriptCall(2, "Bash", `{"command": "echo '<script>'"}`, ""),
+				Decision: DecisionNeedsReview,
+				Message:  "depends on runtime state: current branch",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteHTML(&buf))
+
+	got := buf.String()
+	assert.Contains(t, got, "<code>session.jsonl</code>")
+	assert.Contains(t, got, `<tr class="needs-review">`)
+	assert.Contains(t, got, "&lt;script&gt;")
+	assert.NotContains(t, got, "<script>")
+	assert.Contains(t, got, "<td>needs-review</td><td>1</td>")
+}
+
+func TestSummarizeToolInput(t *testing.T) {
+	tests := []struct {
+		name      string
+		toolName  string
+		toolInput string
+		want      string
+	}{
+		{name: "bash command", toolName: "Bash", toolInput: `{"command": "ls"}`, want: "ls"},
+		{name: "file path", toolName: "Edit", toolInput: `{"file_path": "/a.go", "old_string": "x"}`, want: "/a.go"},
+		{name: "url", toolName: "WebFetch", toolInput: `{"url": "https://example.com"}`, want: "https://example.com"},
+		{name: "fallback to raw input", toolName: "Task", toolInput: `{"prompt": "do it"}`, want: `{"prompt": "do it"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call := newTranscriptCall(1, tt.toolName, tt.toolInput, "")
+			assert.Equal(t, tt.want, summarizeToolInput(call.Input))
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Secret actions configured under the policy's secrets section.
+const (
+	SecretActionBlock  = "block"
+	SecretActionRedact = "redact"
+)
+
+// SecretDetector finds a single kind of credential in text.
+type SecretDetector struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// defaultSecretDetectors are the detectors enabled unless disabled in the policy.
+var defaultSecretDetectors = []SecretDetector{
+	{Name: "github-token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{Name: "anthropic-api-key", Pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{Name: "aws-access-key-id", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "private-key", Pattern: regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY-----(?s:.*?)(?:-----END (?:[A-Z0-9]+ )*PRIVATE KEY-----|$)`)},
+}
+
+// SecretsConfig configures how tool output is scanned for credentials.
+//
+//	secrets:
+//	  action: redact
+//	  disabled: [aws-access-key-id]
+//	  detectors:
+//	    - name: internal-token
+//	      pattern: 'itk_[a-z0-9]{32}'
+type SecretsConfig struct {
+	// Action is "block" (default) or "redact".
+	Action string `yaml:"action"`
+	// Disabled lists built-in detectors to turn off.
+	Disabled []string `yaml:"disabled"`
+	// Custom lists additional detectors.
+	Custom []SecretDetectorConfig `yaml:"detectors"`
+}
+
+// SecretDetectorConfig is a user-defined detector in the policy file.
+type SecretDetectorConfig struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// Detectors returns the built-in detectors that are not disabled followed by
+// the custom detectors. It returns an error if the configuration is invalid.
+func (c SecretsConfig) Detectors() ([]SecretDetector, error) {
+	switch c.Action {
+	case "", SecretActionBlock, SecretActionRedact:
+	default:
+		return nil, fmt.Errorf("secrets action must be %q or %q, got %q", SecretActionBlock, SecretActionRedact, c.Action)
+	}
+
+	disabled := make(map[string]bool, len(c.Disabled))
+	for _, name := range c.Disabled {
+		found := false
+		for _, d := range defaultSecretDetectors {
+			if d.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("cannot disable unknown secret detector %q", name)
+		}
+		disabled[name] = true
+	}
+
+	var detectors []SecretDetector
+	for _, d := range defaultSecretDetectors {
+		if !disabled[d.Name] {
+			detectors = append(detectors, d)
+		}
+	}
+
+	for _, custom := range c.Custom {
+		if custom.Name == "" {
+			return nil, fmt.Errorf("secret detector name is required")
+		}
+		pattern, err := regexp.Compile(custom.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for secret detector %q: %w", custom.Name, err)
+		}
+		detectors = append(detectors, SecretDetector{Name: custom.Name, Pattern: pattern})
+	}
+
+	return detectors, nil
+}
+
+// secretLeakRule blocks tool output that contains credentials.
+// It runs as a post-tool-use rule and inspects the tool_response field.
+//
+// Claude Code runs post-tool-use hooks once the tool has finished, so a
+// blocked result does not remove the original output from the transcript; it
+// tells the agent that the output leaked credentials and, in redact mode,
+// hands it a sanitized copy to continue with.
+type secretLeakRule struct {
+	detectors []SecretDetector
+	redact    bool
+}
+
+// NewSecretLeakRule creates a new rule that blocks tool output containing credentials.
+// When redact is true, the blocked result carries a redacted copy of the output.
+func NewSecretLeakRule(detectors []SecretDetector, redact bool) Rule {
+	return &secretLeakRule{
+		detectors: detectors,
+		redact:    redact,
+	}
+}
+
+// NewSecretLeakRuleFromConfig creates a secret leak rule from the policy's secrets section.
+func NewSecretLeakRuleFromConfig(config SecretsConfig) (Rule, error) {
+	detectors, err := config.Detectors()
+	if err != nil {
+		return nil, err
+	}
+	return NewSecretLeakRule(detectors, config.Action == SecretActionRedact), nil
+}
+
+// Name returns the unique identifier for this rule.
+func (r *secretLeakRule) Name() string {
+	return "secret-leak"
+}
+
+// Description returns a human-readable description of what this rule does.
+func (r *secretLeakRule) Description() string {
+	return "Blocks tool output containing credentials such as GitHub tokens, API keys, and private keys"
+}
+
+// Evaluate checks if the tool response contains credentials.
+func (r *secretLeakRule) Evaluate(input *ToolInput) (*RuleResult, error) {
+	if len(input.ToolResponse) == 0 {
+		return NewAllowedResult(), nil
+	}
+
+	var response interface{}
+	if err := json.Unmarshal(input.ToolResponse, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse tool_response: %w", err)
+	}
+
+	found := make(map[string]bool)
+	redacted := r.redactValue(response, found)
+	if len(found) == 0 {
+		return NewAllowedResult(), nil
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	message := fmt.Sprintf("%s output contains credentials (%s); do not use, store, or repeat them", input.ToolName, strings.Join(names, ", "))
+	if r.redact {
+		data, err := json.MarshalIndent(redacted, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode redacted output: %w", err)
+		}
+		message = fmt.Sprintf("%s output contains credentials (%s) and has been redacted; continue with this output instead:\n%s", input.ToolName, strings.Join(names, ", "), data)
+	}
+
+	return NewBlockedResult(r.Name(), message), nil
+}
+
+// redactValue returns a copy of a decoded JSON value with every detected
+// credential replaced by a placeholder, recording the detector names in found.
+func (r *secretLeakRule) redactValue(value interface{}, found map[string]bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.redactString(v, found)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = r.redactValue(item, found)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = r.redactValue(item, found)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// redactString replaces every detected credential in s with [REDACTED:<detector>].
+func (r *secretLeakRule) redactString(s string, found map[string]bool) string {
+	for _, d := range r.detectors {
+		if !d.Pattern.MatchString(s) {
+			continue
+		}
+		found[d.Name] = true
+		s = d.Pattern.ReplaceAllLiteralString(s, "[REDACTED:"+d.Name+"]")
+	}
+	return s
+}
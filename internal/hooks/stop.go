@@ -0,0 +1,251 @@
+package hooks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michael-freling/claude-code-tools/internal/command"
+)
+
+const (
+	// defaultStopCheckTimeout bounds each stop check when no timeout is configured.
+	defaultStopCheckTimeout = 10 * time.Minute
+
+	// defaultStopMaxBlocks bounds the stops blocked in a row when no limit
+	// is configured.
+	defaultStopMaxBlocks = 3
+
+	// maxStopCheckOutput is the number of trailing bytes of check output
+	// included in the feedback to Claude.
+	maxStopCheckOutput = 4000
+)
+
+// StopInput represents the input to a Stop hook from Claude Code.
+type StopInput struct {
+	SessionID      string `json:"session_id"`
+	TranscriptPath string `json:"transcript_path"`
+	Cwd            string `json:"cwd"`
+	PermissionMode string `json:"permission_mode"`
+	StopHookActive bool   `json:"stop_hook_active"`
+}
+
+// ParseStopInput reads and parses Stop hook input JSON from a reader.
+func ParseStopInput(reader io.Reader) (*StopInput, error) {
+	var input StopInput
+	if err := json.NewDecoder(reader).Decode(&input); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	return &input, nil
+}
+
+// StopConfig configures the checks that must pass before the agent may stop.
+//
+//	stop:
+//	  timeout: 15m
+//	  max_blocks: 5
+//	  checks:
+//	    - name: test
+//	      command: [go, test, ./...]
+//	    - name: lint
+//	      command: [golangci-lint, run]
+type StopConfig struct {
+	// Checks run in order; the first failing check blocks the stop.
+	Checks []StopCheck `yaml:"checks"`
+	// Timeout bounds each check. Defaults to 10 minutes.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxBlocks bounds how many stops in a row failing checks block, so the
+	// agent cannot loop forever on a check it cannot fix. The stop after
+	// that is allowed and reported as allowed with failing checks.
+	// Defaults to 3.
+	MaxBlocks int `yaml:"max_blocks"`
+}
+
+// StopCheck is a command that must exit successfully in the project directory.
+type StopCheck struct {
+	Name    string   `yaml:"name"`
+	Command []string `yaml:"command"`
+}
+
+// validate checks that every stop check has a unique name and a command.
+func (c StopConfig) validate() error {
+	seen := make(map[string]bool, len(c.Checks))
+	for _, check := range c.Checks {
+		if check.Name == "" {
+			return fmt.Errorf("stop check name is required")
+		}
+		if seen[check.Name] {
+			return fmt.Errorf("duplicate stop check %q", check.Name)
+		}
+		seen[check.Name] = true
+		if len(check.Command) == 0 {
+			return fmt.Errorf("stop check %q has no command", check.Name)
+		}
+	}
+	if c.MaxBlocks < 0 {
+		return fmt.Errorf("stop max_blocks must not be negative")
+	}
+	return nil
+}
+
+// StopGate runs quality gate checks when Claude Code tries to stop.
+type StopGate struct {
+	runner    command.Runner
+	checks    []StopCheck
+	timeout   time.Duration
+	maxBlocks int
+	stateDir  string
+}
+
+// NewStopGate creates a stop gate that runs checks with runner. The number of
+// stops blocked in a row is kept per session in stateDir.
+func NewStopGate(runner command.Runner, checks []StopCheck, config StopConfig, stateDir string) *StopGate {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultStopCheckTimeout
+	}
+	maxBlocks := config.MaxBlocks
+	if maxBlocks <= 0 {
+		maxBlocks = defaultStopMaxBlocks
+	}
+
+	return &StopGate{
+		runner:    runner,
+		checks:    checks,
+		timeout:   timeout,
+		maxBlocks: maxBlocks,
+		stateDir:  stateDir,
+	}
+}
+
+// Evaluate runs the checks in the session's working directory and returns a
+// blocked result for the first check that fails, with its output as feedback.
+// Once failing checks have blocked the configured number of stops in a row,
+// the stop is allowed, and the result's message records the failing check.
+// It returns an error if a check cannot be started, such as when the command
+// is not installed, since the agent cannot fix that by continuing.
+func (g *StopGate) Evaluate(ctx context.Context, input *StopInput) (*RuleResult, error) {
+	if input == nil {
+		return nil, fmt.Errorf("input cannot be nil")
+	}
+
+	result, err := g.runChecks(ctx, input.Cwd)
+	if err != nil {
+		return nil, err
+	}
+	if result.Allowed {
+		return result, g.clearBlocks(input.SessionID)
+	}
+
+	// A stop that does not continue from a blocked one starts a new count.
+	blocks := 0
+	if input.StopHookActive {
+		blocks = g.readBlocks(input.SessionID)
+	}
+	if blocks >= g.maxBlocks {
+		if err := g.clearBlocks(input.SessionID); err != nil {
+			return nil, err
+		}
+		return &RuleResult{
+			Allowed:  true,
+			RuleName: result.RuleName,
+			Message: fmt.Sprintf("stop allowed with failing checks after %d blocked stops in a row. %s",
+				blocks, result.Message),
+		}, nil
+	}
+	if err := g.writeBlocks(input.SessionID, blocks+1); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// runChecks runs the checks in dir and returns a blocked result for the first
+// check that fails.
+func (g *StopGate) runChecks(ctx context.Context, dir string) (*RuleResult, error) {
+	for _, check := range g.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, g.timeout)
+		stdout, stderr, err := g.runner.RunInDir(checkCtx, dir, check.Command[0], check.Command[1:]...)
+		timedOut := errors.Is(checkCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("stop check %s failed to start: %w", check.Name, err)
+		}
+
+		reason := fmt.Sprintf("failed: %v", err)
+		if timedOut {
+			reason = fmt.Sprintf("timed out after %s", g.timeout)
+		}
+
+		return NewBlockedResult(
+			"stop-check:"+check.Name,
+			fmt.Sprintf("Check %q (%s) %s. Fix the problems before finishing.\n%s",
+				check.Name, strings.Join(check.Command, " "), reason, tailOutput(stdout, stderr)),
+		), nil
+	}
+
+	return NewAllowedResult(), nil
+}
+
+// blocksPath returns the file the number of stops blocked in a row is kept in
+// for a session. The session ID is hashed, so it cannot escape the directory.
+func (g *StopGate) blocksPath(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return filepath.Join(g.stateDir, hex.EncodeToString(sum[:16]))
+}
+
+// readBlocks returns the number of stops blocked in a row for a session,
+// or 0 if none were recorded.
+func (g *StopGate) readBlocks(sessionID string) int {
+	data, err := os.ReadFile(g.blocksPath(sessionID))
+	if err != nil {
+		return 0
+	}
+	blocks, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return blocks
+}
+
+// writeBlocks records the number of stops blocked in a row for a session.
+func (g *StopGate) writeBlocks(sessionID string, blocks int) error {
+	if err := os.MkdirAll(g.stateDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create stop state directory: %w", err)
+	}
+	if err := os.WriteFile(g.blocksPath(sessionID), []byte(strconv.Itoa(blocks)), 0o600); err != nil {
+		return fmt.Errorf("failed to record blocked stop: %w", err)
+	}
+	return nil
+}
+
+// clearBlocks forgets the stops blocked in a row for a session.
+func (g *StopGate) clearBlocks(sessionID string) error {
+	if err := os.Remove(g.blocksPath(sessionID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to reset blocked stops: %w", err)
+	}
+	return nil
+}
+
+// tailOutput joins stdout and stderr and keeps only the trailing output so
+// the feedback stays small.
+func tailOutput(stdout, stderr string) string {
+	output := strings.TrimSpace(strings.Join([]string{stdout, stderr}, "\n"))
+	if len(output) > maxStopCheckOutput {
+		output = "...\n" + output[len(output)-maxStopCheckOutput:]
+	}
+	return output
+}
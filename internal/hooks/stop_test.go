@@ -0,0 +1,321 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michael-freling/claude-code-tools/internal/command"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestParseStopInput(t *testing.T) {
+	got, err := ParseStopInput(strings.NewReader(`{
+		"session_id": "abc",
+		"transcript_path": "/tmp/session.jsonl",
+		"cwd": "/work",
+		"permission_mode": "plan",
+		"stop_hook_active": true
+	}`))
+
+	require.NoError(t, err)
+	assert.Equal(t, &StopInput{
+		SessionID:      "abc",
+		TranscriptPath: "/tmp/session.jsonl",
+		Cwd:            "/work",
+		PermissionMode: PermissionModePlan,
+		StopHookActive: true,
+	}, got)
+
+	_, err = ParseStopInput(strings.NewReader(`{invalid`))
+	assert.Error(t, err)
+}
+
+func TestStopGate_Evaluate(t *testing.T) {
+	checks := []StopCheck{
+		{Name: "test", Command: []string{"go", "test", "./..."}},
+		{Name: "lint", Command: []string{"golangci-lint", "run"}},
+	}
+
+	tests := []struct {
+		name        string
+		config      StopConfig
+		blocks      int // stops blocked in a row before this one
+		input       *StopInput
+		setupMock   func(m *command.MockRunner)
+		wantBlocks  int // stops blocked in a row after this one
+		wantAllowed bool
+		wantRule    string
+		wantMessage []string
+		wantErr     string
+	}{
+		{
+			name:   "all checks pass",
+			blocks: 2,
+			input:  &StopInput{SessionID: "abc", Cwd: "/work", StopHookActive: true},
+			setupMock: func(m *command.MockRunner) {
+				m.EXPECT().RunInDir(gomock.Any(), "/work", "go", "test", "./...").Return("ok", "", nil)
+				m.EXPECT().RunInDir(gomock.Any(), "/work", "golangci-lint", "run").Return("", "", nil)
+			},
+			wantAllowed: true,
+		},
+		{
+			name:  "first failing check blocks",
+			input: &StopInput{Cwd: "/work"},
+			setupMock: func(m *command.MockRunner) {
+				m.EXPECT().RunInDir(gomock.Any(), "/work", "go", "test", "./...").
+					Return("--- FAIL: TestFoo", "exit status 1", fmt.Errorf("exit status 1"))
+			},
+			wantBlocks:  1,
+			wantRule:    "stop-check:test",
+			wantMessage: []string{`Check "test" (go test ./...) failed: exit status 1`, "--- FAIL: TestFoo"},
+		},
+		{
+			name:   "failing check blocks again when stop hook is already active",
+			blocks: 1,
+			input:  &StopInput{SessionID: "abc", Cwd: "/work", StopHookActive: true},
+			setupMock: func(m *command.MockRunner) {
+				m.EXPECT().RunInDir(gomock.Any(), "/work", "go", "test", "./...").Return("", "", fmt.Errorf("exit status 1"))
+			},
+			wantBlocks: 2,
+			wantRule:   "stop-check:test",
+		},
+		{
+			name:   "new stop starts a new count",
+			blocks: 3,
+			input:  &StopInput{SessionID: "abc", Cwd: "/work"},
+			setupMock: func(m *command.MockRunner) {
+				m.EXPECT().RunInDir(gomock.Any(), "/work", "go", "test", "./...").Return("", "", fmt.Errorf("exit status 1"))
+			},
+			wantBlocks: 1,
+			wantRule:   "stop-check:test",
+		},
+		{
+			name:   "stop is allowed with failing checks after max blocks",
+			blocks: 3,
+			input:  &StopInput{SessionID: "abc", Cwd: "/work", StopHookActive: true},
+			setupMock: func(m *command.MockRunner) {
+				m.EXPECT().RunInDir(gomock.Any(), "/work", "go", "test", "./...").Return("", "", fmt.Errorf("exit status 1"))
+			},
+			wantAllowed: true,
+			wantRule:    "stop-check:test",
+			wantMessage: []string{"stop allowed with failing checks after 3 blocked stops in a row", `Check "test" (go test ./...) failed`},
+		},
+		{
+			name:   "configured max blocks",
+			config: StopConfig{MaxBlocks: 1},
+			blocks: 1,
+			input:  &StopInput{SessionID: "abc", Cwd: "/work", StopHookActive: true},
+			setupMock: func(m *command.MockRunner) {
+				m.EXPECT().RunInDir(gomock.Any(), "/work", "go", "test", "./...").Return("", "", fmt.Errorf("exit status 1"))
+			},
+			wantAllowed: true,
+			wantRule:    "stop-check:test",
+			wantMessage: []string{"after 1 blocked stops in a row"},
+		},
+		{
+			name:  "missing command returns error",
+			input: &StopInput{Cwd: "/work"},
+			setupMock: func(m *command.MockRunner) {
+				m.EXPECT().RunInDir(gomock.Any(), "/work", "go", "test", "./...").Return("", "", &exec.Error{Name: "go", Err: exec.ErrNotFound})
+			},
+			wantErr: "stop check test failed to start",
+		},
+		{
+			name:  "timed out check blocks",
+			input: &StopInput{Cwd: "/work"},
+			config: StopConfig{
+				Timeout: time.Millisecond,
+			},
+			setupMock: func(m *command.MockRunner) {
+				m.EXPECT().RunInDir(gomock.Any(), "/work", "go", "test", "./...").
+					DoAndReturn(func(ctx context.Context, dir, name string, args ...string) (string, string, error) {
+						<-ctx.Done()
+						return "", "", ctx.Err()
+					})
+			},
+			wantBlocks:  1,
+			wantRule:    "stop-check:test",
+			wantMessage: []string{"timed out after 1ms"},
+		},
+		{
+			name:    "nil input returns error",
+			wantErr: "input cannot be nil",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			runner := command.NewMockRunner(ctrl)
+			if tt.setupMock != nil {
+				tt.setupMock(runner)
+			}
+
+			gate := NewStopGate(runner, checks, tt.config, t.TempDir())
+			if tt.blocks > 0 {
+				require.NoError(t, gate.writeBlocks("abc", tt.blocks))
+			}
+			got, err := gate.Evaluate(context.Background(), tt.input)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAllowed, got.Allowed)
+			assert.Equal(t, tt.wantRule, got.RuleName)
+			for _, want := range tt.wantMessage {
+				assert.Contains(t, got.Message, want)
+			}
+			assert.Equal(t, tt.wantBlocks, gate.readBlocks(tt.input.SessionID))
+		})
+	}
+}
+
+func TestStopGate_BlocksPath(t *testing.T) {
+	gate := NewStopGate(nil, nil, StopConfig{}, "/state")
+
+	assert.Equal(t, "/state", filepath.Dir(gate.blocksPath("../../etc/passwd")))
+	assert.NotEqual(t, gate.blocksPath("a"), gate.blocksPath("b"))
+}
+
+func TestTailOutput(t *testing.T) {
+	assert.Equal(t, "out\nerr", tailOutput("out", "err"))
+	assert.Equal(t, "err", tailOutput("", "err"))
+
+	long := strings.Repeat("a", maxStopCheckOutput) + "end"
+	got := tailOutput(long, "")
+	assert.True(t, strings.HasPrefix(got, "...\n"))
+	assert.True(t, strings.HasSuffix(got, "end"))
+	assert.Len(t, got, maxStopCheckOutput+len("...\n"))
+}
+
+func TestStopConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  StopConfig
+		wantErr string
+	}{
+		{name: "empty config"},
+		{
+			name:   "valid checks",
+			config: StopConfig{Checks: []StopCheck{{Name: "test", Command: []string{"make", "test"}}}},
+		},
+		{
+			name:    "missing name",
+			config:  StopConfig{Checks: []StopCheck{{Command: []string{"make"}}}},
+			wantErr: "stop check name is required",
+		},
+		{
+			name: "duplicate name",
+			config: StopConfig{Checks: []StopCheck{
+				{Name: "test", Command: []string{"make"}},
+				{Name: "test", Command: []string{"make"}},
+			}},
+			wantErr: `duplicate stop check "test"`,
+		},
+		{
+			name:    "missing command",
+			config:  StopConfig{Checks: []StopCheck{{Name: "test"}}},
+			wantErr: `stop check "test" has no command`,
+		},
+		{
+			name:    "negative max blocks",
+			config:  StopConfig{MaxBlocks: -1},
+			wantErr: "stop max_blocks must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPolicy_SelectStopChecks(t *testing.T) {
+	stop := StopConfig{Checks: []StopCheck{
+		{Name: "test", Command: []string{"make", "test"}},
+		{Name: "lint", Command: []string{"make", "lint"}},
+	}}
+
+	tests := []struct {
+		name           string
+		policy         *Policy
+		permissionMode string
+		want           []string
+		wantErr        string
+	}{
+		{
+			name:           "no profile runs every check",
+			policy:         &Policy{Stop: stop},
+			permissionMode: PermissionModeDefault,
+			want:           []string{"test", "lint"},
+		},
+		{
+			name: "profile selects checks in configured order",
+			policy: &Policy{
+				Profiles: map[string]Profile{"strict": {StopChecks: []string{"lint", "test"}}},
+				Modes:    map[string]string{PermissionModeBypass: "strict"},
+				Stop:     stop,
+			},
+			permissionMode: PermissionModeBypass,
+			want:           []string{"test", "lint"},
+		},
+		{
+			name: "profile without stop checks runs none",
+			policy: &Policy{
+				DefaultProfile: "relaxed",
+				Profiles:       map[string]Profile{"relaxed": {Rules: []string{"git-push"}}},
+				Stop:           stop,
+			},
+			permissionMode: PermissionModePlan,
+			want:           []string{},
+		},
+		{
+			name: "undefined profile",
+			policy: &Policy{
+				Modes: map[string]string{PermissionModePlan: "missing"},
+				Stop:  stop,
+			},
+			permissionMode: PermissionModePlan,
+			wantErr:        `profile "missing" is not defined`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.SelectStopChecks(tt.permissionMode)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			names := make([]string, 0, len(got))
+			for _, check := range got {
+				names = append(names, check.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package hooks
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TranscriptToolCall is a single tool invocation recorded in a Claude Code transcript.
+type TranscriptToolCall struct {
+	ID        string
+	Timestamp string
+	Line      int
+	Input     *ToolInput
+}
+
+// transcriptEntry represents a single line in a Claude Code transcript JSONL file.
+type transcriptEntry struct {
+	Type           string `json:"type"`
+	Timestamp      string `json:"timestamp"`
+	PermissionMode string `json:"permissionMode"`
+	Message        struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"message"`
+}
+
+// transcriptContent is a content block of an assistant message.
+type transcriptContent struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// ParseTranscript reads a Claude Code transcript in JSONL format and returns
+// every tool_use block from assistant messages in order.
+// Lines that are not valid JSON or carry no tool calls are skipped.
+// The permission mode of the most recent entry that reports one is attached
+// to each tool call.
+func ParseTranscript(reader io.Reader) ([]TranscriptToolCall, error) {
+	var calls []TranscriptToolCall
+	permissionMode := ""
+
+	br := bufio.NewReader(reader)
+	lineNumber := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read transcript: %w", err)
+		}
+		if len(line) > 0 {
+			lineNumber++
+			calls = appendToolCalls(calls, line, lineNumber, &permissionMode)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	return calls, nil
+}
+
+// appendToolCalls parses a transcript line and appends any tool calls it contains.
+func appendToolCalls(calls []TranscriptToolCall, line []byte, lineNumber int, permissionMode *string) []TranscriptToolCall {
+	trimmed := strings.TrimSpace(string(line))
+	if trimmed == "" {
+		return calls
+	}
+
+	var entry transcriptEntry
+	if err := json.Unmarshal([]byte(trimmed), &entry); err != nil {
+		return calls
+	}
+
+	if entry.PermissionMode != "" {
+		*permissionMode = entry.PermissionMode
+	}
+
+	if entry.Type != "assistant" || len(entry.Message.Content) == 0 {
+		return calls
+	}
+
+	// Content is either a plain string or a list of content blocks.
+	var blocks []transcriptContent
+	if err := json.Unmarshal(entry.Message.Content, &blocks); err != nil {
+		return calls
+	}
+
+	for _, block := range blocks {
+		if block.Type != "tool_use" || block.Name == "" {
+			continue
+		}
+
+		input := &ToolInput{
+			ToolName:       block.Name,
+			ToolInput:      block.Input,
+			PermissionMode: *permissionMode,
+		}
+		if len(block.Input) > 0 {
+			var parsed map[string]interface{}
+			if err := json.Unmarshal(block.Input, &parsed); err == nil {
+				input.parsed = parsed
+			}
+		}
+
+		calls = append(calls, TranscriptToolCall{
+			ID:        block.ID,
+			Timestamp: entry.Timestamp,
+			Line:      lineNumber,
+			Input:     input,
+		})
+	}
+
+	return calls
+}
@@ -0,0 +1,63 @@
+package hooks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTranscript(t *testing.T) {
+	transcript := strings.Join([]string{
+		`{"type":"user","timestamp":"2026-05-08T14:30:00Z","permissionMode":"bypassPermissions","message":{"role":"user","content":"push it"}}`,
+		`{"type":"assistant","timestamp":"2026-05-08T14:30:05Z","message":{"role":"assistant","content":[{"type":"text","text":"Pushing."},{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"git push origin main"}}]}}`,
+		``,
+		`not json`,
+		`{"type":"user","timestamp":"2026-05-08T14:30:06Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"ok"}]}}`,
+		`{"type":"user","timestamp":"2026-05-08T14:31:00Z","permissionMode":"plan","message":{"role":"user","content":"now read"}}`,
+		`{"type":"assistant","timestamp":"2026-05-08T14:31:05Z","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_2","name":"Read","input":{"file_path":"/work/main.go"}},{"type":"tool_use","id":"toolu_3","name":"Bash","input":{"command":"ls"}}]}}`,
+		`{"type":"assistant","timestamp":"2026-05-08T14:31:06Z","message":{"role":"assistant","content":"plain text"}}`,
+	}, "\n")
+
+	calls, err := ParseTranscript(strings.NewReader(transcript))
+	require.NoError(t, err)
+	require.Len(t, calls, 3)
+
+	assert.Equal(t, "toolu_1", calls[0].ID)
+	assert.Equal(t, "2026-05-08T14:30:05Z", calls[0].Timestamp)
+	assert.Equal(t, 2, calls[0].Line)
+	assert.Equal(t, "Bash", calls[0].Input.ToolName)
+	assert.Equal(t, PermissionModeBypass, calls[0].Input.PermissionMode)
+	command, ok := calls[0].Input.GetStringArg("command")
+	assert.True(t, ok)
+	assert.Equal(t, "git push origin main", command)
+
+	assert.Equal(t, "toolu_2", calls[1].ID)
+	assert.Equal(t, 7, calls[1].Line)
+	assert.Equal(t, "Read", calls[1].Input.ToolName)
+	assert.Equal(t, PermissionModePlan, calls[1].Input.PermissionMode)
+	filePath, ok := calls[1].Input.GetStringArg("file_path")
+	assert.True(t, ok)
+	assert.Equal(t, "/work/main.go", filePath)
+
+	assert.Equal(t, "toolu_3", calls[2].ID)
+	assert.Equal(t, 7, calls[2].Line)
+}
+
+func TestParseTranscript_Empty(t *testing.T) {
+	calls, err := ParseTranscript(strings.NewReader(""))
+
+	require.NoError(t, err)
+	assert.Empty(t, calls)
+}
+
+func TestParseTranscript_NoTrailingNewline(t *testing.T) {
+	transcript := `{"type":"assistant","message":{"content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"ls"}}]}}`
+
+	calls, err := ParseTranscript(strings.NewReader(transcript))
+
+	require.NoError(t, err)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "toolu_1", calls[0].ID)
+}
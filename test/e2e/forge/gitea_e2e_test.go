@@ -0,0 +1,219 @@
+//go:build forge_e2e
+
+package forge_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// giteaImage is the Gitea release used as a stand-in forge.
+const giteaImage = "gitea/gitea:1.22"
+
+// giteaHost is the host name the gateway serves the Gitea container as.
+const giteaHost = "gitea.test"
+
+// startGitea runs a Gitea container with an admin user and returns its base
+// URL and an access token for the user.
+func startGitea(t *testing.T, ctx context.Context) (string, string) {
+	t.Helper()
+
+	name := fmt.Sprintf("forge-e2e-gitea-%d", time.Now().UnixNano())
+	out, err := exec.CommandContext(ctx, "docker", "run", "-d", "--name", name,
+		"-p", "127.0.0.1::3000",
+		"-e", "GITEA__security__INSTALL_LOCK=true",
+		"-e", "GITEA__database__DB_TYPE=sqlite3",
+		giteaImage,
+	).CombinedOutput()
+	require.NoError(t, err, "failed to start Gitea: %s", out)
+	t.Cleanup(func() { exec.Command("docker", "rm", "-f", name).Run() })
+
+	out, err = exec.CommandContext(ctx, "docker", "port", name, "3000/tcp").Output()
+	require.NoError(t, err)
+	baseURL := "http://" + strings.TrimSpace(strings.Split(string(out), "\n")[0])
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(baseURL + "/api/healthz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Minute, time.Second, "Gitea did not become healthy")
+
+	giteaCmd := func(args ...string) string {
+		args = append([]string{"exec", "-u", "git", name, "gitea"}, args...)
+		out, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput()
+		require.NoError(t, err, "gitea %v: %s", args, out)
+		return strings.TrimSpace(string(out))
+	}
+	giteaCmd("admin", "user", "create", "--admin", "--username", "forge", "--password", "forge-e2e-password",
+		"--email", "forge@example.com", "--must-change-password=false")
+	token := giteaCmd("admin", "user", "generate-access-token", "--username", "forge",
+		"--token-name", "e2e", "--scopes", "all", "--raw")
+
+	return baseURL, token
+}
+
+// createGiteaRepo creates a repository with an initial commit on main.
+func createGiteaRepo(t *testing.T, baseURL, token, repo string) {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]any{"name": repo, "auto_init": true, "default_branch": "main"})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/api/v1/user/repos", bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, "failed to create repo %s: %s", repo, respBody)
+}
+
+// freeAddr returns a free local TCP address.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// TestGateway_Gitea runs the gateway against a Gitea container standing in
+// for a non-GitHub forge, and checks that git and API requests reach it with
+// the gateway's policy applied.
+func TestGateway_Gitea(t *testing.T) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker not found in PATH")
+	}
+	if err := exec.Command("docker", "info").Run(); err != nil {
+		t.Skip("Docker daemon not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	projectRoot := findProjectRoot(t)
+	binaryPath := filepath.Join(t.TempDir(), "claude-forge")
+	buildBinary := exec.Command("go", "build", "-o", binaryPath, "./cmd/claude-forge/")
+	buildBinary.Dir = projectRoot
+	out, err := buildBinary.CombinedOutput()
+	require.NoError(t, err, "failed to build claude-forge binary: %s", out)
+
+	baseURL, token := startGitea(t, ctx)
+	createGiteaRepo(t, baseURL, token, "demo")
+	createGiteaRepo(t, baseURL, token, "other")
+
+	proxyAddr := freeAddr(t)
+	apiAddr := freeAddr(t)
+	gatewayCmd := exec.CommandContext(ctx, binaryPath, "gateway",
+		"--host="+giteaHost,
+		"--forge="+giteaHost+"=gitea",
+		"--forge-url="+giteaHost+"="+baseURL,
+		"--owner=forge", "--repo=demo",
+		"--proxy-addr="+proxyAddr, "--api-addr="+apiAddr,
+	)
+	gatewayCmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "GITHUB_TOKEN="+token)
+	var gatewayOutput bytes.Buffer
+	gatewayCmd.Stdout = &gatewayOutput
+	gatewayCmd.Stderr = &gatewayOutput
+	require.NoError(t, gatewayCmd.Start())
+	t.Cleanup(func() {
+		gatewayCmd.Process.Signal(os.Interrupt)
+		gatewayCmd.Wait()
+		t.Logf("gateway output:\n%s", gatewayOutput.String())
+	})
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", proxyAddr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 10*time.Second, 100*time.Millisecond, "gateway did not start")
+
+	workDir := t.TempDir()
+	git := func(dir string, args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=forge", "GIT_AUTHOR_EMAIL=forge@example.com",
+			"GIT_COMMITTER_NAME=forge", "GIT_COMMITTER_EMAIL=forge@example.com",
+			"GIT_TERMINAL_PROMPT=0",
+		)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+	proxyURL := "http://" + proxyAddr + "/" + giteaHost
+
+	t.Run("clone and push a branch to the project", func(t *testing.T) {
+		out, err := git(workDir, "clone", proxyURL+"/forge/demo.git", "demo")
+		require.NoError(t, err, out)
+		repoDir := filepath.Join(workDir, "demo")
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, "change.txt"), []byte("change\n"), 0o644))
+		out, err = git(repoDir, "add", ".")
+		require.NoError(t, err, out)
+		out, err = git(repoDir, "commit", "-m", "change")
+		require.NoError(t, err, out)
+
+		out, err = git(repoDir, "push", "origin", "HEAD:refs/heads/feature")
+		require.NoError(t, err, out)
+	})
+
+	t.Run("push to protected main is rejected", func(t *testing.T) {
+		out, err := git(filepath.Join(workDir, "demo"), "push", "origin", "HEAD:refs/heads/main")
+		require.Error(t, err)
+		assert.Contains(t, out, "protected ref cannot be pushed to through the gateway")
+	})
+
+	t.Run("non-fast-forward push is rejected", func(t *testing.T) {
+		repoDir := filepath.Join(workDir, "demo")
+		out, err := git(repoDir, "commit", "--amend", "-m", "rewritten")
+		require.NoError(t, err, out)
+
+		out, err = git(repoDir, "push", "--force", "origin", "HEAD:refs/heads/feature")
+		require.Error(t, err)
+		assert.Contains(t, out, "non-fast-forward updates are not allowed through the gateway")
+	})
+
+	t.Run("push to another repository is denied", func(t *testing.T) {
+		out, err := git(workDir, "clone", proxyURL+"/forge/other.git", "other")
+		require.NoError(t, err, out)
+
+		out, err = git(filepath.Join(workDir, "other"), "push", "origin", "HEAD:refs/heads/feature")
+		require.Error(t, err)
+		assert.Contains(t, out, "403")
+	})
+
+	t.Run("API requests reach Gitea", func(t *testing.T) {
+		resp, err := http.Get("http://" + apiAddr + "/api/github/repos/forge/demo")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		var repo struct {
+			FullName string `json:"full_name"`
+		}
+		require.NoError(t, json.Unmarshal(body, &repo))
+		assert.Equal(t, "forge/demo", repo.FullName)
+	})
+}